@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"encoding/xml"
+	"fmt"
 	"io"
 	"log/slog"
 	"math/rand"
@@ -9,6 +11,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofiber/contrib/websocket"
@@ -18,6 +21,7 @@ import (
 
 	"github.com/kdudkov/goatak/cmd/goatak_server/tak_ws"
 	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/internal/database"
 	"github.com/kdudkov/goatak/internal/wshandler"
 	"github.com/kdudkov/goatak/pkg/cot"
 	"github.com/kdudkov/goatak/pkg/log"
@@ -49,53 +53,91 @@ func (h *HttpServer) NewAdminAPI(app *App, addr string, webtakRoot string) *Admi
 	api.f.Get("/login", h.getAdminLoginHandler(app.config.Bool("delay")))
 	api.f.Post("/login", h.getAdminLoginHandler(app.config.Bool("delay")))
 	api.f.Post("/token", h.getAdminTokenHandler())
-	api.f.Get("/logout", logoutHandler)
-
-	api.f.Get("/", getIndexHandler())
-	api.f.Get("/units", getUnitsHandler())
-	api.f.Get("/map", getMapHandler())
-	api.f.Get("/missions", getMissionsPageHandler())
-	api.f.Get("/files", getFilesPage()).Name("admin_files")
-	api.f.Get("/points", getPointsPage())
-	api.f.Get("/devices", getDevicesPage())
-	api.f.Get("/profiles", getProfilesPage())
-	api.f.Get("/feeds", getFeedsPage())
-
-	api.f.Get("/api/config", getConfigHandler(app))
-	api.f.Get("/api/connections", getApiConnHandler(app))
-
-	api.f.Get("/api/unit", getApiUnitsHandler(app))
-	api.f.Get("/api/unit/:uid/track", getApiUnitTrackHandler(app))
-	api.f.Delete("/api/unit/:uid", deleteItemHandler(app))
-	api.f.Get("/api/message", getMessagesHandler(app))
-
-	api.f.Get("/ws", getWsHandler(app))
-	api.f.Get("/takproto/1", getTakWsHandler(app))
-	api.f.Post("/cot", getCotPostHandler(app))
+	api.f.Get("/logout", h.logoutHandler)
+
+	api.f.Get("/", requirePerm(model.PERM_VIEW), getIndexHandler())
+	api.f.Get("/units", requirePerm(model.PERM_VIEW), getUnitsHandler())
+	api.f.Get("/map", requirePerm(model.PERM_VIEW), getMapHandler())
+	api.f.Get("/missions", requirePerm(model.PERM_VIEW), getMissionsPageHandler())
+	api.f.Get("/files", requirePerm(model.PERM_VIEW), getFilesPage()).Name("admin_files")
+	api.f.Get("/points", requirePerm(model.PERM_VIEW), getPointsPage())
+	api.f.Get("/devices", requirePerm(model.PERM_USERS), getDevicesPage())
+	api.f.Get("/profiles", requirePerm(model.PERM_USERS), getProfilesPage())
+	api.f.Get("/feeds", requirePerm(model.PERM_VIEW), getFeedsPage())
+	api.f.Get("/messages", requirePerm(model.PERM_MESSAGES), getMessagesPage())
+	api.f.Get("/outbox", requirePerm(model.PERM_MESSAGES), getOutboxPage())
+	api.f.Get("/alerts", requirePerm(model.PERM_VIEW), getAlertsPage())
+	api.f.Get("/audit", requirePerm(model.PERM_AUDIT), getAuditPage())
+
+	api.f.Get("/api/config", requirePerm(model.PERM_VIEW), getConfigHandler(app))
+	api.f.Get("/api/connections", requirePerm(model.PERM_VIEW), getApiConnHandler(app))
+
+	api.f.Get("/api/unit", requirePerm(model.PERM_VIEW), getApiUnitsHandler(app))
+	api.f.Get("/api/unit/:uid/track", requirePerm(model.PERM_VIEW), getApiUnitTrackHandler(app))
+	api.f.Get("/api/track", requirePerm(model.PERM_VIEW), getApiTracksHandler(app))
+	api.f.Delete("/api/unit/:uid", requirePerm(model.PERM_OPERATE), deleteItemHandler(app))
+	api.f.Get("/api/message", requirePerm(model.PERM_MESSAGES), getMessagesHandler(app))
+	api.f.Get("/api/chatroom", requirePerm(model.PERM_MESSAGES), getChatroomsHandler(app))
+	api.f.Get("/api/outbox", requirePerm(model.PERM_MESSAGES), getApiOutboxHandler(app))
+	api.f.Delete("/api/outbox/:id", requirePerm(model.PERM_OPERATE), getApiOutboxDeleteHandler(app))
+	api.f.Get("/api/alert", requirePerm(model.PERM_VIEW), getApiAlertsHandler(app))
+	api.f.Post("/api/alert/:id/ack", requirePerm(model.PERM_OPERATE), getApiAlertAckHandler(app))
+	api.f.Post("/api/alert/:id/cancel", requirePerm(model.PERM_OPERATE), getApiAlertCancelHandler(app))
+	api.f.Get("/api/audit", requirePerm(model.PERM_AUDIT), getApiAuditHandler(app))
+	api.f.Get("/api/audit/export", requirePerm(model.PERM_AUDIT), getApiAuditExportHandler(app))
+
+	api.f.Get("/ws", requirePerm(model.PERM_VIEW), getWsHandler(app))
+	api.f.Get("/takproto/1", requirePerm(model.PERM_OPERATE), getTakWsHandler(app))
+	api.f.Post("/cot", requirePerm(model.PERM_OPERATE), getCotPostHandler(app))
+	// cot_xml is in no auth paths, permission is checked by handler
 	api.f.Post("/cot_xml", getCotXMLPostHandler(app))
 
-	api.f.Get("/api/file", getApiFilesHandler(app))
-	api.f.Get("/api/file/:id", getApiFileHandler(app))
-	api.f.Get("/api/file/delete/:id", getApiFileDeleteHandler(app))
-	api.f.Get("/api/point", getApiPointsHandler(app))
-	api.f.Get("/api/device", getApiDevicesHandler(app))
-	api.f.Post("/api/device", getApiDevicePostHandler(app))
-	api.f.Put("/api/device/:id", getApiDevicePutHandler(app))
-	api.f.Get("/api/cert", getApiCertsHandler(app))
-	api.f.Get("/api/profile", getApiProfilesHandler(app))
-	api.f.Post("/api/profile", getApiProfilePostHandler(app))
-	api.f.Put("/api/profile/:login/:uid", getApiProfilePutHandler(app))
-	api.f.Delete("/api/profile/:login/:uid", getApiProfileDeleteHandler(app))
-
-	api.f.Get("/api/feed", getApiFeedsHandler(app))
-	api.f.Post("/api/feed", getApiFeedPostHandler(app))
-	api.f.Put("/api/feed/:uid", getApiFeedPutHandler(app))
-	api.f.Delete("/api/feed/:uid", getApiFeedDeleteHandler(app))
-
-	api.f.Get("/api/mission", getApiAllMissionHandler(app))
-	api.f.Get("/api/mission/:id/changes", getApiAllMissionChangesHandler(app))
+	api.f.Get("/api/file", requirePerm(model.PERM_VIEW), getApiFilesHandler(app))
+	api.f.Get("/api/file/:id", requirePerm(model.PERM_VIEW), getApiFileHandler(app))
+	api.f.Get("/api/file/:id/entries", requirePerm(model.PERM_VIEW), getApiFileEntriesHandler(app))
+	api.f.Get("/api/file/:id/entry", requirePerm(model.PERM_VIEW), getApiFileEntryHandler(app))
+	api.f.Get("/api/file/delete/:id", requirePerm(model.PERM_OPERATE), getApiFileDeleteHandler(app))
+	api.f.Get("/api/retention", requirePerm(model.PERM_VIEW), getApiRetentionHandler(app))
+	api.f.Get("/api/quota", requirePerm(model.PERM_VIEW), getApiQuotaHandler(app))
+	api.f.Get("/api/point", requirePerm(model.PERM_VIEW), getApiPointsHandler(app))
+	api.f.Get("/api/device", requirePerm(model.PERM_USERS), getApiDevicesHandler(app))
+	api.f.Post("/api/device", requirePerm(model.PERM_USERS), getApiDevicePostHandler(app))
+	api.f.Put("/api/device/:id", requirePerm(model.PERM_USERS), getApiDevicePutHandler(app))
+	api.f.Get("/api/token", requirePerm(model.PERM_USERS), getApiTokensHandler(app))
+	api.f.Post("/api/token", requirePerm(model.PERM_USERS), getApiTokenPostHandler(app))
+	api.f.Post("/api/token/rotate", requirePerm(model.PERM_USERS), getApiTokenRotateHandler(app))
+	api.f.Delete("/api/token/:id", requirePerm(model.PERM_USERS), getApiTokenRevokeHandler(app))
+	api.f.Get("/api/cert", requirePerm(model.PERM_USERS), getApiCertsHandler(app))
+	api.f.Post("/api/cert/:sn/revoke", requirePerm(model.PERM_USERS), getApiCertRevokeHandler(app))
+	api.f.Get("/api/crl", requirePerm(model.PERM_USERS), getCrlHandler(app))
+	api.f.Get("/api/profile", requirePerm(model.PERM_USERS), getApiProfilesHandler(app))
+	api.f.Post("/api/profile", requirePerm(model.PERM_USERS), getApiProfilePostHandler(app))
+	api.f.Put("/api/profile/:login/:uid", requirePerm(model.PERM_USERS), getApiProfilePutHandler(app))
+	api.f.Delete("/api/profile/:login/:uid", requirePerm(model.PERM_USERS), getApiProfileDeleteHandler(app))
+
+	api.f.Get("/api/feed", requirePerm(model.PERM_VIEW), getApiFeedsHandler(app))
+	api.f.Post("/api/feed", requirePerm(model.PERM_OPERATE), getApiFeedPostHandler(app))
+	api.f.Put("/api/feed/:uid", requirePerm(model.PERM_OPERATE), getApiFeedPutHandler(app))
+	api.f.Delete("/api/feed/:uid", requirePerm(model.PERM_OPERATE), getApiFeedDeleteHandler(app))
+
+	api.f.Get("/api/geofence", requirePerm(model.PERM_VIEW), getApiGeofencesHandler(app))
+	api.f.Post("/api/geofence", requirePerm(model.PERM_OPERATE), getApiGeofencePostHandler(app))
+	api.f.Put("/api/geofence/:id", requirePerm(model.PERM_OPERATE), getApiGeofencePutHandler(app))
+	api.f.Delete("/api/geofence/:id", requirePerm(model.PERM_OPERATE), getApiGeofenceDeleteHandler(app))
+	api.f.Get("/api/geofence/:id/events", requirePerm(model.PERM_VIEW), getApiGeofenceEventsHandler(app))
+
+	api.f.Get("/api/mission", requirePerm(model.PERM_VIEW), getApiAllMissionHandler(app))
+	api.f.Get("/api/mission/:id/changes", requirePerm(model.PERM_VIEW), getApiAllMissionChangesHandler(app))
+	api.f.Get("/api/mission/:id/log", requirePerm(model.PERM_VIEW), getApiMissionLogHandler(app))
+	api.f.Get("/api/mission/:id/kml", requirePerm(model.PERM_VIEW), getApiMissionKmlExportHandler(app))
+	api.f.Post("/api/mission/:id/kml", requirePerm(model.PERM_OPERATE), getApiMissionKmlImportHandler(app))
+
+	api.f.Get("/api/kml", requirePerm(model.PERM_VIEW), getApiKmlExportHandler(app))
+	api.f.Post("/api/kml", requirePerm(model.PERM_OPERATE), getApiKmlImportHandler(app))
 
 	if webtakRoot != "" {
+		// webtak is a full client, it can send cots and delete points
+		api.f.Use([]string{"/webtak", "/webtak-plugins", "/Marti"}, requirePerm(model.PERM_OPERATE))
 		api.f.Static("/webtak", webtakRoot)
 		api.f.Get("/webtak-plugins/webtak-manifest.json", getPluginsManifestHandler(app))
 		addMartiRoutes(app, api.f)
@@ -120,8 +162,8 @@ func (h *HttpServer) getAdminLoginHandler(delay bool) func(c *fiber.Ctx) error {
 			return c.Render("templates/login", nil)
 		}
 
-		if user := h.userManager.Get(login); user.CanLogIn() && user.CheckPassword(c.FormValue("password")) {
-			token, err := generateToken(login, h.tokenKey, h.tokenMaxAge)
+		if user := h.userManager.Authenticate(login, c.FormValue("password")); user.CanLogIn() {
+			token, err := h.tokens.SessionToken(login, h.tokenMaxAge)
 
 			if err != nil {
 				return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
@@ -135,6 +177,7 @@ func (h *HttpServer) getAdminLoginHandler(delay bool) func(c *fiber.Ctx) error {
 		}
 
 		h.log.Warn("invalid login", "user", login)
+		h.audit.Add(&model.AuditEvent{Actor: login, Action: model.AUDIT_LOGIN_FAILED, SourceIP: c.IP()})
 
 		if delay {
 			time.Sleep(time.Second * time.Duration(1+rand.Intn(5)))
@@ -153,9 +196,9 @@ func (h *HttpServer) getAdminTokenHandler() func(c *fiber.Ctx) error {
 		}
 
 		if login := m["login"]; login != "" {
-			if user := h.userManager.Get(login); user != nil {
-				if user.CanLogIn() && user.CheckPassword(m["password"]) {
-					token, err := generateToken(login, h.tokenKey, h.tokenMaxAge)
+			if user := h.userManager.Authenticate(login, m["password"]); user != nil {
+				if user.CanLogIn() {
+					token, err := h.tokens.SessionToken(login, h.tokenMaxAge)
 
 					if err != nil {
 						h.log.Error("generate token error", slog.Any("error", err))
@@ -167,13 +210,22 @@ func (h *HttpServer) getAdminTokenHandler() func(c *fiber.Ctx) error {
 			}
 
 			h.log.Warn("invalid login", "user", login)
+			h.audit.Add(&model.AuditEvent{Actor: login, Action: model.AUDIT_LOGIN_FAILED, SourceIP: c.IP(),
+				Details: "token"})
 		}
 
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 }
 
-func logoutHandler(c *fiber.Ctx) error {
+// logoutHandler puts the session token to the revocation list, so the copy of it can't be used too.
+func (h *HttpServer) logoutHandler(c *fiber.Ctx) error {
+	if claims, err := h.tokens.Parse(getToken(c)); err == nil && claims.Type != tokenTypeApi && claims.ExpiresAt != nil {
+		if err := h.tokens.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+			h.log.Error("token revoke error", slog.Any("error", err))
+		}
+	}
+
 	c.ClearCookie(cookieName)
 
 	return c.Redirect("/")
@@ -183,6 +235,7 @@ func getIndexHandler() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		data := map[string]any{
 			"theme": "auto",
+			"user":  CtxUser(ctx),
 			"page":  " dash",
 			"js":    []string{"main.js"},
 		}
@@ -195,6 +248,7 @@ func getUnitsHandler() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		data := map[string]any{
 			"theme": "auto",
+			"user":  CtxUser(ctx),
 			"page":  " units",
 			"js":    []string{"units.js"},
 		}
@@ -207,6 +261,7 @@ func getMapHandler() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		data := map[string]any{
 			"theme": "auto",
+			"user":  CtxUser(ctx),
 			"js":    []string{"map.js"},
 		}
 
@@ -218,6 +273,7 @@ func getMissionsPageHandler() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		data := map[string]any{
 			"theme": "auto",
+			"user":  CtxUser(ctx),
 			"page":  " missions",
 			"js":    []string{"missions.js"},
 		}
@@ -230,6 +286,7 @@ func getFilesPage() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		data := map[string]any{
 			"theme": "auto",
+			"user":  CtxUser(ctx),
 			"page":  " files",
 			"js":    []string{"files.js"},
 		}
@@ -242,6 +299,7 @@ func getPointsPage() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		data := map[string]any{
 			"theme": "auto",
+			"user":  CtxUser(ctx),
 			"page":  " points",
 			"js":    []string{"points.js"},
 		}
@@ -254,8 +312,10 @@ func getDevicesPage() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		data := map[string]any{
 			"theme": "auto",
+			"user":  CtxUser(ctx),
 			"page":  " devices",
 			"js":    []string{"devices.js"},
+			"roles": grantableRoles(CtxUser(ctx)),
 		}
 
 		return ctx.Render("templates/devices", data, "templates/menu", "templates/header")
@@ -266,6 +326,7 @@ func getProfilesPage() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		data := map[string]any{
 			"theme": "auto",
+			"user":  CtxUser(ctx),
 			"page":  " profiles",
 			"js":    []string{"profiles.js"},
 		}
@@ -278,6 +339,7 @@ func getFeedsPage() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		data := map[string]any{
 			"theme": "auto",
+			"user":  CtxUser(ctx),
 			"page":  " feeds",
 			"js":    []string{"feeds.js"},
 		}
@@ -286,6 +348,45 @@ func getFeedsPage() fiber.Handler {
 	}
 }
 
+func getMessagesPage() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		data := map[string]any{
+			"theme": "auto",
+			"user":  CtxUser(ctx),
+			"page":  " messages",
+			"js":    []string{"messages.js"},
+		}
+
+		return ctx.Render("templates/messages", data, "templates/menu", "templates/header")
+	}
+}
+
+func getOutboxPage() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		data := map[string]any{
+			"theme": "auto",
+			"user":  CtxUser(ctx),
+			"page":  " outbox",
+			"js":    []string{"outbox.js"},
+		}
+
+		return ctx.Render("templates/outbox", data, "templates/menu", "templates/header")
+	}
+}
+
+func getAlertsPage() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		data := map[string]any{
+			"theme": "auto",
+			"user":  CtxUser(ctx),
+			"page":  " alerts",
+			"js":    []string{"alerts.js"},
+		}
+
+		return ctx.Render("templates/alerts", data, "templates/menu", "templates/header")
+	}
+}
+
 func getConfigHandler(app *App) fiber.Handler {
 	m := make(map[string]any, 0)
 	m["lat"] = app.lat
@@ -307,14 +408,200 @@ func getConfigHandler(app *App) fiber.Handler {
 
 func getApiUnitsHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		return ctx.JSON(getUnits(app))
+		return ctx.JSON(getUnits(app, CtxUser(ctx)))
 	}
 }
 
 func getMessagesHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		return ctx.JSON(app.messages)
+		q := chatQuery(app, ctx)
+		if q == nil {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		q.Chatroom(ctx.Query("chatroom")).UID(ctx.Query("uid"))
+
+		if v := ctx.Query("start"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return SendError(ctx, "invalid start time")
+			}
+
+			q.After(t)
+		}
+
+		if v := ctx.Query("end"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return SendError(ctx, "invalid end time")
+			}
+
+			q.Before(t)
+		}
+
+		ctx.Set("X-Total-Count", strconv.FormatInt(q.Count(), 10))
+
+		data := q.Limit(min(ctx.QueryInt("limit", 100), 1000)).Offset(ctx.QueryInt("offset")).Get()
+
+		if data == nil {
+			data = []*model.ChatMessage{}
+		}
+
+		return ctx.JSON(data)
+	}
+}
+
+func getChatroomsHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		q := chatQuery(app, ctx)
+		if q == nil {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		return ctx.JSON(q.Chatrooms())
+	}
+}
+
+// chatQuery makes chat history query limited to scopes the admin user can read.
+// Returns nil if requested scope is not allowed.
+func chatQuery(app *App, ctx *fiber.Ctx) *database.ChatQuery {
+	user := CtxUser(ctx)
+	q := app.dbm.ChatQuery()
+
+	if scope := ctx.Query("scope"); scope != "" {
+		if !user.AdminCanSeeScope(scope) {
+			return nil
+		}
+
+		return q.Scope(scope)
+	}
+
+	return q.ReadScope(user.AdminScopes())
+}
+
+func getApiOutboxHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		q := app.dbm.OutboxQuery().ReadScope(CtxUser(ctx).AdminScopes()).
+			UID(ctx.Query("uid")).Callsign(ctx.Query("callsign")).Active()
+
+		ctx.Set("X-Total-Count", strconv.FormatInt(q.Count(), 10))
+
+		data := q.Limit(min(ctx.QueryInt("limit", 100), 1000)).Offset(ctx.QueryInt("offset")).Get()
+		res := make([]*model.OutboxMessageDTO, 0, len(data))
+
+		for _, o := range data {
+			res = append(res, o.DTO())
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiOutboxDeleteHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return err
+		}
+
+		if id == 0 {
+			return ctx.SendStatus(fiber.StatusBadRequest)
+		}
+
+		if o := app.dbm.OutboxQuery().Id(uint(id)).One(); o == nil || !CtxUser(ctx).AdminCanSeeScope(o.Scope) {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		if _, err := app.dbm.OutboxQuery().Id(uint(id)).Delete(); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		return ctx.JSON(fiber.Map{"status": "ok"})
+	}
+}
+
+func getApiAlertsHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		q := app.dbm.AlertQuery().ReadScope(CtxUser(ctx).AdminScopes()).UID(ctx.Query("uid"))
+
+		if ctx.QueryBool("active") {
+			q.Active()
+		}
+
+		ctx.Set("X-Total-Count", strconv.FormatInt(q.Count(), 10))
+
+		data := q.Limit(min(ctx.QueryInt("limit", 100), 1000)).Offset(ctx.QueryInt("offset")).Get()
+		res := make([]*model.AlertDTO, 0, len(data))
+
+		for _, a := range data {
+			res = append(res, a.DTO())
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiAlertAckHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		a, err := getAlertForAdmin(app, ctx)
+		if a == nil {
+			return err
+		}
+
+		a.Ack(CtxUser(ctx).GetLogin())
+
+		if err := app.dbm.Save(a); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.logger.Info(fmt.Sprintf("alert acknowledged by %s: %s", a.AckedBy, a.String()))
+
+		return ctx.JSON(a.DTO())
+	}
+}
+
+// getApiAlertCancelHandler closes the alert and sends cancel message to clients, so it is removed from their maps.
+func getApiAlertCancelHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		a, err := getAlertForAdmin(app, ctx)
+		if a == nil {
+			return err
+		}
+
+		if !a.Active {
+			return SendError(ctx, "alert is not active")
+		}
+
+		a.Cancel(CtxUser(ctx).GetLogin())
+
+		if err := app.dbm.Save(a); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.logger.Info(fmt.Sprintf("alert cancelled by %s: %s", a.CancelledBy, a.String()))
+		app.updateAlertsMetric()
+		app.NewCotMessage(a.CancelMessage())
+
+		return ctx.JSON(a.DTO())
+	}
+}
+
+func getAlertForAdmin(app *App, ctx *fiber.Ctx) (*model.Alert, error) {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return nil, err
+	}
+
+	if id == 0 {
+		return nil, ctx.SendStatus(fiber.StatusBadRequest)
+	}
+
+	a := app.dbm.AlertQuery().Id(uint(id)).One()
+	if a == nil || !CtxUser(ctx).AdminCanSeeScope(a.Scope) {
+		return nil, ctx.SendStatus(fiber.StatusNotFound)
 	}
+
+	return a, nil
 }
 
 func getApiUnitTrackHandler(app *App) fiber.Handler {
@@ -322,7 +609,7 @@ func getApiUnitTrackHandler(app *App) fiber.Handler {
 		uid := ctx.Params("uid")
 
 		item := app.items.Get(uid)
-		if item == nil {
+		if item == nil || !CtxUser(ctx).AdminCanSeeScope(item.GetScope()) {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
@@ -330,14 +617,73 @@ func getApiUnitTrackHandler(app *App) fiber.Handler {
 	}
 }
 
+// getApiTracksHandler returns track history as json or exports it to gpx, kml or geojson.
+func getApiTracksHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := CtxUser(ctx)
+		q := app.dbm.TrackQuery().Order("time")
+
+		if scope := ctx.Query("scope"); scope != "" {
+			if !user.AdminCanSeeScope(scope) {
+				return ctx.SendStatus(fiber.StatusForbidden)
+			}
+
+			q.Scope(scope)
+		} else {
+			q.ReadScope(user.AdminScopes())
+		}
+
+		if err := setTrackFilter(ctx, q); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		data := q.Limit(min(ctx.QueryInt("limit", 10000), 100000)).Get()
+
+		format := ctx.Query("format", "json")
+		if format == "json" {
+			res := make([]*model.TrackPointDTO, 0, len(data))
+
+			for _, p := range data {
+				res = append(res, p.DTO())
+			}
+
+			return ctx.JSON(res)
+		}
+
+		var buf bytes.Buffer
+
+		ct, err := model.ExportTracks(&buf, format, "GoATAK tracks", model.GroupTracks(data))
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		ctx.Attachment("tracks." + format)
+		ctx.Set(fiber.HeaderContentType, ct)
+
+		return ctx.Send(buf.Bytes())
+	}
+}
+
 func deleteItemHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		uid := ctx.Params("uid")
+		user := CtxUser(ctx)
+
+		item := app.items.Get(uid)
+
+		if item == nil || !user.AdminCanSeeScope(item.GetScope()) {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
 		app.items.Remove(uid)
 
+		e := auditEvent(ctx, model.AUDIT_UNIT_DELETE, uid, item.GetScope())
+		e.Details = item.GetCallsign()
+		app.audit.Add(e)
+
 		r := make(map[string]any, 0)
-		r["units"] = getUnits(app)
-		r["messages"] = app.messages
+		r["units"] = getUnits(app, user)
+		r["messages"] = app.dbm.ChatQuery().ReadScope(user.AdminScopes()).Get()
 
 		return ctx.JSON(r)
 	}
@@ -345,9 +691,17 @@ func deleteItemHandler(app *App) fiber.Handler {
 
 func getApiConnHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
+		user := CtxUser(ctx)
 		conn := make([]*Connection, 0)
 
 		app.ForAllClients(func(ch client.ClientHandler) bool {
+			ph, isPeer := ch.(*peerHandler)
+
+			// peers are server-wide, only super admin can see them
+			if (isPeer && !user.IsSuperAdmin()) || !user.AdminCanSeeScope(ch.GetDevice().GetScope()) {
+				return true
+			}
+
 			c := &Connection{
 				Uids:     ch.GetUids(),
 				User:     ch.GetDevice().GetLogin(),
@@ -355,12 +709,29 @@ func getApiConnHandler(app *App) fiber.Handler {
 				Addr:     ch.GetName(),
 				Scope:    ch.GetDevice().GetScope(),
 				LastSeen: ch.GetLastSeen(),
+				Queue:    ch.GetQueueStats(),
+			}
+
+			if isPeer {
+				c.Peer = ph.peer.Status()
 			}
+
 			conn = append(conn, c)
 
 			return true
 		})
 
+		for _, p := range app.peers {
+			if user.IsSuperAdmin() && !p.connected.Load() {
+				conn = append(conn, &Connection{
+					Addr:  p.HandlerName(),
+					User:  p.HandlerName(),
+					Scope: p.conf.Scope,
+					Peer:  p.Status(),
+				})
+			}
+		}
+
 		sort.Slice(conn, func(i, j int) bool {
 			return conn[i].Addr < conn[j].Addr
 		})
@@ -373,6 +744,25 @@ func getCotXMLPostHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		scope := ctx.Query("scope", "test")
 
+		// requests without token can post to configured scope only
+		if user := CtxUser(ctx); user != nil {
+			if !user.Can(model.PERM_OPERATE) || !user.AdminCanSeeScope(scope) {
+				return ctx.SendStatus(fiber.StatusForbidden)
+			}
+		} else {
+			anon := app.config.CotXMLScope()
+
+			if anon == "" {
+				return ctx.SendStatus(fiber.StatusUnauthorized)
+			}
+
+			if s := ctx.Query("scope"); s != "" && s != anon {
+				return ctx.SendStatus(fiber.StatusForbidden)
+			}
+
+			scope = anon
+		}
+
 		ev := new(cot.Event)
 
 		if err := xml.Unmarshal(ctx.Body(), &ev); err != nil {
@@ -390,6 +780,7 @@ func getCotXMLPostHandler(app *App) fiber.Handler {
 
 		c.Scope = scope
 		app.NewCotMessage(c)
+		app.audit.Add(cotAuditEvent(ctx, c))
 
 		return nil
 	}
@@ -397,7 +788,7 @@ func getCotXMLPostHandler(app *App) fiber.Handler {
 
 func getApiAllMissionHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		data := app.dbm.MissionQuery().Full().Get()
+		data := app.dbm.MissionQuery().ReadScope(CtxUser(ctx).AdminScopes()).Full().Get()
 
 		result := make([]*model.MissionDTO, len(data))
 
@@ -416,7 +807,10 @@ func getApiAllMissionChangesHandler(app *App) fiber.Handler {
 			return err
 		}
 
-		m := app.dbm.MissionQuery().Id(uint(id)).One()
+		m := app.dbm.MissionQuery().Id(uint(id)).ReadScope(CtxUser(ctx).AdminScopes()).One()
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
 
 		ch := app.dbm.GetChanges(m.ID, time.Now().Add(-time.Hour*24*365), false)
 
@@ -432,7 +826,7 @@ func getApiAllMissionChangesHandler(app *App) fiber.Handler {
 
 func getApiFilesHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		data := app.dbm.ResourceQuery().Order("created_at DESC").Get()
+		data := app.dbm.ResourceQuery().ReadScope(CtxUser(ctx).AdminScopes()).Order("created_at DESC").Get()
 
 		return ctx.JSON(data)
 	}
@@ -450,7 +844,7 @@ func getApiFileHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusBadRequest)
 		}
 
-		pi := app.dbm.ResourceQuery().Id(uint(id)).One()
+		pi := app.dbm.ResourceQuery().Id(uint(id)).ReadScope(CtxUser(ctx).AdminScopes()).One()
 
 		if pi == nil {
 			return ctx.SendStatus(fiber.StatusNotFound)
@@ -496,7 +890,24 @@ func getApiFileDeleteHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusBadRequest)
 		}
 
-		app.dbm.ResourceQuery().Id(uint(id)).Delete()
+		if c := app.dbm.ResourceQuery().Id(uint(id)).ReadScope(CtxUser(ctx).AdminScopes()).One(); c != nil {
+			// file is removed from missions first, so subscribers know it is gone
+			for _, m := range app.dbm.MissionQuery().Resource(c.ID).Limit(0).Full().Get() {
+				app.notifyMissionSubscribers(m, app.dbm.DeleteMissionContent(m, c.Hash, ""))
+			}
+
+			size, err := app.removeResource(c)
+			if err != nil {
+				return err
+			}
+
+			retentionFilesMetric.WithLabelValues(reasonDeleted).Inc()
+			retentionBytesMetric.WithLabelValues(reasonDeleted).Add(float64(size))
+
+			e := auditEvent(ctx, model.AUDIT_FILE_DELETE, c.Hash, c.Scope)
+			e.Details = c.Name
+			app.audit.Add(e)
+		}
 
 		return ctx.RedirectToRoute("admin_files", nil)
 	}
@@ -504,7 +915,7 @@ func getApiFileDeleteHandler(app *App) fiber.Handler {
 
 func getApiPointsHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		data := app.dbm.PointQuery().Order("created_at DESC").Get()
+		data := app.dbm.PointQuery().ReadScope(CtxUser(ctx).AdminScopes()).Order("created_at DESC").Get()
 
 		return ctx.JSON(data)
 	}
@@ -512,12 +923,15 @@ func getApiPointsHandler(app *App) fiber.Handler {
 
 func getApiDevicesHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
+		user := CtxUser(ctx)
 		data := app.dbm.DeviceQuery().Full().Get()
 
-		devices := make([]*model.DeviceDTO, len(data))
+		devices := make([]*model.DeviceDTO, 0, len(data))
 
-		for i, d := range data {
-			devices[i] = d.DTO()
+		for _, d := range data {
+			if user.AdminCanSeeScope(d.Scope) {
+				devices = append(devices, d.DTO())
+			}
 		}
 
 		return ctx.JSON(devices)
@@ -544,12 +958,24 @@ func getApiDevicePostHandler(app *App) fiber.Handler {
 			return SendError(ctx, "empty scope")
 		}
 
+		if !model.ValidRole(m.Role) {
+			return SendError(ctx, "invalid role "+m.Role)
+		}
+
+		user := CtxUser(ctx)
+
 		d := &model.Device{
-			Login:     m.Login,
-			Admin:     m.Admin,
-			Disabled:  m.Disabled,
-			Scope:     m.Scope,
-			ReadScope: m.ReadScope,
+			Login:      m.Login,
+			Admin:      m.Admin,
+			SuperAdmin: m.SuperAdmin,
+			Role:       m.Role,
+			Disabled:   m.Disabled,
+			Scope:      m.Scope,
+			ReadScope:  m.ReadScope,
+		}
+
+		if !canGrantScopes(user, m.Scope, m.ReadScope) || !canGrantRole(user, d) {
+			return ctx.SendStatus(fiber.StatusForbidden)
 		}
 
 		if err := d.SetPassword(m.Password); err != nil {
@@ -560,31 +986,81 @@ func getApiDevicePostHandler(app *App) fiber.Handler {
 			return SendError(ctx, err.Error())
 		}
 
+		e := auditEvent(ctx, model.AUDIT_DEVICE_CREATE, d.Login, d.Scope)
+		e.Details = fmt.Sprintf("admin: %t, super_admin: %t, role: %s, disabled: %t, read_scope: %v", d.Admin,
+			d.SuperAdmin, d.Role, d.Disabled, d.ReadScope)
+		app.audit.Add(e)
+
 		return ctx.JSON(d.DTO())
 	}
 }
 
 func getApiCertsHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
+		user := CtxUser(ctx)
 		data := app.dbm.CertsQuery().Get()
 
-		certs := make([]*model.CertificateDTO, len(data))
+		certs := make([]*model.CertificateDTO, 0, len(data))
 
-		for i, d := range data {
-			certs[i] = d.DTO()
+		for _, c := range data {
+			if user.AdminCanSeeScope(app.users.Get(c.Login).GetScope()) {
+				certs = append(certs, c.DTO())
+			}
 		}
 
 		return ctx.JSON(certs)
 	}
 }
 
+func getApiCertRevokeHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		sn := ctx.Params("sn")
+
+		cert := app.dbm.CertsQuery().SN(sn).One()
+		if cert == nil || !CtxUser(ctx).AdminCanSeeScope(app.users.Get(cert.Login).GetScope()) {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		var m struct {
+			Reason string `json:"reason"`
+		}
+
+		if len(ctx.Body()) > 0 {
+			if err := ctx.BodyParser(&m); err != nil {
+				return err
+			}
+		}
+
+		if m.Reason == "" {
+			m.Reason = model.REVOKE_UNSPECIFIED
+		}
+
+		if !model.ValidRevokeReason(m.Reason) {
+			return SendError(ctx, "invalid reason "+m.Reason)
+		}
+
+		if err := app.revokeCert(sn, m.Reason); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.logger.Info(fmt.Sprintf("certificate %s of %s revoked by %s", sn, cert.Login, Username(ctx)))
+
+		e := auditEvent(ctx, model.AUDIT_CERT_REVOKE, cert.Login, app.users.Get(cert.Login).GetScope())
+		e.Details = fmt.Sprintf("serial %s, reason %s", sn, m.Reason)
+		app.audit.Add(e)
+
+		return ctx.JSON(app.dbm.CertsQuery().SN(sn).One().DTO())
+	}
+}
+
 func getApiDevicePutHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		login := ctx.Params("id")
 
+		user := CtxUser(ctx)
 		d := app.dbm.DeviceQuery().Login(login).One()
 
-		if d == nil {
+		if d == nil || !user.AdminCanSeeScope(d.Scope) {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
@@ -594,6 +1070,17 @@ func getApiDevicePutHandler(app *App) fiber.Handler {
 			return err
 		}
 
+		if !model.ValidRole(m.Role) {
+			return SendError(ctx, "invalid role "+m.Role)
+		}
+
+		if !canGrantScopes(user, m.Scope, m.ReadScope) || !canGrantRole(user, d) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		e := auditEvent(ctx, model.AUDIT_DEVICE_UPDATE, d.Login, d.Scope)
+		old := *d
+
 		if m.Password != "" {
 			if err := d.SetPassword(m.Password); err != nil {
 				return err
@@ -604,13 +1091,65 @@ func getApiDevicePutHandler(app *App) fiber.Handler {
 		d.ReadScope = m.ReadScope
 		//d.Admin = m.Admin
 		d.Disabled = m.Disabled
+		d.Role = m.Role
+
+		if user.IsSuperAdmin() {
+			d.SuperAdmin = m.SuperAdmin
+		}
+
+		if !canGrantRole(user, d) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
 
 		app.dbm.Save(d)
 
+		e.Details = deviceChanges(&old, d, m.Password != "")
+		app.audit.Add(e)
+
 		return ctx.JSON(d.DTO())
 	}
 }
 
+// canGrantRole checks that admin does not make or change admins having permissions the admin doesn't have.
+func canGrantRole(user *model.Device, d *model.Device) bool {
+	if d.IsSuperAdmin() && !user.IsSuperAdmin() {
+		return false
+	}
+
+	if !d.Admin && d.Role == "" {
+		return true
+	}
+
+	return model.RoleIncludes(user.GetRole(), d.GetRole())
+}
+
+func grantableRoles(user *model.Device) []string {
+	var res []string
+
+	for _, r := range model.Roles() {
+		if canGrantRole(user, &model.Device{Admin: true, Role: r}) {
+			res = append(res, r)
+		}
+	}
+
+	return res
+}
+
+// canGrantScopes checks that admin does not give other users access to scopes the admin can't see.
+func canGrantScopes(user *model.Device, scope string, readScope []string) bool {
+	if !user.AdminCanSeeScope(scope) {
+		return false
+	}
+
+	for _, s := range readScope {
+		if !user.AdminCanSeeScope(s) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func getApiProfilesHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		data := app.dbm.ProfileQuery().Get()
@@ -699,13 +1238,15 @@ func getApiProfileDeleteHandler(app *App) fiber.Handler {
 			return SendError(ctx, err.Error())
 		}
 
+		app.audit.Add(auditEvent(ctx, model.AUDIT_PROFILE_DELETE, login+"/"+uid, app.users.Get(login).GetScope()))
+
 		return ctx.JSON(fiber.Map{"status": "ok"})
 	}
 }
 
 func getApiFeedsHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		data := app.dbm.FeedQuery().All(true).Get()
+		data := app.dbm.FeedQuery().ReadScope(CtxUser(ctx).AdminScopes()).All(true).Get()
 
 		feeds := make([]*model.Feed2DTO, len(data))
 
@@ -729,6 +1270,10 @@ func getApiFeedPostHandler(app *App) fiber.Handler {
 			m.UID = uuid.NewString()
 		}
 
+		if !CtxUser(ctx).AdminCanSeeScope(m.Scope) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
 		f := &model.Feed2{
 			UID:       m.UID,
 			Active:    m.Active,
@@ -755,7 +1300,7 @@ func getApiFeedPutHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		uid := ctx.Params("uid")
 
-		f := app.dbm.FeedQuery().UID(uid).All(true).One()
+		f := app.dbm.FeedQuery().UID(uid).ReadScope(CtxUser(ctx).AdminScopes()).All(true).One()
 
 		if f == nil {
 			return ctx.SendStatus(fiber.StatusNotFound)
@@ -767,6 +1312,10 @@ func getApiFeedPutHandler(app *App) fiber.Handler {
 			return err
 		}
 
+		if !CtxUser(ctx).AdminCanSeeScope(m.Scope) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
 		f.Active = m.Active
 		f.Alias = m.Alias
 		f.URL = m.URL
@@ -789,14 +1338,183 @@ func getApiFeedDeleteHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		uid := ctx.Params("uid")
 
-		if err := app.dbm.FeedQuery().UID(uid).Delete(); err != nil {
+		if err := app.dbm.FeedQuery().UID(uid).ReadScope(CtxUser(ctx).AdminScopes()).All(true).Delete(); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		return ctx.JSON(fiber.Map{"status": "ok"})
+	}
+}
+
+func getApiGeofencesHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := CtxUser(ctx)
+		data := app.dbm.GeofenceQuery().Scope(ctx.Query("scope")).Get()
+
+		fences := make([]*model.GeofenceDTO, 0, len(data))
+
+		for _, f := range data {
+			if user.AdminCanSeeScope(f.Scope) {
+				fences = append(fences, f.DTO())
+			}
+		}
+
+		return ctx.JSON(fences)
+	}
+}
+
+func getApiGeofencePostHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var m *model.GeofencePostDTO
+
+		if err := ctx.BodyParser(&m); err != nil {
+			return err
+		}
+
+		if !CtxUser(ctx).AdminCanSeeScope(m.Scope) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		f := &model.Geofence{
+			Scope:   m.Scope,
+			Name:    m.Name,
+			Enabled: m.Enabled,
+			Author:  Username(ctx),
+		}
+
+		if err := setGeofenceGeometry(app, f, m); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		if err := app.dbm.Create(f); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.reloadGeofences()
+
+		return ctx.JSON(f.DTO())
+	}
+}
+
+func getApiGeofencePutHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return err
+		}
+
+		user := CtxUser(ctx)
+
+		f := app.dbm.GeofenceQuery().Id(uint(id)).One()
+		if f == nil || !user.AdminCanSeeScope(f.Scope) {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		var m *model.GeofencePostDTO
+
+		if err := ctx.BodyParser(&m); err != nil {
+			return err
+		}
+
+		if m.Scope != "" && !user.AdminCanSeeScope(m.Scope) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		f.Name = m.Name
+		f.Enabled = m.Enabled
+
+		if m.Scope != "" {
+			f.Scope = m.Scope
+		}
+
+		if err := setGeofenceGeometry(app, f, m); err != nil {
 			return SendError(ctx, err.Error())
 		}
 
+		if err := app.dbm.Save(f); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.reloadGeofences()
+
+		return ctx.JSON(f.DTO())
+	}
+}
+
+func getApiGeofenceDeleteHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return err
+		}
+
+		if id == 0 {
+			return ctx.SendStatus(fiber.StatusBadRequest)
+		}
+
+		if f := app.dbm.GeofenceQuery().Id(uint(id)).One(); f == nil || !CtxUser(ctx).AdminCanSeeScope(f.Scope) {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		if err := app.dbm.GeofenceQuery().Id(uint(id)).Delete(); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.reloadGeofences()
+
 		return ctx.JSON(fiber.Map{"status": "ok"})
 	}
 }
 
+func getApiGeofenceEventsHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return err
+		}
+
+		if f := app.dbm.GeofenceQuery().Id(uint(id)).One(); f == nil || !CtxUser(ctx).AdminCanSeeScope(f.Scope) {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		data := app.dbm.GeofenceEventQuery().Geofence(uint(id)).UID(ctx.Query("uid")).
+			Limit(ctx.QueryInt("limit", 100)).Offset(ctx.QueryInt("offset")).Get()
+
+		events := make([]*model.GeofenceEventDTO, len(data))
+
+		for i, e := range data {
+			events[i] = e.DTO()
+		}
+
+		return ctx.JSON(events)
+	}
+}
+
+// setGeofenceGeometry takes fence geometry from the drawing shape if shape uid is set, from the request otherwise.
+func setGeofenceGeometry(app *App, f *model.Geofence, m *model.GeofencePostDTO) error {
+	if m.ShapeUID != "" {
+		item := app.items.Get(m.ShapeUID)
+		if item == nil {
+			return fmt.Errorf("shape %s is not found", m.ShapeUID)
+		}
+
+		if !cot.MatchAnyPattern(item.GetType(), "u-d-f", "u-d-r", "u-d-c-c") {
+			return fmt.Errorf("item %s is not a shape", m.ShapeUID)
+		}
+
+		return f.UpdateFromShape(item.GetMsg())
+	}
+
+	f.ShapeUID = ""
+	f.Kind = m.Kind
+	f.Points = m.Points
+	f.Lat = m.Lat
+	f.Lon = m.Lon
+	f.Radius = m.Radius
+
+	return f.Validate()
+}
+
 func getPluginsManifestHandler(_ *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		return ctx.JSON(fiber.Map{"plugins": []string{}, "iconSets": []string{}})
@@ -808,10 +1526,38 @@ func getWsHandler(app *App) fiber.Handler {
 		name := uuid.NewString()
 
 		h := wshandler.NewHandler(app.logger, name, ws)
+		user := User(ws)
+
+		// uids of items the page has, deletes of other items are not sent
+		var sent sync.Map
 
 		app.logger.Debug("ws listener connected")
-		app.items.ChangeCallback().SubscribeNamed(name, h.SendItem)
-		app.items.DeleteCallback().SubscribeNamed(name, h.DeleteItem)
+		app.items.ChangeCallback().SubscribeNamed(name, func(item *model.Item) bool {
+			if !user.AdminCanSeeScope(item.GetScope()) {
+				return h.IsActive()
+			}
+
+			sent.Store(item.GetUID(), struct{}{})
+
+			return h.SendItem(item)
+		})
+		app.items.DeleteCallback().SubscribeNamed(name, func(uid string) bool {
+			if _, ok := sent.LoadAndDelete(uid); !ok {
+				return h.IsActive()
+			}
+
+			return h.DeleteItem(uid)
+		})
+
+		// items visible at connect are loaded by page from /api/unit
+		app.items.ForEach(func(item *model.Item) bool {
+			if user.AdminCanSeeScope(item.GetScope()) {
+				sent.Store(item.GetUID(), struct{}{})
+			}
+
+			return true
+		})
+
 		h.Listen()
 		app.logger.Debug("ws listener disconnected")
 	})
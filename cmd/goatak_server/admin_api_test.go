@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/pkg/cot"
 	"github.com/kdudkov/goatak/pkg/model"
 )
 
@@ -35,12 +37,20 @@ func Device(login, pass string, admin, disabled bool) *model.Device {
 }
 
 func NewTestApp() *TestApp {
+	return NewTestAppWithConfig(nil)
+}
+
+func NewTestAppWithConfig(settings map[string]any) *TestApp {
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
 
 	cfg := config.NewAppConfig()
 	cfg.Set("db", ":memory:")
 	cfg.Set("delay", false)
 
+	for k, v := range settings {
+		cfg.Set(k, v)
+	}
+
 	app := &TestApp{
 		App: NewApp(cfg),
 	}
@@ -62,10 +72,11 @@ func NewTestApp() *TestApp {
 		log:         app.logger.With("logger", "http"),
 		listeners:   make(map[string]Listener),
 		userManager: app.users,
-		tokenKey:    []byte("111"),
+		tokens:      app.tokens,
+		audit:       app.audit,
 		tokenMaxAge: time.Hour,
 		loginUrl:    "/login",
-		noAuth:      nil,
+		noAuth:      noAuthPaths,
 	}
 
 	app.api = srv.NewAdminAPI(app.App, "localhost:1234", "")
@@ -164,3 +175,106 @@ func TestLoginGetToken(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
 }
+
+func (app *TestApp) Token(t *testing.T, login, psw string) string {
+	resp, err := app.PostJSON("/token", "", fiber.Map{"login": login, "password": psw})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	m := make(map[string]string)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+
+	return m["token"]
+}
+
+func TestMessages(t *testing.T) {
+	app := NewTestApp()
+
+	for i, scope := range []string{"", "", "b"} {
+		chat := &model.ChatMessage{
+			ID:       strconv.Itoa(i),
+			Time:     time.Now(),
+			Parent:   "RootContactGroup",
+			Chatroom: "All Chat Rooms",
+			From:     "user",
+			FromUID:  "uid" + strconv.Itoa(i),
+			ToUID:    "All Chat Rooms",
+			Text:     "text",
+		}
+
+		msg, err := cot.CotFromProto(model.MakeChatMessage(chat), "", scope)
+		require.NoError(t, err)
+		app.chatProcessor(msg)
+	}
+
+	token := app.Token(t, "adm1", "111")
+
+	resp, err := app.Req("GET", "/api/message?limit=1", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.Equal(t, "2", resp.Header.Get("X-Total-Count"))
+
+	var res []*model.ChatMessage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.Len(t, res, 1)
+
+	resp, err = app.Req("GET", "/api/message?uid=uid1", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, "1", resp.Header.Get("X-Total-Count"))
+
+	resp, err = app.Req("GET", "/api/message?scope=b", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp, err = app.Req("GET", "/api/message?start=bad", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusNotAcceptable, resp.StatusCode)
+}
+
+func TestScopedAdmin(t *testing.T) {
+	app := NewTestApp()
+
+	d := Device("adm3", "333", true, false)
+	d.Scope = "a"
+	app.dbm.Save(d)
+
+	d = Device("super", "444", true, false)
+	d.SuperAdmin = true
+	app.dbm.Save(d)
+
+	app.items.Store(model.FromMsg(newCotMessage("a", "uid_a", 10, 10)))
+	app.items.Store(model.FromMsg(newCotMessage("b", "uid_b", 10, 10)))
+
+	getUnits := func(token string) []*model.WebUnit {
+		resp, err := app.Req("GET", "/api/unit", token, nil)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var res []*model.WebUnit
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+
+		return res
+	}
+
+	scoped := app.Token(t, "adm3", "333")
+	super := app.Token(t, "super", "444")
+
+	units := getUnits(scoped)
+	require.Len(t, units, 1)
+	require.Equal(t, "uid_a", units[0].UID)
+
+	require.Len(t, getUnits(super), 2)
+
+	resp, err := app.Req("GET", "/api/unit/uid_b/track", scoped, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+	// scoped admin can't give more rights than it has
+	resp, err = app.PostJSON("/api/device", scoped, fiber.Map{"login": "u1", "password": "1", "scope": "b"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp, err = app.PostJSON("/api/device", scoped, fiber.Map{"login": "u1", "password": "1", "scope": "a", "super_admin": true})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// alertProcessor keeps emergency alerts in database, repeated alert message updates the active one.
+func (app *App) alertProcessor(msg *cot.CotMessage) bool {
+	if msg.GetType() == model.ALERT_CANCEL || msg.GetDetail().GetFirst("emergency").GetAttr("cancel") == "true" {
+		app.cancelAlerts(msg)
+
+		return true
+	}
+
+	a := app.dbm.AlertQuery().UID(msg.GetUID()).Scope(msg.Scope).Active().One()
+
+	if a == nil {
+		a = model.NewAlert(msg)
+		app.logger.Warn("new alert: " + a.String())
+	} else {
+		a.Update(msg)
+	}
+
+	if err := app.dbm.Save(a); err != nil {
+		return true
+	}
+
+	app.updateAlertsMetric()
+
+	return true
+}
+
+func (app *App) cancelAlerts(msg *cot.CotMessage) {
+	_, callsign := msg.GetParent()
+	if e := msg.GetDetail().GetFirst("emergency"); e != nil && e.GetText() != "" {
+		callsign = e.GetText()
+	}
+
+	for _, a := range app.dbm.AlertQuery().UID(msg.GetUID()).Scope(msg.Scope).Active().Limit(0).Get() {
+		a.Cancel(callsign)
+
+		if err := app.dbm.Save(a); err == nil {
+			app.logger.Info(fmt.Sprintf("alert cancelled by %s: %s", callsign, a.String()))
+		}
+	}
+
+	app.updateAlertsMetric()
+}
+
+// sendActiveAlerts sends active alerts to just connected contact, alerts from other scopes are not sent.
+func (app *App) sendActiveAlerts(uid string) {
+	for _, a := range app.dbm.AlertQuery().Active().Order("created_at").Limit(0).Get() {
+		if a.SenderUID == uid {
+			continue
+		}
+
+		msg, err := a.Message()
+		if err != nil {
+			app.logger.Error("invalid alert message "+a.String(), slog.Any("error", err))
+
+			continue
+		}
+
+		if app.sendToUID(uid, msg) {
+			app.logger.Info(fmt.Sprintf("alert %s sent to %s", a.UID, uid))
+		}
+	}
+}
+
+func (app *App) updateAlertsMetric() {
+	alertsMetric.Reset()
+
+	for scope, n := range app.dbm.AlertQuery().Active().CountByScope() {
+		alertsMetric.WithLabelValues(scope).Set(float64(n))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func newAlert(scope, typ, sender, callsign string, cancel bool) *cot.CotMessage {
+	tak := cot.BasicMsg(typ, sender+"-9-1-1", time.Second*20)
+	tak.CotEvent.Lat = 10
+	tak.CotEvent.Lon = 20
+
+	det := cot.NewXMLDetails()
+	det.AddPpLink(sender, "a-f-G-U-C", callsign)
+
+	if cancel {
+		det.AddChild("emergency", map[string]string{"cancel": "true"}, callsign)
+	} else {
+		det.AddChild("emergency", map[string]string{"type": "911 Alert"}, callsign)
+	}
+
+	tak.CotEvent.Detail = &cotproto.Detail{XmlDetail: det.AsXMLString()}
+
+	return &cot.CotMessage{TakMessage: tak, Detail: det, Scope: scope}
+}
+
+func TestAlerts(t *testing.T) {
+	app := NewTestApp()
+
+	app.alertProcessor(newAlert("", "b-a-o-tbl", "dev1", "bob", false))
+	app.alertProcessor(newAlert("", "b-a-o-tbl", "dev1", "bob", false))
+	app.alertProcessor(newAlert("", "b-a-o-pan", "dev2", "alice", false))
+	app.alertProcessor(newAlert("b", "b-a-o-tbl", "dev3", "john", false))
+
+	require.Equal(t, int64(3), app.dbm.AlertQuery().Active().Count())
+	assert.InDelta(t, 2., testutil.ToFloat64(alertsMetric.WithLabelValues("")), 0.1)
+
+	a := app.dbm.AlertQuery().UID("dev1-9-1-1").One()
+	require.NotNil(t, a)
+	assert.Equal(t, "911 Alert", a.Kind)
+	assert.Equal(t, "bob", a.Callsign)
+	assert.Equal(t, "dev1", a.SenderUID)
+
+	// late joiner gets alerts of its scope only, but not its own
+	h := &testHandler{name: "h1", uids: map[string]string{"dev2": "alice"}, device: &model.Device{Login: "alice"}}
+	app.AddClientHandler(h)
+	app.sendActiveAlerts("dev2")
+
+	sent := h.Sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "dev1-9-1-1", sent[0].GetUID())
+	assert.True(t, sent[0].GetStaleTime().After(time.Now()))
+
+	// cancel by client
+	app.alertProcessor(newAlert("", "b-a-o-can", "dev2", "alice", true))
+	assert.Equal(t, int64(2), app.dbm.AlertQuery().Active().Count())
+	assert.InDelta(t, 1., testutil.ToFloat64(alertsMetric.WithLabelValues("")), 0.1)
+
+	token := app.Token(t, "adm1", "111")
+
+	resp, err := app.Req("GET", "/api/alert?active=true", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.Equal(t, "1", resp.Header.Get("X-Total-Count"))
+
+	resp, err = app.Req("GET", "/api/alert", token, nil)
+	require.NoError(t, err)
+
+	var res []*model.AlertDTO
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.Len(t, res, 2)
+
+	// alert from other scope
+	other := app.dbm.AlertQuery().Scope("b").One()
+	resp, err = app.Req("POST", fmt.Sprintf("/api/alert/%d/ack", other.ID), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+	resp, err = app.Req("POST", fmt.Sprintf("/api/alert/%d/ack", a.ID), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	a = app.dbm.AlertQuery().Id(a.ID).One()
+	assert.Equal(t, "adm1", a.AckedBy)
+	assert.True(t, a.Active)
+
+	resp, err = app.Req("POST", fmt.Sprintf("/api/alert/%d/cancel", a.ID), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	a = app.dbm.AlertQuery().Id(a.ID).One()
+	assert.False(t, a.Active)
+	assert.Equal(t, "adm1", a.CancelledBy)
+
+	select {
+	case msg := <-app.ch:
+		assert.Equal(t, "b-a-o-can", msg.GetType())
+		assert.Equal(t, "dev1-9-1-1", msg.GetUID())
+	default:
+		t.Error("no cancel message")
+	}
+
+	resp, err = app.Req("POST", fmt.Sprintf("/api/alert/%d/cancel", a.ID), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusNotAcceptable, resp.StatusCode)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// AuditLog stores audit events in database and appends them to JSON lines file for external log collectors.
+type AuditLog struct {
+	logger *slog.Logger
+	dbm    *database.DatabaseManager
+
+	mx   sync.Mutex
+	file *os.File
+}
+
+func NewAuditLog(dbm *database.DatabaseManager, fileName string) (*AuditLog, error) {
+	a := &AuditLog{
+		logger: slog.With(slog.String("logger", "audit")),
+		dbm:    dbm,
+	}
+
+	if fileName != "" {
+		if err := os.MkdirAll(filepath.Dir(fileName), 0o755); err != nil {
+			return nil, err
+		}
+
+		f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+		if err != nil {
+			return nil, err
+		}
+
+		a.file = f
+	}
+
+	return a, nil
+}
+
+// Add records the event. Errors are logged only, failed audit write does not stop the action.
+func (a *AuditLog) Add(e *model.AuditEvent) {
+	if a == nil || e == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	auditMetric.WithLabelValues(e.Action).Inc()
+
+	if err := a.dbm.Create(e); err != nil {
+		a.logger.Error("can't save audit event", slog.String("action", e.Action), slog.Any("error", err))
+	}
+
+	if a.file == nil {
+		return
+	}
+
+	b, err := json.Marshal(e.DTO())
+	if err != nil {
+		return
+	}
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if _, err := a.file.Write(append(b, '\n')); err != nil {
+		a.logger.Error("can't write audit file", slog.Any("error", err))
+	}
+}
+
+func (a *AuditLog) Close() error {
+	if a == nil || a.file == nil {
+		return nil
+	}
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	return a.file.Close()
+}
+
+// auditEvent makes the event of the request, actor is the logged in user.
+func auditEvent(ctx *fiber.Ctx, action, target, scope string) *model.AuditEvent {
+	return &model.AuditEvent{
+		Actor:    Username(ctx),
+		Action:   action,
+		Target:   target,
+		Scope:    scope,
+		SourceIP: ctx.IP(),
+	}
+}
+
+func cotAuditEvent(ctx *fiber.Ctx, msg *cot.CotMessage) *model.AuditEvent {
+	e := auditEvent(ctx, model.AUDIT_COT_POST, msg.GetUID(), msg.Scope)
+	e.Details = strings.TrimSpace(msg.GetType() + " " + msg.GetCallsign())
+
+	return e
+}
+
+// deviceChanges describes what admin has changed in the device, password is never shown.
+func deviceChanges(old, d *model.Device, password bool) string {
+	var res []string
+
+	if old.Scope != d.Scope {
+		res = append(res, fmt.Sprintf("scope: %s -> %s", old.Scope, d.Scope))
+	}
+
+	if !slices.Equal(old.ReadScope, d.ReadScope) {
+		res = append(res, fmt.Sprintf("read_scope: %v -> %v", old.ReadScope, d.ReadScope))
+	}
+
+	if old.Disabled != d.Disabled {
+		res = append(res, fmt.Sprintf("disabled: %t -> %t", old.Disabled, d.Disabled))
+	}
+
+	if old.SuperAdmin != d.SuperAdmin {
+		res = append(res, fmt.Sprintf("super_admin: %t -> %t", old.SuperAdmin, d.SuperAdmin))
+	}
+
+	if old.Role != d.Role {
+		res = append(res, fmt.Sprintf("role: %s -> %s", old.Role, d.Role))
+	}
+
+	if password {
+		res = append(res, "password changed")
+	}
+
+	return strings.Join(res, ", ")
+}
+
+// auditQuery makes the query of events in scopes the admin can see with filters from request.
+func auditQuery(app *App, ctx *fiber.Ctx) (*database.AuditQuery, error) {
+	user := CtxUser(ctx)
+
+	if scope := ctx.Query("scope"); scope != "" && !user.AdminCanSeeScope(scope) {
+		return nil, fiber.NewError(fiber.StatusForbidden, "scope is not allowed")
+	}
+
+	q := app.dbm.AuditQuery().ReadScope(user.AdminScopes()).
+		Actor(ctx.Query("actor")).
+		Action(ctx.Query("action")).
+		Target(ctx.Query("target")).
+		Scope(ctx.Query("scope"))
+
+	if v := ctx.Query("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusNotAcceptable, "invalid start time")
+		}
+
+		q.After(t)
+	}
+
+	if v := ctx.Query("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusNotAcceptable, "invalid end time")
+		}
+
+		q.Before(t)
+	}
+
+	return q, nil
+}
+
+func getAuditPage() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		data := map[string]any{
+			"theme": "auto",
+			"user":  CtxUser(ctx),
+			"page":  " audit",
+			"js":    []string{"audit.js"},
+		}
+
+		return ctx.Render("templates/audit", data, "templates/menu", "templates/header")
+	}
+}
+
+func getApiAuditHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		q, err := auditQuery(app, ctx)
+		if err != nil {
+			return err
+		}
+
+		ctx.Set("X-Total-Count", strconv.FormatInt(q.Count(), 10))
+
+		data := q.Limit(min(ctx.QueryInt("limit", 100), 1000)).Offset(ctx.QueryInt("offset")).Get()
+		res := make([]*model.AuditEventDTO, 0, len(data))
+
+		for _, e := range data {
+			res = append(res, e.DTO())
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+// getApiAuditExportHandler sends events as JSON lines, oldest first, all of them if limit is not set.
+func getApiAuditExportHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		q, err := auditQuery(app, ctx)
+		if err != nil {
+			return err
+		}
+
+		data := q.Order("time, id").Limit(ctx.QueryInt("limit")).Get()
+
+		ctx.Attachment("audit.jsonl")
+		ctx.Set(fiber.HeaderContentType, "application/x-ndjson")
+
+		w := ctx.Response().BodyWriter()
+		enc := json.NewEncoder(w)
+
+		for _, e := range data {
+			if err := enc.Encode(e.DTO()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func getAudit(t *testing.T, app *TestApp, token, query string) []*model.AuditEventDTO {
+	t.Helper()
+
+	resp, err := app.Req("GET", "/api/audit?"+query, token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var res []*model.AuditEventDTO
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+
+	return res
+}
+
+func TestAudit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	app := NewTestAppWithConfig(map[string]any{"audit.file": file})
+
+	sa := Device("sa", "sa", true, false)
+	sa.SuperAdmin = true
+	require.NoError(t, app.dbm.Save(sa))
+
+	blue := Device("blue", "blue", true, false)
+	blue.Scope = "blue"
+	require.NoError(t, app.dbm.Save(blue))
+
+	resp, err := app.PostJSON("/token", "", fiber.Map{"login": "sa", "password": "bad"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	token := app.Token(t, "sa", "sa")
+	blueToken := app.Token(t, "blue", "blue")
+
+	resp, err = app.PostJSON("/api/device", token, fiber.Map{"login": "usr3", "password": "3", "scope": "blue"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	req, err := http.NewRequest("PUT", "/api/device/usr3", strings.NewReader(`{"scope":"blue","disabled":true}`))
+	require.NoError(t, err)
+	req.Header.Add(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	resp, err = app.api.f.Test(req, 3000)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.PostJSON("/api/device", token, fiber.Map{"login": "usr4", "password": "4", "scope": "red"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	events := getAudit(t, app, token, "action=login_failed")
+	require.Len(t, events, 1)
+	assert.Equal(t, "sa", events[0].Actor)
+	assert.Equal(t, "0.0.0.0", events[0].SourceIP)
+
+	events = getAudit(t, app, token, "action=device_create")
+	require.Len(t, events, 2)
+	assert.Equal(t, "usr4", events[0].Target)
+	assert.Equal(t, "sa", events[0].Actor)
+	assert.Equal(t, "red", events[0].Scope)
+
+	// admin sees events of own scopes only
+	events = getAudit(t, app, blueToken, "")
+	require.Len(t, events, 2)
+	assert.Equal(t, "usr3", events[0].Target)
+	assert.Equal(t, model.AUDIT_DEVICE_UPDATE, events[0].Action)
+	assert.Equal(t, "disabled: false -> true", events[0].Details)
+
+	assert.Empty(t, getAudit(t, app, token, "actor=nobody"))
+
+	// scope filter narrows the result and can't widen admin's scopes
+	events = getAudit(t, app, token, "scope=blue")
+	require.Len(t, events, 2)
+	assert.Equal(t, "blue", events[1].Scope)
+
+	resp, err = app.Req("GET", "/api/audit?scope=red", blueToken, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp, err = app.Req("GET", "/api/audit?start=bad", token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotAcceptable, resp.StatusCode)
+
+	// events can't be changed
+	e := app.dbm.AuditQuery().Action(model.AUDIT_LOGIN_FAILED).Get()[0]
+	e.Actor = "other"
+	require.ErrorIs(t, app.dbm.Save(e), model.ErrAuditAppendOnly)
+	assert.Equal(t, "sa", app.dbm.AuditQuery().Action(model.AUDIT_LOGIN_FAILED).Get()[0].Actor)
+
+	// export is oldest first
+	resp, err = app.Req("GET", "/api/audit/export", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var actions []string
+
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		var ev model.AuditEventDTO
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &ev))
+		actions = append(actions, ev.Action)
+	}
+
+	require.Len(t, actions, 4)
+	assert.Equal(t, model.AUDIT_LOGIN_FAILED, actions[0])
+
+	// the same events are in the file
+	require.NoError(t, app.audit.Close())
+
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+
+	n := 0
+	for sc = bufio.NewScanner(f); sc.Scan(); n++ {
+		var ev model.AuditEventDTO
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &ev))
+		assert.Equal(t, actions[n], ev.Action)
+	}
+
+	assert.Equal(t, 4, n)
+}
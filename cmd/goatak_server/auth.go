@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"math/rand"
 	"strings"
 	"time"
 
@@ -13,6 +12,8 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/golang-jwt/jwt/v5"
 
+	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/internal/repository"
 	"github.com/kdudkov/goatak/pkg/model"
 )
 
@@ -52,9 +53,21 @@ func (h *HttpServer) CookieAuth(c *fiber.Ctx) error {
 	}
 
 	for _, p := range h.noAuth {
-		if strings.HasPrefix(c.Path(), p) {
-			return c.Next()
+		if !strings.HasPrefix(c.Path(), p) {
+			continue
 		}
+
+		if tokenStr := getToken(c); tokenStr != "" {
+			user, err := h.checkToken(tokenStr)
+			if err != nil {
+				return c.SendStatus(fiber.StatusUnauthorized)
+			}
+
+			c.Locals(UsernameKey, user.Login)
+			c.Locals(UserKey, user)
+		}
+
+		return c.Next()
 	}
 
 	user, err := h.checkToken(getToken(c))
@@ -70,28 +83,50 @@ func (h *HttpServer) CookieAuth(c *fiber.Ctx) error {
 	return c.Next()
 }
 
+// requirePerm passes the request further only if admin's role has the permission.
+func requirePerm(perm string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := CtxUser(c)
+
+		if user == nil {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		if !user.Can(perm) {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+
+		return c.Next()
+	}
+}
+
 func (h *HttpServer) checkToken(tokenStr string) (*model.Device, error) {
 	if tokenStr == "" {
 		return nil, noTokenErr
 	}
 
-	claims := &jwt.RegisteredClaims{}
-
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (any, error) {
-		return h.tokenKey, nil
-	})
+	claims, err := h.tokens.Parse(tokenStr)
 
 	if err != nil {
 		h.log.With(slog.String("logger", "auth")).Warn("token parse error", slog.Any("error", err))
 
-		if errors.Is(err, jwt.ErrSignatureInvalid) || errors.Is(err, jwt.ErrTokenExpired) {
+		if errors.Is(err, jwt.ErrSignatureInvalid) || errors.Is(err, jwt.ErrTokenExpired) ||
+			errors.Is(err, jwt.ErrTokenUnverifiable) {
 			return nil, badToken
 		}
 
 		return nil, err
 	}
 
-	if !token.Valid {
+	if h.tokens.IsRevoked(claims.ID) {
+		return nil, badToken
+	}
+
+	if claims.Type == tokenTypeApi {
+		if t := h.tokens.ApiToken(claims.ID); t != nil {
+			return t.Device(), nil
+		}
+
 		return nil, badToken
 	}
 
@@ -109,6 +144,33 @@ func (h *HttpServer) DeviceAuthHandler() fiber.Handler {
 	})
 }
 
+func newAuthBackends(conf *config.AppConfig, users *repository.UserDbRepository) ([]repository.Authenticator, error) {
+	res := make([]repository.Authenticator, 0)
+
+	for _, name := range conf.AuthBackends() {
+		switch name {
+		case "local":
+			res = append(res, users.Local())
+		case "ldap":
+			c, err := conf.LDAPConfig()
+			if err != nil {
+				return nil, err
+			}
+
+			a, err := repository.NewLDAPAuth(c)
+			if err != nil {
+				return nil, err
+			}
+
+			res = append(res, a)
+		default:
+			return nil, fmt.Errorf("unknown auth backend %s", name)
+		}
+	}
+
+	return res, nil
+}
+
 func SSLCheckHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		if c := ctx.Context(); c != nil {
@@ -122,6 +184,8 @@ func SSLCheckHandler(app *App) fiber.Handler {
 				}
 
 				app.logger.Warn(fmt.Sprintf("invalid user %s serial %s", username, serial))
+				app.audit.Add(&model.AuditEvent{Actor: username, Action: model.AUDIT_CERT_REJECTED, Target: serial,
+					Scope: app.users.Get(username).GetScope(), SourceIP: ctx.IP(), Details: "marti"})
 			}
 		}
 
@@ -141,6 +205,14 @@ func Username(c *fiber.Ctx) string {
 	return u.(string)
 }
 
+func CtxUser(c *fiber.Ctx) *model.Device {
+	if u, ok := c.Locals(UserKey).(*model.Device); ok {
+		return u
+	}
+
+	return nil
+}
+
 func User(c *websocket.Conn) *model.Device {
 	val := c.Locals(UserKey)
 
@@ -162,23 +234,3 @@ func getToken(c *fiber.Ctx) string {
 
 	return c.Cookies(cookieName)
 }
-
-func generateToken(username string, key []byte, t time.Duration) (string, error) {
-	claims := &jwt.RegisteredClaims{
-		Subject:   username,
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(t)),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(key)
-}
-
-func randomString(n int) string {
-	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
-
-	s := make([]rune, n)
-	for i := range s {
-		s[i] = letters[rand.Intn(len(letters))]
-	}
-	return string(s)
-}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/internal/pm"
+)
+
+const blobUsage = `usage: goatak_server [-config file] blob <command> [options]
+
+commands:
+  migrate -from type -to type [-dry-run] [-delete]  copy blobs between stores (fs, s3), checking sha256 hashes
+  verify [-store type]                              check sha256 hashes of all stored blobs
+`
+
+func newBlobStore(conf *config.AppConfig, typ string) (pm.BlobStore, error) {
+	switch typ {
+	case "", "fs":
+		return pm.NewFsStore(conf.BlobDir()), nil
+	case "s3":
+		c, err := conf.S3Config()
+		if err != nil {
+			return nil, err
+		}
+
+		return pm.NewS3Store(c)
+	default:
+		return nil, fmt.Errorf("unknown blob store type %s", typ)
+	}
+}
+
+func runBlob(conf *config.AppConfig, args []string) error {
+	if len(args) == 0 {
+		fmt.Print(blobUsage)
+
+		return nil
+	}
+
+	switch args[0] {
+	case "migrate":
+		return blobMigrateCmd(conf, args[1:])
+	case "verify":
+		return blobVerifyCmd(conf, args[1:])
+	default:
+		fmt.Print(blobUsage)
+
+		return fmt.Errorf("unknown blob command %s", args[0])
+	}
+}
+
+func blobMigrateCmd(conf *config.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("blob migrate", flag.ContinueOnError)
+	from := fs.String("from", "fs", "source store type")
+	to := fs.String("to", conf.BlobStoreType(), "destination store type")
+	dryRun := fs.Bool("dry-run", false, "only count blobs to copy")
+	del := fs.Bool("delete", false, "delete blobs from the source after verified copy")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == *to {
+		return errors.New("source and destination are the same")
+	}
+
+	src, err := newBlobStore(conf, *from)
+	if err != nil {
+		return err
+	}
+
+	dst, err := newBlobStore(conf, *to)
+	if err != nil {
+		return err
+	}
+
+	res, err := pm.Migrate(src, dst, pm.MigrateOpts{DryRun: *dryRun, Delete: *del})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range res.Errors {
+		fmt.Println(e)
+	}
+
+	if *dryRun {
+		fmt.Printf("%d blobs (%d bytes) to copy, %d already in %s\n", res.Copied, res.Bytes, res.Skipped, *to)
+	} else {
+		fmt.Printf("%d blobs (%d bytes) copied, %d skipped, %d errors\n", res.Copied, res.Bytes, res.Skipped, len(res.Errors))
+	}
+
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("%d blobs are not copied", len(res.Errors))
+	}
+
+	return nil
+}
+
+func blobVerifyCmd(conf *config.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("blob verify", flag.ContinueOnError)
+	typ := fs.String("store", conf.BlobStoreType(), "store type")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := newBlobStore(conf, *typ)
+	if err != nil {
+		return err
+	}
+
+	blobs, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	var bad int
+
+	for _, b := range blobs {
+		if err := pm.VerifyBlob(s, b.Scope, b.Hash); err != nil {
+			fmt.Printf("%s/%s: %s\n", b.Scope, b.Hash, err.Error())
+			bad++
+		}
+	}
+
+	fmt.Printf("%d blobs checked, %d bad\n", len(blobs), bad)
+
+	if bad > 0 {
+		return fmt.Errorf("%d bad blobs", bad)
+	}
+
+	return nil
+}
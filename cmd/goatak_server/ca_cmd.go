@@ -0,0 +1,576 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kdudkov/goatak/cmd/goatak_server/mp"
+	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/internal/repository"
+	"github.com/kdudkov/goatak/pkg/tlsutil"
+)
+
+const (
+	caUsage = `usage: goatak_server [-config file] ca <command> [options]
+
+commands:
+  init [-cn name] [-days n] [-force]               create new CA (ssl.ca, ssl.ca_key)
+  server [-days n] [-new-key] [host [name...]]     issue or rotate server certificate (ssl.cert, ssl.key)
+  user [-uid uid] [-host host] [-port n] [-days n] [-out dir] login
+                                                   issue user .p12 and connection data package
+  list [-login login] [-uid uid]                   list issued certificates
+  renew [-before days] [-days n] [-new-key]        renew CA and server certificates that expire soon
+`
+
+	caDefaultDays = 3650
+	day           = time.Hour * 24
+)
+
+type caManager struct {
+	conf *config.AppConfig
+	dbm  *database.DatabaseManager
+	out  io.Writer
+}
+
+func runCa(conf *config.AppConfig, args []string) error {
+	if len(args) == 0 {
+		fmt.Print(caUsage)
+
+		return nil
+	}
+
+	m := &caManager{conf: conf, out: os.Stdout}
+
+	switch args[0] {
+	case "init":
+		return m.initCmd(args[1:])
+	case "server":
+		return m.serverCmd(args[1:])
+	case "user":
+		return m.userCmd(args[1:])
+	case "list":
+		return m.listCmd(args[1:])
+	case "renew":
+		return m.renewCmd(args[1:])
+	default:
+		fmt.Print(caUsage)
+
+		return fmt.Errorf("unknown ca command %s", args[0])
+	}
+}
+
+func (m *caManager) initCmd(args []string) error {
+	fs := flag.NewFlagSet("ca init", flag.ContinueOnError)
+	cn := fs.String("cn", "Goatak CA", "CA common name")
+	days := fs.Int("days", caDefaultDays, "validity in days")
+	force := fs.Bool("force", false, "overwrite existing CA")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return m.createCA(*cn, time.Duration(*days)*day, *force)
+}
+
+func (m *caManager) serverCmd(args []string) error {
+	fs := flag.NewFlagSet("ca server", flag.ContinueOnError)
+	days := fs.Int("days", caDefaultDays, "validity in days")
+	newKey := fs.Bool("new-key", false, "generate new key, certificates issued with the old key will be invalid")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	_, err := m.issueServer(fs.Arg(0), fs.Args()[min(1, fs.NArg()):], time.Duration(*days)*day, *newKey)
+
+	return err
+}
+
+func (m *caManager) userCmd(args []string) error {
+	fs := flag.NewFlagSet("ca user", flag.ContinueOnError)
+	uid := fs.String("uid", "", "device uid")
+	host := fs.String("host", "", "server address for connection, server certificate name by default")
+	port := fs.Int("port", m.tlsPort(), "server tls port")
+	days := fs.Int("days", m.conf.CertTTLDays(), "validity in days")
+	out := fs.String("out", ".", "output directory")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("login is required")
+	}
+
+	_, _, err := m.issueUser(fs.Arg(0), *uid, *host, *port, time.Duration(*days)*day, *out)
+
+	return err
+}
+
+func (m *caManager) listCmd(args []string) error {
+	fs := flag.NewFlagSet("ca list", flag.ContinueOnError)
+	login := fs.String("login", "", "filter by login")
+	uid := fs.String("uid", "", "filter by device uid")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return m.list(*login, *uid)
+}
+
+func (m *caManager) renewCmd(args []string) error {
+	fs := flag.NewFlagSet("ca renew", flag.ContinueOnError)
+	before := fs.Int("before", 30, "renew certificates that expire in less than given days")
+	days := fs.Int("days", caDefaultDays, "validity of renewed certificates in days")
+	newKey := fs.Bool("new-key", false, "generate new server key")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return m.renew(time.Duration(*before)*day, time.Duration(*days)*day, *newKey)
+}
+
+func (m *caManager) createCA(cn string, ttl time.Duration, force bool) error {
+	certFile, keyFile, err := m.caFiles()
+	if err != nil {
+		return err
+	}
+
+	if !force && fileExists(keyFile) {
+		return fmt.Errorf("CA key %s exists, use -force to overwrite", keyFile)
+	}
+
+	key, err := tlsutil.NewKey(tlsutil.CAKeyBits)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tlsutil.Sign(tlsutil.CATemplate(cn, ttl), key.Public(), nil, key)
+	if err != nil {
+		return err
+	}
+
+	if err := m.writeKey(keyFile, key); err != nil {
+		return err
+	}
+
+	if err := writeFile(certFile, tlsutil.CertsToPem(cert), 0o644); err != nil {
+		return err
+	}
+
+	m.printCert("CA", cert)
+
+	return nil
+}
+
+// issueServer makes new server certificate signed by CA. If the server cert exists, its subject and key are
+// kept, so certificates already signed by the server stay valid. Host and names of the existing cert are used
+// if no host is given.
+func (m *caManager) issueServer(host string, names []string, ttl time.Duration, newKey bool) (*x509.Certificate, error) {
+	ca, caKey, err := m.loadCA()
+	if err != nil {
+		return nil, err
+	}
+
+	certFile, keyFile, err := m.serverFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	old, key, _ := loadPair(certFile, keyFile)
+
+	if host == "" {
+		if old == nil {
+			return nil, errors.New("host is required")
+		}
+
+		host = old.Subject.CommonName
+		names = tlsutil.Names(old)
+	}
+
+	tpl := tlsutil.ServerTemplate(host, names, ttl)
+
+	if old != nil && old.Subject.CommonName == host {
+		tpl.Subject = old.Subject
+	}
+
+	keyChanged := key == nil || newKey
+
+	if keyChanged {
+		if key, err = tlsutil.NewKey(tlsutil.CertKeyBits); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tlsutil.Sign(tpl, key.Public(), ca, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: tlsutil.MakeCertPool(ca)}); err != nil {
+		return nil, fmt.Errorf("new server certificate is not valid: %w", err)
+	}
+
+	if keyChanged {
+		if err := m.writeKey(keyFile, key); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeFile(certFile, tlsutil.CertsToPem(cert, ca), 0o644); err != nil {
+		return nil, err
+	}
+
+	m.printCert("server", cert)
+
+	return cert, nil
+}
+
+// issueUser signs user certificate with server key, as it is done on enrollment, and writes .p12 file and
+// data package with connection settings to dir.
+func (m *caManager) issueUser(login, uid, host string, port int, ttl time.Duration, dir string) (string, string, error) {
+	dbm, err := m.db()
+	if err != nil {
+		return "", "", err
+	}
+
+	if dbm.DeviceQuery().Login(login).One() == nil {
+		return "", "", fmt.Errorf("no user %s, create it first", login)
+	}
+
+	certFile, keyFile, err := m.serverFiles()
+	if err != nil {
+		return "", "", err
+	}
+
+	srv, srvKey, err := loadPair(certFile, keyFile)
+	if err != nil {
+		return "", "", err
+	}
+
+	// CA key is not needed here, it can be kept offline
+	cas, err := loadCerts(m.conf.String("ssl.ca"))
+	if err != nil {
+		return "", "", err
+	}
+
+	if host == "" {
+		host = srv.Subject.CommonName
+	}
+
+	key, err := tlsutil.NewKey(tlsutil.CertKeyBits)
+	if err != nil {
+		return "", "", err
+	}
+
+	cert, err := tlsutil.Sign(tlsutil.ClientTemplate(login, uid, ttl), key.Public(), srv, srvKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	p12, err := tlsutil.MakeP12(p12Password, key, cert, append([]*x509.Certificate{srv}, cas...)...)
+	if err != nil {
+		return "", "", err
+	}
+
+	trust, err := tlsutil.MakeP12TrustStore(p12Password, cas...)
+	if err != nil {
+		return "", "", err
+	}
+
+	dp, err := connectionPackage(host, port, login, p12, trust)
+	if err != nil {
+		return "", "", err
+	}
+
+	p12File := filepath.Join(dir, login+".p12")
+	dpFile := filepath.Join(dir, fmt.Sprintf("%s_%s.zip", host, login))
+
+	if err := writeFile(p12File, p12, 0o600); err != nil {
+		return "", "", err
+	}
+
+	if err := writeFile(dpFile, dp, 0o600); err != nil {
+		return "", "", err
+	}
+
+	repository.NewUserDbRepository("", dbm).SaveSignInfo(login, uid, tlsutil.SerialString(cert.SerialNumber), cert.NotAfter)
+
+	m.printCert("user "+login, cert)
+	fmt.Fprintf(m.out, "keystore: %s\ndata package: %s\n", p12File, dpFile)
+
+	return p12File, dpFile, nil
+}
+
+func connectionPackage(host string, port int, login string, p12, trust []byte) ([]byte, error) {
+	p12Name := login + ".p12"
+
+	pref := mp.NewPrefFile(fmt.Sprintf("certs/%s.pref", host))
+	pref.AddParam(mp.STREAMS, "count", "1")
+	pref.AddParam(mp.STREAMS, "enabled0", "true")
+	pref.AddParam(mp.STREAMS, "connectString0", fmt.Sprintf("%s:%d:ssl", host, port))
+	pref.AddParam(mp.STREAMS, "description0", "SSL connection to "+host)
+	pref.AddParam(mp.STREAMS, "useAuth0", "false")
+	pref.AddParam(mp.APP_PREF, "caLocation", "cert/truststore.p12")
+	pref.AddParam(mp.APP_PREF, "caPassword", p12Password)
+	pref.AddParam(mp.APP_PREF, "certificateLocation", "cert/"+p12Name)
+	pref.AddParam(mp.APP_PREF, "clientPassword", p12Password)
+	pref.AddParam(mp.APP_PREF, "displayServerConnectionWidget", "true")
+
+	pkg := mp.NewMissionPackage(host+"_config", host+" config")
+	pkg.Param("onReceiveImport", "true")
+	pkg.Param("onReceiveDelete", "true")
+	pkg.AddFiles(pref, mp.NewBlobFile("certs/truststore.p12", trust), mp.NewBlobFile("certs/"+p12Name, p12))
+
+	return pkg.Create()
+}
+
+func (m *caManager) list(login, uid string) error {
+	dbm, err := m.db()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(m.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIAL\tLOGIN\tUID\tCREATED\tVALID TILL\tLAST CONNECT\tSTATUS")
+
+	for _, c := range dbm.CertsQuery().Login(login).UID(uid).Limit(0).Get() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.Serial, c.Login, c.UID, formatTime(&c.CreatedAt),
+			formatTime(c.ValidTill), formatTime(c.LastConnect), certStatus(c.IsRevoked(), c.IsExpired(), c.RevokeReason))
+	}
+
+	return w.Flush()
+}
+
+// renew re-signs CA with the same key and issues new server certificate if any of them expires soon.
+// User certificates are not renewed, devices get new ones on enrollment.
+func (m *caManager) renew(before, ttl time.Duration, newKey bool) error {
+	ca, caKey, err := m.loadCA()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(before)
+	renewed := false
+
+	if ca.NotAfter.Before(deadline) {
+		tpl := tlsutil.CATemplate(ca.Subject.CommonName, ttl)
+		tpl.Subject = ca.Subject
+
+		if ca, err = tlsutil.Sign(tpl, caKey.Public(), nil, caKey); err != nil {
+			return err
+		}
+
+		certFile, _, _ := m.caFiles()
+		if err := writeFile(certFile, tlsutil.CertsToPem(ca), 0o644); err != nil {
+			return err
+		}
+
+		m.printCert("CA", ca)
+
+		renewed = true
+	}
+
+	certFile, keyFile, err := m.serverFiles()
+	if err != nil {
+		return err
+	}
+
+	srv, _, err := loadPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	if renewed || newKey || srv.NotAfter.Before(deadline) {
+		if _, err := m.issueServer("", nil, ttl, newKey); err != nil {
+			return err
+		}
+
+		renewed = true
+	}
+
+	if !renewed {
+		fmt.Fprintf(m.out, "nothing to renew, server certificate is valid till %s\n", srv.NotAfter.Format(time.DateOnly))
+	}
+
+	dbm, err := m.db()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range dbm.CertsQuery().Limit(0).Get() {
+		if !c.IsRevoked() && !c.IsExpired() && c.ValidTill != nil && c.ValidTill.Before(deadline) {
+			fmt.Fprintf(m.out, "user certificate %s of %s %s expires %s\n", c.Serial, c.Login, c.UID, formatTime(c.ValidTill))
+		}
+	}
+
+	return nil
+}
+
+func (m *caManager) db() (*database.DatabaseManager, error) {
+	if m.dbm != nil {
+		return m.dbm, nil
+	}
+
+	db, err := database.GetDatabase(m.conf.String("db"), false)
+	if err != nil {
+		return nil, err
+	}
+
+	m.dbm = database.New(db)
+
+	return m.dbm, m.dbm.Migrate()
+}
+
+func (m *caManager) caFiles() (string, string, error) {
+	certFile, keyFile := m.conf.String("ssl.ca"), m.conf.CAKeyFile()
+
+	if certFile == "" || keyFile == "" {
+		return "", "", errors.New("no ssl.ca in config")
+	}
+
+	return certFile, keyFile, nil
+}
+
+func (m *caManager) serverFiles() (string, string, error) {
+	certFile, keyFile := m.conf.String("ssl.cert"), m.conf.String("ssl.key")
+
+	if certFile == "" || keyFile == "" {
+		return "", "", errors.New("no ssl.cert or ssl.key in config")
+	}
+
+	return certFile, keyFile, nil
+}
+
+func (m *caManager) loadCA() (*x509.Certificate, crypto.Signer, error) {
+	certFile, keyFile, err := m.caFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, key, err := loadPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't load CA, create it with 'ca init': %w", err)
+	}
+
+	return cert, key, nil
+}
+
+func (m *caManager) tlsPort() int {
+	if _, p, err := net.SplitHostPort(m.conf.String("tls_addr")); err == nil {
+		if n, err := strconv.Atoi(p); err == nil {
+			return n
+		}
+	}
+
+	return 8089
+}
+
+func (m *caManager) writeKey(name string, key crypto.Signer) error {
+	b, err := tlsutil.KeyToPem(key)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(name, b, 0o600)
+}
+
+func (m *caManager) printCert(name string, cert *x509.Certificate) {
+	fmt.Fprintf(m.out, "%s certificate %s, sn %s, valid till %s\n", name, cert.Subject.CommonName,
+		tlsutil.SerialString(cert.SerialNumber), cert.NotAfter.Format(time.DateOnly))
+
+	if names := tlsutil.Names(cert); len(names) > 0 {
+		fmt.Fprintf(m.out, "  names: %v\n", names)
+	}
+}
+
+func loadCerts(name string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := tlsutil.DecodeAllCerts(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate in %s", name)
+	}
+
+	return certs, nil
+}
+
+// loadPair reads the first certificate and private key from PEM files.
+func loadPair(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	certs, err := loadCerts(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := tlsutil.ParseKey(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", keyFile, err)
+	}
+
+	return certs[0], key, nil
+}
+
+// writeFile keeps previous version of the file with .bak suffix.
+func writeFile(name string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	if fileExists(name) {
+		if err := os.Rename(name, name+".bak"); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(name, data, perm)
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+
+	return err == nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.DateTime)
+}
+
+func certStatus(revoked, expired bool, reason string) string {
+	switch {
+	case revoked:
+		return "revoked: " + reason
+	case expired:
+		return "expired"
+	default:
+		return "valid"
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/x509"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/pkg/tlsutil"
+)
+
+func TestCaCommands(t *testing.T) {
+	app := NewTestApp()
+	dir := t.TempDir()
+
+	conf := config.NewAppConfig()
+	_ = conf.Set("ssl.ca", filepath.Join(dir, "ca.pem"))
+	_ = conf.Set("ssl.cert", filepath.Join(dir, "server.pem"))
+	_ = conf.Set("ssl.key", filepath.Join(dir, "server.key"))
+
+	out := new(bytes.Buffer)
+	m := &caManager{conf: conf, dbm: app.dbm, out: out}
+
+	require.NoError(t, m.createCA("test CA", time.Hour*24*365, false))
+	assert.FileExists(t, filepath.Join(dir, "ca.key"))
+	require.Error(t, m.createCA("test CA", time.Hour*24*365, false))
+
+	srv, err := m.issueServer("tak.example.com", []string{"10.0.0.1", "tak"}, time.Hour*24*30, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tak.example.com", "tak"}, srv.DNSNames)
+	assert.Equal(t, "10.0.0.1", srv.IPAddresses[0].String())
+
+	require.NoError(t, conf.ProcessCerts())
+	assert.Equal(t, srv.SerialNumber, conf.ServerCert.SerialNumber)
+
+	// user
+	_, _, err = m.issueUser("nobody", "", "", 8089, time.Hour, dir)
+	require.Error(t, err)
+
+	p12File, dpFile, err := m.issueUser("usr1", "ANDROID-1", "", 8089, time.Hour*24, dir)
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(p12File)
+	require.NoError(t, err)
+
+	_, cert, cas, err := pkcs12.DecodeChain(b, p12Password)
+	require.NoError(t, err)
+	assert.Equal(t, "usr1", cert.Subject.CommonName)
+	assert.Equal(t, []string{"ANDROID-1"}, cert.EmailAddresses)
+	assert.Len(t, cas, 2)
+
+	c := app.dbm.CertsQuery().SN(tlsutil.SerialString(cert.SerialNumber)).One()
+	require.NotNil(t, c)
+	assert.Equal(t, "ANDROID-1", c.UID)
+
+	pref := readZipFile(t, dpFile, "certs/tak.example.com.pref")
+	assert.Contains(t, pref, `<entry key="connectString0" class="class java.lang.String">tak.example.com:8089:ssl</entry>`)
+	assert.Contains(t, pref, `<entry key="count" class="class java.lang.Integer">1</entry>`)
+	assert.Contains(t, pref, "cert/usr1.p12")
+	assert.NotEmpty(t, readZipFile(t, dpFile, "certs/truststore.p12"))
+
+	// rotation keeps names and key, so old user certs are still valid
+	srv2, err := m.issueServer("", nil, time.Hour*24*30, false)
+	require.NoError(t, err)
+	assert.NotEqual(t, srv.SerialNumber, srv2.SerialNumber)
+	assert.Equal(t, srv.DNSNames, srv2.DNSNames)
+	assert.Equal(t, srv.PublicKey, srv2.PublicKey)
+
+	require.NoError(t, conf.ProcessCerts())
+
+	_, err = cert.Verify(x509.VerifyOptions{Roots: conf.CertPool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	require.NoError(t, err)
+
+	// list
+	out.Reset()
+	require.NoError(t, m.list("usr1", ""))
+	assert.Contains(t, out.String(), c.Serial)
+
+	// renew
+	out.Reset()
+	require.NoError(t, m.renew(time.Hour*24, time.Hour*24*30, false))
+	assert.Contains(t, out.String(), "nothing to renew")
+
+	out.Reset()
+	require.NoError(t, m.renew(time.Hour*24*60, time.Hour*24*365, false))
+	assert.Contains(t, out.String(), "server certificate")
+
+	require.NoError(t, conf.ProcessCerts())
+	assert.True(t, conf.ServerCert.NotAfter.After(time.Now().Add(time.Hour*24*300)))
+
+	_, err = cert.Verify(x509.VerifyOptions{Roots: conf.CertPool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	require.NoError(t, err)
+}
+
+func readZipFile(t *testing.T, name, entry string) string {
+	t.Helper()
+
+	r, err := zip.OpenReader(name)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	f, err := r.Open(entry)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+
+	return string(b)
+}
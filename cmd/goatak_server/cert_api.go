@@ -6,7 +6,6 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"math/big"
@@ -16,7 +15,9 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"github.com/kdudkov/goatak/internal/client"
 	"github.com/kdudkov/goatak/pkg/log"
+	"github.com/kdudkov/goatak/pkg/model"
 
 	"github.com/kdudkov/goatak/cmd/goatak_server/mp"
 	"github.com/kdudkov/goatak/pkg/tlsutil"
@@ -24,6 +25,7 @@ import (
 
 const (
 	p12Password = "atakatak"
+	crlTTL      = time.Hour * 24
 )
 
 type CertAPI struct {
@@ -44,6 +46,9 @@ func (h *HttpServer) NewCertAPI(app *App, addr string) *CertAPI {
 	api.f.Use(NewMetricHandler("cert_api"))
 	api.f.Use(log.NewFiberLogger(&log.LoggerConfig{Name: "cert_api", UserGetter: Username}))
 
+	// crl is public
+	api.f.Get("/Marti/api/tls/crl", getCrlHandler(app))
+
 	api.f.Use(h.DeviceAuthHandler())
 
 	if app.config.EnrollSSL() {
@@ -102,8 +107,6 @@ func signClientCert(uid string, clientCSR *x509.CertificateRequest, serverCert *
 }
 
 func getCertTemplate(issuer *pkix.Name, csr *x509.CertificateRequest, uid string, till time.Time) *x509.Certificate {
-	serialNumber, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
-
 	return &x509.Certificate{
 		Signature:          csr.Signature,
 		SignatureAlgorithm: csr.SignatureAlgorithm,
@@ -111,7 +114,7 @@ func getCertTemplate(issuer *pkix.Name, csr *x509.CertificateRequest, uid string
 		PublicKeyAlgorithm: csr.PublicKeyAlgorithm,
 		PublicKey:          csr.PublicKey,
 
-		SerialNumber:   serialNumber,
+		SerialNumber:   tlsutil.NewSerial(),
 		Issuer:         *issuer,
 		Subject:        csr.Subject,
 		NotBefore:      time.Now(),
@@ -149,10 +152,14 @@ func (app *App) processSignRequest(ctx *fiber.Ctx) (*x509.Certificate, error) {
 		return nil, err
 	}
 
-	serial := hex.EncodeToString(signedCert.SerialNumber.Bytes())
+	serial := tlsutil.SerialString(signedCert.SerialNumber)
 	app.users.SaveSignInfo(username, uid, serial, till)
 	app.logger.Info(fmt.Sprintf("new cert signed for user %s uid %s ver %s serial %s", username, uid, ver, serial))
 
+	e := auditEvent(ctx, model.AUDIT_CERT_SIGN, username, app.users.Get(username).GetScope())
+	e.Details = fmt.Sprintf("uid %s, serial %s, valid till %s", uid, serial, till.Format(time.DateOnly))
+	app.audit.Add(e)
+
 	return signedCert, nil
 }
 
@@ -277,3 +284,76 @@ func getProfileEnrollmentHandler(app *App) fiber.Handler {
 		return ctx.Send(dat)
 	}
 }
+
+// revokeCert marks certificate as revoked and drops connections that use it.
+func (app *App) revokeCert(sn, reason string) error {
+	if err := app.users.RevokeCert(sn, reason); err != nil {
+		return err
+	}
+
+	app.ForAllClients(func(ch client.ClientHandler) bool {
+		if ch.GetSerial() == sn {
+			app.logger.Info(fmt.Sprintf("disconnect %s, certificate %s is revoked", ch.GetName(), sn))
+			ch.Stop()
+		}
+
+		return true
+	})
+
+	return nil
+}
+
+// makeCrl makes DER encoded list of revoked certificates that are not expired yet, signed by server certificate.
+func (app *App) makeCrl() ([]byte, error) {
+	if app.config.ServerCert == nil || app.config.TlsCert == nil {
+		return nil, fmt.Errorf("no server certificate")
+	}
+
+	signer, ok := app.config.TlsCert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("invalid server key")
+	}
+
+	now := time.Now()
+	entries := make([]x509.RevocationListEntry, 0)
+
+	for _, c := range app.dbm.CertsQuery().Revoked().Limit(0).Get() {
+		if c.IsExpired() {
+			continue
+		}
+
+		e, err := c.RevocationEntry()
+		if err != nil {
+			app.logger.Warn("invalid serial "+c.Serial, slog.Any("error", err))
+
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	tpl := &x509.RevocationList{
+		Number:                    big.NewInt(now.Unix()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(crlTTL),
+		RevokedCertificateEntries: entries,
+	}
+
+	return x509.CreateRevocationList(rand.Reader, tpl, app.config.ServerCert, signer)
+}
+
+func getCrlHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		crl, err := app.makeCrl()
+		if err != nil {
+			app.logger.Error("crl error", slog.Any("error", err))
+
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		ctx.Set(fiber.HeaderContentType, "application/pkix-crl")
+		ctx.Set(fiber.HeaderContentDisposition, "attachment; filename=goatak.crl")
+
+		return ctx.Send(crl)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestCrl(t *testing.T) {
+	app := NewTestApp()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "server"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	app.config.ServerCert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	app.config.TlsCert = &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+
+	till := time.Now().Add(time.Hour)
+	app.users.SaveSignInfo("usr1", "uid1", "0a01", till)
+	app.users.SaveSignInfo("usr1", "uid2", "0a02", till)
+	app.users.SaveSignInfo("usr1", "uid3", "0a03", time.Now().Add(-time.Minute))
+
+	require.NoError(t, app.revokeCert("0a01", model.REVOKE_KEY_COMPROMISE))
+	require.NoError(t, app.revokeCert("0a03", model.REVOKE_CESSATION))
+
+	b, err := app.makeCrl()
+	require.NoError(t, err)
+
+	crl, err := x509.ParseRevocationList(b)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(app.config.ServerCert))
+
+	// expired cert is not in the list
+	require.Len(t, crl.RevokedCertificateEntries, 1)
+	require.Equal(t, int64(0x0a01), crl.RevokedCertificateEntries[0].SerialNumber.Int64())
+	require.Equal(t, 1, crl.RevokedCertificateEntries[0].ReasonCode)
+}
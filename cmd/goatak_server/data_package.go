@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/cmd/goatak_server/mp"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// packagePointStale is the stale time for imported points that are already stale.
+const packagePointStale = time.Hour * 24 * 365
+
+// openPackage opens the package blob, the reader must be closed.
+func (app *App) openPackage(c *model.Resource) (*mp.PackageReader, error) {
+	f, err := app.files.GetFile(c.Hash, c.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// fs store files are read as needed, other ones are read to memory
+	if ra, ok := f.(io.ReaderAt); ok {
+		p, err := mp.OpenPackage(ra, int64(c.Size))
+		if err != nil {
+			f.Close()
+		}
+
+		return p, err
+	}
+
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, int64(c.Size)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > c.Size {
+		return nil, fmt.Errorf("package %s is bigger than %d bytes", c.FileName, c.Size)
+	}
+
+	return mp.OpenPackageBytes(data)
+}
+
+// ingestPackage indexes the files of uploaded data package and imports cot files from it as points
+// in the package scope, if manifest does not forbid it with onReceiveImport=false.
+// Package with onReceiveDelete=true gets expiration time.
+func (app *App) ingestPackage(c *model.Resource) error {
+	p, err := app.openPackage(c)
+	if err != nil {
+		return err
+	}
+
+	defer p.Close()
+
+	if err := app.dbm.PackageEntryQuery().Resource(c.ID).Delete(); err != nil {
+		return err
+	}
+
+	manifest := p.Manifest()
+	msgs := make([]*cot.CotMessage, 0)
+
+	for _, entry := range packageEntries(c, p) {
+		if strings.EqualFold(path.Ext(entry.Name), ".cot") && !entry.Ignore && manifest.OnReceiveImport() {
+			msg, err := readPackageCot(p, entry.Name, c.Scope)
+			if err != nil {
+				app.logger.Warn("bad cot in package "+c.FileName+": "+entry.Name, slog.Any("error", err))
+			} else {
+				msgs = append(msgs, msg)
+				entry.Imported = true
+				entry.UID = msg.GetUID()
+			}
+		}
+
+		if err := app.dbm.Create(entry); err != nil {
+			return err
+		}
+	}
+
+	if ttl := app.config.PackageTTL(); manifest.OnReceiveDelete() && ttl > 0 {
+		c.Expiration = time.Now().Add(ttl).Unix()
+
+		if err := app.dbm.ResourceQuery().Id(c.ID).Update(map[string]any{"expiration": c.Expiration}); err != nil {
+			return err
+		}
+	}
+
+	app.logger.Info(fmt.Sprintf("package %s: %d files, %d points imported", c.FileName, len(p.Entries()), len(msgs)))
+
+	_, err = app.importMessages(msgs)
+
+	return err
+}
+
+// packageEntries returns the files of the package, not stored in database.
+func packageEntries(c *model.Resource, p *mp.PackageReader) []*model.PackageEntry {
+	entries := p.Entries()
+	res := make([]*model.PackageEntry, len(entries))
+
+	for i, e := range entries {
+		res[i] = &model.PackageEntry{
+			ResourceID: c.ID,
+			Scope:      c.Scope,
+			Name:       e.Name,
+			MIMEType:   entryMimeType(e.Name),
+			Size:       e.Size,
+			UID:        e.UID,
+			Ignore:     e.Ignore,
+		}
+	}
+
+	return res
+}
+
+func readPackageCot(p *mp.PackageReader, name, scope string) (*cot.CotMessage, error) {
+	data, err := p.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ev := new(cot.Event)
+	if err := xml.Unmarshal(data, ev); err != nil {
+		return nil, err
+	}
+
+	msg, err := cot.EventToProtoExt(ev, "", scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.GetUID() == "" {
+		return nil, fmt.Errorf("no uid")
+	}
+
+	// packages are often imported long after the points were made
+	now := time.Now()
+	evt := msg.GetTakMessage().GetCotEvent()
+
+	if cot.TimeFromMillis(evt.GetStaleTime()).Before(now) {
+		evt.SendTime = cot.TimeToMillis(now)
+		evt.StartTime = cot.TimeToMillis(now)
+		evt.StaleTime = cot.TimeToMillis(now.Add(packagePointStale))
+	}
+
+	return msg, nil
+}
+
+func entryMimeType(name string) string {
+	switch ext := path.Ext(name); ext {
+	case ".cot", ".kml":
+		return "application/xml"
+	case "":
+		return "application/octet-stream"
+	default:
+		if t := mime.TypeByExtension(ext); t != "" {
+			return t
+		}
+
+		return "application/octet-stream"
+	}
+}
+
+func (app *App) adminResource(ctx *fiber.Ctx) (*model.Resource, error) {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return nil, err
+	}
+
+	return app.dbm.ResourceQuery().Id(uint(id)).ReadScope(CtxUser(ctx).AdminScopes()).One(), nil
+}
+
+func getApiFileEntriesHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		c, err := app.adminResource(ctx)
+		if err != nil {
+			return err
+		}
+
+		if c == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		if entries := app.dbm.PackageEntryQuery().Resource(c.ID).Get(); len(entries) > 0 {
+			return ctx.JSON(entries)
+		}
+
+		// packages that are not ingested, e.g. uploaded before indexing was added, are read as is
+		p, err := app.openPackage(c)
+		if err != nil {
+			return ctx.JSON([]*model.PackageEntry{})
+		}
+
+		defer p.Close()
+
+		return ctx.JSON(packageEntries(c, p))
+	}
+}
+
+func getApiFileEntryHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		c, err := app.adminResource(ctx)
+		if err != nil {
+			return err
+		}
+
+		if c == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		name := ctx.Query("name")
+
+		p, err := app.openPackage(c)
+		if err != nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		defer p.Close()
+
+		var e *model.PackageEntry
+
+		for _, pe := range packageEntries(c, p) {
+			if pe.Name == name {
+				e = pe
+				break
+			}
+		}
+
+		if e == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		data, err := p.ReadFile(name)
+		if errors.Is(err, mp.ErrTooBig) {
+			return fiber.NewError(fiber.StatusRequestEntityTooLarge, "file is too big")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// entries come from clients, so only images are shown inline. Other files are attachments and preview is plain
+		// text, html or svg of the package can't run scripts on admin origin
+		download := ctx.QueryBool("download")
+		image := strings.HasPrefix(e.MIMEType, "image/")
+		contentType := e.MIMEType
+
+		if !image || download || e.MIMEType == "image/svg+xml" {
+			ctx.Attachment(path.Base(name))
+		}
+
+		if !image && !download {
+			contentType = fiber.MIMETextPlainCharsetUTF8
+		}
+
+		ctx.Set(fiber.HeaderContentType, contentType)
+		ctx.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		ctx.Set(fiber.HeaderContentLength, strconv.Itoa(len(data)))
+
+		return ctx.SendStream(bytes.NewReader(data))
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/cmd/goatak_server/mp"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const packageCot = `<?xml version="1.0" encoding="UTF-8"?>
+<event version="2.0" uid="%s" type="b-m-p-s-m" how="h-g-i-g-o" time="2024-01-01T10:00:00Z" start="2024-01-01T10:00:00Z" stale="2024-01-02T10:00:00Z">
+<point lat="10.5" lon="20.5" hae="0" ce="9999999" le="9999999"/>
+<detail><contact callsign="%s"/></detail>
+</event>`
+
+func testPackage(t *testing.T, params map[string]string) []byte {
+	t.Helper()
+
+	p := mp.NewMissionPackage("pkg1", "test")
+	for k, v := range params {
+		p.Param(k, v)
+	}
+
+	p.AddFiles(
+		mp.NewBlobFile("p1/p1.cot", []byte(fmt.Sprintf(packageCot, "point1", "Point 1"))),
+		mp.NewBlobFile("p2/p2.cot", []byte(fmt.Sprintf(packageCot, "point2", "Point 2"))),
+		mp.NewBlobFile("files/readme.txt", []byte("hello")),
+	)
+
+	data, err := p.Create()
+	require.NoError(t, err)
+
+	return data
+}
+
+func uploadPackage(t *testing.T, f *fiber.App, data []byte) {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	w := multipart.NewWriter(&b)
+	fw, _ := w.CreateFormFile("assetfile", "test.zip")
+	_, _ = fw.Write(data)
+	_ = w.Close()
+
+	h := sha256.Sum256(data)
+
+	req, _ := http.NewRequest("POST", "/Marti/sync/missionupload?filename=test.zip&creatorUid=uid1&hash="+hex.EncodeToString(h[:]), &b)
+	req.Header.Set(fiber.HeaderContentType, w.FormDataContentType())
+
+	resp, err := f.Test(req, 3000)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestDataPackageUpload(t *testing.T) {
+	app := NewTestAppWithConfig(map[string]any{"data_dir": t.TempDir()})
+	app.InitMessageProcessors()
+
+	f := fiber.New()
+	f.Use(func(c *fiber.Ctx) error {
+		c.Locals(UsernameKey, "usr1")
+
+		return c.Next()
+	})
+	addMartiRoutes(app.App, f)
+
+	uploadPackage(t, f, testPackage(t, map[string]string{"onReceiveDelete": "true"}))
+	assert.Equal(t, 2, app.drain())
+
+	item := app.items.Get("point1")
+	require.NotNil(t, item)
+	assert.Equal(t, "Point 1", item.GetCallsign())
+	// stale points are refreshed
+	assert.True(t, item.GetMsg().GetStaleTime().After(time.Now()))
+
+	res := app.dbm.ResourceQuery().One()
+	require.NotNil(t, res)
+	assert.Greater(t, res.Expiration, time.Now().Unix())
+
+	token := app.Token(t, "adm1", "111")
+
+	resp, err := app.Req("GET", fmt.Sprintf("/api/file/%d/entries", res.ID), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var entries []*model.PackageEntry
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	require.Len(t, entries, 3)
+	assert.Equal(t, "files/readme.txt", entries[0].Name)
+	assert.False(t, entries[0].Imported)
+	assert.True(t, entries[1].Imported)
+	assert.Equal(t, "point1", entries[1].UID)
+
+	resp, err = app.Req("GET", fmt.Sprintf("/api/file/%d/entry?name=files/readme.txt&download=1", res.ID), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get(fiber.HeaderContentDisposition), "readme.txt")
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+
+	// preview of non-image entry is plain text attachment
+	resp, err = app.Req("GET", fmt.Sprintf("/api/file/%d/entry?name=p1/p1.cot", res.ID), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, fiber.MIMETextPlainCharsetUTF8, resp.Header.Get(fiber.HeaderContentType))
+	assert.Contains(t, resp.Header.Get(fiber.HeaderContentDisposition), "attachment")
+	assert.Equal(t, "nosniff", resp.Header.Get(fiber.HeaderXContentTypeOptions))
+
+	resp, err = app.Req("GET", fmt.Sprintf("/api/file/%d/entry?name=nofile", res.ID), token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+	_, err = app.Req("GET", fmt.Sprintf("/api/file/delete/%d", res.ID), token, nil)
+	require.NoError(t, err)
+	assert.Zero(t, app.dbm.PackageEntryQuery().Count())
+}
+
+func TestDataPackageNoImport(t *testing.T) {
+	app := NewTestAppWithConfig(map[string]any{"data_dir": t.TempDir()})
+	app.InitMessageProcessors()
+
+	f := fiber.New()
+	f.Use(func(c *fiber.Ctx) error {
+		c.Locals(UsernameKey, "usr1")
+
+		return c.Next()
+	})
+	addMartiRoutes(app.App, f)
+
+	uploadPackage(t, f, testPackage(t, map[string]string{"onReceiveImport": "false"}))
+	assert.Zero(t, app.drain())
+	assert.Nil(t, app.items.Get("point1"))
+
+	res := app.dbm.ResourceQuery().One()
+	require.NotNil(t, res)
+	assert.Equal(t, int64(-1), res.Expiration)
+	assert.Equal(t, int64(3), app.dbm.PackageEntryQuery().Resource(res.ID).Count())
+}
+
+func TestDataPackageNotIngested(t *testing.T) {
+	app := NewTestAppWithConfig(map[string]any{"data_dir": t.TempDir()})
+
+	data := testPackage(t, nil)
+	hash, _, err := app.files.PutFile("", "", bytes.NewReader(data))
+	require.NoError(t, err)
+
+	res := &model.Resource{Hash: hash, FileName: "old.zip", Size: len(data), Expiration: -1}
+	require.NoError(t, app.dbm.Create(res))
+
+	token := app.Token(t, "adm1", "111")
+
+	resp, err := app.Req("GET", fmt.Sprintf("/api/file/%d/entries", res.ID), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var entries []*model.PackageEntry
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	require.Len(t, entries, 3)
+	assert.False(t, entries[1].Imported)
+
+	// entries are read from the package, nothing is written
+	assert.Zero(t, app.dbm.PackageEntryQuery().Count())
+
+	resp, err = app.Req("GET", fmt.Sprintf("/api/file/%d/entry?name=files/readme.txt&download=1", res.ID), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+}
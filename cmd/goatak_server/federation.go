@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	peerMinBackoff  = time.Second
+	peerMaxBackoff  = time.Minute * 5
+	peerDialTimeout = time.Second * 5
+)
+
+type Peer struct {
+	conf       *config.PeerConfig
+	connected  atomic.Bool
+	lastMsg    atomic.Pointer[time.Time]
+	received   atomic.Uint64
+	sent       atomic.Uint64
+	dropped    atomic.Uint64
+	reconnects atomic.Uint64
+
+	mx        sync.RWMutex
+	lastError string
+}
+
+type PeerStatus struct {
+	Name        string     `json:"name"`
+	Addr        string     `json:"addr"`
+	Connected   bool       `json:"connected"`
+	LastMessage *time.Time `json:"last_message"`
+	LastError   string     `json:"last_error,omitempty"`
+	Received    uint64     `json:"received"`
+	Sent        uint64     `json:"sent"`
+	Dropped     uint64     `json:"dropped"`
+	Reconnects  uint64     `json:"reconnects"`
+	OutScopes   []string   `json:"out_scopes"`
+}
+
+func NewPeer(conf *config.PeerConfig) *Peer {
+	return &Peer{conf: conf}
+}
+
+func (p *Peer) HandlerName() string {
+	return "peer_" + p.conf.Name
+}
+
+func (p *Peer) setError(err error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if err == nil {
+		p.lastError = ""
+	} else {
+		p.lastError = err.Error()
+	}
+}
+
+func (p *Peer) Status() *PeerStatus {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	return &PeerStatus{
+		Name:        p.conf.Name,
+		Addr:        p.conf.Addr,
+		Connected:   p.connected.Load(),
+		LastMessage: p.lastMsg.Load(),
+		LastError:   p.lastError,
+		Received:    p.received.Load(),
+		Sent:        p.sent.Load(),
+		Dropped:     p.dropped.Load(),
+		Reconnects:  p.reconnects.Load(),
+		OutScopes:   p.conf.OutScopes,
+	}
+}
+
+// peerHandler sends to the peer only messages from allowed scopes.
+type peerHandler struct {
+	*client.ConnClientHandler
+	peer *Peer
+}
+
+func (h *peerHandler) SendMsg(msg *cot.CotMessage) error {
+	if msg.IsLocal() || !h.peer.conf.CanSend(msg.Scope) {
+		return nil
+	}
+
+	if err := h.SendCot(msg.GetTakMessage()); err != nil {
+		return err
+	}
+
+	h.peer.sent.Add(1)
+
+	return nil
+}
+
+func (app *App) startFederation(ctx context.Context) {
+	for _, p := range app.peers {
+		app.logger.Info(fmt.Sprintf("start federation with %s (%s)", p.conf.Name, p.conf.Addr))
+
+		go app.ConnectTo(ctx, p)
+	}
+}
+
+func (app *App) federationEnabled() bool {
+	return app.config.FederationName() != "" || len(app.peers) > 0
+}
+
+func (app *App) federationName() string {
+	if n := app.config.FederationName(); n != "" {
+		return n
+	}
+
+	return "goatak-" + app.uid
+}
+
+func (app *App) getPeer(name string) *Peer {
+	for _, p := range app.peers {
+		if p.HandlerName() == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// federationProcessor drops messages that have already passed this server and marks all others
+// with server's flow tag, so federated servers will not send them back.
+func (app *App) federationProcessor(msg *cot.CotMessage) bool {
+	if msg.IsLocal() {
+		return true
+	}
+
+	name := app.federationName()
+
+	maxHops := app.config.Int("federation.max_hops")
+
+	if msg.HasFlowTag(name) || (maxHops > 0 && msg.FlowHops() >= maxHops) {
+		app.logger.Debug(fmt.Sprintf("drop looped message %s %s from %s", msg.GetType(), msg.GetUID(), msg.From))
+
+		if p := app.getPeer(msg.From); p != nil {
+			p.dropped.Add(1)
+		}
+
+		dropMetric.WithLabelValues(msg.Scope, "federation_loop").Inc()
+
+		return false
+	}
+
+	msg.AddFlowTag(name, time.Now())
+
+	return true
+}
+
+func (app *App) ConnectTo(ctx context.Context, p *Peer) {
+	name := p.HandlerName()
+	logger := app.logger.With("peer", p.conf.Name)
+	backoff := peerMinBackoff
+
+	for ctx.Err() == nil {
+		conn, err := app.dialPeer(p.conf)
+		if err != nil {
+			p.setError(err)
+			logger.Error(fmt.Sprintf("connect error, retry in %s", backoff), slog.Any("error", err))
+
+			if !sleepCtx(ctx, backoff) {
+				return
+			}
+
+			backoff = min(backoff*2, peerMaxBackoff)
+
+			continue
+		}
+
+		logger.Info("connected")
+		p.setError(nil)
+		p.connected.Store(true)
+
+		started := time.Now()
+		done := make(chan struct{})
+
+		h := &peerHandler{peer: p}
+		h.ConnClientHandler = client.NewConnClientHandler(name, conn, &client.HandlerConfig{
+			Device: &model.Device{Login: name, Scope: p.conf.Scope},
+			MessageCb: func(msg *cot.CotMessage) {
+				now := time.Now()
+				p.lastMsg.Store(&now)
+				p.received.Add(1)
+				app.NewCotMessage(msg)
+			},
+			RemoveCb: func(_ client.ClientHandler) {
+				app.RemoveClientHandler(name)
+				close(done)
+			},
+			IsClient:   true,
+			UID:        app.uid,
+			Logger:     logger,
+			DropMetric: dropMetric,
+		})
+
+		app.AddClientHandler(h)
+		h.Start()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			h.Stop()
+			<-done
+		}
+
+		p.connected.Store(false)
+		logger.Info("disconnected")
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		p.reconnects.Add(1)
+
+		if time.Since(started) > peerMaxBackoff {
+			backoff = peerMinBackoff
+		}
+
+		if !sleepCtx(ctx, backoff) {
+			return
+		}
+
+		backoff = min(backoff*2, peerMaxBackoff)
+	}
+}
+
+func (app *App) dialPeer(p *config.PeerConfig) (net.Conn, error) {
+	if !p.IsTLS() {
+		app.logger.Info(fmt.Sprintf("connecting to %s...", p.Addr))
+
+		return net.DialTimeout("tcp", p.Addr, peerDialTimeout)
+	}
+
+	tlsConf, err := p.TLSConfig(app.config.TlsCert, app.config.CertPool)
+	if err != nil {
+		return nil, err
+	}
+
+	app.logger.Info(fmt.Sprintf("connecting with SSL to %s...", p.Addr))
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: peerDialTimeout}, "tcp", p.Addr, tlsConf)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := conn.ConnectionState()
+
+	for i, cert := range cs.PeerCertificates {
+		app.logger.Debug(fmt.Sprintf("cert #%d subject: %s, issuer: %s, dns_names: %s",
+			i, cert.Subject.String(), cert.Issuer.String(), strings.Join(cert.DNSNames, ",")))
+	}
+
+	return conn, nil
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/config"
+)
+
+func TestFederationLoop(t *testing.T) {
+	app := NewTestApp()
+	app.peers = []*Peer{NewPeer(&config.PeerConfig{Name: "hq", Addr: "localhost:8089", OutScopes: []string{"public"}})}
+
+	msg := newCotMessage("public", "uid1", 10, 20)
+	msg.From = "peer_hq"
+
+	require.True(t, app.federationProcessor(msg))
+	require.True(t, msg.HasFlowTag(app.federationName()))
+
+	// the same message returned back by peer
+	require.False(t, app.federationProcessor(msg))
+	assert.Equal(t, uint64(1), app.peers[0].Status().Dropped)
+}
+
+func TestPeerConfig(t *testing.T) {
+	p := &config.PeerConfig{Name: "hq", Addr: "localhost:8089", OutScopes: []string{"public"}}
+	require.NoError(t, p.Validate())
+	assert.True(t, p.IsTLS())
+	assert.True(t, p.CanSend("public"))
+	assert.False(t, p.CanSend("private"))
+
+	require.Error(t, (&config.PeerConfig{Name: "hq", Addr: "localhost"}).Validate())
+	require.Error(t, (&config.PeerConfig{Name: "hq", Addr: "localhost:1", Proto: "udp"}).Validate())
+	require.Error(t, (&config.PeerConfig{Name: "hq", Addr: "localhost:1", Cert: "a.pem"}).Validate())
+
+	_, err := p.TLSConfig(nil, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const GEOFENCE_FROM_UID = "GEOFENCE_UID"
+
+// GeofenceMonitor keeps enabled fences and last known position of units relative to them.
+type GeofenceMonitor struct {
+	mx     sync.RWMutex
+	fences []*model.Geofence
+	inside map[uint]map[string]bool
+}
+
+func NewGeofenceMonitor() *GeofenceMonitor {
+	return &GeofenceMonitor{inside: make(map[uint]map[string]bool)}
+}
+
+func (m *GeofenceMonitor) SetFences(fences []*model.Geofence) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.fences = fences
+
+	inside := make(map[uint]map[string]bool, len(fences))
+
+	for _, f := range fences {
+		if v, ok := m.inside[f.ID]; ok {
+			inside[f.ID] = v
+		} else {
+			inside[f.ID] = make(map[string]bool)
+		}
+	}
+
+	m.inside = inside
+}
+
+// Check returns fences the unit has just entered or left. First position of the unit is not a transition.
+func (m *GeofenceMonitor) Check(scope, uid string, lat, lon float64) (entered, left []*model.Geofence) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	for _, f := range m.fences {
+		if f.Scope != scope {
+			continue
+		}
+
+		in := f.Contains(lat, lon)
+		prev, known := m.inside[f.ID][uid]
+		m.inside[f.ID][uid] = in
+
+		if !known || prev == in {
+			continue
+		}
+
+		if in {
+			entered = append(entered, f)
+		} else {
+			left = append(left, f)
+		}
+	}
+
+	return entered, left
+}
+
+func (m *GeofenceMonitor) Empty() bool {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	return len(m.fences) == 0
+}
+
+func (app *App) reloadGeofences() {
+	app.geofences.SetFences(app.dbm.GeofenceQuery().Enabled().Get())
+}
+
+func (app *App) geofenceProcessor(msg *cot.CotMessage) bool {
+	if app.geofences.Empty() || msg.IsLocal() {
+		return true
+	}
+
+	lat, lon := msg.GetLatLon()
+	if lat == 0 && lon == 0 {
+		return true
+	}
+
+	entered, left := app.geofences.Check(msg.Scope, msg.GetUID(), lat, lon)
+
+	for _, f := range entered {
+		app.geofenceTransition(f, msg, model.GEOFENCE_ENTER)
+	}
+
+	for _, f := range left {
+		app.geofenceTransition(f, msg, model.GEOFENCE_EXIT)
+	}
+
+	return true
+}
+
+// geofenceShapeProcessor updates fences made from drawing shapes when the shape is changed.
+func (app *App) geofenceShapeProcessor(msg *cot.CotMessage) bool {
+	fences := app.dbm.GeofenceQuery().ShapeUID(msg.GetUID()).Scope(msg.Scope).Get()
+
+	if len(fences) == 0 {
+		return true
+	}
+
+	for _, f := range fences {
+		if err := f.UpdateFromShape(msg); err != nil {
+			app.logger.Warn("can't update geofence "+f.Name, slog.Any("error", err))
+
+			continue
+		}
+
+		_ = app.dbm.Save(f)
+	}
+
+	app.reloadGeofences()
+
+	return true
+}
+
+func (app *App) geofenceTransition(f *model.Geofence, msg *cot.CotMessage, event string) {
+	lat, lon := msg.GetLatLon()
+
+	app.logger.Info(fmt.Sprintf("geofence %s: %s %s (%s)", f.Name, event, msg.GetUID(), msg.GetCallsign()))
+
+	_ = app.dbm.Create(&model.GeofenceEvent{
+		GeofenceID: f.ID,
+		Scope:      f.Scope,
+		UID:        msg.GetUID(),
+		Callsign:   msg.GetCallsign(),
+		Type:       msg.GetType(),
+		Event:      event,
+		Lat:        lat,
+		Lon:        lon,
+	})
+
+	text := fmt.Sprintf("%s entered %s", msg.GetCallsign(), f.Name)
+	if event == model.GEOFENCE_EXIT {
+		text = fmt.Sprintf("%s left %s", msg.GetCallsign(), f.Name)
+	}
+
+	if m, err := cot.CotFromProto(makeGeofenceAlert(f, msg, event, text), "", f.Scope); err == nil {
+		app.NewCotMessage(m)
+	}
+
+	chat := &model.ChatMessage{
+		ID:       uuid.NewString(),
+		Time:     time.Now(),
+		Parent:   "RootContactGroup",
+		Chatroom: "All Chat Rooms",
+		From:     "Geofence",
+		FromUID:  GEOFENCE_FROM_UID,
+		ToUID:    "All Chat Rooms",
+		Text:     text,
+	}
+
+	if m, err := cot.CotFromProto(model.MakeChatMessage(chat), "", f.Scope); err == nil {
+		app.NewCotMessage(m)
+	}
+}
+
+func makeGeofenceAlert(f *model.Geofence, msg *cot.CotMessage, event, text string) *cotproto.TakMessage {
+	m := cot.BasicMsg("b-a-g", uuid.NewString(), time.Minute*5)
+	m.CotEvent.How = "m-g"
+	m.CotEvent.Lat, m.CotEvent.Lon = msg.GetLatLon()
+
+	xd := cot.NewXMLDetails()
+	xd.AddPpLink(msg.GetUID(), msg.GetType(), msg.GetCallsign())
+	xd.AddChild("__geofence", map[string]string{"name": f.Name, "event": event, "id": fmt.Sprint(f.ID)}, "")
+	xd.AddChild("remarks", nil, text)
+
+	m.CotEvent.Detail = &cotproto.Detail{
+		XmlDetail: xd.AsXMLString(),
+		Contact:   &cotproto.Contact{Callsign: text},
+	}
+
+	return m
+}
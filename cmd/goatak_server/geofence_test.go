@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestGeofenceTransitions(t *testing.T) {
+	app := NewTestApp()
+
+	f := &model.Geofence{Scope: "scope1", Name: "base", Kind: model.GEOFENCE_CIRCLE, Lat: 50, Lon: 30, Radius: 1000, Enabled: true}
+	require.NoError(t, app.dbm.Create(f))
+	require.NoError(t, app.dbm.Create(&model.Geofence{Scope: "scope1", Name: "off", Kind: model.GEOFENCE_CIRCLE, Lat: 50, Lon: 30, Radius: 1000}))
+	app.reloadGeofences()
+
+	// first position is not a transition
+	app.geofenceProcessor(newCotMessage("scope1", "uid1", 50.1, 30))
+	app.geofenceProcessor(newCotMessage("scope1", "uid1", 50.001, 30))
+	// other scope
+	app.geofenceProcessor(newCotMessage("scope2", "uid2", 50.1, 30))
+	app.geofenceProcessor(newCotMessage("scope2", "uid2", 50.001, 30))
+
+	app.geofenceProcessor(newCotMessage("scope1", "uid1", 50.002, 30))
+	app.geofenceProcessor(newCotMessage("scope1", "uid1", 51, 30))
+
+	events := app.dbm.GeofenceEventQuery().Geofence(f.ID).Get()
+	require.Len(t, events, 2)
+	assert.Equal(t, model.GEOFENCE_EXIT, events[0].Event)
+	assert.Equal(t, model.GEOFENCE_ENTER, events[1].Event)
+	assert.Equal(t, "uid1", events[1].UID)
+
+	// alert and chat for each transition
+	require.Len(t, app.ch, 4)
+
+	alert := <-app.ch
+	assert.Equal(t, "b-a-g", alert.GetType())
+	assert.Equal(t, "scope1", alert.Scope)
+
+	chat := <-app.ch
+	assert.True(t, chat.IsChat())
+	assert.Equal(t, "scope1", chat.Scope)
+}
@@ -1,13 +1,12 @@
 package main
 
 import (
-	"crypto/hmac"
-	"crypto/sha512"
 	"embed"
 	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/kdudkov/goatak/internal/client"
 	"github.com/kdudkov/goatak/internal/repository"
 	"github.com/kdudkov/goatak/pkg/model"
 )
@@ -15,13 +14,18 @@ import (
 //go:embed templates
 var templates embed.FS
 
+// noAuthPaths can be used without admin login, token is checked if it is sent
+var noAuthPaths = []string{"/cot_xml"}
+
 type Connection struct {
-	Addr     string            `json:"addr"`
-	User     string            `json:"user"`
-	Ver      int32             `json:"ver"`
-	Scope    string            `json:"scope"`
-	Uids     map[string]string `json:"uids"`
-	LastSeen *time.Time        `json:"last_seen"`
+	Addr     string             `json:"addr"`
+	User     string             `json:"user"`
+	Ver      int32              `json:"ver"`
+	Scope    string             `json:"scope"`
+	Uids     map[string]string  `json:"uids"`
+	LastSeen *time.Time         `json:"last_seen"`
+	Peer     *PeerStatus        `json:"peer,omitempty"`
+	Queue    *client.QueueStats `json:"queue,omitempty"`
 }
 
 type Listener interface {
@@ -33,23 +37,23 @@ type HttpServer struct {
 	log         *slog.Logger
 	listeners   map[string]Listener
 	userManager repository.AuthRepository
-	tokenKey    []byte
+	tokens      *TokenManager
+	audit       *AuditLog
 	tokenMaxAge time.Duration
 	loginUrl    string
 	noAuth      []string
 }
 
 func NewHttp(app *App) *HttpServer {
-	mac := hmac.New(sha512.New, []byte(randomString(25)))
-
 	srv := &HttpServer{
 		log:         app.logger.With("logger", "http"),
 		listeners:   make(map[string]Listener),
 		userManager: app.users,
-		tokenKey:    mac.Sum(nil),
-		tokenMaxAge: time.Hour * 48,
+		tokens:      app.tokens,
+		audit:       app.audit,
+		tokenMaxAge: app.config.SessionTTL(),
 		loginUrl:    "/login",
-		noAuth:      []string{"/cot_xml"},
+		noAuth:      noAuthPaths,
 	}
 
 	if addr := app.config.String("admin_addr"); addr != "" {
@@ -79,11 +83,13 @@ func (h *HttpServer) Start() {
 	}
 }
 
-func getUnits(app *App) []*model.WebUnit {
+func getUnits(app *App, user *model.Device) []*model.WebUnit {
 	units := make([]*model.WebUnit, 0)
 
 	app.items.ForEach(func(item *model.Item) bool {
-		units = append(units, item.ToWeb())
+		if user.AdminCanSeeScope(item.GetScope()) {
+			units = append(units, item.ToWeb())
+		}
 
 		return true
 	})
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	kmlMaxSize     = model.KmlMaxSize
+	kmzContentType = "application/vnd.google-earth.kmz"
+)
+
+// importKML sends points and shapes from KML/KMZ file as they were received from the client,
+// so they are stored, routed and added to the mission as usual.
+func (app *App) importKML(data []byte, opts *model.KmlImportOpts, mission string) (int, error) {
+	msgs, err := model.ParseKML(data, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	if mission != "" {
+		for _, msg := range msgs {
+			msg.Detail.AddOrChangeChild("marti", nil).AddChild("dest", map[string]string{"mission": mission}, "")
+			msg.TakMessage = msg.GetUpdatedTakMessage()
+		}
+	}
+
+	if n, err := app.importMessages(msgs); err != nil {
+		return n, err
+	}
+
+	app.logger.Info(fmt.Sprintf("%d items imported from %s to scope %s %s", len(msgs), opts.Source, opts.Scope, mission))
+
+	return len(msgs), nil
+}
+
+// scopeItems returns points and units of the scope with their last messages.
+func (app *App) scopeItems(scope string) []*cot.CotMessage {
+	res := make([]*cot.CotMessage, 0)
+
+	app.items.ForEach(func(item *model.Item) bool {
+		if item.GetScope() == scope && item.GetClass() != model.CONTACT {
+			res = append(res, item.GetMsg())
+		}
+
+		return true
+	})
+
+	return res
+}
+
+func missionItems(m *model.Mission) []*cot.CotMessage {
+	res := make([]*cot.CotMessage, 0, len(m.Points))
+
+	for _, p := range m.Points {
+		msg, err := cot.CotFromProto(&cotproto.TakMessage{CotEvent: p.GetEvent()}, "", m.Scope)
+		if err != nil {
+			continue
+		}
+
+		res = append(res, msg)
+	}
+
+	return res
+}
+
+func sendKMZ(ctx *fiber.Ctx, name string, msgs []*cot.CotMessage) error {
+	var b bytes.Buffer
+
+	if err := model.WriteKMZ(&b, name, msgs); err != nil {
+		return err
+	}
+
+	ctx.Attachment(name + ".kmz")
+	ctx.Set(fiber.HeaderContentType, kmzContentType)
+
+	return ctx.Send(b.Bytes())
+}
+
+// kmlUpload returns file from multipart form field "file" or request body.
+func kmlUpload(ctx *fiber.Ctx) ([]byte, string, error) {
+	if !strings.HasPrefix(ctx.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		return ctx.Body(), ctx.Query("name", "import.kml"), nil
+	}
+
+	fh, err := ctx.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+
+	if fh.Size > kmlMaxSize {
+		return nil, "", fmt.Errorf("file is too big")
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+
+	return data, fh.Filename, err
+}
+
+func kmlImportOpts(ctx *fiber.Ctx, name, scope string) (*model.KmlImportOpts, error) {
+	opts := &model.KmlImportOpts{Source: scope + "/" + name, Scope: scope}
+
+	if s := ctx.Query("stale"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stale %s", s)
+		}
+
+		opts.Stale = d
+	}
+
+	return opts, nil
+}
+
+func (app *App) kmlImport(ctx *fiber.Ctx, scope, mission string, user *model.Device) error {
+	data, name, err := kmlUpload(ctx)
+	if err != nil {
+		return SendError(ctx, err.Error())
+	}
+
+	opts, err := kmlImportOpts(ctx, name, scope)
+	if err != nil {
+		return SendError(ctx, err.Error())
+	}
+
+	if uid := ctx.Query("creatorUid"); uid != "" {
+		opts.CreatorUID = uid
+		opts.CreatorCallsign = user.GetLogin()
+	}
+
+	n, err := app.importKML(data, opts, mission)
+	if err != nil {
+		if errors.Is(err, errQueueFull) {
+			return ctx.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"count": n, "error": err.Error()})
+		}
+
+		return SendError(ctx, err.Error())
+	}
+
+	return ctx.JSON(fiber.Map{"count": n})
+}
+
+func getApiKmlImportHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := CtxUser(ctx)
+		scope := ctx.Query("scope")
+
+		if !user.AdminCanSeeScope(scope) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		return app.kmlImport(ctx, scope, "", user)
+	}
+}
+
+func getApiKmlExportHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		scope := ctx.Query("scope")
+
+		if !CtxUser(ctx).AdminCanSeeScope(scope) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		return sendKMZ(ctx, "goatak_"+scope, app.scopeItems(scope))
+	}
+}
+
+func getApiMissionKmlImportHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := CtxUser(ctx)
+
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return err
+		}
+
+		m := app.dbm.MissionQuery().Id(uint(id)).ReadScope(user.AdminScopes()).One()
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		return app.kmlImport(ctx, m.Scope, m.Name, user)
+	}
+}
+
+func getApiMissionKmlExportHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return err
+		}
+
+		m := app.dbm.MissionQuery().Id(uint(id)).ReadScope(CtxUser(ctx).AdminScopes()).Full().One()
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		return sendKMZ(ctx, m.Name, missionItems(m))
+	}
+}
+
+func getKmlImportHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+
+		return app.kmlImport(ctx, user.GetScope(), "", user)
+	}
+}
+
+func getKmlExportHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+
+		return sendKMZ(ctx, "goatak_"+user.GetScope(), app.scopeItems(user.GetScope()))
+	}
+}
+
+func getMissionKmlImportHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+		m := app.dbm.MissionQuery().Scope(user.GetScope()).Name(ctx.Params("missionname")).One()
+
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		if !app.missionAllowed(ctx, user, m, model.PermWrite) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		return app.kmlImport(ctx, m.Scope, m.Name, user)
+	}
+}
+
+func getMissionKmlExportHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+		m := app.dbm.MissionQuery().Scope(user.GetScope()).ReadScope(user.GetReadScope()).
+			Name(ctx.Params("missionname")).Full().One()
+
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		return sendKMZ(ctx, m.Name, missionItems(m))
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const testKml = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+<Document>
+  <Placemark><name>point 1</name><Point><coordinates>30.5,50.25,0</coordinates></Point></Placemark>
+  <Placemark><name>point 2</name><Point><coordinates>31.5,51.25,0</coordinates></Point></Placemark>
+  <Placemark><name>line</name><LineString><coordinates>30,50 31,50 31,51</coordinates></LineString></Placemark>
+</Document>
+</kml>`
+
+// drain processes all messages sent to the main channel.
+func (app *TestApp) drain() int {
+	n := 0
+
+	for {
+		select {
+		case msg := <-app.ch:
+			app.processMessage(msg)
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+func kmlUploadReq(url, token string) *http.Request {
+	var b bytes.Buffer
+
+	w := multipart.NewWriter(&b)
+	fw, _ := w.CreateFormFile("file", "test.kml")
+	_, _ = fw.Write([]byte(testKml))
+	_ = w.Close()
+
+	req, _ := http.NewRequest("POST", url, &b)
+	req.Header.Set(fiber.HeaderContentType, w.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+func TestKmlImportExport(t *testing.T) {
+	app := NewTestApp()
+	app.InitMessageProcessors()
+
+	token := app.Token(t, "adm1", "111")
+
+	resp, err := app.api.f.Test(kmlUploadReq("/api/kml", token), 3000)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var res map[string]int
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Equal(t, 3, res["count"])
+	assert.Equal(t, 3, app.drain())
+
+	names := make(map[string]string)
+
+	app.items.ForEach(func(item *model.Item) bool {
+		names[item.GetCallsign()] = item.GetType()
+
+		return true
+	})
+
+	assert.Equal(t, model.KmlPointType, names["point 1"])
+	assert.Equal(t, model.KmlShapeType, names["line"])
+
+	resp, err = app.Req("GET", "/api/kml", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, kmzContentType, resp.Header.Get(fiber.HeaderContentType))
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	msgs, err := model.ParseKML(b, &model.KmlImportOpts{Source: "export"})
+	require.NoError(t, err)
+	assert.Len(t, msgs, 3)
+
+	resp, err = app.Req("GET", "/api/kml?scope=other", token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp, err = app.Req("POST", "/api/kml", token, bytes.NewBufferString("<kml></kml>"))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotAcceptable, resp.StatusCode)
+}
+
+func TestKmlMissionImport(t *testing.T) {
+	app := NewTestApp()
+	app.InitMessageProcessors()
+
+	m := &model.Mission{Name: "mission1", Creator: "usr1"}
+	require.NoError(t, app.dbm.CreateMission(m))
+
+	token := app.Token(t, "adm1", "111")
+
+	resp, err := app.api.f.Test(kmlUploadReq(fmt.Sprintf("/api/mission/%d/kml", m.ID), token), 3000)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	app.drain()
+
+	m1 := app.dbm.MissionQuery().Id(m.ID).Full().One()
+	require.NotNil(t, m1)
+	assert.Len(t, m1.Points, 3)
+
+	resp, err = app.Req("GET", fmt.Sprintf("/api/mission/%d/kml", m.ID), token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	msgs, err := model.ParseKML(b, &model.KmlImportOpts{Source: "export"})
+	require.NoError(t, err)
+	assert.Len(t, msgs, 3)
+
+	// marti api for mission
+	f := fiber.New()
+	f.Use(func(c *fiber.Ctx) error {
+		c.Locals(UsernameKey, "usr1")
+
+		return c.Next()
+	})
+	addMartiRoutes(app.App, f)
+
+	req, _ := http.NewRequest("PUT", "/Marti/api/missions/mission1/kml?name=a.kml", bytes.NewBufferString(testKml))
+	resp, err = f.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = f.Test(httpGet("/Marti/api/missions/nomission/kml"))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
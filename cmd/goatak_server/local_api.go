@@ -55,7 +55,12 @@ func getCotPostHandler(app *App) fiber.Handler {
 			return err
 		}
 
+		if u := CtxUser(ctx); u != nil && !u.AdminCanSeeScope(c.Scope) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
 		app.NewCotMessage(c)
+		app.audit.Add(cotAuditEvent(ctx, c))
 
 		return nil
 	}
@@ -2,34 +2,38 @@ package main
 
 import (
 	"context"
-	"crypto"
-	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"log/slog"
-	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
-	"software.sslmate.com/src/go-pkcs12"
 
 	"github.com/kdudkov/goatak/internal/client"
 	"github.com/kdudkov/goatak/internal/config"
 	"github.com/kdudkov/goatak/internal/database"
 	"github.com/kdudkov/goatak/internal/pm"
 	"github.com/kdudkov/goatak/internal/repository"
+	"github.com/kdudkov/goatak/internal/rules"
 	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotlog"
 	"github.com/kdudkov/goatak/pkg/model"
 )
 
+const importTimeout = time.Second * 5
+
+var errQueueFull = errors.New("message queue is full")
+
 type App struct {
 	logger *slog.Logger
 	files  *pm.BlobManager
@@ -40,10 +44,18 @@ type App struct {
 
 	handlers sync.Map
 
-	items    repository.ItemsRepository
-	messages []*model.ChatMessage
-	dbm      *database.DatabaseManager
-	users    repository.DeviceRepository
+	items  repository.ItemsRepository
+	dbm    *database.DatabaseManager
+	users  repository.DeviceRepository
+	tokens *TokenManager
+	audit  *AuditLog
+	peers  []*Peer
+	rules  *rules.Engine
+
+	geofences *GeofenceMonitor
+	tracks    *repository.TrackWriter
+	cotLog    *cotlog.Writer
+	retention atomic.Pointer[RetentionStats]
 
 	uid             string
 	ch              chan *cot.CotMessage
@@ -54,14 +66,21 @@ func NewApp(config *config.AppConfig) *App {
 	app := &App{
 		logger:          slog.Default(),
 		config:          config,
-		files:           pm.NewBlobManages(filepath.Join(config.DataDir(), "blob")),
 		ch:              make(chan *cot.CotMessage, 100),
 		handlers:        sync.Map{},
-		items:           repository.NewItemsMemoryRepo(),
 		uid:             uuid.NewString(),
 		eventProcessors: make([]*EventProcessor, 0),
+		rules:           rules.NewEngine(rulesMetric),
+		geofences:       NewGeofenceMonitor(),
 	}
 
+	store, err := newBlobStore(config, config.BlobStoreType())
+	if err != nil {
+		panic(err)
+	}
+
+	app.files = pm.NewBlobManager(store)
+
 	db, err := database.GetDatabase(config.String("db"), false)
 
 	if err != nil {
@@ -74,8 +93,66 @@ func NewApp(config *config.AppConfig) *App {
 	}
 
 	app.dbm.AddDefaults()
+	app.reloadGeofences()
+	app.updateAlertsMetric()
+
+	if config.LogAll() {
+		app.cotLog = cotlog.NewWriter(cotlog.WriterOpts{
+			Dir:      filepath.Join(config.DataDir(), "log"),
+			MaxSize:  config.LogMaxSize(),
+			MaxAge:   config.LogMaxAge(),
+			Compress: config.Bool("log_compress"),
+			Source:   "goatak_server " + getVersion(),
+		})
+	}
+
+	if config.TrackHistory() {
+		app.tracks = repository.NewTrackWriter(app.dbm)
+	}
+
+	if config.PersistItems() {
+		r := repository.NewItemsDbRepo(app.dbm)
+
+		// track points are written by track history
+		if app.tracks != nil {
+			r.WithoutTrack()
+		}
+
+		app.items = r
+	} else {
+		app.items = repository.NewItemsMemoryRepo()
+	}
+
+	users := repository.NewUserDbRepository(config.UsersFile(), app.dbm)
 
-	app.users = repository.NewUserDbRepository(config.UsersFile(), app.dbm)
+	backends, err := newAuthBackends(config, users)
+	if err != nil {
+		panic(err)
+	}
+
+	users.SetBackends(backends...)
+	app.users = users
+
+	if app.tokens, err = NewTokenManager(app.dbm, config.TokenKeyRotation(), config.SessionTTL()); err != nil {
+		panic(err)
+	}
+
+	if app.audit, err = NewAuditLog(app.dbm, config.AuditFile()); err != nil {
+		panic(err)
+	}
+
+	peers, err := config.Connections()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, c := range peers {
+		app.peers = append(app.peers, NewPeer(c))
+	}
+
+	if err := app.loadRules(config); err != nil {
+		panic(err)
+	}
 
 	return app
 }
@@ -91,6 +168,12 @@ func (app *App) Run() {
 		log.Fatal(err)
 	}
 
+	prometheus.MustRegister(newQueueCollector(app), newStorageCollector(app))
+
+	if app.tracks != nil {
+		app.tracks.Start()
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	if addr := app.config.String("udp_addr"); addr != "" {
@@ -121,9 +204,26 @@ func (app *App) Run() {
 
 	go app.messageProcessLoop()
 
-	for _, c := range app.config.Connections() {
-		app.logger.Info("start external connection to " + c)
-		go app.ConnectTo(ctx, c)
+	app.startFederation(ctx)
+
+	go app.cleanOutbox(ctx)
+
+	if app.cotLog != nil {
+		go app.flushCotLog(ctx)
+	}
+
+	if ttl := app.trackTTL(); ttl > 0 {
+		go app.cleanTracks(ctx, ttl)
+	}
+
+	if app.config.RetentionInterval() > 0 {
+		go app.retentionLoop(ctx)
+	}
+
+	go app.tokenLoop(ctx)
+
+	if err := app.watchRules(ctx); err != nil {
+		app.logger.Error("can't watch config file", slog.Any("error", err))
 	}
 
 	c := make(chan os.Signal, 1)
@@ -131,6 +231,21 @@ func (app *App) Run() {
 	<-c
 	app.logger.Info("exiting...")
 	cancel()
+	app.items.Stop()
+
+	if app.tracks != nil {
+		app.tracks.Stop()
+	}
+
+	if app.cotLog != nil {
+		if err := app.cotLog.Close(); err != nil {
+			app.logger.Error("error closing cot log", slog.Any("error", err))
+		}
+	}
+
+	if err := app.audit.Close(); err != nil {
+		app.logger.Error("error closing audit file", slog.Any("error", err))
+	}
 }
 
 func (app *App) NewCotMessage(msg *cot.CotMessage) {
@@ -151,6 +266,22 @@ func (app *App) NewCotMessage(msg *cot.CotMessage) {
 	}
 }
 
+// importMessages sends messages to processing like NewCotMessage, but waits for the free space in the queue
+// instead of dropping them.
+func (app *App) importMessages(msgs []*cot.CotMessage) (int, error) {
+	for i, msg := range msgs {
+		messagesMetric.With(prometheus.Labels{"scope": msg.Scope, "msg_type": msg.GetType()}).Inc()
+
+		select {
+		case app.ch <- msg:
+		case <-time.After(importTimeout):
+			return i, errQueueFull
+		}
+	}
+
+	return len(msgs), nil
+}
+
 func (app *App) AddClientHandler(ch client.ClientHandler) {
 	app.handlers.Store(ch.GetName(), ch)
 	connectionsMetric.With(prometheus.Labels{"scope": ch.GetDevice().GetScope()}).Inc()
@@ -191,116 +322,9 @@ func (app *App) RemoveHandlerCb(cl client.ClientHandler) {
 
 func (app *App) NewContactCb(uid, callsign string) {
 	app.logger.Info(fmt.Sprintf("new contact: %s %s", uid, callsign))
-}
-
-func (app *App) ConnectTo(ctx context.Context, addr string) {
-	name := "ext_" + addr
 
-	for ctx.Err() == nil {
-		conn, err := app.connect(addr)
-		if err != nil {
-			app.logger.Error("connect error", slog.Any("error", err))
-			time.Sleep(time.Second * 5)
-
-			continue
-		}
-
-		app.logger.Info("connected")
-
-		wg := &sync.WaitGroup{}
-		wg.Add(1)
-
-		h := client.NewConnClientHandler(name, conn, &client.HandlerConfig{
-			MessageCb: app.NewCotMessage,
-			RemoveCb: func(ch client.ClientHandler) {
-				wg.Done()
-				app.handlers.Delete(name)
-				app.logger.Info("disconnected")
-			},
-			IsClient: true,
-			UID:      app.uid,
-		})
-
-		go h.Start()
-		app.AddClientHandler(h)
-
-		wg.Wait()
-	}
-}
-
-func (app *App) connect(connectStr string) (net.Conn, error) {
-	parts := strings.Split(connectStr, ":")
-
-	if len(parts) != 3 {
-		return nil, fmt.Errorf("invalid connect string: %s", connectStr)
-	}
-
-	var tlsConn bool
-
-	switch parts[2] {
-	case "tcp":
-		tlsConn = false
-	case "ssl":
-		tlsConn = true
-	default:
-		return nil, fmt.Errorf("invalid connect string: %s", connectStr)
-	}
-
-	addr := net.JoinHostPort(parts[0], parts[1])
-
-	if tlsConn {
-		app.logger.Info(fmt.Sprintf("connecting with SSL to %s...", connectStr))
-
-		conn, err := tls.Dial("tcp", addr, app.getTLSConfig())
-		if err != nil {
-			return nil, err
-		}
-
-		app.logger.Debug("handshake...")
-
-		if err := conn.Handshake(); err != nil {
-			return conn, err
-		}
-
-		cs := conn.ConnectionState()
-
-		app.logger.Info(fmt.Sprintf("Handshake complete: %t", cs.HandshakeComplete))
-		app.logger.Info(fmt.Sprintf("version: %d", cs.Version))
-
-		for i, cert := range cs.PeerCertificates {
-			app.logger.Info(fmt.Sprintf("cert #%d subject: %s", i, cert.Subject.String()))
-			app.logger.Info(fmt.Sprintf("cert #%d issuer: %s", i, cert.Issuer.String()))
-			app.logger.Info(fmt.Sprintf("cert #%d dns_names: %s", i, strings.Join(cert.DNSNames, ",")))
-		}
-
-		return conn, nil
-	}
-
-	app.logger.Info(fmt.Sprintf("connecting to %s...", connectStr))
-
-	return net.DialTimeout("tcp", addr, time.Second*3)
-}
-
-func (app *App) getTLSConfig() *tls.Config {
-	p12Data, err := os.ReadFile(app.config.String("ssl.cert"))
-	if err != nil {
-		app.logger.Error(err.Error())
-		panic(err)
-	}
-
-	key, cert, _, err := pkcs12.DecodeChain(p12Data, app.config.String("ssl.password"))
-	if err != nil {
-		app.logger.Error(err.Error())
-		panic(err)
-	}
-
-	tlsCert := tls.Certificate{ //nolint:exhaustruct,typeassert
-		Certificate: [][]byte{cert.Raw},
-		PrivateKey:  key.(crypto.PrivateKey),
-		Leaf:        cert,
-	}
-
-	return &tls.Config{Certificates: []tls.Certificate{tlsCert}, InsecureSkipVerify: true} //nolint:exhaustruct
+	go app.flushOutbox(uid, callsign)
+	go app.sendActiveAlerts(uid)
 }
 
 func (app *App) messageProcessLoop() {
@@ -310,6 +334,13 @@ func (app *App) messageProcessLoop() {
 }
 
 func (app *App) route(msg *cot.CotMessage) bool {
+	if len(msg.DestLogins) > 0 {
+		app.logger.Debug(fmt.Sprintf("msg %s %s -> logins %s", msg.GetUID(), msg.GetCallsign(), strings.Join(msg.DestLogins, ",")))
+		app.sendToLogins(msg.DestLogins, msg)
+
+		return true
+	}
+
 	if missions := msg.GetDetail().GetDestMission(); len(missions) > 0 {
 		app.logger.Debug(fmt.Sprintf("point %s %s: missions: %s", msg.GetUID(), msg.GetCallsign(), strings.Join(missions, ",")))
 
@@ -323,7 +354,10 @@ func (app *App) route(msg *cot.CotMessage) bool {
 	if dest := msg.GetDetail().GetDestCallsign(); len(dest) > 0 {
 		for _, s := range dest {
 			app.logger.Info(fmt.Sprintf("msg %s %s -> callsign %s", msg.GetUID(), msg.GetCallsign(), s))
-			app.sendToCallsign(s, msg)
+
+			if !app.sendToCallsign(s, msg) {
+				app.storeForContact("", s, msg)
+			}
 		}
 
 		return true
@@ -331,6 +365,10 @@ func (app *App) route(msg *cot.CotMessage) bool {
 
 	app.sendBroadcast(msg)
 
+	for _, scope := range msg.CopyScopes {
+		app.sendCopy(scope, msg)
+	}
+
 	return true
 }
 
@@ -379,7 +417,8 @@ func (app *App) sendBroadcast(msg *cot.CotMessage) {
 	})
 }
 
-func (app *App) sendToCallsign(callsign string, msg *cot.CotMessage) {
+// sendToCallsign returns false if there is no such contact online.
+func (app *App) sendToCallsign(callsign string, msg *cot.CotMessage) bool {
 	var found bool
 
 	app.ForAllClients(func(ch client.ClientHandler) bool {
@@ -396,11 +435,17 @@ func (app *App) sendToCallsign(callsign string, msg *cot.CotMessage) {
 	if !found {
 		app.logger.Warn("callsign " + callsign + " is not found")
 	}
+
+	return found
 }
 
-func (app *App) sendToUID(uid string, msg *cot.CotMessage) {
+// sendToUID returns false if there is no contact with this uid online that can see message scope.
+func (app *App) sendToUID(uid string, msg *cot.CotMessage) bool {
+	var found bool
+
 	app.ForAllClients(func(ch client.ClientHandler) bool {
-		if ch.HasUID(uid) {
+		if ch.HasUID(uid) && (msg.IsLocal() || ch.GetDevice().CanSeeScope(msg.Scope)) {
+			found = true
 			if err := ch.SendMsg(msg); err != nil {
 				app.logger.Error("send error", slog.Any("error", err))
 			}
@@ -408,6 +453,8 @@ func (app *App) sendToUID(uid string, msg *cot.CotMessage) {
 
 		return true
 	})
+
+	return found
 }
 
 func (app *App) checkUID(uid string) bool {
@@ -433,6 +480,24 @@ func main() {
 		panic(err)
 	}
 
+	if flag.Arg(0) == "ca" {
+		if err := runCa(conf, flag.Args()[1:]); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if flag.Arg(0) == "blob" {
+		if err := runBlob(conf, flag.Args()[1:]); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	var h slog.Handler
 	if conf.Bool("debug") {
 		h = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
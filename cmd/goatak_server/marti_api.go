@@ -3,10 +3,12 @@ package main
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -44,7 +46,7 @@ func (h *HttpServer) NewMartiAPI(app *App, addr string) *MartiAPI {
 		f: fiber.New(fiber.Config{
 			EnablePrintRoutes:     false,
 			DisableStartupMessage: true,
-			BodyLimit:             64 * 1024 * 1024,
+			BodyLimit:             bodyLimit(app.config.MaxUploadSize()),
 			StreamRequestBody:     true}),
 		addr: addr,
 	}
@@ -66,6 +68,15 @@ func (h *HttpServer) NewMartiAPI(app *App, addr string) *MartiAPI {
 	return api
 }
 
+// bodyLimit is the request body limit for the max upload size, with some space for multipart headers.
+func bodyLimit(size int64) int {
+	if size <= 0 || size > math.MaxInt32 {
+		return math.MaxInt32
+	}
+
+	return int(size) + 1024*1024
+}
+
 func (api *MartiAPI) Address() string {
 	return api.addr
 }
@@ -100,6 +111,9 @@ func addMartiRoutes(app *App, f fiber.Router) {
 	f.Get("/Marti/sync/content", getContentGetHandler(app))
 	f.Post("/Marti/sync/upload", getUploadHandler(app))
 	f.Get("/Marti/api/cot/xml/:uid", getXmlHandler(app))
+	f.Get("/Marti/api/cot/xml/:uid/all", getXmlHistoryHandler(app))
+	f.Get("/Marti/api/kml", getKmlExportHandler(app))
+	f.Put("/Marti/api/kml", getKmlImportHandler(app))
 	f.Get("/Marti/api/sync/metadata/:hash/:name", getMetadataGetHandler(app))
 	f.Put("/Marti/api/sync/metadata/:hash/:name", getMetadataPutHandler(app))
 
@@ -220,11 +234,15 @@ func getMissionUploadHandler(app *App) fiber.Handler {
 		c, err := app.uploadMultipart(ctx, "", hash, fname, true)
 		if err != nil {
 			app.logger.Error("error", slog.Any("error", err))
-			return ctx.SendStatus(fiber.StatusNotAcceptable)
+			return uploadError(ctx, err)
 		}
 
 		app.logger.Info(fmt.Sprintf("save packege %s %s %s", c.FileName, c.UID, c.Hash))
 
+		if err := app.ingestPackage(c); err != nil {
+			app.logger.Warn("can't read package "+c.FileName, slog.Any("error", err))
+		}
+
 		return ctx.SendString(resourceUrl(ctx.BaseURL(), c))
 	}
 }
@@ -252,7 +270,7 @@ func getUploadHandler(app *App) fiber.Handler {
 			c, err := app.uploadMultipart(ctx, uid, "", fname, false)
 			if err != nil {
 				app.logger.Error("multipart upload error", slog.Any("error", err))
-				return ctx.SendStatus(fiber.StatusNotAcceptable)
+				return uploadError(ctx, err)
 			}
 			return ctx.SendString(resourceUrl(ctx.BaseURL(), c))
 
@@ -261,7 +279,7 @@ func getUploadHandler(app *App) fiber.Handler {
 			c, err := app.uploadFile(ctx, uid, fname)
 			if err != nil {
 				app.logger.Error("raw upload error", slog.Any("error", err))
-				return ctx.SendStatus(fiber.StatusNotAcceptable)
+				return uploadError(ctx, err)
 			}
 			return ctx.SendString(resourceUrl(ctx.BaseURL(), c))
 		}
@@ -287,6 +305,11 @@ func (app *App) uploadMultipart(ctx *fiber.Ctx, uid, hash, filename string, pack
 		return nil, err
 	}
 
+	if _, err := app.checkQuota(user.GetScope(), user.GetLogin(), fh.Size); err != nil {
+		countQuotaError(user.GetScope(), err)
+		return nil, err
+	}
+
 	// Check if this is a video file that should go to data/videos
 	isVideoForTools := strings.Contains(filename, "webcam-recording")
 
@@ -431,8 +454,15 @@ func (app *App) uploadFile(ctx *fiber.Ctx, uid, filename string) (*model.Resourc
 		slog.String("filename", filename),
 		slog.String("keywords_received", keywords))
 
-	hash, n, err := app.files.PutFile(user.GetScope(), "", ctx.Context().RequestBodyStream())
+	limit, err := app.checkQuota(user.GetScope(), user.GetLogin(), max(int64(ctx.Request().Header.ContentLength()), -1))
 	if err != nil {
+		countQuotaError(user.GetScope(), err)
+		return nil, err
+	}
+
+	hash, n, err := app.files.PutFile(user.GetScope(), "", limit.Reader(ctx.Context().RequestBodyStream()))
+	if err != nil {
+		countQuotaError(user.GetScope(), err)
 		app.logger.Error("save file error", slog.Any("error", err))
 		return nil, err
 	}
@@ -754,6 +784,35 @@ func getXmlHandler(app *App) fiber.Handler {
 	}
 }
 
+type cotEvents struct {
+	XMLName xml.Name     `xml:"events"`
+	Events  []*cot.Event `xml:"event"`
+}
+
+// getXmlHistoryHandler returns all stored positions of the item between start and end.
+func getXmlHistoryHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+
+		q := app.dbm.TrackQuery().ReadScope([]string{user.GetScope()}).ReadScope(user.GetReadScope()).
+			Order("time").Limit(10000)
+
+		if err := setTrackFilter(ctx, q); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+
+		q.UID(ctx.Params("uid"))
+
+		res := &cotEvents{Events: make([]*cot.Event, 0)}
+
+		for _, p := range q.Get() {
+			res.Events = append(res.Events, p.Event())
+		}
+
+		return ctx.XML(res)
+	}
+}
+
 func resourceUrl(root string, c *model.Resource) string {
 	return fmt.Sprintf("%s/Marti/sync/content?hash=%s", root, c.Hash)
 }
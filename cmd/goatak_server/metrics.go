@@ -2,6 +2,7 @@
 package main
 
 import (
+	"log/slog"
 	"strconv"
 	"time"
 
@@ -9,6 +10,8 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/savsgio/gotils/strings"
+
+	"github.com/kdudkov/goatak/internal/client"
 )
 
 var (
@@ -30,6 +33,48 @@ var (
 		Help:      "The total number of connections",
 	}, []string{"scope"})
 
+	rulesMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "goatak",
+		Name:      "rule_matches",
+		Help:      "The total number of messages matched by routing rule",
+	}, []string{"rule", "action"})
+
+	outboxMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "goatak",
+		Name:      "outbox_messages",
+		Help:      "The total number of messages stored for offline contacts, delivered and expired",
+	}, []string{"event"})
+
+	alertsMetric = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "goatak",
+		Name:      "alerts_open",
+		Help:      "The number of active emergency alerts",
+	}, []string{"scope"})
+
+	retentionFilesMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "goatak",
+		Name:      "retention_files_removed",
+		Help:      "The total number of files and blobs removed by retention job or admin",
+	}, []string{"reason"})
+
+	retentionBytesMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "goatak",
+		Name:      "retention_reclaimed_bytes",
+		Help:      "The total size of removed blobs",
+	}, []string{"reason"})
+
+	quotaRejectedMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "goatak",
+		Name:      "quota_rejected_uploads",
+		Help:      "The total number of uploads rejected by storage quotas",
+	}, []string{"scope", "reason"})
+
+	auditMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "goatak",
+		Name:      "audit_events",
+		Help:      "The total number of audit events",
+	}, []string{"action"})
+
 	httpRequestsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: "goatak",
 		Subsystem: "http",
@@ -55,3 +100,85 @@ func NewMetricHandler(api string) fiber.Handler {
 		return chainErr
 	}
 }
+
+// queueCollector reports send queues of connected clients, so metrics of disconnected ones are gone with them.
+type queueCollector struct {
+	app     *App
+	depth   *prometheus.Desc
+	dropped *prometheus.Desc
+}
+
+func newQueueCollector(app *App) *queueCollector {
+	labels := []string{"client", "login", "scope", "class"}
+
+	return &queueCollector{
+		app:     app,
+		depth:   prometheus.NewDesc("goatak_client_queue_depth", "The number of messages in client send queue", labels, nil),
+		dropped: prometheus.NewDesc("goatak_client_queue_dropped", "The total number of messages dropped from client send queue", labels, nil),
+	}
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.depth
+	ch <- c.dropped
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.app.ForAllClients(func(h client.ClientHandler) bool {
+		s := h.GetQueueStats()
+		if s == nil {
+			return true
+		}
+
+		for class, cs := range s.Classes {
+			lv := []string{h.GetName(), h.GetDevice().GetLogin(), h.GetDevice().GetScope(), class}
+			ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, float64(cs.Depth), lv...)
+			ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(cs.Dropped), lv...)
+		}
+
+		return true
+	})
+}
+
+// storageCollector reports files usage and quotas of scopes from the database.
+type storageCollector struct {
+	app   *App
+	files *prometheus.Desc
+	bytes *prometheus.Desc
+	quota *prometheus.Desc
+}
+
+func newStorageCollector(app *App) *storageCollector {
+	labels := []string{"scope"}
+
+	return &storageCollector{
+		app:   app,
+		files: prometheus.NewDesc("goatak_storage_files", "The number of stored files", labels, nil),
+		bytes: prometheus.NewDesc("goatak_storage_bytes", "The total size of stored files", labels, nil),
+		quota: prometheus.NewDesc("goatak_storage_quota_bytes", "The storage quota of the scope", labels, nil),
+	}
+}
+
+func (c *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.files
+	ch <- c.bytes
+	ch <- c.quota
+}
+
+func (c *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	usage, err := c.app.dbm.ScopeFilesUsage("")
+	if err != nil {
+		c.app.logger.Error("can't get files usage", slog.Any("error", err))
+
+		return
+	}
+
+	for scope, u := range usage {
+		ch <- prometheus.MustNewConstMetric(c.files, prometheus.GaugeValue, float64(u.Files), scope)
+		ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(u.Bytes), scope)
+
+		if q := c.app.config.ScopeQuota(scope); q.MaxBytes > 0 {
+			ch <- prometheus.MustNewConstMetric(c.quota, prometheus.GaugeValue, float64(q.MaxBytes), scope)
+		}
+	}
+}
@@ -14,8 +14,10 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"github.com/kdudkov/goatak/internal/client"
 	"github.com/kdudkov/goatak/pkg/cot"
 	"github.com/kdudkov/goatak/pkg/model"
+	"github.com/kdudkov/goatak/pkg/util"
 )
 
 const (
@@ -33,6 +35,9 @@ func addMissionApi(app *App, f fiber.Router) {
 	g.Get("/", getMissionsHandler(app))
 	g.Get("/all/invitations", getMissionsInvitationsHandler(app))
 
+	addLogEntryRoutes(app, g.Group("/logs/entries"))
+	addLogEntryRoutes(app, f.Group("/Marti/api/missionlogs/entries"))
+
 	g.Get("/:missionname", getMissionHandler(app))
 	g.Put("/:missionname", getMissionPutHandler(app))
 	g.Delete("/:missionname", getMissionDeleteHandler(app))
@@ -42,8 +47,15 @@ func addMissionApi(app *App, f fiber.Router) {
 	g.Put("/:missionname/contents", getMissionContentPutHandler(app))
 	g.Put("/:missionname/contents/missionpackage", getMissionContentPackagePutHandler(app))
 	g.Delete("/:missionname/contents", getMissionContentDeleteHandler(app))
+	g.Get("/:missionname/kml", getMissionKmlExportHandler(app))
+	g.Put("/:missionname/kml", getMissionKmlImportHandler(app))
 	g.Get("/:missionname/log", getMissionLogHandler(app))
+	g.Post("/:missionname/log", getMissionLogPostHandler(app))
+	g.Put("/:missionname/log/:id", getMissionLogPutHandler(app))
+	g.Delete("/:missionname/log/:id", getMissionLogDeleteHandler(app))
 	g.Put("/:missionname/keywords", getMissionKeywordsPutHandler(app))
+	g.Put("/:missionname/password", getMissionPasswordPutHandler(app))
+	g.Delete("/:missionname/password", getMissionPasswordDeleteHandler(app))
 	g.Get("/:missionname/role", getMissionRoleHandler(app))
 	g.Put("/:missionname/role", getMissionRolePutHandler(app))
 	g.Get("/:missionname/subscription", getMissionSubscriptionHandler(app))
@@ -55,6 +67,87 @@ func addMissionApi(app *App, f fiber.Router) {
 	g.Delete("/:missionname/invite/:type/:uid", getInviteDeleteHandler(app))
 }
 
+// clientUID returns uid of the client making the request, ATAK sends it with different names.
+func clientUID(ctx *fiber.Ctx) string {
+	return util.FirstString(queryIgnoreCase(ctx, "creatorUid"), queryIgnoreCase(ctx, "clientUid"))
+}
+
+// missionRole returns the role of the user in the mission. Without login (no auth mode) the role of
+// subscription with given client uid is used. Missions from read scopes are read only.
+func (app *App) missionRole(user *model.Device, m *model.Mission, uid string) *model.MissionRoleDTO {
+	if m.Scope != user.GetScope() {
+		return model.GetRole(model.RoleReadOnly)
+	}
+
+	var role string
+
+	switch login := user.GetLogin(); {
+	case login != "" && m.Creator == login:
+		role = model.RoleOwner
+	case login != "":
+		role = app.dbm.UserRole(m.ID, login)
+	case uid != "":
+		if s := app.dbm.SubscriptionQuery().Mission(m.ID).Client(uid).One(); s != nil {
+			role = s.Role
+		}
+	}
+
+	if role == "" {
+		role = model.RoleReadOnly
+	}
+
+	return model.GetRole(role)
+}
+
+// invitationFor returns the invitation to the mission addressed to the user's login or to the client uid of the user.
+func (app *App) invitationFor(user *model.Device, m *model.Mission, uid string) *model.Invitation {
+	for _, inv := range app.dbm.InvitationQuery().Mission(m.ID).Get() {
+		switch inv.Typ {
+		case "clientUid":
+			if inv.Invitee == uid && app.ownsUID(user, uid) {
+				return inv
+			}
+		case "userName":
+			if inv.Invitee == user.GetLogin() {
+				return inv
+			}
+		}
+	}
+
+	return nil
+}
+
+// ownsUID checks that the client is connected with user's credentials or has the certificate of the user.
+func (app *App) ownsUID(user *model.Device, uid string) bool {
+	login := user.GetLogin()
+
+	if uid == "" || login == "" {
+		return false
+	}
+
+	found := false
+
+	app.ForAllClients(func(ch client.ClientHandler) bool {
+		if ch.GetDevice().GetLogin() == login && ch.HasUID(uid) {
+			found = true
+		}
+
+		return !found
+	})
+
+	return found || app.dbm.CertsQuery().Login(login).UID(uid).Count() > 0
+}
+
+func (app *App) missionAllowed(ctx *fiber.Ctx, user *model.Device, m *model.Mission, perm string) bool {
+	if app.missionRole(user, m, clientUID(ctx)).Has(perm) {
+		return true
+	}
+
+	app.logger.Warn(fmt.Sprintf("user %s has no %s permission for mission %s", user.GetLogin(), perm, m.Name))
+
+	return false
+}
+
 func getMissionsHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		user := app.users.Get(Username(ctx))
@@ -115,7 +208,6 @@ func getMissionPutHandler(app *App) fiber.Handler {
 			Classification: ctx.Query("classification"),
 			Description:    ctx.Query("description"),
 			InviteOnly:     ctx.QueryBool("inviteOnly", false),
-			Password:       ctx.Query("password"),
 			Path:           ctx.Query("path"),
 			Tool:           ctx.Query("tool"),
 			Groups:         "",
@@ -123,6 +215,10 @@ func getMissionPutHandler(app *App) fiber.Handler {
 			Token:          uuid.NewString(),
 		}
 
+		if err := m.SetPassword(ctx.Query("password")); err != nil {
+			return err
+		}
+
 		if err := app.dbm.CreateMission(m); err != nil {
 			app.logger.Warn("mission add error", slog.Any("error", err))
 			return ctx.Status(fiber.StatusConflict).SendString(err.Error())
@@ -147,6 +243,10 @@ func getMissionDeleteHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		if !app.missionAllowed(ctx, user, m, model.PermDelete) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
 		app.dbm.MissionQuery().Delete(m.ID)
 
 		return ctx.JSON(makeAnswer(missionType, []*model.MissionDTO{model.ToMissionDTO(m, false)}))
@@ -171,37 +271,42 @@ func getMissionRoleHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
-		return ctx.JSON(makeAnswer(missionRoleType, model.GetRole("")))
+		return ctx.JSON(makeAnswer(missionRoleType, app.missionRole(user, m, clientUID(ctx))))
 	}
 }
 
+// getMissionRolePutHandler sets the role of subscriber with clientUid, role is checked for the user
+// or for creatorUid in no auth mode.
 func getMissionRolePutHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		user := app.users.Get(Username(ctx))
 		m := app.dbm.MissionQuery().Scope(user.GetScope()).ReadScope(user.GetReadScope()).
-			Name(ctx.Params("missionname")).Full().One()
+			Name(ctx.Params("missionname")).One()
 
 		if m == nil {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
-		return ctx.JSON(makeAnswer(missionRoleType, model.GetRole("")))
-	}
-}
+		if !app.missionRole(user, m, queryIgnoreCase(ctx, "creatorUid")).Has(model.PermSetRole) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
 
-func getMissionLogHandler(app *App) fiber.Handler {
-	result := makeAnswer(logEntryType, []*model.MissionLogEntryDTO{})
+		role := util.FirstString(ctx.Query("role"), model.RoleSubscriber)
+		uid := queryIgnoreCase(ctx, "clientUid")
 
-	return func(ctx *fiber.Ctx) error {
-		user := app.users.Get(Username(ctx))
-		m := app.dbm.MissionQuery().Scope(user.GetScope()).ReadScope(user.GetReadScope()).
-			Name(ctx.Params("missionname")).One()
+		if !model.IsValidRole(role) {
+			return ctx.Status(fiber.StatusBadRequest).SendString("invalid role " + role)
+		}
 
-		if m == nil {
+		if uid == "" {
+			return ctx.Status(fiber.StatusBadRequest).SendString("empty clientUid")
+		}
+
+		if err := app.dbm.SetRole(m.ID, uid, role); err != nil {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
-		return ctx.JSON(result)
+		return ctx.JSON(makeAnswer(missionRoleType, model.GetRole(role)))
 	}
 }
 
@@ -215,6 +320,10 @@ func getMissionKeywordsPutHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		if !app.missionAllowed(ctx, user, m, model.PermWrite) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
 		var kw []string
 
 		if err := json.Unmarshal(ctx.Body(), &kw); err != nil {
@@ -225,6 +334,37 @@ func getMissionKeywordsPutHandler(app *App) fiber.Handler {
 	}
 }
 
+func getMissionPasswordPutHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		return app.setMissionPassword(ctx, ctx.Query("password"))
+	}
+}
+
+func getMissionPasswordDeleteHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		return app.setMissionPassword(ctx, "")
+	}
+}
+
+func (app *App) setMissionPassword(ctx *fiber.Ctx, password string) error {
+	user := app.users.Get(Username(ctx))
+	m := app.dbm.MissionQuery().Scope(user.GetScope()).Name(ctx.Params("missionname")).One()
+
+	if m == nil {
+		return ctx.SendStatus(fiber.StatusNotFound)
+	}
+
+	if !app.missionAllowed(ctx, user, m, model.PermSetPassword) {
+		return ctx.SendStatus(fiber.StatusForbidden)
+	}
+
+	if err := m.SetPassword(password); err != nil {
+		return err
+	}
+
+	return app.dbm.MissionQuery().Id(m.ID).Update(map[string]any{"password": m.Password})
+}
+
 func getMissionSubscriptionsHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		user := app.users.Get(Username(ctx))
@@ -269,7 +409,8 @@ func getMissionSubscriptionPutHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
-		s, err := app.dbm.Subscribe(user, m, ctx.Query("uid"), ctx.Query("password"))
+		uid := ctx.Query("uid")
+		s, err := app.dbm.Subscribe(user, m, uid, ctx.Query("password"), app.invitationFor(user, m, uid))
 
 		if err != nil {
 			return ctx.Status(fiber.StatusForbidden).SendString(err.Error())
@@ -290,7 +431,16 @@ func getMissionSubscriptionDeleteHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
-		app.dbm.SubscriptionQuery().Mission(m.ID).Client(ctx.Query("uid")).Delete()
+		uid := ctx.Query("uid")
+
+		// only owner can unsubscribe other users
+		if s := app.dbm.SubscriptionQuery().Mission(m.ID).Client(uid).One(); s != nil && s.Username != user.GetLogin() {
+			if !app.missionRole(user, m, "").Has(model.PermSetRole) {
+				return ctx.SendStatus(fiber.StatusForbidden)
+			}
+		}
+
+		app.dbm.SubscriptionQuery().Mission(m.ID).Client(uid).Delete()
 
 		return nil
 	}
@@ -395,6 +545,10 @@ func getMissionContentPutHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		if !app.missionAllowed(ctx, user, mission, model.PermWrite) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
 		var data map[string][]string
 
 		if err := json.Unmarshal(ctx.Body(), &data); err != nil {
@@ -430,6 +584,10 @@ func getMissionContentPackagePutHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		if !app.missionAllowed(ctx, user, mission, model.PermWrite) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
 		f, err := os.CreateTemp("", "tak_pkg_*.zip")
 
 		if err != nil {
@@ -494,6 +652,10 @@ func getMissionContentDeleteHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		if !app.missionAllowed(ctx, user, mission, model.PermWrite) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
 		author := ctx.Query("creatorUid")
 
 		if uid := ctx.Query("uid"); uid != "" {
@@ -524,10 +686,26 @@ func getInvitePutHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		role := app.missionRole(user, mission, clientUID(ctx))
+
+		if !role.Has(model.PermWrite) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		invRole := ctx.Query("role")
+
+		if invRole != "" && !model.IsValidRole(invRole) {
+			return ctx.Status(fiber.StatusBadRequest).SendString("invalid role " + invRole)
+		}
+
+		if invRole == model.RoleOwner && !role.Has(model.PermSetRole) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
 		// type can be: clientUid, callsign, userName, group, team
 		typ := ctx.Params("type")
 
-		if typ != "clientUid" {
+		if typ != "clientUid" && typ != "userName" {
 			app.logger.Warn(fmt.Sprintf("we do not support invitation with type %s now", typ))
 			return ctx.SendStatus(fiber.StatusBadRequest)
 		}
@@ -537,12 +715,28 @@ func getInvitePutHandler(app *App) fiber.Handler {
 			Typ:        typ,
 			Invitee:    ctx.Params("uid"),
 			CreatorUID: ctx.Query("creatorUid"),
-			Role:       ctx.Query("role"),
+			Role:       invRole,
+		}
+
+		if _, err := app.dbm.Invite(inv); err != nil {
+			return err
 		}
 
-		_, err := app.dbm.Invite(inv)
+		msg := model.MissionInviteNotificationMsg(mission, inv)
 
-		return err
+		if typ == "userName" {
+			app.ForAllClients(func(ch client.ClientHandler) bool {
+				if ch.GetDevice().GetLogin() == inv.Invitee {
+					_ = ch.SendMsg(msg)
+				}
+
+				return true
+			})
+		} else {
+			app.sendOrStore(inv.Invitee, msg)
+		}
+
+		return nil
 	}
 }
 
@@ -556,6 +750,10 @@ func getInviteDeleteHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		if !app.missionAllowed(ctx, user, mission, model.PermWrite) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
 		app.dbm.InvitationQuery().Mission(mission.ID).Invitee(ctx.Params("uid")).
 			Type(ctx.Params("type")).Delete()
 
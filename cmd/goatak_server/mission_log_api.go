@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/kdudkov/goatak/pkg/model"
+	"github.com/kdudkov/goatak/pkg/util"
+)
+
+func addLogEntryRoutes(app *App, g fiber.Router) {
+	g.Post("/", getLogEntryPostHandler(app))
+	g.Put("/", getLogEntryPutHandler(app))
+	g.Get("/:id", getLogEntryHandler(app))
+	g.Delete("/:id", getLogEntryDeleteHandler(app))
+}
+
+func logEntryBody(ctx *fiber.Ctx) (*model.MissionLogEntryDTO, error) {
+	d := new(model.MissionLogEntryDTO)
+
+	if err := json.Unmarshal(ctx.Body(), d); err != nil {
+		return nil, fmt.Errorf("invalid log entry: %w", err)
+	}
+
+	return d, nil
+}
+
+func logScopes(user *model.Device) []string {
+	return append([]string{user.GetScope()}, user.GetReadScope()...)
+}
+
+// logEntryDTO returns the entry with the names of all missions it is in.
+func logEntryDTO(entries []*model.MissionLogEntry) *model.MissionLogEntryDTO {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(entries))
+
+	for _, e := range entries {
+		if e.Mission != nil {
+			names = append(names, e.Mission.Name)
+		}
+	}
+
+	return model.ToMissionLogEntryDTO(entries[0], names)
+}
+
+// putLogEntry saves the entry to all given missions. With replace the entry is removed from
+// the missions that are not in the list.
+func (app *App) putLogEntry(ctx *fiber.Ctx, user *model.Device, d *model.MissionLogEntryDTO,
+	missions []*model.Mission, replace bool,
+) error {
+	author := util.FirstString(clientUID(ctx), d.CreatorUID)
+
+	for _, m := range missions {
+		if !app.missionRole(user, m, author).Has(model.PermWrite) {
+			app.logger.Warn(fmt.Sprintf("user %s can't write log of mission %s", user.GetLogin(), m.Name))
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+	}
+
+	if d.ID == "" {
+		d.ID = uuid.NewString()
+	}
+
+	existing := app.dbm.MissionLogQuery().UID(d.ID).Get()
+	saved := make([]*model.MissionLogEntry, 0, len(missions))
+
+	for _, m := range missions {
+		var e *model.MissionLogEntry
+
+		for _, e1 := range existing {
+			if e1.MissionID == m.ID {
+				e = e1
+				break
+			}
+		}
+
+		if e == nil {
+			e = &model.MissionLogEntry{UID: d.ID, MissionID: m.ID, Scope: m.Scope}
+		}
+
+		e.UpdateFromDTO(d)
+
+		change, err := app.dbm.SaveMissionLogEntry(e, author)
+		if err != nil {
+			return err
+		}
+
+		e.Mission = m
+		saved = append(saved, e)
+
+		app.notifyMissionSubscribers(m, change)
+	}
+
+	if replace {
+		for _, e := range existing {
+			if e.Mission == nil || containsMission(missions, e.MissionID) {
+				continue
+			}
+
+			if !app.missionRole(user, e.Mission, author).Has(model.PermWrite) {
+				continue
+			}
+
+			change, err := app.dbm.DeleteMissionLogEntry(e, author)
+			if err != nil {
+				return err
+			}
+
+			app.notifyMissionSubscribers(e.Mission, change)
+		}
+	}
+
+	return ctx.JSON(makeAnswer(logEntryType, logEntryDTO(saved)))
+}
+
+func (app *App) deleteLogEntries(ctx *fiber.Ctx, user *model.Device, entries []*model.MissionLogEntry) error {
+	if len(entries) == 0 {
+		return ctx.SendStatus(fiber.StatusNotFound)
+	}
+
+	author := clientUID(ctx)
+
+	for _, e := range entries {
+		if e.Mission == nil || !app.missionRole(user, e.Mission, author).Has(model.PermWrite) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+	}
+
+	for _, e := range entries {
+		change, err := app.dbm.DeleteMissionLogEntry(e, author)
+		if err != nil {
+			return err
+		}
+
+		app.notifyMissionSubscribers(e.Mission, change)
+	}
+
+	return ctx.JSON(makeAnswer(logEntryType, logEntryDTO(entries)))
+}
+
+func containsMission(missions []*model.Mission, id uint) bool {
+	for _, m := range missions {
+		if m.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// logMissions returns missions from the list of names, nil if any of them is not found.
+func (app *App) logMissions(user *model.Device, names []string) []*model.Mission {
+	res := make([]*model.Mission, 0, len(names))
+
+	for _, name := range names {
+		m := app.dbm.MissionQuery().Scope(user.GetScope()).Name(name).One()
+		if m == nil {
+			return nil
+		}
+
+		res = append(res, m)
+	}
+
+	return res
+}
+
+func getLogEntryPostHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+
+		d, err := logEntryBody(ctx)
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		if len(d.MissionNames) == 0 {
+			return ctx.Status(fiber.StatusBadRequest).SendString("no mission names")
+		}
+
+		missions := app.logMissions(user, d.MissionNames)
+		if missions == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		return app.putLogEntry(ctx, user, d, missions, false)
+	}
+}
+
+func getLogEntryPutHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+
+		d, err := logEntryBody(ctx)
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		if d.ID == "" {
+			return ctx.Status(fiber.StatusBadRequest).SendString("no entry id")
+		}
+
+		existing := app.dbm.MissionLogQuery().UID(d.ID).ReadScope([]string{user.GetScope()}).Get()
+		if len(existing) == 0 {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		var missions []*model.Mission
+
+		if len(d.MissionNames) == 0 {
+			for _, e := range existing {
+				missions = append(missions, e.Mission)
+			}
+		} else if missions = app.logMissions(user, d.MissionNames); missions == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		return app.putLogEntry(ctx, user, d, missions, true)
+	}
+}
+
+func getLogEntryHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+
+		entries := app.dbm.MissionLogQuery().UID(ctx.Params("id")).ReadScope(logScopes(user)).Get()
+		if len(entries) == 0 {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		return ctx.JSON(makeAnswer(logEntryType, logEntryDTO(entries)))
+	}
+}
+
+func getLogEntryDeleteHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+
+		return app.deleteLogEntries(ctx, user,
+			app.dbm.MissionLogQuery().UID(ctx.Params("id")).ReadScope([]string{user.GetScope()}).Get())
+	}
+}
+
+func getMissionLogHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+		m := app.dbm.MissionQuery().Scope(user.GetScope()).ReadScope(user.GetReadScope()).
+			Name(ctx.Params("missionname")).One()
+
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		q := app.dbm.MissionLogQuery().Mission(m.ID)
+
+		if secago := ctx.QueryInt("secago"); secago > 0 {
+			q.After(time.Now().Add(-time.Second * time.Duration(secago)))
+		}
+
+		if s := ctx.Query("start"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return ctx.Status(fiber.StatusBadRequest).SendString("invalid start " + s)
+			}
+
+			q.After(t)
+		}
+
+		if s := ctx.Query("end"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return ctx.Status(fiber.StatusBadRequest).SendString("invalid end " + s)
+			}
+
+			q.Before(t)
+		}
+
+		entries := q.Get()
+		result := make([]*model.MissionLogEntryDTO, len(entries))
+
+		for i, e := range entries {
+			result[i] = model.ToMissionLogEntryDTO(e, []string{m.Name})
+		}
+
+		return ctx.JSON(makeAnswer(logEntryType, result))
+	}
+}
+
+func getMissionLogPostHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+
+		m := app.dbm.MissionQuery().Scope(user.GetScope()).Name(ctx.Params("missionname")).One()
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		d, err := logEntryBody(ctx)
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		return app.putLogEntry(ctx, user, d, []*model.Mission{m}, false)
+	}
+}
+
+func getMissionLogPutHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+
+		m := app.dbm.MissionQuery().Scope(user.GetScope()).Name(ctx.Params("missionname")).One()
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		d, err := logEntryBody(ctx)
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		d.ID = ctx.Params("id")
+
+		if app.dbm.MissionLogQuery().Mission(m.ID).UID(d.ID).One() == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		return app.putLogEntry(ctx, user, d, []*model.Mission{m}, false)
+	}
+}
+
+func getMissionLogDeleteHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+
+		m := app.dbm.MissionQuery().Scope(user.GetScope()).Name(ctx.Params("missionname")).One()
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		return app.deleteLogEntries(ctx, user, app.dbm.MissionLogQuery().Mission(m.ID).UID(ctx.Params("id")).Get())
+	}
+}
+
+func getApiMissionLogHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return err
+		}
+
+		m := app.dbm.MissionQuery().Id(uint(id)).ReadScope(CtxUser(ctx).AdminScopes()).One()
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		entries := app.dbm.MissionLogQuery().Mission(m.ID).Get()
+		result := make([]*model.MissionLogEntryDTO, len(entries))
+
+		for i, e := range entries {
+			result[i] = model.ToMissionLogEntryDTO(e, []string{m.Name})
+		}
+
+		return ctx.JSON(result)
+	}
+}
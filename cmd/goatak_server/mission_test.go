@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
@@ -34,10 +38,10 @@ func TestMissionSubscriptions(t *testing.T) {
 
 	user := &model.Device{Login: "login"}
 
-	m.Subscribe(user, m1, "uid1", "")
-	m.Subscribe(user, m1, "uid1", "")
-	m.Subscribe(user, m1, "uid2", "")
-	m.Subscribe(user, m2, "uid1", "")
+	m.Subscribe(user, m1, "uid1", "", nil)
+	m.Subscribe(user, m1, "uid1", "", nil)
+	m.Subscribe(user, m1, "uid2", "", nil)
+	m.Subscribe(user, m2, "uid1", "", nil)
 
 	assert.Len(t, m.SubscriptionQuery().Mission(m1.ID).Get(), 2)
 	assert.Len(t, m.GetSubscribers(m1.ID), 2)
@@ -73,10 +77,10 @@ func TestMissionCRUD(t *testing.T) {
 
 	user := &model.Device{Login: "login"}
 
-	m.Subscribe(user, m1, "uid1", "")
-	m.Subscribe(user, m1, "uid1", "")
-	m.Subscribe(user, m1, "uid2", "")
-	m.Subscribe(user, m2, "uid1", "")
+	m.Subscribe(user, m1, "uid1", "", nil)
+	m.Subscribe(user, m1, "uid1", "", nil)
+	m.Subscribe(user, m1, "uid2", "", nil)
+	m.Subscribe(user, m2, "uid1", "", nil)
 
 	assert.Len(t, m.SubscriptionQuery().Mission(m1.ID).Get(), 2)
 	assert.Len(t, m.GetSubscribers(m1.ID), 2)
@@ -149,6 +153,223 @@ func TestMissionContent(t *testing.T) {
 	assert.NotNil(t, m2.Resources[0])
 }
 
+func TestMissionPasswordMigration(t *testing.T) {
+	db := getTestDatabase()
+
+	m := database.New(db)
+	require.NoError(t, m.Migrate())
+
+	m1 := &model.Mission{Name: "mission1", Scope: "scope1", Password: "secret", CreatorUID: "uid1"}
+	require.NoError(t, m.CreateMission(m1))
+	require.NoError(t, db.Model(&model.Subscription{}).Where("mission_id = ?", m1.ID).Update("role", "MISSION_CREATOR").Error)
+
+	require.NoError(t, m.Migrate())
+
+	m2 := m.MissionQuery().Id(m1.ID).One()
+	assert.NotEqual(t, "secret", m2.Password)
+	assert.True(t, m2.PasswordHashed())
+	assert.True(t, m2.CheckPassword("secret"))
+	assert.False(t, m2.CheckPassword("secret1"))
+
+	assert.Equal(t, model.RoleOwner, m.SubscriptionQuery().Mission(m1.ID).Client("uid1").One().Role)
+}
+
+func martiApp(app *TestApp, login string) *fiber.App {
+	f := fiber.New()
+	f.Use(func(c *fiber.Ctx) error {
+		c.Locals(UsernameKey, login)
+
+		return c.Next()
+	})
+	addMartiRoutes(app.App, f)
+
+	return f
+}
+
+func TestMissionRoles(t *testing.T) {
+	app := NewTestApp()
+	app.dbm.Save(Device("usr3", "3", false, false))
+
+	owner := martiApp(app, "usr1")
+	other := martiApp(app, "usr3")
+
+	req := func(f *fiber.App, method, url string, body string) int {
+		r, _ := http.NewRequest(method, url, strings.NewReader(body))
+		resp, err := f.Test(r, 5000)
+		require.NoError(t, err)
+
+		return resp.StatusCode
+	}
+
+	role := func(f *fiber.App) string {
+		r, _ := http.NewRequest("GET", "/Marti/api/missions/m1/role", nil)
+		resp, err := f.Test(r)
+		require.NoError(t, err)
+
+		var res model.Answer[*model.MissionRoleDTO]
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+
+		return res.Data.Type
+	}
+
+	require.Equal(t, fiber.StatusCreated, req(owner, "PUT", "/Marti/api/missions/m1?creatorUid=uid1&password=secret", ""))
+
+	m := app.dbm.MissionQuery().Name("m1").One()
+	require.NotNil(t, m)
+	assert.True(t, strings.HasPrefix(m.Password, "$2"))
+
+	assert.Equal(t, model.RoleOwner, role(owner))
+	assert.Equal(t, model.RoleReadOnly, role(other))
+
+	assert.Equal(t, fiber.StatusForbidden, req(other, "PUT", "/Marti/api/missions/m1/subscription?uid=uid3&password=bad", ""))
+	assert.Equal(t, fiber.StatusCreated, req(other, "PUT", "/Marti/api/missions/m1/subscription?uid=uid3&password=secret", ""))
+	assert.Equal(t, model.RoleSubscriber, role(other))
+
+	assert.Equal(t, fiber.StatusOK, req(other, "PUT", "/Marti/api/missions/m1/keywords?creatorUid=uid3", `["a"]`))
+	assert.Equal(t, fiber.StatusForbidden, req(other, "DELETE", "/Marti/api/missions/m1?creatorUid=uid3", ""))
+	assert.Equal(t, fiber.StatusForbidden, req(other, "PUT", "/Marti/api/missions/m1/role?clientUid=uid1&role=MISSION_READONLY_SUBSCRIBER", ""))
+	assert.Equal(t, fiber.StatusForbidden, req(other, "PUT", "/Marti/api/missions/m1/invite/clientUid/uid5?role=MISSION_OWNER", ""))
+
+	// owner makes subscriber read only
+	assert.Equal(t, fiber.StatusBadRequest, req(owner, "PUT", "/Marti/api/missions/m1/role?clientUid=uid3&role=BOSS", ""))
+	assert.Equal(t, fiber.StatusBadRequest, req(owner, "PUT", "/Marti/api/missions/m1/role?role=MISSION_READONLY_SUBSCRIBER", ""))
+	assert.Equal(t, fiber.StatusNotFound, req(owner, "PUT", "/Marti/api/missions/m1/role?clientUid=uid9&role=MISSION_READONLY_SUBSCRIBER", ""))
+	assert.Equal(t, model.RoleSubscriber, role(other))
+	assert.Equal(t, fiber.StatusOK, req(owner, "PUT", "/Marti/api/missions/m1/role?clientUid=uid3&role=MISSION_READONLY_SUBSCRIBER", ""))
+	assert.Equal(t, model.RoleReadOnly, role(other))
+
+	// resubscribe keeps the role
+	assert.Equal(t, fiber.StatusCreated, req(other, "PUT", "/Marti/api/missions/m1/subscription?uid=uid3&password=secret", ""))
+	assert.Equal(t, model.RoleReadOnly, role(other))
+
+	assert.Equal(t, fiber.StatusForbidden, req(other, "PUT", "/Marti/api/missions/m1/keywords", `["b"]`))
+	assert.Equal(t, fiber.StatusForbidden, req(other, "PUT", "/Marti/api/missions/m1/contents", `{"hashes":[]}`))
+	assert.Equal(t, fiber.StatusForbidden, req(other, "DELETE", "/Marti/api/missions/m1/contents?uid=point1", ""))
+	assert.Equal(t, fiber.StatusForbidden, req(other, "PUT", "/Marti/api/missions/m1/invite/clientUid/uid5", ""))
+	assert.Equal(t, fiber.StatusForbidden, req(other, "DELETE", "/Marti/api/missions/m1/subscription?uid=uid1", ""))
+
+	// invitation of other's client can't be used
+	assert.Equal(t, fiber.StatusOK, req(owner, "PUT", "/Marti/api/missions/m1/invite/clientUid/uid4?role=MISSION_OWNER", ""))
+	assert.Equal(t, fiber.StatusForbidden, req(other, "PUT", "/Marti/api/missions/m1/subscription?uid=uid4", ""))
+	assert.Equal(t, model.RoleReadOnly, role(other))
+
+	// invited client of the user gets the role without password, invitation is used once
+	require.NoError(t, app.dbm.Create(&model.Certificate{Serial: "sn4", Login: "usr3", UID: "uid4"}))
+	assert.Equal(t, fiber.StatusCreated, req(other, "PUT", "/Marti/api/missions/m1/subscription?uid=uid4", ""))
+	assert.Equal(t, model.RoleOwner, role(other))
+	assert.Nil(t, app.dbm.InvitationQuery().Mission(m.ID).Invitee("uid4").One())
+
+	assert.Equal(t, fiber.StatusOK, req(owner, "PUT", "/Marti/api/missions/m1/invite/userName/usr3?role=MISSION_SUBSCRIBER", ""))
+	assert.Equal(t, fiber.StatusCreated, req(other, "PUT", "/Marti/api/missions/m1/subscription?uid=uid6", ""))
+	assert.Equal(t, fiber.StatusForbidden, req(other, "PUT", "/Marti/api/missions/m1/subscription?uid=uid7", ""))
+
+	// demotion of one client changes all subscriptions of the user
+	assert.Equal(t, model.RoleOwner, role(other))
+	assert.Equal(t, fiber.StatusOK, req(owner, "PUT", "/Marti/api/missions/m1/role?clientUid=uid6&role=MISSION_READONLY_SUBSCRIBER", ""))
+	assert.Equal(t, model.RoleReadOnly, role(other))
+	assert.Equal(t, model.RoleReadOnly, app.dbm.SubscriptionQuery().Mission(m.ID).Client("uid4").One().Role)
+	assert.Equal(t, model.RoleOwner, role(owner))
+
+	assert.Equal(t, fiber.StatusOK, req(owner, "DELETE", "/Marti/api/missions/m1", ""))
+	assert.Nil(t, app.dbm.MissionQuery().Name("m1").One())
+}
+
+func TestMissionLog(t *testing.T) {
+	app := NewTestApp()
+	app.dbm.Save(Device("usr3", "3", false, false))
+
+	owner := martiApp(app, "usr1")
+	other := martiApp(app, "usr3")
+
+	req := func(f *fiber.App, method, url string, body string, res any) int {
+		r, _ := http.NewRequest(method, url, strings.NewReader(body))
+		resp, err := f.Test(r, 5000)
+		require.NoError(t, err)
+
+		if res != nil && resp.StatusCode == fiber.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(res))
+		}
+
+		return resp.StatusCode
+	}
+
+	log := func(name string) []*model.MissionLogEntryDTO {
+		var res model.Answer[[]*model.MissionLogEntryDTO]
+		require.Equal(t, fiber.StatusOK, req(owner, "GET", "/Marti/api/missions/"+name+"/log", "", &res))
+
+		return res.Data
+	}
+
+	require.Equal(t, fiber.StatusCreated, req(owner, "PUT", "/Marti/api/missions/m1?creatorUid=uid1", "", nil))
+	require.Equal(t, fiber.StatusCreated, req(owner, "PUT", "/Marti/api/missions/m2?creatorUid=uid1", "", nil))
+
+	var entry model.Answer[*model.MissionLogEntryDTO]
+
+	body := `{"content":"hello","creatorUid":"uid1","entryUid":"e1","missionNames":["m1","m2"],"dtg":"2024-01-01T10:00:00Z","keywords":["k1"]}`
+	require.Equal(t, fiber.StatusOK, req(owner, "POST", "/Marti/api/missionlogs/entries", body, &entry))
+
+	id := entry.Data.ID
+	require.NotEmpty(t, id)
+	assert.ElementsMatch(t, []string{"m1", "m2"}, entry.Data.MissionNames)
+
+	l := log("m1")
+	require.Len(t, l, 1)
+	assert.Equal(t, "hello", l[0].Content)
+	assert.Equal(t, []string{"k1"}, l[0].Keywords)
+	assert.Len(t, log("m2"), 1)
+
+	assert.Equal(t, fiber.StatusOK, req(other, "GET", "/Marti/api/missionlogs/entries/"+id, "", &entry))
+	assert.Equal(t, fiber.StatusForbidden, req(other, "POST", "/Marti/api/missions/m1/log", `{"content":"spam"}`, nil))
+	assert.Equal(t, fiber.StatusForbidden, req(other, "DELETE", "/Marti/api/missionlogs/entries/"+id, "", nil))
+	assert.Equal(t, fiber.StatusNotFound, req(owner, "POST", "/Marti/api/missionlogs/entries", `{"content":"a","missionNames":["none"]}`, nil))
+
+	// update moves entry out of m2
+	body = fmt.Sprintf(`{"id":"%s","content":"changed","missionNames":["m1"]}`, id)
+	require.Equal(t, fiber.StatusOK, req(owner, "PUT", "/Marti/api/missionlogs/entries", body, &entry))
+	assert.Equal(t, []string{"m1"}, entry.Data.MissionNames)
+
+	l = log("m1")
+	require.Len(t, l, 1)
+	assert.Equal(t, "changed", l[0].Content)
+	assert.Equal(t, 2024, l[0].Dtg.Year())
+	assert.Empty(t, log("m2"))
+
+	var changes model.Answer[[]*model.MissionChangeDTO]
+	require.Equal(t, fiber.StatusOK, req(owner, "GET", "/Marti/api/missions/m1/changes", "", &changes))
+
+	var n int
+
+	for _, c := range changes.Data {
+		if c.LogEntry != nil {
+			assert.Equal(t, id, c.ContentUID)
+			n++
+		}
+	}
+
+	assert.Equal(t, 2, n)
+
+	var squashed model.Answer[[]*model.MissionChangeDTO]
+	require.Equal(t, fiber.StatusOK, req(owner, "GET", "/Marti/api/missions/m1/changes?squashed=true", "", &squashed))
+
+	for _, c := range squashed.Data {
+		assert.Nil(t, c.LogEntry)
+	}
+
+	// per mission api
+	require.Equal(t, fiber.StatusOK, req(owner, "PUT", "/Marti/api/missions/m1/log/"+id, `{"content":"again"}`, &entry))
+	assert.Equal(t, "again", log("m1")[0].Content)
+	assert.Equal(t, fiber.StatusNotFound, req(owner, "PUT", "/Marti/api/missions/m2/log/"+id, `{"content":"again"}`, nil))
+
+	require.Equal(t, fiber.StatusOK, req(owner, "DELETE", "/Marti/api/missions/m1/log/"+id, "", nil))
+	assert.Empty(t, log("m1"))
+
+	require.Equal(t, fiber.StatusOK, req(owner, "POST", "/Marti/api/missions/m1/log", `{"content":"last"}`, &entry))
+	assert.Len(t, log("m1"), 1)
+
+	require.Equal(t, fiber.StatusOK, req(owner, "DELETE", "/Marti/api/missions/m1", "", nil))
+	assert.Zero(t, app.dbm.MissionLogQuery().UID(entry.Data.ID).Count())
+}
+
 func getTestDatabase() *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Info)})
 	if err != nil {
@@ -160,7 +160,14 @@ func (p *PrefFile) Content() []byte {
 		sb.WriteString(fmt.Sprintf("<preference version=\"1\" name=\"%s\">\n", name))
 
 		for k, v := range data {
-			e := GetEntry(k, v)
+			var e string
+
+			if name == STREAMS {
+				e = GetStreamEntry(k, v)
+			} else {
+				e = GetEntry(k, v)
+			}
+
 			if e != "" {
 				sb.WriteString(e + "\n")
 			}
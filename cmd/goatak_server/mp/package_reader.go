@@ -0,0 +1,234 @@
+package mp
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	ManifestName = "MANIFEST/manifest.xml"
+	// MaxEntrySize is the max uncompressed size of the file read from the package
+	MaxEntrySize = 64 << 20
+	// MaxReadSize is the max total uncompressed size of files read from one package
+	MaxReadSize = 256 << 20
+)
+
+var (
+	ErrNotFound = errors.New("entry not found")
+	ErrTooBig   = errors.New("entry is too big")
+)
+
+type Parameter struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type Content struct {
+	Ignore   bool        `xml:"ignore,attr"`
+	ZipEntry string      `xml:"zipEntry,attr"`
+	Params   []Parameter `xml:"Parameter"`
+}
+
+func (c *Content) Param(name string) string {
+	return getParam(c.Params, name)
+}
+
+type Manifest struct {
+	XMLName  xml.Name    `xml:"MissionPackageManifest"`
+	Version  string      `xml:"version,attr"`
+	Params   []Parameter `xml:"Configuration>Parameter"`
+	Contents []*Content  `xml:"Contents>Content"`
+}
+
+func (m *Manifest) Param(name string) string {
+	return getParam(m.Params, name)
+}
+
+// OnReceiveImport is true if parameter is missing, as ATAK does.
+func (m *Manifest) OnReceiveImport() bool {
+	return m.Param("onReceiveImport") != "false"
+}
+
+func (m *Manifest) OnReceiveDelete() bool {
+	return m.Param("onReceiveDelete") == "true"
+}
+
+func (m *Manifest) content(name string) *Content {
+	for _, c := range m.Contents {
+		if c.ZipEntry == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// Entry is a file in the package.
+type Entry struct {
+	Name   string
+	Size   int64
+	Ignore bool
+	// UID is the uid parameter from manifest, ATAK sets it for cot files and attachments
+	UID string
+}
+
+func (e *Entry) IsCot() bool {
+	return strings.EqualFold(path.Ext(e.Name), ".cot")
+}
+
+// PackageReader reads zip data package uploaded by the client.
+type PackageReader struct {
+	r        io.ReaderAt
+	zr       *zip.Reader
+	manifest *Manifest
+	// left is the uncompressed size that can be read yet
+	left int64
+}
+
+func OpenPackage(r io.ReaderAt, size int64) (*PackageReader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PackageReader{r: r, zr: zr, left: MaxReadSize}
+
+	data, err := p.ReadFile(ManifestName)
+
+	switch {
+	case errors.Is(err, ErrNotFound):
+		// plain zip, every file is a content
+		p.manifest = new(Manifest)
+
+		for _, f := range zr.File {
+			if !f.FileInfo().IsDir() {
+				p.manifest.Contents = append(p.manifest.Contents, &Content{ZipEntry: f.Name})
+			}
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if p.manifest, err = ParseManifest(data); err != nil {
+			return nil, fmt.Errorf("bad manifest: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+func OpenPackageBytes(data []byte) (*PackageReader, error) {
+	return OpenPackage(bytes.NewReader(data), int64(len(data)))
+}
+
+func ParseManifest(data []byte) (*Manifest, error) {
+	m := new(Manifest)
+
+	if err := xml.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Close closes the underlying reader if it is a closer.
+func (p *PackageReader) Close() error {
+	if c, ok := p.r.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+func (p *PackageReader) Manifest() *Manifest {
+	return p.manifest
+}
+
+// Entries returns all files of the package except the manifest.
+func (p *PackageReader) Entries() []*Entry {
+	res := make([]*Entry, 0, len(p.zr.File))
+
+	for _, f := range p.zr.File {
+		if f.FileInfo().IsDir() || f.Name == ManifestName {
+			continue
+		}
+
+		e := &Entry{Name: f.Name, Size: int64(f.UncompressedSize64)}
+
+		if c := p.manifest.content(f.Name); c != nil {
+			e.Ignore = c.Ignore
+			e.UID = c.Param("uid")
+		}
+
+		res = append(res, e)
+	}
+
+	return res
+}
+
+func (p *PackageReader) file(name string) *zip.File {
+	for _, f := range p.zr.File {
+		if f.Name == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+func (p *PackageReader) Open(name string) (io.ReadCloser, error) {
+	if f := p.file(name); f != nil {
+		return f.Open()
+	}
+
+	return nil, ErrNotFound
+}
+
+// ReadFile reads the file up to MaxEntrySize, all files read from the package can't be bigger than MaxReadSize.
+func (p *PackageReader) ReadFile(name string) ([]byte, error) {
+	f := p.file(name)
+	if f == nil {
+		return nil, ErrNotFound
+	}
+
+	limit := min(MaxEntrySize, p.left)
+
+	if f.UncompressedSize64 > uint64(limit) {
+		return nil, ErrTooBig
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > limit {
+		return nil, ErrTooBig
+	}
+
+	p.left -= int64(len(data))
+
+	return data, nil
+}
+
+func getParam(params []Parameter, name string) string {
+	for _, p := range params {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+
+	return ""
+}
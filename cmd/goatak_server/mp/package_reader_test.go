@@ -0,0 +1,100 @@
+package mp
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageReader(t *testing.T) {
+	p := NewMissionPackage("uid1", "test")
+	p.Param("onReceiveImport", "false")
+	p.AddFiles(NewBlobFile("abc/point.cot", []byte("<event/>")), NewBlobFile("img/1.jpg", []byte("jpg")))
+
+	data, err := p.Create()
+	require.NoError(t, err)
+
+	r, err := OpenPackageBytes(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, "test", r.Manifest().Param("name"))
+	assert.False(t, r.Manifest().OnReceiveImport())
+	assert.False(t, r.Manifest().OnReceiveDelete())
+
+	entries := r.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "abc/point.cot", entries[0].Name)
+	assert.True(t, entries[0].IsCot())
+	assert.False(t, entries[1].IsCot())
+	assert.Equal(t, int64(3), entries[1].Size)
+
+	b, err := r.ReadFile("img/1.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "jpg", string(b))
+
+	_, err = r.ReadFile("nofile")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManifest(t *testing.T) {
+	m, err := ParseManifest([]byte(`<MissionPackageManifest version="2">
+<Configuration><Parameter name="uid" value="u1"/><Parameter name="onReceiveDelete" value="true"/></Configuration>
+<Contents><Content ignore="true" zipEntry="a/b.cot"><Parameter name="uid" value="point1"/></Content></Contents>
+</MissionPackageManifest>`))
+	require.NoError(t, err)
+
+	assert.True(t, m.OnReceiveImport())
+	assert.True(t, m.OnReceiveDelete())
+	require.Len(t, m.Contents, 1)
+	assert.True(t, m.Contents[0].Ignore)
+	assert.Equal(t, "point1", m.Contents[0].Param("uid"))
+}
+
+func TestPlainZip(t *testing.T) {
+	var b bytes.Buffer
+
+	w := zip.NewWriter(&b)
+	f, _ := w.Create("doc.kml")
+	_, _ = f.Write([]byte("<kml/>"))
+	require.NoError(t, w.Close())
+
+	r, err := OpenPackageBytes(b.Bytes())
+	require.NoError(t, err)
+	assert.True(t, r.Manifest().OnReceiveImport())
+	require.Len(t, r.Entries(), 1)
+	assert.Equal(t, "doc.kml", r.Entries()[0].Name)
+}
+
+func TestPackageReaderLimits(t *testing.T) {
+	var b bytes.Buffer
+
+	zw := zip.NewWriter(&b)
+
+	for name, size := range map[string]int{"big.cot": MaxEntrySize + 1, "a.cot": 10, "b.cot": 10} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+
+		_, err = w.Write(make([]byte, size))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, zw.Close())
+
+	r, err := OpenPackageBytes(b.Bytes())
+	require.NoError(t, err)
+
+	_, err = r.ReadFile("big.cot")
+	require.ErrorIs(t, err, ErrTooBig)
+
+	// total size of read files
+	r.left = 15
+
+	_, err = r.ReadFile("a.cot")
+	require.NoError(t, err)
+
+	_, err = r.ReadFile("b.cot")
+	require.ErrorIs(t, err, ErrTooBig)
+}
@@ -302,3 +302,17 @@ func GetEntry(key, val string) string {
 
 	return ""
 }
+
+// GetStreamEntry makes cot_streams entry, keys there have connection number suffix, like connectString0.
+func GetStreamEntry(key, val string) string {
+	cls := "String"
+
+	switch strings.TrimRight(key, "0123456789") {
+	case "count":
+		cls = "Integer"
+	case "enabled", "useAuth", "enrollForCertificateWithTrust", "compress":
+		cls = "Boolean"
+	}
+
+	return fmt.Sprintf("<entry key=\"%s\" class=\"class java.lang.%s\">%s</entry>", key, cls, val)
+}
@@ -26,3 +26,9 @@ func TestDouble(t *testing.T) {
 		s.Add(p.Key)
 	}
 }
+
+func TestStreamEntry(t *testing.T) {
+	assert.Equal(t, `<entry key="count" class="class java.lang.Integer">1</entry>`, GetStreamEntry("count", "1"))
+	assert.Equal(t, `<entry key="enabled12" class="class java.lang.Boolean">true</entry>`, GetStreamEntry("enabled12", "true"))
+	assert.Equal(t, `<entry key="connectString0" class="class java.lang.String">a:8089:ssl</entry>`, GetStreamEntry("connectString0", "a:8089:ssl"))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	outboxCleanInterval = time.Minute
+	// pause between stored messages, not to overflow client send queue
+	outboxSendDelay = time.Millisecond * 20
+)
+
+// storable messages are kept for offline recipients: direct chats, file transfers and mission invitations.
+func storable(msg *cot.CotMessage) bool {
+	return msg.IsChat() || msg.IsFileTransfer() || msg.GetType() == "t-x-m-i"
+}
+
+// storeForContact puts the message to the outbox of offline contact. If uid is unknown, it is looked up
+// by callsign, otherwise the message waits for any contact with this callsign.
+func (app *App) storeForContact(uid, callsign string, msg *cot.CotMessage) {
+	ttl := app.config.OutboxTTL()
+
+	if ttl <= 0 || !storable(msg) {
+		return
+	}
+
+	if uid == "" {
+		uid = app.findContactUID(callsign, msg.Scope)
+	}
+
+	o, err := model.NewOutboxMessage(uid, callsign, msg, ttl)
+	if err != nil {
+		app.logger.Error("can't store message", slog.Any("error", err))
+
+		return
+	}
+
+	if err := app.dbm.AddToOutbox(o); err != nil {
+		return
+	}
+
+	outboxMetric.WithLabelValues("stored").Inc()
+	app.logger.Info("message stored for offline contact: " + o.String())
+}
+
+func (app *App) sendOrStore(uid string, msg *cot.CotMessage) {
+	if !app.sendToUID(uid, msg) {
+		app.storeForContact(uid, "", msg)
+	}
+}
+
+func (app *App) findContactUID(callsign, scope string) string {
+	var uid string
+
+	app.items.ForEach(func(item *model.Item) bool {
+		if item.GetClass() == model.CONTACT && item.GetCallsign() == callsign && item.GetScope() == scope {
+			uid = item.GetUID()
+
+			return false
+		}
+
+		return true
+	})
+
+	return uid
+}
+
+// flushOutbox sends stored messages to just connected contact.
+func (app *App) flushOutbox(uid, callsign string) {
+	for _, o := range app.dbm.OutboxQuery().Recipient(uid, callsign).Limit(0).Get() {
+		msg, err := o.Message()
+		if err != nil {
+			app.logger.Error("invalid stored message "+o.String(), slog.Any("error", err))
+			_, _ = app.dbm.OutboxQuery().Id(o.ID).Delete()
+
+			continue
+		}
+
+		if !app.sendToUID(uid, msg) {
+			// contact is gone or is in other scope
+			continue
+		}
+
+		if _, err := app.dbm.OutboxQuery().Id(o.ID).Delete(); err != nil {
+			app.logger.Error("outbox delete error", slog.Any("error", err))
+		}
+
+		outboxMetric.WithLabelValues("delivered").Inc()
+		app.logger.Info(fmt.Sprintf("stored message %s delivered to %s %s", o.MsgUID, uid, callsign))
+
+		time.Sleep(outboxSendDelay)
+	}
+}
+
+func (app *App) cleanOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxCleanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := app.dbm.OutboxQuery().Expired().Delete()
+			if err != nil {
+				app.logger.Error("outbox cleanup error", slog.Any("error", err))
+
+				continue
+			}
+
+			if n > 0 {
+				outboxMetric.WithLabelValues("expired").Add(float64(n))
+				app.logger.Info(fmt.Sprintf("%d expired messages removed from outbox", n))
+			}
+		}
+	}
+}
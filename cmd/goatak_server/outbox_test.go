@@ -0,0 +1,153 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type testHandler struct {
+	name   string
+	uids   map[string]string
+	device *model.Device
+
+	mx   sync.Mutex
+	msgs []*cot.CotMessage
+}
+
+func (h *testHandler) GetName() string {
+	return h.name
+}
+
+func (h *testHandler) HasUID(uid string) bool {
+	_, ok := h.uids[uid]
+	return ok
+}
+
+func (h *testHandler) HasCallsign(callsign string) bool {
+	for _, c := range h.uids {
+		if c == callsign {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *testHandler) GetUids() map[string]string {
+	return h.uids
+}
+
+func (h *testHandler) GetDevice() *model.Device {
+	return h.device
+}
+
+func (h *testHandler) GetSerial() string {
+	return ""
+}
+
+func (h *testHandler) GetVersion() int32 {
+	return 1
+}
+
+func (h *testHandler) SendMsg(msg *cot.CotMessage) error {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.msgs = append(h.msgs, msg)
+
+	return nil
+}
+
+func (h *testHandler) GetLastSeen() *time.Time {
+	return nil
+}
+
+func (h *testHandler) GetQueueStats() *client.QueueStats {
+	return nil
+}
+
+func (h *testHandler) Stop() {}
+
+func (h *testHandler) Sent() []*cot.CotMessage {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	return h.msgs
+}
+
+func newDirectChat(scope, uid, to string) *cot.CotMessage {
+	tak := cot.BasicMsg("b-t-f", uid, time.Second*10)
+
+	det, _ := cot.DetailsFromString(`<marti><dest callsign="` + to + `"/></marti><remarks>hello</remarks>`)
+	tak.CotEvent.Detail = &cotproto.Detail{XmlDetail: det.AsXMLString()}
+
+	return &cot.CotMessage{TakMessage: tak, Detail: det, Scope: scope}
+}
+
+func TestOutbox(t *testing.T) {
+	app := NewTestApp()
+
+	// message to offline callsign is stored once
+	msg := newDirectChat("test", "GeoChat.1.bob.1", "bob")
+	app.route(msg)
+	app.route(msg)
+	app.route(newCotMessage("test", "unit1", 10, 10))
+
+	require.Equal(t, int64(1), app.dbm.OutboxQuery().Count())
+
+	o := app.dbm.OutboxQuery().One()
+	assert.Equal(t, "bob", o.Callsign)
+	assert.Empty(t, o.UID)
+	assert.Equal(t, "hello", o.DTO().Text)
+
+	// invitation to offline uid
+	mission := &model.Mission{Name: "m1", Scope: "test"}
+	app.sendOrStore("bob-uid", model.MissionInviteNotificationMsg(mission, &model.Invitation{Invitee: "bob-uid", Role: "MISSION_SUBSCRIBER"}))
+	app.sendOrStore("bob-uid", model.MissionInviteNotificationMsg(mission, &model.Invitation{Invitee: "bob-uid", Role: "MISSION_OWNER"}))
+
+	require.Equal(t, int64(2), app.dbm.OutboxQuery().Count())
+
+	// contact in other scope gets nothing
+	other := &testHandler{name: "h1", uids: map[string]string{"bob-uid": "bob"}, device: &model.Device{Login: "bob", Scope: "other"}}
+	app.AddClientHandler(other)
+	app.flushOutbox("bob-uid", "bob")
+
+	assert.Empty(t, other.Sent())
+	assert.Equal(t, int64(2), app.dbm.OutboxQuery().Count())
+	app.RemoveClientHandler("h1")
+
+	h := &testHandler{name: "h2", uids: map[string]string{"bob-uid": "bob"}, device: &model.Device{Login: "bob", Scope: "test"}}
+	app.AddClientHandler(h)
+	app.flushOutbox("bob-uid", "bob")
+
+	sent := h.Sent()
+	require.Len(t, sent, 2)
+	assert.Equal(t, "GeoChat.1.bob.1", sent[0].GetUID())
+	assert.Equal(t, "t-x-m-i", sent[1].GetType())
+	assert.Equal(t, "MISSION_OWNER", sent[1].GetDetail().GetFirst("mission").GetFirst("role").GetAttr("type"))
+	assert.True(t, sent[0].GetStaleTime().After(time.Now()))
+	assert.Equal(t, int64(0), app.dbm.OutboxQuery().Count())
+
+	// online contact gets message directly
+	app.route(newDirectChat("test", "GeoChat.1.bob.2", "bob"))
+	assert.Len(t, h.Sent(), 3)
+	assert.Equal(t, int64(0), app.dbm.OutboxQuery().Count())
+
+	// expired
+	app.route(newDirectChat("test", "GeoChat.1.alice.1", "alice"))
+	require.NoError(t, app.dbm.OutboxQuery().Callsign("alice").Update(map[string]any{"expires_at": time.Now().Add(-time.Minute)}))
+	assert.Empty(t, app.dbm.OutboxQuery().Recipient("alice-uid", "alice").Get())
+
+	n, err := app.dbm.OutboxQuery().Expired().Delete()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
@@ -1,15 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"google.golang.org/protobuf/proto"
 
 	"github.com/kdudkov/goatak/pkg/cot"
 	"github.com/kdudkov/goatak/pkg/model"
@@ -30,6 +28,12 @@ func (app *App) AddEventProcessor(name string, cb func(msg *cot.CotMessage) bool
 func (app *App) InitMessageProcessors() {
 	app.AddEventProcessor("logger", app.loggerProcessor, ".-")
 
+	if app.federationEnabled() {
+		app.AddEventProcessor("federation", app.federationProcessor, ".-")
+	}
+
+	app.AddEventProcessor("rules", app.rulesProcessor, ".-")
+
 	if app.config.LogAll() {
 		app.AddEventProcessor("file_logger", app.fileLoggerProcessor, ".-")
 	}
@@ -37,7 +41,10 @@ func (app *App) InitMessageProcessors() {
 	app.AddEventProcessor("metrics", app.metricsProcessor, "t-x-c-m")
 	app.AddEventProcessor("remove", app.removeItemProcessor, "t-x-d-d")
 	app.AddEventProcessor("chat", app.chatProcessor, "b-t-f")
+	app.AddEventProcessor("alerts", app.alertProcessor, "b-a-o-")
 	app.AddEventProcessor("items", app.saveItemProcessor, "a-", "b-", "u-")
+	app.AddEventProcessor("geofence", app.geofenceProcessor, "a-")
+	app.AddEventProcessor("geofence_shapes", app.geofenceShapeProcessor, "u-d-f", "u-d-r", "u-d-c-c")
 	app.AddEventProcessor("filter_control", filterProcessor, "t-")
 
 	app.AddEventProcessor("router", app.route, ".-")
@@ -107,9 +114,18 @@ func (app *App) chatProcessor(msg *cot.CotMessage) bool {
 
 	app.logger.Info("Chat " + c.String())
 
-	app.messages = append(app.messages, c)
-	if err := logChatMessage(c); err != nil {
-		app.logger.Warn("error logging chat", slog.Any("error", err))
+	if c.FromUID == WELCOME_MESSAGE_FROM_UID {
+		return true
+	}
+
+	if c.ID == "" {
+		c.ID = uuid.NewString()
+	}
+
+	c.Scope = msg.Scope
+
+	if err := app.dbm.ForceSave(c); err != nil {
+		app.logger.Warn("error saving chat message", slog.Any("error", err))
 	}
 
 	return true
@@ -147,6 +163,12 @@ func (app *App) saveItemProcessor(msg *cot.CotMessage) bool {
 		}
 	}
 
+	if app.tracks != nil && (cl == model.UNIT || cl == model.CONTACT) && (msg.GetLat() != 0 || msg.GetLon() != 0) {
+		if !app.tracks.Add(model.TrackPointFromMsg(msg)) {
+			dropMetric.WithLabelValues(msg.Scope, "track_history").Inc()
+		}
+	}
+
 	return true
 }
 
@@ -155,13 +177,30 @@ func (app *App) fileLoggerProcessor(msg *cot.CotMessage) bool {
 		return true
 	}
 
-	if err := logMessage(msg, filepath.Join(app.config.DataDir(), "log")); err != nil {
+	if err := app.cotLog.Write(msg.Scope, msg.GetTakMessage()); err != nil {
 		app.logger.Warn("error logging message", slog.Any("error", err))
 	}
 
 	return true
 }
 
+// flushCotLog writes buffered cot log records to disk every second.
+func (app *App) flushCotLog(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := app.cotLog.Flush(); err != nil {
+				app.logger.Warn("error writing cot log", slog.Any("error", err))
+			}
+		}
+	}
+}
+
 func (app *App) metricsProcessor(msg *cot.CotMessage) bool {
 	uid := msg.GetFirstLink("p-s").GetAttr("uid")
 
@@ -192,44 +231,3 @@ func (app *App) metricsProcessor(msg *cot.CotMessage) bool {
 func filterProcessor(msg *cot.CotMessage) bool {
 	return !msg.IsControl()
 }
-
-func logMessage(msg *cot.CotMessage, dir string) error {
-	if err := os.MkdirAll(dir, 0777); err != nil {
-		return err
-	}
-
-	fname := filepath.Join(dir, time.Now().Format("2006-01-02.tak"))
-
-	f, err := os.OpenFile(fname, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	d, err := proto.Marshal(msg.GetTakMessage())
-	if err != nil {
-		return err
-	}
-
-	l := uint32(len(d))
-	_, _ = f.Write([]byte{byte(l % 256), byte(l / 256)})
-	_, _ = f.Write(d)
-
-	return nil
-}
-
-func logChatMessage(c *model.ChatMessage) error {
-	if c.FromUID == WELCOME_MESSAGE_FROM_UID {
-		return nil
-	}
-
-	fd, err := os.OpenFile("msg.log", os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
-	if err != nil {
-		return nil
-	}
-
-	defer fd.Close()
-	_, err = fmt.Fprintf(fd, "%s %s (%s) -> %s (%s) \"%s\"\n", c.Time, c.From, c.FromUID, c.Chatroom, c.ToUID, c.Text)
-
-	return err
-}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/internal/database"
+)
+
+var (
+	errFileTooLarge = errors.New("file is too large")
+	errTooManyFiles = errors.New("files count quota exceeded")
+	errNoSpace      = errors.New("storage quota exceeded")
+)
+
+// uploadLimit is how many bytes the upload can have before it breaks a quota.
+type uploadLimit struct {
+	n   int64
+	err error
+}
+
+func (l *uploadLimit) lower(n int64, err error) {
+	if l.n < 0 || n < l.n {
+		l.n = max(n, 0)
+		l.err = err
+	}
+}
+
+// Reader fails with the quota error when r has more data than the limit.
+func (l *uploadLimit) Reader(r io.Reader) io.Reader {
+	if l.n < 0 {
+		return r
+	}
+
+	return &limitReader{r: r, left: l.n, err: l.err}
+}
+
+type limitReader struct {
+	r    io.Reader
+	left int64
+	err  error
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.left -= int64(n)
+
+	if lr.left < 0 {
+		return n, lr.err
+	}
+
+	return n, err
+}
+
+// checkQuota checks that one more file of given size fits into the scope and user quotas.
+// Size is -1 if it is not known yet, returned limit is to be checked while the file is read.
+func (app *App) checkQuota(scope, login string, size int64) (*uploadLimit, error) {
+	l := &uploadLimit{n: -1}
+
+	su, err := app.dbm.ScopeFilesUsage(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.apply(app.config.ScopeQuota(scope), su[scope], "scope "+scope); err != nil {
+		return nil, err
+	}
+
+	if login != "" {
+		uu, err := app.dbm.UserFilesUsage(login)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := l.apply(app.config.UserQuota(login), uu[login], "user "+login); err != nil {
+			return nil, err
+		}
+	}
+
+	if size >= 0 && l.n >= 0 && size > l.n {
+		return nil, l.err
+	}
+
+	return l, nil
+}
+
+func (l *uploadLimit) apply(q config.Quota, u *database.Usage, name string) error {
+	if u == nil {
+		u = new(database.Usage)
+	}
+
+	if q.MaxFiles > 0 && u.Files >= q.MaxFiles {
+		return fmt.Errorf("%w: %s has %d files", errTooManyFiles, name, u.Files)
+	}
+
+	if q.MaxFileSize > 0 {
+		l.lower(q.MaxFileSize, fmt.Errorf("%w: %s limit is %d bytes", errFileTooLarge, name, q.MaxFileSize))
+	}
+
+	if q.MaxBytes > 0 {
+		l.lower(q.MaxBytes-u.Bytes, fmt.Errorf("%w: %s has %d of %d bytes", errNoSpace, name, u.Bytes, q.MaxBytes))
+	}
+
+	return nil
+}
+
+func quotaErrorReason(err error) string {
+	switch {
+	case errors.Is(err, errFileTooLarge):
+		return "file_size"
+	case errors.Is(err, errTooManyFiles):
+		return "files"
+	case errors.Is(err, errNoSpace):
+		return "bytes"
+	default:
+		return ""
+	}
+}
+
+// countQuotaError counts rejected upload if the error is a quota one.
+func countQuotaError(scope string, err error) {
+	if r := quotaErrorReason(err); r != "" {
+		quotaRejectedMetric.WithLabelValues(scope, r).Inc()
+	}
+}
+
+// uploadError sends 413 and 507 for quota errors, 406 for others.
+func uploadError(ctx *fiber.Ctx, err error) error {
+	switch quotaErrorReason(err) {
+	case "file_size":
+		return ctx.Status(fiber.StatusRequestEntityTooLarge).SendString(err.Error())
+	case "files", "bytes":
+		return ctx.Status(fiber.StatusInsufficientStorage).SendString(err.Error())
+	default:
+		return ctx.SendStatus(fiber.StatusNotAcceptable)
+	}
+}
+
+type QuotaUsage struct {
+	Name  string       `json:"name"`
+	Files int64        `json:"files"`
+	Bytes int64        `json:"bytes"`
+	Quota config.Quota `json:"quota"`
+}
+
+func getApiQuotaHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		su, err := app.dbm.ScopeFilesUsage("")
+		if err != nil {
+			return err
+		}
+
+		uu, err := app.dbm.UserFilesUsage("")
+		if err != nil {
+			return err
+		}
+
+		scopes := make([]*QuotaUsage, 0, len(su))
+
+		for name, u := range su {
+			if CtxUser(ctx).AdminCanSeeScope(name) {
+				scopes = append(scopes, &QuotaUsage{Name: name, Files: u.Files, Bytes: u.Bytes, Quota: app.config.ScopeQuota(name)})
+			}
+		}
+
+		users := make([]*QuotaUsage, 0, len(uu))
+
+		for name, u := range uu {
+			if !CtxUser(ctx).AdminCanSeeScope(app.users.Get(name).GetScope()) {
+				continue
+			}
+
+			users = append(users, &QuotaUsage{Name: name, Files: u.Files, Bytes: u.Bytes, Quota: app.config.UserQuota(name)})
+		}
+
+		sort.Slice(scopes, func(i, j int) bool { return scopes[i].Name < scopes[j].Name })
+		sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+
+		return ctx.JSON(fiber.Map{"scopes": scopes, "users": users})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuota(t *testing.T) {
+	app := NewTestAppWithConfig(map[string]any{
+		"data_dir":                       t.TempDir(),
+		"quota.max_file_size":            1,
+		"quota.scopes.s1.max_files":      4,
+		"quota.scopes.s1.max_bytes":      2,
+		"quota.users.usr4.max_bytes":     1,
+		"quota.users.usr5.max_file_size": 0,
+	})
+
+	for _, login := range []string{"usr3", "usr4"} {
+		d := Device(login, "1", false, false)
+		d.Scope = "s1"
+		app.dbm.Save(d)
+	}
+
+	var n byte
+
+	data := func(kb int) []byte {
+		n++
+
+		return append(bytes.Repeat([]byte{n}, kb*1024-1), n)
+	}
+
+	upload := func(login string, body io.Reader, multi bool) int {
+		f := fiber.New(fiber.Config{StreamRequestBody: true})
+		f.Use(func(c *fiber.Ctx) error {
+			c.Locals(UsernameKey, login)
+
+			return c.Next()
+		})
+		addMartiRoutes(app.App, f)
+
+		ct := "application/octet-stream"
+
+		if multi {
+			var b bytes.Buffer
+
+			w := multipart.NewWriter(&b)
+			fw, _ := w.CreateFormFile("assetfile", "file.bin")
+			_, _ = io.Copy(fw, body)
+			_ = w.Close()
+
+			body = &b
+			ct = w.FormDataContentType()
+		}
+
+		req, _ := http.NewRequest("POST", "/Marti/sync/upload?name=file.bin", body)
+		req.Header.Set(fiber.HeaderContentType, ct)
+
+		resp, err := f.Test(req, 5000)
+		require.NoError(t, err)
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, fiber.StatusOK, upload("usr3", bytes.NewReader(data(600)), true))
+	assert.Equal(t, fiber.StatusRequestEntityTooLarge, upload("usr3", bytes.NewReader(data(1200)), true))
+	assert.Equal(t, fiber.StatusOK, upload("usr3", bytes.NewReader(data(600)), false))
+	assert.Equal(t, fiber.StatusOK, upload("usr4", bytes.NewReader(data(600)), false))
+
+	// unknown size, user has 424 KB left
+	limit, err := app.checkQuota("s1", "usr4", -1)
+	require.NoError(t, err)
+
+	_, _, err = app.files.PutFile("s1", "", limit.Reader(bytes.NewReader(data(500))))
+	require.ErrorIs(t, err, errNoSpace)
+
+	_, err = app.checkQuota("s1", "usr4", 500*1024)
+	require.ErrorIs(t, err, errNoSpace)
+
+	assert.Equal(t, fiber.StatusOK, upload("usr3", bytes.NewReader(data(10)), false))
+	assert.Equal(t, fiber.StatusInsufficientStorage, upload("usr3", bytes.NewReader(data(10)), true))
+
+	usage, err := app.dbm.ScopeFilesUsage("s1")
+	require.NoError(t, err)
+	require.Contains(t, usage, "s1")
+	assert.Equal(t, int64(4), usage["s1"].Files)
+	assert.Equal(t, int64(1810*1024), usage["s1"].Bytes)
+
+	users, err := app.dbm.UserFilesUsage("")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), users["usr4"].Files)
+
+	// rejected upload is not stored
+	blobs, err := app.files.List()
+	require.NoError(t, err)
+	assert.Len(t, blobs, 4)
+
+	q := app.config.ScopeQuota("s1")
+	assert.Equal(t, int64(1024*1024), q.MaxFileSize)
+	assert.Equal(t, int64(0), app.config.MaxUploadSize())
+	assert.Equal(t, int64(1024*1024), app.config.UserQuota("usr4").MaxBytes)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/internal/pm"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// blobs younger than this can be uploaded right now and have no resource yet
+const orphanBlobGrace = time.Hour
+
+const (
+	reasonExpired = "expired"
+	reasonMaxAge  = "max_age"
+	reasonMaxSize = "max_size"
+	reasonOrphan  = "orphan"
+	reasonDeleted = "deleted"
+)
+
+type RetentionStats struct {
+	Time     time.Time        `json:"time"`
+	Duration time.Duration    `json:"duration"`
+	Files    map[string]int   `json:"files"`
+	Bytes    map[string]int64 `json:"bytes"`
+	Errors   int              `json:"errors"`
+}
+
+func (s *RetentionStats) add(reason string, size int64) {
+	s.Files[reason]++
+	s.Bytes[reason] += size
+
+	retentionFilesMetric.WithLabelValues(reason).Inc()
+	retentionBytesMetric.WithLabelValues(reason).Add(float64(size))
+}
+
+func (app *App) retentionLoop(ctx context.Context) {
+	ticker := time.NewTicker(app.config.RetentionInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.runRetention()
+		}
+	}
+}
+
+// runRetention removes expired files and files out of scope limits, then blobs no file refers to if enabled.
+// Files added to missions are kept.
+func (app *App) runRetention() *RetentionStats {
+	st := &RetentionStats{Time: time.Now(), Files: make(map[string]int), Bytes: make(map[string]int64)}
+
+	app.removeResources(st, reasonExpired, app.dbm.ResourceQuery().Expired().NotInMission().Limit(0).Get())
+
+	usage, err := app.dbm.ScopeUsage()
+	if err != nil {
+		app.logger.Error("retention: can't get scope usage", slog.Any("error", err))
+		st.Errors++
+	}
+
+	for scope, size := range usage {
+		p := app.config.RetentionPolicy(scope)
+
+		if p.MaxAge > 0 {
+			old := app.dbm.ResourceQuery().Scope(scope).Before(time.Now().Add(-p.MaxAge)).NotInMission().Limit(0).Get()
+
+			for _, r := range old {
+				size -= int64(r.Size)
+			}
+
+			app.removeResources(st, reasonMaxAge, old)
+		}
+
+		if p.MaxSize > 0 && size > p.MaxSize {
+			var del []*model.Resource
+
+			for _, r := range app.dbm.ResourceQuery().Scope(scope).NotInMission().Limit(0).Get() {
+				if size <= p.MaxSize {
+					break
+				}
+
+				del = append(del, r)
+				size -= int64(r.Size)
+			}
+
+			app.removeResources(st, reasonMaxSize, del)
+		}
+	}
+
+	if app.config.RetentionOrphanBlobs() {
+		app.removeOrphanBlobs(st)
+	}
+
+	st.Duration = time.Since(st.Time)
+	app.retention.Store(st)
+
+	var n int
+	var size int64
+
+	for reason, c := range st.Files {
+		n += c
+		size += st.Bytes[reason]
+	}
+
+	if n > 0 {
+		app.logger.Info(fmt.Sprintf("retention: %d files removed, %d bytes reclaimed", n, size))
+	}
+
+	return st
+}
+
+func (app *App) removeResources(st *RetentionStats, reason string, res []*model.Resource) {
+	for _, r := range res {
+		size, err := app.removeResource(r)
+		if err != nil {
+			app.logger.Error("retention: can't remove "+r.String(), slog.Any("error", err))
+			st.Errors++
+
+			continue
+		}
+
+		app.logger.Info(fmt.Sprintf("retention: %s removed (%s)", r.String(), reason))
+		st.add(reason, size)
+	}
+}
+
+// removeResource deletes the resource and its blob if no other resource has it. Returns the size of removed blob.
+func (app *App) removeResource(r *model.Resource) (int64, error) {
+	if err := app.dbm.DeleteResource(r.ID); err != nil {
+		return 0, err
+	}
+
+	if app.dbm.BlobInUse(r.Scope, r.Hash) {
+		return 0, nil
+	}
+
+	fi, err := app.files.GetFileStat(r.Scope, r.Hash)
+	if err != nil {
+		// not a blob, e.g. recorded video
+		return 0, nil
+	}
+
+	if err := app.files.Delete(r.Scope, r.Hash); err != nil && !errors.Is(err, pm.ErrNotFound) {
+		return 0, err
+	}
+
+	return fi.Size, nil
+}
+
+func (app *App) removeOrphanBlobs(st *RetentionStats) {
+	blobs, err := app.files.List()
+	if err != nil {
+		app.logger.Error("retention: can't list blobs", slog.Any("error", err))
+		st.Errors++
+
+		return
+	}
+
+	for _, b := range blobs {
+		if time.Since(b.ModTime) < orphanBlobGrace || app.dbm.BlobInUse(b.Scope, b.Hash) {
+			continue
+		}
+
+		if err := app.files.Delete(b.Scope, b.Hash); err != nil {
+			app.logger.Error(fmt.Sprintf("retention: can't remove blob %s/%s", b.Scope, b.Hash), slog.Any("error", err))
+			st.Errors++
+
+			continue
+		}
+
+		app.logger.Info(fmt.Sprintf("retention: orphan blob %s/%s removed", b.Scope, b.Hash))
+		st.add(reasonOrphan, b.Size)
+	}
+}
+
+func getApiRetentionHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		usage, err := app.dbm.ScopeUsage()
+		if err != nil {
+			return err
+		}
+
+		for scope := range usage {
+			if !CtxUser(ctx).AdminCanSeeScope(scope) {
+				delete(usage, scope)
+			}
+		}
+
+		return ctx.JSON(fiber.Map{"last": app.retention.Load(), "usage": usage})
+	}
+}
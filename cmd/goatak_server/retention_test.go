@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	app := NewTestAppWithConfig(map[string]any{
+		"data_dir":                     dir,
+		"retention.max_age":            "1h",
+		"retention.scopes.s1.max_age":  "24h",
+		"retention.scopes.s2.max_size": 1,
+		"retention.scopes.s3.max_age":  "0",
+	})
+
+	var n byte
+
+	// blob of size*3+1 bytes
+	blob := func(scope string, size int, old bool) string {
+		n++
+		data := append(bytes.Repeat([]byte(scope+"x"), size), n)
+
+		hash, _, err := app.files.PutFile(scope, "", bytes.NewReader(data))
+		require.NoError(t, err)
+
+		if old {
+			tm := time.Now().Add(-time.Hour * 2)
+			require.NoError(t, os.Chtimes(filepath.Join(dir, "blob", scope, hash), tm, tm))
+		}
+
+		return hash
+	}
+
+	resource := func(scope, hash string, size int, age time.Duration, exp int64) *model.Resource {
+		r := &model.Resource{
+			Scope:      scope,
+			Hash:       hash,
+			FileName:   hash[:8],
+			Size:       size,
+			CreatedAt:  time.Now().Add(-age),
+			Expiration: exp,
+		}
+		require.NoError(t, app.dbm.Create(r))
+
+		return r
+	}
+
+	exists := func(scope, hash string) bool {
+		_, err := app.files.GetFileStat(scope, hash)
+
+		return err == nil
+	}
+
+	past := time.Now().Add(-time.Minute).Unix()
+	mb := 1024 * 1024
+
+	// expired resource, blob is shared with other resource
+	h1 := blob("s3", 100, false)
+	resource("s3", h1, 100, 0, past)
+	h2 := blob("s3", 200, false)
+	resource("s3", h2, 200, 0, past)
+	resource("s3", h2, 200, 0, -1)
+
+	// old resources, one of them is in mission
+	h3 := blob("s1", 300, false)
+	resource("s1", h3, 300, time.Hour*48, -1)
+	h4 := blob("s1", 400, false)
+	resource("s1", h4, 400, time.Hour*48, -1)
+	h5 := blob("s1", 500, false)
+	resource("s1", h5, 500, time.Hour, -1)
+
+	m := &model.Mission{Name: "m1", Scope: "s1", CreatorUID: "uid1"}
+	require.NoError(t, app.dbm.CreateMission(m))
+	require.NotNil(t, app.dbm.AddMissionResource(m, h4, "uid1"))
+
+	// expired resource in mission
+	h11 := blob("s1", 1100, false)
+	resource("s1", h11, 1100, 0, past)
+	require.NotNil(t, app.dbm.AddMissionResource(m, h11, "uid1"))
+
+	// scope over its size
+	h6 := blob("s2", mb/2, false)
+	resource("s2", h6, mb/2, time.Minute*3, -1)
+	h7 := blob("s2", mb/2, false)
+	resource("s2", h7, mb/2, time.Minute*2, -1)
+	h8 := blob("s2", mb/2, false)
+	resource("s2", h8, mb/2, time.Minute, -1)
+
+	// orphans
+	h9 := blob("s1", 900, true)
+	h10 := blob("s1", 1000, false)
+
+	st := app.runRetention()
+
+	assert.Equal(t, 0, st.Errors)
+	assert.Equal(t, map[string]int{reasonExpired: 2, reasonMaxAge: 1, reasonMaxSize: 1, reasonOrphan: 1}, st.Files)
+	assert.Equal(t, int64(3*100+1), st.Bytes[reasonExpired])
+	assert.Equal(t, st, app.retention.Load())
+
+	assert.False(t, exists("s3", h1))
+	assert.True(t, exists("s3", h2))
+	assert.False(t, exists("s1", h3))
+	assert.True(t, exists("s1", h4))
+	assert.True(t, exists("s1", h5))
+	assert.False(t, exists("s2", h6))
+	assert.True(t, exists("s2", h7))
+	assert.True(t, exists("s2", h8))
+	assert.False(t, exists("s1", h9))
+	assert.True(t, exists("s1", h10))
+	assert.True(t, exists("s1", h11))
+
+	assert.Nil(t, app.dbm.ResourceQuery().Scope("s1").Hash(h3).One())
+	assert.NotNil(t, app.dbm.ResourceQuery().Scope("s1").Hash(h4).One())
+	assert.NotNil(t, app.dbm.ResourceQuery().Scope("s1").Hash(h11).One())
+	assert.Error(t, app.dbm.DeleteResource(app.dbm.ResourceQuery().Scope("s1").Hash(h11).One().ID))
+
+	// second run has nothing to do
+	st = app.runRetention()
+	assert.Empty(t, st.Files)
+}
+
+func TestRetentionOrphansDisabled(t *testing.T) {
+	dir := t.TempDir()
+	app := NewTestAppWithConfig(map[string]any{
+		"data_dir":               dir,
+		"retention.orphan_blobs": false,
+	})
+
+	hash, _, err := app.files.PutFile("s1", "", bytes.NewReader([]byte("orphan")))
+	require.NoError(t, err)
+
+	tm := time.Now().Add(-time.Hour * 2)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "blob", "s1", hash), tm, tm))
+
+	st := app.runRetention()
+	assert.Empty(t, st.Files)
+
+	_, err = app.files.GetFileStat("s1", hash)
+	assert.NoError(t, err)
+}
+
+func TestDeleteMissionFile(t *testing.T) {
+	app := NewTestAppWithConfig(map[string]any{"data_dir": t.TempDir()})
+
+	hash, _, err := app.files.PutFile("", "", bytes.NewReader([]byte("data")))
+	require.NoError(t, err)
+
+	r := &model.Resource{Hash: hash, FileName: "f1", Size: 4, Expiration: -1}
+	require.NoError(t, app.dbm.Create(r))
+
+	m := &model.Mission{Name: "m1", CreatorUID: "uid1"}
+	require.NoError(t, app.dbm.CreateMission(m))
+	require.NotNil(t, app.dbm.AddMissionResource(m, hash, "uid1"))
+
+	resp, err := app.Req("GET", fmt.Sprintf("/api/file/delete/%d", r.ID), app.Token(t, "adm1", "111"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusFound, resp.StatusCode)
+
+	assert.Nil(t, app.dbm.ResourceQuery().Id(r.ID).One())
+	assert.Empty(t, app.dbm.MissionQuery().Id(m.ID).Full().One().Resources)
+
+	// the last change is the first one
+	changes := app.dbm.ChangeQuery().Mission(m.ID).Get()
+	require.NotEmpty(t, changes)
+	assert.Equal(t, model.CHANGE_TYPE_REMOVE, changes[0].Type)
+	assert.Equal(t, hash, changes[0].ContentHash)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func roleDevice(t *testing.T, app *TestApp, login, role string) string {
+	t.Helper()
+
+	d := Device(login, login, true, false)
+	d.Role = role
+	d.ReadScope = []string{"s"}
+	require.NoError(t, app.dbm.Save(d))
+
+	return app.Token(t, login, login)
+}
+
+func putJSON(t *testing.T, app *TestApp, url, token string, obj any) int {
+	t.Helper()
+
+	b, err := json.Marshal(obj)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("PUT", url, strings.NewReader(string(b)))
+	require.NoError(t, err)
+	req.Header.Add(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	resp, err := app.api.f.Test(req, 3000)
+	require.NoError(t, err)
+
+	return resp.StatusCode
+}
+
+func status(t *testing.T, app *TestApp, method, url, token string) int {
+	t.Helper()
+
+	resp, err := app.Req(method, url, token, nil)
+	require.NoError(t, err)
+
+	return resp.StatusCode
+}
+
+func TestRoles(t *testing.T) {
+	app := NewTestApp()
+
+	viewer := roleDevice(t, app, "viewer", model.ROLE_VIEWER)
+	operator := roleDevice(t, app, "operator", model.ROLE_OPERATOR)
+	manager := roleDevice(t, app, "manager", model.ROLE_USER_MANAGER)
+	admin := roleDevice(t, app, "admin", "")
+
+	t.Run("viewer", func(t *testing.T) {
+		assert.Equal(t, fiber.StatusOK, status(t, app, "GET", "/api/unit", viewer))
+		assert.Equal(t, fiber.StatusOK, status(t, app, "GET", "/api/alert", viewer))
+		assert.Equal(t, fiber.StatusForbidden, status(t, app, "DELETE", "/api/unit/uid1", viewer))
+		assert.Equal(t, fiber.StatusForbidden, status(t, app, "POST", "/cot_xml?scope=s", viewer))
+		assert.Equal(t, fiber.StatusForbidden, status(t, app, "GET", "/api/message", viewer))
+		assert.Equal(t, fiber.StatusForbidden, status(t, app, "GET", "/api/device", viewer))
+		assert.Equal(t, fiber.StatusForbidden, status(t, app, "GET", "/devices", viewer))
+		assert.Equal(t, fiber.StatusForbidden, putJSON(t, app, "/api/device/usr1", viewer, fiber.Map{"disabled": true}))
+
+		// map is shown without delete buttons
+		resp, err := app.Req("GET", "/map", viewer, nil)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), "deleteCurrentUnit")
+
+		resp, err = app.Req("GET", "/", viewer, nil)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		b, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), `href="/devices"`)
+		assert.Contains(t, string(b), `href="/units"`)
+	})
+
+	t.Run("operator", func(t *testing.T) {
+		assert.Equal(t, fiber.StatusOK, status(t, app, "GET", "/api/message", operator))
+		assert.NotEqual(t, fiber.StatusForbidden, status(t, app, "DELETE", "/api/unit/uid1", operator))
+		assert.Equal(t, fiber.StatusForbidden, status(t, app, "GET", "/api/device", operator))
+		assert.Equal(t, fiber.StatusForbidden, status(t, app, "GET", "/api/audit", operator))
+	})
+
+	t.Run("user_manager", func(t *testing.T) {
+		assert.Equal(t, fiber.StatusOK, status(t, app, "GET", "/api/device", manager))
+		assert.Equal(t, fiber.StatusOK, status(t, app, "GET", "/api/audit", manager))
+		assert.Equal(t, fiber.StatusForbidden, status(t, app, "GET", "/api/message", manager))
+		assert.Equal(t, fiber.StatusForbidden, status(t, app, "DELETE", "/api/unit/uid1", manager))
+
+		assert.Equal(t, fiber.StatusOK, putJSON(t, app, "/api/device/usr1", manager, fiber.Map{"disabled": true}))
+		assert.True(t, app.dbm.DeviceQuery().Login("usr1").One().Disabled)
+
+		// admins with more permissions can't be changed or made
+		assert.Equal(t, fiber.StatusForbidden, putJSON(t, app, "/api/device/adm1", manager, fiber.Map{"disabled": true}))
+		assert.Equal(t, fiber.StatusForbidden, putJSON(t, app, "/api/device/viewer", manager,
+			fiber.Map{"role": model.ROLE_OPERATOR}))
+
+		resp, err := app.PostJSON("/api/device", manager, fiber.Map{"login": "op2", "password": "1", "scope": "s",
+			"admin": true, "role": model.ROLE_OPERATOR})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.PostJSON("/api/device", manager, fiber.Map{"login": "view2", "password": "1", "scope": "s",
+			"admin": true, "role": model.ROLE_VIEWER})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, model.ROLE_VIEWER, app.dbm.DeviceQuery().Login("view2").One().Role)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		// admin without role has all permissions
+		for _, url := range []string{"/api/unit", "/api/message", "/api/device", "/api/audit", "/devices"} {
+			assert.Equal(t, fiber.StatusOK, status(t, app, "GET", url, admin), url)
+		}
+
+		// every page has full menu and user's role
+		for _, url := range []string{"/", "/units", "/missions", "/files", "/points", "/devices", "/profiles", "/feeds",
+			"/messages", "/outbox", "/alerts", "/audit"} {
+			resp, err := app.Req("GET", url, admin, nil)
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusOK, resp.StatusCode, url)
+
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Contains(t, string(b), "admin (admin)", url)
+			assert.Contains(t, string(b), `href="/audit"`, url)
+			assert.Contains(t, string(b), `href="/devices"`, url)
+		}
+
+		assert.Equal(t, fiber.StatusOK, putJSON(t, app, "/api/device/viewer", admin,
+			fiber.Map{"role": model.ROLE_OPERATOR}))
+		assert.Equal(t, model.ROLE_OPERATOR, app.dbm.DeviceQuery().Login("viewer").One().Role)
+
+		resp, err := app.PostJSON("/api/device", admin, fiber.Map{"login": "sa2", "password": "1", "scope": "s",
+			"admin": true, "role": model.ROLE_SUPERADMIN})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.PostJSON("/api/device", admin, fiber.Map{"login": "bad", "password": "1", "scope": "s",
+			"admin": true, "role": "bad"})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotAcceptable, resp.StatusCode)
+
+		// the same rules for api tokens
+		resp, err = app.PostJSON("/api/token", manager, fiber.Map{"name": "t1", "scope": "s", "role": model.ROLE_OPERATOR})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.PostJSON("/api/token", admin, fiber.Map{"name": "t1", "scope": "s", "role": model.ROLE_VIEWER})
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var tok model.ApiTokenDTO
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&tok))
+
+		assert.Equal(t, fiber.StatusOK, status(t, app, "GET", "/api/unit", tok.Token))
+		assert.Equal(t, fiber.StatusForbidden, status(t, app, "DELETE", "/api/unit/uid1", tok.Token))
+	})
+}
+
+func TestRequirePermNoUser(t *testing.T) {
+	f := fiber.New()
+	f.Get("/", requirePerm(model.PERM_VIEW), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	resp, err := f.Test(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestCotXMLAuth(t *testing.T) {
+	post := func(app *TestApp, url, token string) int {
+		t.Helper()
+
+		resp, err := app.Req("POST", url, token, strings.NewReader(fmt.Sprintf(packageCot, "p1", "p1")))
+		require.NoError(t, err)
+
+		return resp.StatusCode
+	}
+
+	scope := func(app *TestApp) string {
+		t.Helper()
+
+		select {
+		case msg := <-app.ch:
+			return msg.Scope
+		default:
+			return ""
+		}
+	}
+
+	app := NewTestApp()
+	admin := roleDevice(t, app, "admin", "")
+
+	// token is checked on no auth path too
+	assert.Equal(t, fiber.StatusOK, post(app, "/cot_xml?scope=s", admin))
+	assert.Equal(t, "s", scope(app))
+	assert.Equal(t, fiber.StatusForbidden, post(app, "/cot_xml?scope=other", admin))
+	assert.Equal(t, fiber.StatusUnauthorized, post(app, "/cot_xml?scope=s", "bad"))
+
+	// posts without token are disabled by default
+	assert.Equal(t, fiber.StatusUnauthorized, post(app, "/cot_xml", ""))
+
+	app = NewTestAppWithConfig(map[string]any{"cot_xml_scope": "anon"})
+
+	assert.Equal(t, fiber.StatusOK, post(app, "/cot_xml", ""))
+	assert.Equal(t, "anon", scope(app))
+	assert.Equal(t, fiber.StatusForbidden, post(app, "/cot_xml?scope=s", ""))
+}
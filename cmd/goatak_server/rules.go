@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+func (app *App) rulesProcessor(msg *cot.CotMessage) bool {
+	if app.rules.Apply(msg, app.getLogin(msg.From)) {
+		return true
+	}
+
+	app.logger.Debug(fmt.Sprintf("msg %s %s from %s is dropped by rule", msg.GetType(), msg.GetUID(), msg.From))
+
+	return false
+}
+
+func (app *App) getLogin(from string) string {
+	if v, ok := app.handlers.Load(from); ok {
+		return v.(client.ClientHandler).GetDevice().GetLogin()
+	}
+
+	return ""
+}
+
+func (app *App) loadRules(conf *config.AppConfig) error {
+	r, err := conf.Rules()
+	if err != nil {
+		return err
+	}
+
+	if err := app.rules.SetRules(r); err != nil {
+		return err
+	}
+
+	app.logger.Info(fmt.Sprintf("%d routing rules loaded", len(r)))
+
+	return nil
+}
+
+func (app *App) reloadRules() {
+	conf := config.NewAppConfig()
+
+	if !conf.Load(app.config.Files()...) {
+		return
+	}
+
+	if err := app.loadRules(conf); err != nil {
+		app.logger.Error("rules are not changed", slog.Any("error", err))
+	}
+}
+
+// watchRules reloads rules when config file is changed.
+func (app *App) watchRules(ctx context.Context) error {
+	files := app.config.Files()
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+
+	// watch directories, editors often replace file instead of writing to it
+	for _, f := range files {
+		name := filepath.Clean(f)
+		names = append(names, name)
+
+		if err := watcher.Add(filepath.Dir(name)); err != nil {
+			_ = watcher.Close()
+
+			return err
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if event.Has(fsnotify.Write|fsnotify.Create) && slices.Contains(names, filepath.Clean(event.Name)) {
+					app.logger.Info("config file is modified, reloading rules")
+					app.reloadRules()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				app.logger.Error("watcher error", slog.Any("error", err))
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (app *App) sendToLogins(logins []string, msg *cot.CotMessage) {
+	app.ForAllClients(func(ch client.ClientHandler) bool {
+		if ch.GetName() != msg.From && slices.Contains(logins, ch.GetDevice().GetLogin()) {
+			if err := ch.SendMsg(msg); err != nil {
+				app.logger.Error("send error", slog.Any("error", err))
+			}
+		}
+
+		return true
+	})
+}
+
+// sendCopy sends message as if it was from other scope to clients that did not get the original one.
+func (app *App) sendCopy(scope string, msg *cot.CotMessage) {
+	c := *msg
+	c.Scope = scope
+
+	app.ForAllClients(func(ch client.ClientHandler) bool {
+		if ch.GetName() != msg.From && !ch.GetDevice().CanSeeScope(msg.Scope) {
+			if err := ch.SendMsg(&c); err != nil {
+				app.logger.Error("send error", slog.Any("error", err))
+			}
+		}
+
+		return true
+	})
+}
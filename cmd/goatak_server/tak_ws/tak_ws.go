@@ -12,6 +12,7 @@ import (
 
 	"github.com/gofiber/contrib/websocket"
 
+	"github.com/kdudkov/goatak/internal/client"
 	"github.com/kdudkov/goatak/pkg/cot"
 	"github.com/kdudkov/goatak/pkg/cotproto"
 	"github.com/kdudkov/goatak/pkg/model"
@@ -24,7 +25,7 @@ type WsClientHandler struct {
 	name      string
 	user      *model.Device
 	ws        *websocket.Conn
-	ch        chan []byte
+	queue     *client.SendQueue
 	uids      sync.Map
 	active    int32
 	messageCb MessageCb
@@ -37,7 +38,7 @@ func New(name string, user *model.Device, ws *websocket.Conn, mc MessageCb) *WsC
 		user:      user,
 		ws:        ws,
 		uids:      sync.Map{},
-		ch:        make(chan []byte, 10),
+		queue:     client.NewSendQueue(nil),
 		active:    1,
 		messageCb: mc,
 	}
@@ -96,6 +97,10 @@ func (w *WsClientHandler) GetLastSeen() *time.Time {
 	return nil
 }
 
+func (w *WsClientHandler) GetQueueStats() *client.QueueStats {
+	return w.queue.Stats()
+}
+
 func (w *WsClientHandler) SendMsg(msg *cot.CotMessage) error {
 	if msg.IsLocal() || w.user.CanSeeScope(msg.Scope) {
 		return w.SendCot(msg.GetTakMessage())
@@ -110,23 +115,19 @@ func (w *WsClientHandler) SendCot(msg *cotproto.TakMessage) error {
 		return err
 	}
 
-	if w.tryAddPacket(dat) {
+	if w.tryAddPacket(client.MessagePriority(msg), msg.GetCotEvent().GetUid(), dat) {
 		return nil
 	}
 
 	return fmt.Errorf("client is off")
 }
 
-func (w *WsClientHandler) tryAddPacket(msg []byte) bool {
+func (w *WsClientHandler) tryAddPacket(prio client.Priority, uid string, msg []byte) bool {
 	if !w.IsActive() {
 		return false
 	}
-	select {
-	case w.ch <- msg:
-	default:
-	}
 
-	return true
+	return w.queue.Push(prio, uid, msg)
 }
 
 func (w *WsClientHandler) IsActive() bool {
@@ -134,7 +135,12 @@ func (w *WsClientHandler) IsActive() bool {
 }
 
 func (w *WsClientHandler) writer() {
-	for b := range w.ch {
+	for {
+		b, ok := w.queue.Pop()
+		if !ok {
+			break
+		}
+
 		if err := w.ws.WriteMessage(websocket.BinaryMessage, b); err != nil {
 			w.log.Error("send error", slog.Any("error", err))
 			w.Stop()
@@ -169,7 +175,7 @@ func (w *WsClientHandler) reader() {
 
 func (w *WsClientHandler) Stop() {
 	if atomic.CompareAndSwapInt32(&w.active, 1, 0) {
-		close(w.ch)
+		w.queue.Close()
 		_ = w.ws.Close()
 	}
 }
@@ -5,12 +5,14 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"time"
 
 	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/pkg/model"
 	"github.com/kdudkov/goatak/pkg/tlsutil"
 )
 
@@ -100,6 +102,12 @@ func (app *App) processTLSConn(ctx context.Context, conn *tls.Conn) {
 
 	if err := conn.HandshakeContext(ctx1); err != nil {
 		app.logger.Debug("Handshake error", slog.Any("error", err))
+
+		var ce *certRejectedError
+		if errors.As(err, &ce) {
+			app.auditCertRejected(ce.user, ce.sn, conn.RemoteAddr())
+		}
+
 		_ = conn.Close()
 
 		return
@@ -109,7 +117,10 @@ func (app *App) processTLSConn(ctx context.Context, conn *tls.Conn) {
 	username, sn := getCertUser(&st)
 	uid := getCertUID(&st)
 	if !app.users.IsValid(username, sn) {
-		app.logger.Info(fmt.Sprintf("bad user %s, sn %s", username, sn))
+		app.logger.Info(fmt.Sprintf("bad user or certificate %s, sn %s", username, sn))
+		app.auditCertRejected(username, sn, conn.RemoteAddr())
+		_ = conn.Close()
+
 		return
 	}
 
@@ -134,14 +145,40 @@ func (app *App) verifyConnection(st tls.ConnectionState) error {
 	tlsutil.LogCerts(app.logger, st.PeerCertificates...)
 
 	if !app.users.IsValid(user, sn) {
-		app.logger.Warn("bad user " + user)
+		app.logger.Warn(fmt.Sprintf("bad user or certificate %s, sn %s", user, sn))
 
-		return fmt.Errorf("bad user")
+		return &certRejectedError{user: user, sn: sn}
 	}
 
 	return nil
 }
 
+// certRejectedError keeps the user of rejected certificate, so the rejection can be audited with client address.
+type certRejectedError struct {
+	user string
+	sn   string
+}
+
+func (e *certRejectedError) Error() string {
+	return "bad user or certificate"
+}
+
+func (app *App) auditCertRejected(user, sn string, addr net.Addr) {
+	e := &model.AuditEvent{
+		Actor:   user,
+		Action:  model.AUDIT_CERT_REJECTED,
+		Target:  sn,
+		Scope:   app.users.Get(user).GetScope(),
+		Details: "tls",
+	}
+
+	if a, ok := addr.(*net.TCPAddr); ok {
+		e.SourceIP = a.IP.String()
+	}
+
+	app.audit.Add(e)
+}
+
 func getCert(st *tls.ConnectionState) *x509.Certificate {
 	for _, cert := range st.PeerCertificates {
 		if cert.Subject.CommonName != "" {
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/kdudkov/goatak/internal/cache"
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	tokenTypeApi = "api"
+	// last use of api token is written not more often than this
+	tokenTouchInterval = time.Minute
+	tokenLoopInterval  = time.Hour
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Type string `json:"typ,omitempty"`
+}
+
+// TokenManager signs and checks admin session and api tokens. Signing keys are stored in database, so tokens
+// survive restarts. Tokens have the key id in kid header, retired keys are kept until tokens signed by them expire.
+type TokenManager struct {
+	logger     *slog.Logger
+	dbm        *database.DatabaseManager
+	rotation   time.Duration
+	sessionTTL time.Duration
+
+	mx      sync.RWMutex
+	keys    []*model.SigningKey
+	revoked map[string]bool
+
+	tokens  *cache.Cache[*model.ApiToken]
+	touched sync.Map
+}
+
+func NewTokenManager(dbm *database.DatabaseManager, rotation, sessionTTL time.Duration) (*TokenManager, error) {
+	m := &TokenManager{
+		logger:     slog.With(slog.String("logger", "tokens")),
+		dbm:        dbm,
+		rotation:   rotation,
+		sessionTTL: sessionTTL,
+		revoked:    make(map[string]bool),
+	}
+
+	m.tokens = cache.NewWithTTL(time.Second*10, func(id string) *model.ApiToken {
+		return dbm.ApiTokenQuery().Id(id).One()
+	})
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	if err := m.RotateIfNeeded(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *TokenManager) load() error {
+	keys, err := m.dbm.SigningKeys()
+	if err != nil {
+		return err
+	}
+
+	ids, err := m.dbm.RevokedTokens()
+	if err != nil {
+		return err
+	}
+
+	revoked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		revoked[id] = true
+	}
+
+	m.mx.Lock()
+	m.keys = keys
+	m.revoked = revoked
+	m.mx.Unlock()
+
+	return nil
+}
+
+func (m *TokenManager) current() *model.SigningKey {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	if len(m.keys) == 0 {
+		return nil
+	}
+
+	return m.keys[0]
+}
+
+func (m *TokenManager) key(id string) []byte {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	for _, k := range m.keys {
+		if k.ID == id {
+			return k.Key
+		}
+	}
+
+	return nil
+}
+
+// RotateIfNeeded creates the first key or the new one when the current is older than rotation period.
+func (m *TokenManager) RotateIfNeeded() error {
+	k := m.current()
+
+	if k != nil && (m.rotation <= 0 || time.Since(k.CreatedAt) < m.rotation) {
+		return nil
+	}
+
+	return m.Rotate(false)
+}
+
+// Rotate makes the new signing key and retires the others. With drop old keys are removed at once,
+// so all issued tokens become invalid.
+func (m *TokenManager) Rotate(drop bool) error {
+	b := make([]byte, 72)
+
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	k := &model.SigningKey{ID: hex.EncodeToString(b[:8]), Key: b[8:], CreatedAt: time.Now()}
+
+	if err := m.dbm.Create(k); err != nil {
+		return err
+	}
+
+	if drop {
+		if _, err := m.dbm.DropSigningKeys(k.ID); err != nil {
+			return err
+		}
+	} else {
+		for _, old := range m.keysCopy() {
+			if !old.IsRetired() {
+				old.RetiredAt = &k.CreatedAt
+
+				if err := m.dbm.Save(old); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	m.logger.Info("token signing key rotated", slog.String("kid", k.ID), slog.Bool("drop", drop))
+
+	return m.load()
+}
+
+func (m *TokenManager) keysCopy() []*model.SigningKey {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	return append([]*model.SigningKey(nil), m.keys...)
+}
+
+// Cleanup removes retired keys no valid token can be signed with and expired revocations.
+func (m *TokenManager) Cleanup() error {
+	if _, err := m.dbm.DeleteSigningKeys(time.Now().Add(-m.sessionTTL)); err != nil {
+		return err
+	}
+
+	if _, err := m.dbm.DeleteExpiredRevocations(); err != nil {
+		return err
+	}
+
+	m.tokens.Clean()
+
+	return m.load()
+}
+
+func (m *TokenManager) sign(claims *tokenClaims) (string, string, error) {
+	k := m.current()
+	if k == nil {
+		return "", "", errUnknownKey
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = k.ID
+
+	s, err := token.SignedString(k.Key)
+
+	return s, k.ID, err
+}
+
+// Parse checks signature and expiration of the token.
+func (m *TokenManager) Parse(tokenStr string) (*tokenClaims, error) {
+	claims := new(tokenClaims)
+
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		if key := m.key(kid); key != nil {
+			return key, nil
+		}
+
+		return nil, errUnknownKey
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// SessionToken issues the token of admin login.
+func (m *TokenManager) SessionToken(login string, ttl time.Duration) (string, error) {
+	now := time.Now()
+
+	s, _, err := m.sign(&tokenClaims{RegisteredClaims: jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Subject:   login,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}})
+
+	return s, err
+}
+
+// IssueApiToken stores the token and returns its string. The string is not stored and can't be shown again.
+func (m *TokenManager) IssueApiToken(t *model.ApiToken) (string, error) {
+	t.ID = uuid.NewString()
+	t.CreatedAt = time.Now()
+
+	claims := &tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       t.ID,
+			Subject:  model.API_TOKEN_PREFIX + t.Name,
+			IssuedAt: jwt.NewNumericDate(t.CreatedAt),
+		},
+		Type: tokenTypeApi,
+	}
+
+	if t.ExpiresAt != nil {
+		claims.ExpiresAt = jwt.NewNumericDate(*t.ExpiresAt)
+	}
+
+	s, kid, err := m.sign(claims)
+	if err != nil {
+		return "", err
+	}
+
+	t.KeyID = kid
+
+	if err := m.dbm.Create(t); err != nil {
+		return "", err
+	}
+
+	return s, nil
+}
+
+func (m *TokenManager) RevokeApiToken(t *model.ApiToken) error {
+	if t.IsRevoked() {
+		return nil
+	}
+
+	t.Revoke()
+
+	if err := m.dbm.Save(t); err != nil {
+		return err
+	}
+
+	m.tokens.Delete(t.ID)
+
+	return nil
+}
+
+// ApiToken returns active api token by id.
+func (m *TokenManager) ApiToken(id string) *model.ApiToken {
+	t := m.tokens.Load(id)
+
+	if !t.IsActive() {
+		return nil
+	}
+
+	if last, ok := m.touched.Load(id); !ok || time.Since(last.(time.Time)) > tokenTouchInterval {
+		m.touched.Store(id, time.Now())
+		_ = m.dbm.ApiTokenQuery().Id(id).Update(map[string]any{"last_used": time.Now()})
+	}
+
+	return t
+}
+
+// Revoke adds the token id to the revocation list until the token expires.
+func (m *TokenManager) Revoke(id string, expires time.Time) error {
+	if id == "" || m.IsRevoked(id) {
+		return nil
+	}
+
+	if err := m.dbm.Save(&model.RevokedToken{ID: id, ExpiresAt: expires}); err != nil {
+		return err
+	}
+
+	m.mx.Lock()
+	m.revoked[id] = true
+	m.mx.Unlock()
+
+	return nil
+}
+
+func (m *TokenManager) IsRevoked(id string) bool {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	return m.revoked[id]
+}
+
+func (app *App) tokenLoop(ctx context.Context) {
+	ticker := time.NewTicker(tokenLoopInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := app.tokens.RotateIfNeeded(); err != nil {
+				app.logger.Error("can't rotate token signing key", slog.Any("error", err))
+			}
+
+			if err := app.tokens.Cleanup(); err != nil {
+				app.logger.Error("token cleanup error", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+func isApiToken(user *model.Device) bool {
+	return user != nil && user.AuthSource == model.API_TOKEN_SOURCE
+}
+
+func getApiTokensHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		q := app.dbm.ApiTokenQuery().ReadScope(CtxUser(ctx).AdminScopes()).Limit(0)
+
+		if ctx.QueryBool("active") {
+			q.Active()
+		}
+
+		data := q.Get()
+		res := make([]*model.ApiTokenDTO, 0, len(data))
+
+		for _, t := range data {
+			res = append(res, t.DTO())
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiTokenPostHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var m *model.ApiTokenPostDTO
+
+		if err := ctx.BodyParser(&m); err != nil {
+			return err
+		}
+
+		if m.Name == "" {
+			return SendError(ctx, "empty name")
+		}
+
+		if m.Scope == "" {
+			return SendError(ctx, "empty scope")
+		}
+
+		if !model.ValidRole(m.Role) {
+			return SendError(ctx, "invalid role "+m.Role)
+		}
+
+		user := CtxUser(ctx)
+
+		t := &model.ApiToken{
+			Name:       m.Name,
+			CreatedBy:  user.GetLogin(),
+			Scope:      m.Scope,
+			ReadScope:  m.ReadScope,
+			SuperAdmin: m.SuperAdmin,
+			Role:       m.Role,
+			ExpiresAt:  m.ExpiresAt,
+		}
+
+		// tokens can't make new tokens, otherwise revoked token could leave its successor
+		if isApiToken(user) || !canGrantScopes(user, m.Scope, m.ReadScope) || !canGrantRole(user, t.Device()) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		if app.dbm.ApiTokenQuery().Name(m.Name).Count() > 0 {
+			return SendError(ctx, fmt.Sprintf("token %s exists", m.Name))
+		}
+
+		if t.ExpiresAt == nil {
+			if ttl := app.config.ApiTokenTTL(); ttl > 0 {
+				exp := time.Now().Add(ttl)
+				t.ExpiresAt = &exp
+			}
+		}
+
+		if t.IsExpired() {
+			return SendError(ctx, "expiration time is in the past")
+		}
+
+		s, err := app.tokens.IssueApiToken(t)
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.logger.Info(fmt.Sprintf("api token %s for scope %s created by %s", t.Name, t.Scope, t.CreatedBy))
+		app.audit.Add(auditEvent(ctx, model.AUDIT_TOKEN_CREATE, t.Name, t.Scope))
+
+		dto := t.DTO()
+		dto.Token = s
+
+		return ctx.JSON(dto)
+	}
+}
+
+func getApiTokenRevokeHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		t := app.dbm.ApiTokenQuery().Id(ctx.Params("id")).One()
+
+		if t == nil || !CtxUser(ctx).AdminCanSeeScope(t.Scope) {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		if err := app.tokens.RevokeApiToken(t); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.logger.Info(fmt.Sprintf("api token %s revoked by %s", t.Name, Username(ctx)))
+		app.audit.Add(auditEvent(ctx, model.AUDIT_TOKEN_REVOKE, t.Name, t.Scope))
+
+		return ctx.JSON(t.DTO())
+	}
+}
+
+func getApiTokenRotateHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if user := CtxUser(ctx); !user.IsSuperAdmin() || isApiToken(user) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		drop := ctx.QueryBool("drop")
+
+		if err := app.tokens.Rotate(drop); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.logger.Info(fmt.Sprintf("token signing key rotated by %s, old keys dropped: %t", Username(ctx), drop))
+
+		e := auditEvent(ctx, model.AUDIT_KEY_ROTATE, app.tokens.current().ID, "")
+		e.Details = fmt.Sprintf("old keys dropped: %t", drop)
+		app.audit.Add(e)
+
+		return ctx.JSON(fiber.Map{"status": "ok"})
+	}
+}
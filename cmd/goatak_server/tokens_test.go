@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func createApiToken(t *testing.T, app *TestApp, token string, m fiber.Map) (int, *model.ApiTokenDTO) {
+	t.Helper()
+
+	resp, err := app.PostJSON("/api/token", token, m)
+	require.NoError(t, err)
+
+	if resp.StatusCode != fiber.StatusOK {
+		return resp.StatusCode, nil
+	}
+
+	res := new(model.ApiTokenDTO)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(res))
+
+	return resp.StatusCode, res
+}
+
+func TestApiTokens(t *testing.T) {
+	app := NewTestApp()
+
+	sa := Device("sa", "sa", true, false)
+	sa.SuperAdmin = true
+	require.NoError(t, app.dbm.Save(sa))
+
+	blue := Device("blue", "blue", true, false)
+	blue.Scope = "blue"
+	require.NoError(t, app.dbm.Save(blue))
+
+	saToken := app.Token(t, "sa", "sa")
+	blueToken := app.Token(t, "blue", "blue")
+
+	code, _ := createApiToken(t, app, blueToken, fiber.Map{"name": "red", "scope": "red"})
+	assert.Equal(t, fiber.StatusForbidden, code)
+
+	code, _ = createApiToken(t, app, blueToken, fiber.Map{"name": "blue", "scope": "blue", "super_admin": true})
+	assert.Equal(t, fiber.StatusForbidden, code)
+
+	code, bt := createApiToken(t, app, blueToken, fiber.Map{"name": "blue", "scope": "blue"})
+	require.Equal(t, fiber.StatusOK, code)
+	require.NotEmpty(t, bt.Token)
+	require.NotNil(t, bt.ExpiresAt)
+	assert.Equal(t, "blue", bt.CreatedBy)
+
+	code, _ = createApiToken(t, app, saToken, fiber.Map{"name": "blue", "scope": "red"})
+	assert.Equal(t, fiber.StatusNotAcceptable, code)
+
+	code, rt := createApiToken(t, app, saToken, fiber.Map{"name": "red", "scope": "red"})
+	require.Equal(t, fiber.StatusOK, code)
+
+	// token acts as admin of its scope
+	resp, err := app.Req("GET", "/api/token", bt.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var list []*model.ApiTokenDTO
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list, 1)
+	assert.Equal(t, "blue", list[0].Name)
+	assert.Empty(t, list[0].Token)
+
+	code, _ = createApiToken(t, app, bt.Token, fiber.Map{"name": "blue2", "scope": "blue"})
+	assert.Equal(t, fiber.StatusForbidden, code)
+
+	resp, err = app.Req("POST", "/cot_xml?scope=red", bt.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp, err = app.Req("DELETE", "/api/token/"+rt.ID, blueToken, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+	// tokens and keys survive restart
+	srv := &HttpServer{log: app.logger, userManager: app.users}
+	srv.tokens, err = NewTokenManager(app.dbm, time.Hour, time.Hour)
+	require.NoError(t, err)
+
+	u, err := srv.checkToken(bt.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "token:blue", u.Login)
+	assert.Equal(t, "blue", u.Scope)
+	assert.True(t, u.CanLogIn())
+
+	u, err = srv.checkToken(saToken)
+	require.NoError(t, err)
+	assert.Equal(t, "sa", u.Login)
+
+	resp, err = app.Req("DELETE", "/api/token/"+bt.ID, blueToken, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.Req("GET", "/api/token", bt.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusFound, resp.StatusCode)
+
+	assert.NotNil(t, app.dbm.ApiTokenQuery().Id(bt.ID).One().RevokedAt)
+
+	// expired
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, app.dbm.ApiTokenQuery().Id(rt.ID).Update(map[string]any{"expires_at": past}))
+	app.tokens.tokens.Delete(rt.ID)
+
+	_, err = app.tokens.Parse(rt.Token)
+	require.NoError(t, err)
+
+	_, err = srv.checkToken(rt.Token)
+	require.Error(t, err)
+
+	code, _ = createApiToken(t, app, saToken, fiber.Map{"name": "old", "scope": "red", "expires_at": past})
+	assert.Equal(t, fiber.StatusNotAcceptable, code)
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	app := NewTestApp()
+
+	token := app.Token(t, "adm1", "111")
+
+	resp, err := app.Req("GET", "/api/config", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	req, err := http.NewRequest("GET", "/logout", nil)
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: cookieName, Value: token})
+
+	_, err = app.api.f.Test(req, 3000)
+	require.NoError(t, err)
+
+	resp, err = app.Req("GET", "/api/config", token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusFound, resp.StatusCode)
+
+	// revocation list is in database
+	m, err := NewTokenManager(app.dbm, time.Hour, time.Hour)
+	require.NoError(t, err)
+
+	claims, err := m.Parse(token)
+	require.NoError(t, err)
+	assert.True(t, m.IsRevoked(claims.ID))
+}
+
+func TestTokenKeyRotation(t *testing.T) {
+	app := NewTestApp()
+
+	sa := Device("sa", "sa", true, false)
+	sa.SuperAdmin = true
+	require.NoError(t, app.dbm.Save(sa))
+
+	token := app.Token(t, "sa", "sa")
+	code, at := createApiToken(t, app, token, fiber.Map{"name": "svc", "scope": "blue"})
+	require.Equal(t, fiber.StatusOK, code)
+
+	resp, err := app.Req("POST", "/api/token/rotate", app.Token(t, "adm1", "111"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	kid := app.tokens.current().ID
+
+	resp, err = app.Req("POST", "/api/token/rotate", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, kid, app.tokens.current().ID)
+
+	// tokens signed with the retired key are still valid
+	for _, s := range []string{token, at.Token} {
+		resp, err = app.Req("GET", "/api/token", s, nil)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	}
+
+	// the key of active api token is kept on cleanup, the key of sessions only goes after session ttl
+	m, err := NewTokenManager(app.dbm, time.Hour, 0)
+	require.NoError(t, err)
+	require.NoError(t, m.Cleanup())
+	assert.NotNil(t, m.key(kid))
+
+	require.NoError(t, app.tokens.RevokeApiToken(app.dbm.ApiTokenQuery().Id(at.ID).One()))
+	require.NoError(t, m.Cleanup())
+	assert.Nil(t, m.key(kid))
+
+	resp, err = app.Req("POST", "/api/token/rotate?drop=true", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.Req("GET", "/api/token", token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusFound, resp.StatusCode)
+}
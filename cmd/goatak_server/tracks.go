@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/internal/database"
+)
+
+const tracksCleanInterval = time.Hour
+
+// trackTTL returns how long track points are kept in database, 0 means forever.
+func (app *App) trackTTL() time.Duration {
+	switch {
+	case app.tracks != nil:
+		return app.config.TrackHistoryTTL()
+	case app.config.PersistItems():
+		return app.config.PersistItemsTrackTTL()
+	default:
+		return 0
+	}
+}
+
+// cleanTracks removes track points older than ttl.
+func (app *App) cleanTracks(ctx context.Context, ttl time.Duration) {
+	ticker := time.NewTicker(tracksCleanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := app.dbm.TrackQuery().Before(time.Now().Add(-ttl)).Delete()
+			if err != nil {
+				app.logger.Error("track cleanup error", slog.Any("error", err))
+
+				continue
+			}
+
+			if n > 0 {
+				app.logger.Info(fmt.Sprintf("%d old track points removed", n))
+			}
+		}
+	}
+}
+
+// setTrackFilter sets uid, time and bbox filters from request parameters.
+func setTrackFilter(ctx *fiber.Ctx, q *database.TrackQuery) error {
+	q.UID(ctx.Query("uid"))
+
+	if v := ctx.Query("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("invalid start time")
+		}
+
+		q.After(t)
+	}
+
+	if v := ctx.Query("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("invalid end time")
+		}
+
+		q.Before(t)
+	}
+
+	if v := ctx.Query("bbox"); v != "" {
+		parts := strings.Split(v, ",")
+		if len(parts) != 4 {
+			return fmt.Errorf("invalid bbox")
+		}
+
+		b := make([]float64, 4)
+
+		for i, s := range parts {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return fmt.Errorf("invalid bbox")
+			}
+
+			b[i] = f
+		}
+
+		q.BBox(b[0], b[1], b[2], b[3])
+	}
+
+	return nil
+}
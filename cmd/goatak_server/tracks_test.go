@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestTrackHistory(t *testing.T) {
+	app := NewTestAppWithConfig(map[string]any{"track_history.enabled": true})
+	require.NotNil(t, app.tracks)
+	app.tracks.Start()
+
+	start := time.Now().Add(-time.Second)
+
+	for i := range 5 {
+		app.saveItemProcessor(newCotMessage("", "unit1", 10+float64(i), 20))
+		app.saveItemProcessor(newCotMessage("", "unit2", 30, 40+float64(i)))
+		app.saveItemProcessor(newCotMessage("b", "unit3", 10, 20))
+	}
+
+	app.tracks.Stop()
+
+	require.Equal(t, int64(15), app.dbm.TrackQuery().Count())
+
+	token := app.Token(t, "adm1", "111")
+
+	getPoints := func(url string) []*model.TrackPointDTO {
+		resp, err := app.Req("GET", url, token, nil)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var res []*model.TrackPointDTO
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+
+		return res
+	}
+
+	// other scope is not visible
+	assert.Len(t, getPoints("/api/track"), 10)
+
+	points := getPoints("/api/track?uid=unit1&start=" + start.UTC().Format(time.RFC3339))
+	require.Len(t, points, 5)
+	assert.InDelta(t, 10., points[0].Lat, 0.0001)
+	assert.InDelta(t, 14., points[4].Lat, 0.0001)
+
+	// lon, lat order
+	points = getPoints("/api/track?bbox=19,11.5,21,20")
+	require.Len(t, points, 3)
+	assert.Equal(t, "unit1", points[0].UID)
+
+	assert.Empty(t, getPoints("/api/track?end="+start.UTC().Format(time.RFC3339)))
+
+	resp, err := app.Req("GET", "/api/track?scope=b", token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp, err = app.Req("GET", "/api/track?bbox=1,2,3", token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotAcceptable, resp.StatusCode)
+
+	for format, s := range map[string]string{"gpx": "<trkpt", "kml": "<gx:coord>", "geojson": "LineString"} {
+		resp, err = app.Req("GET", "/api/track?uid=unit2&format="+format, token, nil)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get(fiber.HeaderContentDisposition), "tracks."+format)
+
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(b), s)
+	}
+
+	// marti history
+	f := fiber.New()
+	f.Use(func(c *fiber.Ctx) error {
+		c.Locals(UsernameKey, "usr1")
+
+		return c.Next()
+	})
+	addMartiRoutes(app.App, f)
+
+	resp, err = f.Test(httpGet("/Marti/api/cot/xml/unit2/all?start=" + start.UTC().Format(time.RFC3339)))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var evts cotEvents
+	require.NoError(t, xml.NewDecoder(resp.Body).Decode(&evts))
+	require.Len(t, evts.Events, 5)
+	assert.Equal(t, "unit2", evts.Events[0].UID)
+	assert.InDelta(t, 44., evts.Events[4].Point.Lon, 0.0001)
+
+	// unit from other scope
+	resp, err = f.Test(httpGet("/Marti/api/cot/xml/unit3/all"))
+	require.NoError(t, err)
+
+	var other cotEvents
+	require.NoError(t, xml.NewDecoder(resp.Body).Decode(&other))
+	assert.Empty(t, other.Events)
+}
+
+func httpGet(url string) *http.Request {
+	req, _ := http.NewRequest("GET", url, strings.NewReader(""))
+
+	return req
+}
@@ -210,3 +210,41 @@ func (r *RemoteAPI) GetFile(ctx context.Context, hash string, f func(r io.Reader
 
 	return nil
 }
+
+func kmlPath(mission string) string {
+	if mission == "" {
+		return "/Marti/api/kml"
+	}
+
+	return "/Marti/api/missions/" + mission + "/kml"
+}
+
+func (r *RemoteAPI) ImportKML(ctx context.Context, mission string, name string, body io.Reader) (string, error) {
+	b, err := r.request(kmlPath(mission)).
+		Put().
+		Args(map[string]string{"name": name}).
+		Body(body).
+		Do(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer b.Close()
+
+	d, err := io.ReadAll(b)
+
+	return string(d), err
+}
+
+func (r *RemoteAPI) ExportKML(ctx context.Context, mission string, f func(r io.Reader) error) error {
+	b, err := r.request(kmlPath(mission)).Do(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer b.Close()
+
+	return f(b)
+}
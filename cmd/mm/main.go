@@ -10,6 +10,7 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -88,6 +89,18 @@ func (app *App) Run(cmd string, args []string) {
 			return
 		}
 		app.getFile(args[0], args[1])
+	case "kml-import":
+		if len(args) == 0 {
+			fmt.Println("need file name and optional mission")
+			return
+		}
+		app.importKML(args[0], getArg(args, 1))
+	case "kml-export":
+		if len(args) == 0 {
+			fmt.Println("need file name and optional mission")
+			return
+		}
+		app.exportKML(args[0], getArg(args, 1))
 	default:
 		app.UI()
 	}
@@ -124,6 +137,51 @@ func (app *App) getFile(hash string, name string) {
 	}
 }
 
+func (app *App) importKML(name string, mission string) {
+	f, err := os.Open(name)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	defer f.Close()
+
+	res, err := app.remoteAPI.ImportKML(context.Background(), mission, filepath.Base(name), f)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(res)
+}
+
+func (app *App) exportKML(name string, mission string) {
+	err := app.remoteAPI.ExportKML(context.Background(), mission, func(r io.Reader) error {
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		_, err = io.Copy(f, r)
+
+		return err
+	})
+
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func getArg(args []string, n int) string {
+	if len(args) > n {
+		return args[n]
+	}
+
+	return ""
+}
+
 func (app *App) UI() {
 	if m, err := app.remoteAPI.GetMissions(context.Background()); err == nil {
 		for _, mm := range m {
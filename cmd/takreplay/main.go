@@ -6,18 +6,28 @@ import (
 	"fmt"
 	"io"
 	"os"
-
-	"google.golang.org/protobuf/proto"
+	"strings"
+	"time"
 
 	"github.com/kdudkov/goatak/pkg/cot"
-	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/cotlog"
 )
 
 func main() {
-	format := flag.String("format", "", "dump format (text|json|gpx|stats)")
+	format := flag.String("format", "", "dump format (text|json|json2|gpx|stats|broadcast|contacts|replay)")
 	uid := flag.String("uid", "", "uid to show")
 	typ := flag.String("type", "", "type to show")
 	n := flag.Int("n", 10, "")
+	send := flag.String("send", "", "replay messages to tcp://host:port, tls://host:port or udp://host:port")
+	speed := flag.Float64("speed", 1, "replay speed multiplier")
+	from := flag.String("from", "", "start replay from time (RFC3339) or offset from the first message (10m)")
+	cert := flag.String("cert", "", "p12 client certificate for tls")
+	passw := flag.String("password", "atakatak", "p12 certificate password")
+	insecure := flag.Bool("insecure", false, "do not verify server certificate")
+	uidPrefix := flag.String("uid-prefix", "", "prefix to add to every uid in replay")
+	uidMap := flag.String("map-uid", "", "uid mapping for replay, old1=new1,old2=new2")
+	scopeCerts := flag.String("scope-cert", "",
+		"p12 certificates to replay messages of logged scopes with, scope1=user1.p12,scope2=user2.p12")
 
 	flag.Parse()
 
@@ -29,8 +39,28 @@ func main() {
 		os.Exit(1)
 	}
 
+	var (
+		fromTime   time.Time
+		fromOffset time.Duration
+	)
+
+	if *from != "" {
+		if t, err := time.Parse(time.RFC3339, *from); err == nil {
+			fromTime = t
+		} else if d, err := time.ParseDuration(*from); err == nil {
+			fromOffset = d
+		} else {
+			fmt.Printf("invalid start time %s\n", *from)
+			os.Exit(1)
+		}
+	}
+
 	var dmp Dumper
 
+	if *send != "" {
+		*format = "replay"
+	}
+
 	switch *format {
 	case "", "text":
 		dmp = new(TextDumper)
@@ -51,6 +81,15 @@ func main() {
 		dmp = NewBroadcastDumper(*n)
 	case "contacts":
 		dmp = new(ContactsDumper)
+	case "replay":
+		d, err := newReplay(*send, *speed, fromTime, fromOffset, TLSOpts{CertFile: *cert, Password: *passw, Insecure: *insecure},
+			parseMapping(*scopeCerts), &Remapper{UIDs: parseMapping(*uidMap), UIDPrefix: *uidPrefix})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		dmp = d
 	default:
 		fmt.Printf("invalid format %s\n", *format)
 		os.Exit(1)
@@ -59,12 +98,7 @@ func main() {
 	dmp.Start()
 
 	for _, file := range files {
-		f, err := os.Open(file)
-		if err != nil {
-			panic(err)
-		}
-
-		if err := readFile(f, *uid, *typ, dmp); !errors.Is(err, io.EOF) {
+		if err := readFile(file, fromTime, *uid, *typ, dmp); !errors.Is(err, io.EOF) {
 			fmt.Println(err)
 		}
 	}
@@ -72,26 +106,74 @@ func main() {
 	dmp.Stop()
 }
 
-func readFile(f *os.File, uid, typ string, dmp Dumper) error {
-	lenBuf := make([]byte, 2)
+func newReplay(addr string, speed float64, from time.Time, offset time.Duration, opts TLSOpts,
+	scopeCerts map[string]string, remap *Remapper,
+) (*ReplayDumper, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("need -send address to replay")
+	}
 
-	for {
-		if _, err := io.ReadFull(f, lenBuf); err != nil {
-			return err
+	d := NewReplayDumper(nil, speed, remap)
+	d.SeekTo(from)
+	d.SeekOffset(offset)
+
+	if len(scopeCerts) > 0 {
+		sender, err := newScopeSender(addr, opts, scopeCerts)
+		if err != nil {
+			return nil, err
 		}
 
-		n := uint32(lenBuf[0]) + uint32(lenBuf[1])*256
-		buf := make([]byte, n)
+		d.sender = sender
 
-		if _, err := io.ReadFull(f, buf); err != nil {
+		return d, nil
+	}
+
+	sender, err := NewSender(addr, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	d.sender = sender
+
+	return d, nil
+}
+
+// parseMapping parses "a=b,c=d" string.
+func parseMapping(s string) map[string]string {
+	res := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			res[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+
+	return res
+}
+
+// readFile reads legacy or new format log, if from is set, log index is used to skip older messages.
+func readFile(name string, from time.Time, uid, typ string, dmp Dumper) error {
+	r, err := cotlog.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	if !from.IsZero() {
+		if err := r.Seek(from); err != nil {
 			return err
 		}
+	}
 
-		m := new(cotproto.TakMessage)
-		if err := proto.Unmarshal(buf, m); err != nil {
+	for {
+		rec, err := r.Next()
+		if err != nil {
 			return err
 		}
 
+		m := rec.Msg
+
 		if uid != "" && m.GetCotEvent().GetUid() != uid {
 			continue
 		}
@@ -100,7 +182,7 @@ func readFile(f *os.File, uid, typ string, dmp Dumper) error {
 			continue
 		}
 
-		msg, err := cot.CotFromProto(m, "", "")
+		msg, err := cot.CotFromProto(m, "", rec.Scope)
 		if err != nil {
 			return err
 		}
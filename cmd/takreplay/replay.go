@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+// Remapper changes uids of replayed messages.
+// Uids are changed in event uid and in all uid and senderUid attributes of the detail, so links and chats stay consistent.
+// Scope is not in the message, server takes it from credentials of the connection, see scopeSender.
+type Remapper struct {
+	UIDs      map[string]string
+	UIDPrefix string
+}
+
+func (r *Remapper) UID(uid string) string {
+	if uid == "" {
+		return uid
+	}
+
+	if u, ok := r.UIDs[uid]; ok {
+		return u
+	}
+
+	return r.UIDPrefix + uid
+}
+
+func (r *Remapper) Apply(msg *cot.CotMessage) {
+	if len(r.UIDs) == 0 && r.UIDPrefix == "" {
+		return
+	}
+
+	if evt := msg.GetTakMessage().GetCotEvent(); evt != nil {
+		evt.Uid = r.UID(evt.GetUid())
+	}
+
+	r.remapNode(msg.Detail)
+}
+
+func (r *Remapper) remapNode(n *cot.Node) {
+	if n == nil {
+		return
+	}
+
+	for i, a := range n.Attrs {
+		if a.Name.Local == "uid" || a.Name.Local == "senderUid" {
+			n.Attrs[i].Value = r.UID(a.Value)
+		}
+	}
+
+	for _, c := range n.Nodes {
+		r.remapNode(c)
+	}
+}
+
+// ReplayDumper sends messages keeping original intervals between them, divided by speed.
+// Messages before From are skipped. Send, start and stale times are moved to the time of sending.
+type ReplayDumper struct {
+	sender Sender
+	logger *slog.Logger
+	speed  float64
+	from   time.Time
+	offset time.Duration
+	remap  *Remapper
+
+	// time of first replayed message in log and when it was sent
+	logStart  time.Time
+	wallStart time.Time
+
+	sleep func(d time.Duration)
+	now   func() time.Time
+
+	sent int
+}
+
+func NewReplayDumper(sender Sender, speed float64, remap *Remapper) *ReplayDumper {
+	if speed <= 0 {
+		speed = 1
+	}
+
+	return &ReplayDumper{
+		sender: sender,
+		logger: slog.With("logger", "replay"),
+		speed:  speed,
+		remap:  remap,
+		sleep:  time.Sleep,
+		now:    time.Now,
+	}
+}
+
+// SeekTo skips messages sent before t.
+func (d *ReplayDumper) SeekTo(t time.Time) {
+	d.from = t
+}
+
+// SeekOffset skips messages sent earlier than offset after the first message in log.
+func (d *ReplayDumper) SeekOffset(offset time.Duration) {
+	d.offset = offset
+}
+
+func (d *ReplayDumper) Start() {
+}
+
+func (d *ReplayDumper) Stop() {
+	d.logger.Info(fmt.Sprintf("%d messages sent", d.sent))
+
+	if d.sender != nil {
+		_ = d.sender.Close()
+	}
+}
+
+func (d *ReplayDumper) Process(msg *cot.CotMessage) error {
+	evt := msg.GetTakMessage().GetCotEvent()
+	if evt == nil {
+		return nil
+	}
+
+	t := msg.GetSendTime()
+
+	if d.from.IsZero() && d.offset > 0 {
+		d.from = t.Add(d.offset)
+	}
+
+	if !d.from.IsZero() && t.Before(d.from) {
+		return nil
+	}
+
+	if d.logStart.IsZero() {
+		d.logStart = t
+		d.wallStart = d.now()
+	} else if dt := t.Sub(d.logStart); dt > 0 {
+		if wait := d.wallStart.Add(time.Duration(float64(dt) / d.speed)).Sub(d.now()); wait > 0 {
+			d.sleep(wait)
+		}
+	}
+
+	now := d.now()
+	evt.StartTime = cot.TimeToMillis(now.Add(msg.GetStartTime().Sub(t)))
+	evt.StaleTime = cot.TimeToMillis(now.Add(msg.GetStaleTime().Sub(t)))
+	evt.SendTime = cot.TimeToMillis(now)
+
+	if d.remap != nil {
+		d.remap.Apply(msg)
+	}
+
+	if err := d.sender.Send(msg); err != nil {
+		return err
+	}
+
+	d.sent++
+
+	return nil
+}
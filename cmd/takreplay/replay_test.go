@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/xml"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+type testSender struct {
+	sent []*cot.CotMessage
+}
+
+func (s *testSender) Send(msg *cot.CotMessage) error {
+	s.sent = append(s.sent, msg)
+
+	return nil
+}
+
+func (s *testSender) Close() error {
+	return nil
+}
+
+func logMsg(uid string, t time.Time) *cot.CotMessage {
+	msg := cot.BasicMsg("a-f-G", uid, time.Minute)
+	msg.CotEvent.SendTime = cot.TimeToMillis(t)
+	msg.CotEvent.StartTime = cot.TimeToMillis(t)
+	msg.CotEvent.StaleTime = cot.TimeToMillis(t.Add(time.Minute))
+
+	det := cot.NewXMLDetails()
+	det.AddPpLink(uid+"-parent", "a-f-G", "parent")
+	msg.CotEvent.Detail = &cotproto.Detail{XmlDetail: det.AsXMLString()}
+
+	c, _ := cot.CotFromProto(msg, "", "")
+
+	return c
+}
+
+func TestReplayTiming(t *testing.T) {
+	s := new(testSender)
+	d := NewReplayDumper(s, 2, nil)
+
+	now := time.Now()
+	var slept []time.Duration
+
+	d.now = func() time.Time { return now }
+	d.sleep = func(dt time.Duration) {
+		slept = append(slept, dt)
+		now = now.Add(dt)
+	}
+
+	logStart := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	d.SeekOffset(time.Second * 10)
+
+	for _, sec := range []int{0, 5, 10, 20, 40} {
+		require.NoError(t, d.Process(logMsg("uid1", logStart.Add(time.Second*time.Duration(sec)))))
+	}
+
+	require.Len(t, s.sent, 3)
+	assert.Equal(t, []time.Duration{time.Second * 5, time.Second * 10}, slept)
+
+	msg := s.sent[2]
+	assert.WithinDuration(t, now, msg.GetSendTime(), time.Millisecond)
+	assert.WithinDuration(t, now, msg.GetStartTime(), time.Millisecond)
+	assert.WithinDuration(t, now.Add(time.Minute), msg.GetStaleTime(), time.Millisecond)
+}
+
+func TestRemap(t *testing.T) {
+	r := &Remapper{UIDs: parseMapping("uid1=new1, bad"), UIDPrefix: "x-"}
+
+	msg := logMsg("uid1", time.Now())
+	r.Apply(msg)
+	assert.Equal(t, "new1", msg.GetUID())
+
+	uid, _ := msg.GetParent()
+	assert.Equal(t, "x-uid1-parent", uid)
+
+	msg = logMsg("uid2", time.Now())
+	r.Apply(msg)
+	assert.Equal(t, "x-uid2", msg.GetUID())
+}
+
+func TestTCPSender(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer l.Close()
+
+	res := make(chan *cot.Event, 1)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		ev := new(cot.Event)
+		if err := xml.NewDecoder(conn).Decode(ev); err == nil {
+			res <- ev
+		}
+	}()
+
+	s, err := NewSender("tcp://"+l.Addr().String(), TLSOpts{})
+	require.NoError(t, err)
+
+	defer s.Close()
+
+	// remapped uids are on the wire
+	msg := logMsg("uid1", time.Now())
+	(&Remapper{UIDs: parseMapping("uid1=new1"), UIDPrefix: "x-"}).Apply(msg)
+
+	require.NoError(t, s.Send(msg))
+
+	select {
+	case ev := <-res:
+		assert.Equal(t, "new1", ev.UID)
+		assert.Equal(t, "x-uid1-parent", ev.Detail.GetFirst("link").GetAttr("uid"))
+	case <-time.After(time.Second * 5):
+		t.Error("no message received")
+	}
+
+	_, err = NewSender("http://localhost:8080", TLSOpts{})
+	require.Error(t, err)
+}
+
+func TestScopeSender(t *testing.T) {
+	blue, def := new(testSender), new(testSender)
+	s := &scopeSender{def: def, scopes: map[string]Sender{"blue": blue}}
+
+	m1 := logMsg("uid1", time.Now())
+	m1.Scope = "blue"
+	m2 := logMsg("uid2", time.Now())
+	m2.Scope = "red"
+
+	require.NoError(t, s.Send(m1))
+	require.NoError(t, s.Send(m2))
+
+	require.Len(t, blue.sent, 1)
+	assert.Equal(t, "uid1", blue.sent[0].GetUID())
+	require.Len(t, def.sent, 1)
+	assert.Equal(t, "uid2", def.sent[0].GetUID())
+
+	// without default connection other scopes are skipped
+	s.def = nil
+	require.NoError(t, s.Send(m2))
+	assert.Len(t, def.sent, 1)
+
+	_, err := newScopeSender("tcp://localhost:8999", TLSOpts{}, map[string]string{"blue": "blue.p12"})
+	require.Error(t, err)
+}
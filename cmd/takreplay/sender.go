@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/tlsutil"
+)
+
+const dialTimeout = time.Second * 10
+
+// Sender sends messages to server or client.
+type Sender interface {
+	Send(msg *cot.CotMessage) error
+	Close() error
+}
+
+type TLSOpts struct {
+	CertFile string
+	Password string
+	Insecure bool
+}
+
+// NewSender connects to addr - tcp://host:port, tls://host:port or udp://host:port.
+func NewSender(addr string, opts TLSOpts) (Sender, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid address %s", addr)
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", u.Host, dialTimeout)
+		if err != nil {
+			return nil, err
+		}
+
+		return newStreamSender(conn), nil
+	case "tls", "ssl":
+		cert, cas, err := client.LoadP12(opts.CertFile, opts.Password)
+		if err != nil {
+			return nil, fmt.Errorf("error loading cert: %w", err)
+		}
+
+		conf := &tls.Config{ //nolint:exhaustruct
+			Certificates:       []tls.Certificate{*cert},
+			RootCAs:            tlsutil.MakeCertPool(cas...),
+			InsecureSkipVerify: opts.Insecure, //nolint:gosec
+		}
+
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", u.Host, conf) //nolint:exhaustruct
+		if err != nil {
+			return nil, err
+		}
+
+		return newStreamSender(conn), nil
+	case "udp":
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		return &udpSender{conn: conn}, nil
+	}
+
+	return nil, fmt.Errorf("invalid protocol %s", u.Scheme)
+}
+
+// scopeSender sends messages of every logged scope over its own connection, server assigns the scope
+// of the connection by login of its certificate. Messages of scopes without connection go to def, if it is set.
+type scopeSender struct {
+	def    Sender
+	scopes map[string]Sender
+}
+
+// newScopeSender connects to tls addr with certificate of every scope from certs, default connection uses opts.CertFile.
+func newScopeSender(addr string, opts TLSOpts, certs map[string]string) (*scopeSender, error) {
+	if u, err := url.Parse(addr); err != nil || (u.Scheme != "tls" && u.Scheme != "ssl") {
+		return nil, fmt.Errorf("scope mapping needs tls address")
+	}
+
+	s := &scopeSender{scopes: make(map[string]Sender, len(certs))}
+
+	for scope, certFile := range certs {
+		sender, err := NewSender(addr, TLSOpts{CertFile: certFile, Password: opts.Password, Insecure: opts.Insecure})
+		if err != nil {
+			_ = s.Close()
+
+			return nil, fmt.Errorf("scope %s: %w", scope, err)
+		}
+
+		s.scopes[scope] = sender
+	}
+
+	if opts.CertFile != "" {
+		sender, err := NewSender(addr, opts)
+		if err != nil {
+			_ = s.Close()
+
+			return nil, err
+		}
+
+		s.def = sender
+	}
+
+	return s, nil
+}
+
+func (s *scopeSender) Send(msg *cot.CotMessage) error {
+	if sender, ok := s.scopes[msg.Scope]; ok {
+		return sender.Send(msg)
+	}
+
+	if s.def != nil {
+		return s.def.Send(msg)
+	}
+
+	return nil
+}
+
+func (s *scopeSender) Close() error {
+	var errs []error
+
+	for _, sender := range s.scopes {
+		errs = append(errs, sender.Close())
+	}
+
+	if s.def != nil {
+		errs = append(errs, s.def.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// streamSender sends xml events over tcp or tls connection, as any client does before protocol negotiation.
+type streamSender struct {
+	conn net.Conn
+}
+
+func newStreamSender(conn net.Conn) *streamSender {
+	// server sends us messages too, just drop them
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	return &streamSender{conn: conn}
+}
+
+func (s *streamSender) Send(msg *cot.CotMessage) error {
+	b, err := xml.Marshal(cot.ProtoToEvent(msg.GetUpdatedTakMessage()))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn.Write(b)
+
+	return err
+}
+
+func (s *streamSender) Close() error {
+	return s.conn.Close()
+}
+
+// udpSender sends protobuf packets, one message per datagram.
+type udpSender struct {
+	conn net.Conn
+}
+
+func (s *udpSender) Send(msg *cot.CotMessage) error {
+	b, err := proto.Marshal(msg.GetUpdatedTakMessage())
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn.Write(append([]byte{magicByte, 1, magicByte}, b...))
+
+	return err
+}
+
+func (s *udpSender) Close() error {
+	return s.conn.Close()
+}
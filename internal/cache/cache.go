@@ -43,6 +43,10 @@ func (c *Cache[T]) Clean() {
 	})
 }
 
+func (c *Cache[T]) Delete(key string) {
+	c.m.Delete(key)
+}
+
 func (c *Cache[T]) Load(key string) T {
 	var e *entry[T]
 
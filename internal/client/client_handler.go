@@ -48,6 +48,7 @@ type ClientHandler interface {
 	GetVersion() int32
 	SendMsg(msg *cot.CotMessage) error
 	GetLastSeen() *time.Time
+	GetQueueStats() *QueueStats
 	Stop()
 }
 
@@ -61,7 +62,7 @@ type ConnClientHandler struct {
 	uids         sync.Map
 	lastActivity atomic.Pointer[time.Time]
 	closeTimer   *time.Timer
-	sendChan     chan []byte
+	queue        *SendQueue
 	active       int32
 	device       *model.Device
 	serial       string
@@ -78,7 +79,6 @@ func NewConnClientHandler(name string, conn net.Conn, config *HandlerConfig) *Co
 		addr:         name,
 		conn:         conn,
 		ver:          0,
-		sendChan:     make(chan []byte, 50),
 		active:       1,
 		uids:         sync.Map{},
 		lastActivity: atomic.Pointer[time.Time]{},
@@ -112,6 +112,7 @@ func NewConnClientHandler(name string, conn net.Conn, config *HandlerConfig) *Co
 		}
 	}
 
+	c.queue = NewSendQueue(c.onDrop)
 	c.setActivity()
 
 	return c
@@ -170,6 +171,10 @@ func (h *ConnClientHandler) GetLastSeen() *time.Time {
 	return h.lastActivity.Load()
 }
 
+func (h *ConnClientHandler) GetQueueStats() *QueueStats {
+	return h.queue.Stats()
+}
+
 func (h *ConnClientHandler) Start() {
 	h.logger.Info("starting")
 
@@ -425,7 +430,12 @@ func (h *ConnClientHandler) handleWrite() {
 		}
 	}()
 
-	for msg := range h.sendChan {
+	for {
+		msg, ok := h.queue.Pop()
+		if !ok {
+			break
+		}
+
 		if _, err := h.conn.Write(msg); err != nil {
 			h.logger.Debug(fmt.Sprintf("client %s write error %v", h.addr, err))
 			h.Stop()
@@ -440,7 +450,7 @@ func (h *ConnClientHandler) Stop() {
 		h.logger.Info("stopping")
 		h.cancel()
 
-		close(h.sendChan)
+		h.queue.Close()
 
 		if h.conn != nil {
 			_ = h.conn.Close()
@@ -494,7 +504,7 @@ func (h *ConnClientHandler) sendEvent(evt *cot.Event) error {
 
 	h.logger.Debug("sending " + string(msg))
 
-	if h.tryAddPacket(msg) {
+	if h.tryAddPacket(PrioControl, "", msg) {
 		return nil
 	}
 
@@ -510,6 +520,9 @@ func (h *ConnClientHandler) SendMsg(msg *cot.CotMessage) error {
 }
 
 func (h *ConnClientHandler) SendCot(msg *cotproto.TakMessage) error {
+	prio := MessagePriority(msg)
+	uid := msg.GetCotEvent().GetUid()
+
 	switch h.GetVersion() {
 	case 0:
 		buf, err := xml.Marshal(cot.ProtoToEvent(msg))
@@ -517,7 +530,7 @@ func (h *ConnClientHandler) SendCot(msg *cotproto.TakMessage) error {
 			return err
 		}
 
-		if h.tryAddPacket(buf) {
+		if h.tryAddPacket(prio, uid, buf) {
 			return nil
 		}
 	case 1:
@@ -526,7 +539,7 @@ func (h *ConnClientHandler) SendCot(msg *cotproto.TakMessage) error {
 			return err
 		}
 
-		if h.tryAddPacket(buf) {
+		if h.tryAddPacket(prio, uid, buf) {
 			return nil
 		}
 	}
@@ -534,17 +547,16 @@ func (h *ConnClientHandler) SendCot(msg *cotproto.TakMessage) error {
 	return fmt.Errorf("client is off")
 }
 
-func (h *ConnClientHandler) tryAddPacket(msg []byte) bool {
+func (h *ConnClientHandler) tryAddPacket(prio Priority, uid string, msg []byte) bool {
 	if !h.IsActive() {
 		return false
 	}
-	select {
-	case h.sendChan <- msg:
-	default:
-		if h.dropMetric != nil {
-			h.dropMetric.WithLabelValues("reason", "client_handler").Inc()
-		}
-	}
 
-	return true
+	return h.queue.Push(prio, uid, msg)
+}
+
+func (h *ConnClientHandler) onDrop(prio Priority) {
+	if h.dropMetric != nil {
+		h.dropMetric.WithLabelValues(h.device.GetScope(), "client_queue_"+prio.String()).Inc()
+	}
 }
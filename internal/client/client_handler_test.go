@@ -3,10 +3,13 @@ package client
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/proto"
@@ -79,32 +82,67 @@ func passMsg(h *ConnClientHandler, msg *cot.CotMessage) (*cotproto.TakMessage, e
 		return nil, err
 	}
 
-	select {
-	case dat := <-h.sendChan:
-		bb := bytes.NewBuffer(dat)
+	dat, ok := h.queue.TryPop()
+	if !ok {
+		return nil, nil
+	}
 
-		_, err := bb.ReadByte()
-		if err != nil {
-			return nil, err
-		}
+	bb := bytes.NewBuffer(dat)
 
-		size, err := binary.ReadUvarint(bb)
-		if err != nil {
-			return nil, err
-		}
+	_, err := bb.ReadByte()
+	if err != nil {
+		return nil, err
+	}
 
-		buf := make([]byte, size)
-		_, err = io.ReadFull(bb, buf)
+	size, err := binary.ReadUvarint(bb)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	buf := make([]byte, size)
+	_, err = io.ReadFull(bb, buf)
 
-		msg := new(cotproto.TakMessage)
-		err = proto.Unmarshal(buf, msg)
+	if err != nil {
+		return nil, err
+	}
 
-		return msg, err
-	default:
-		return nil, nil
+	res := new(cotproto.TakMessage)
+	err = proto.Unmarshal(buf, res)
+
+	return res, err
+}
+
+func TestQueueDrop(t *testing.T) {
+	m := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "dropped"}, []string{"scope", "reason"})
+
+	h := NewConnClientHandler("test", nil, &HandlerConfig{UID: "111", IsClient: true, DropMetric: m})
+	h.ver = 1
+	h.device = &model.Device{Scope: "aaa"}
+
+	for i := range prioLimits[PrioUrgent] + 1 {
+		tak := cot.BasicMsg("b-t-f", fmt.Sprintf("msg%d", i), time.Second*10)
+		require.NoError(t, h.SendMsg(&cot.CotMessage{TakMessage: tak, Scope: "aaa"}))
 	}
+
+	for i := range 3 {
+		require.NoError(t, h.SendMsg(&cot.CotMessage{TakMessage: cot.BasicMsg("a-f-G", "unit", time.Minute), Scope: "aaa"}))
+		require.NoError(t, h.SendMsg(&cot.CotMessage{TakMessage: cot.BasicMsg("a-f-G", fmt.Sprintf("unit%d", i), time.Minute), Scope: "aaa"}))
+	}
+
+	assert.InDelta(t, 1., testutil.ToFloat64(m.WithLabelValues("aaa", "client_queue_urgent")), 0.1)
+
+	s := h.GetQueueStats()
+	assert.Equal(t, prioLimits[PrioUrgent]+4, s.Depth)
+	assert.Equal(t, uint64(1), s.Dropped)
+	assert.Equal(t, uint64(2), s.Coalesced)
+	assert.Equal(t, 4, s.Classes["pli"].Depth)
+
+	c, err := passMsg(h, &cot.CotMessage{TakMessage: cot.MakePing("123"), Scope: "aaa"})
+	require.NoError(t, err)
+	assert.Equal(t, "t-x-c-t", c.GetCotEvent().GetType())
+
+	// message from other scope is not queued, so we get the first chat. The oldest one is dropped
+	c, err = passMsg(h, &cot.CotMessage{TakMessage: cot.MakePing("123"), Scope: "bbb"})
+	require.NoError(t, err)
+	assert.Equal(t, "msg1", c.GetCotEvent().GetUid())
 }
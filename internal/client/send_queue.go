@@ -0,0 +1,240 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+type Priority int
+
+// message classes, lower is sent first.
+const (
+	PrioControl Priority = iota
+	PrioUrgent
+	PrioNormal
+	PrioPLI
+	prioCount
+)
+
+var prioNames = [prioCount]string{"control", "urgent", "normal", "pli"}
+
+// queue limits per class, for PLI it is the number of uids.
+var prioLimits = [prioCount]int{50, 200, 100, 1000}
+
+func (p Priority) String() string {
+	if p < 0 || p >= prioCount {
+		return "unknown"
+	}
+
+	return prioNames[p]
+}
+
+// MessagePriority gets the class of the message: pings and protocol messages go first, then chats,
+// alerts and file transfers, then other messages. Positions are the last ones.
+func MessagePriority(msg *cotproto.TakMessage) Priority {
+	t := msg.GetCotEvent().GetType()
+
+	switch {
+	case cot.MatchAnyPattern(t, "t-"):
+		return PrioControl
+	case cot.MatchAnyPattern(t, "b-t-f", "b-t-f-", "b-a-", "b-f-t-"):
+		return PrioUrgent
+	case cot.MatchAnyPattern(t, "a-"):
+		return PrioPLI
+	default:
+		return PrioNormal
+	}
+}
+
+type ClassStats struct {
+	Depth   int    `json:"depth"`
+	Dropped uint64 `json:"dropped"`
+}
+
+type QueueStats struct {
+	Depth     int                    `json:"depth"`
+	Dropped   uint64                 `json:"dropped"`
+	Coalesced uint64                 `json:"coalesced"`
+	Classes   map[string]*ClassStats `json:"classes"`
+}
+
+// SendQueue is a client outgoing queue with priority classes. When a class is full, its oldest packet is dropped.
+// Queued PLI packet is replaced with the new one from the same uid, keeping its place in the queue.
+type SendQueue struct {
+	mx        sync.Mutex
+	cond      *sync.Cond
+	queues    [prioCount][][]byte
+	pliUids   []string
+	pli       map[string][]byte
+	dropped   [prioCount]uint64
+	coalesced uint64
+	closed    bool
+	onDrop    func(p Priority)
+}
+
+func NewSendQueue(onDrop func(p Priority)) *SendQueue {
+	q := &SendQueue{
+		pli:    make(map[string][]byte),
+		onDrop: onDrop,
+	}
+
+	q.cond = sync.NewCond(&q.mx)
+
+	return q
+}
+
+// Push adds the packet to the queue, uid is used to coalesce PLI packets. Returns false if queue is closed.
+func (q *SendQueue) Push(p Priority, uid string, data []byte) bool {
+	if p < 0 || p >= prioCount {
+		p = PrioNormal
+	}
+
+	if p == PrioPLI && uid == "" {
+		p = PrioNormal
+	}
+
+	q.mx.Lock()
+
+	if q.closed {
+		q.mx.Unlock()
+
+		return false
+	}
+
+	var dropped bool
+
+	if p == PrioPLI {
+		dropped = q.pushPLI(uid, data)
+	} else {
+		if len(q.queues[p]) >= prioLimits[p] {
+			q.queues[p][0] = nil
+			q.queues[p] = q.queues[p][1:]
+			dropped = true
+		}
+
+		q.queues[p] = append(q.queues[p], data)
+	}
+
+	if dropped {
+		q.dropped[p]++
+	}
+
+	q.mx.Unlock()
+	q.cond.Signal()
+
+	if dropped && q.onDrop != nil {
+		q.onDrop(p)
+	}
+
+	return true
+}
+
+func (q *SendQueue) pushPLI(uid string, data []byte) bool {
+	if _, ok := q.pli[uid]; ok {
+		q.pli[uid] = data
+		q.coalesced++
+
+		return false
+	}
+
+	var dropped bool
+
+	if len(q.pliUids) >= prioLimits[PrioPLI] {
+		delete(q.pli, q.pliUids[0])
+		q.pliUids = q.pliUids[1:]
+		dropped = true
+	}
+
+	q.pli[uid] = data
+	q.pliUids = append(q.pliUids, uid)
+
+	return dropped
+}
+
+// Pop waits for the next packet. Returns false when queue is closed.
+func (q *SendQueue) Pop() ([]byte, bool) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	for {
+		if q.closed {
+			return nil, false
+		}
+
+		if data, ok := q.pop(); ok {
+			return data, true
+		}
+
+		q.cond.Wait()
+	}
+}
+
+// TryPop gets the next packet without waiting.
+func (q *SendQueue) TryPop() ([]byte, bool) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if q.closed {
+		return nil, false
+	}
+
+	return q.pop()
+}
+
+func (q *SendQueue) pop() ([]byte, bool) {
+	for p := range PrioPLI {
+		if len(q.queues[p]) > 0 {
+			data := q.queues[p][0]
+			q.queues[p][0] = nil
+			q.queues[p] = q.queues[p][1:]
+
+			return data, true
+		}
+	}
+
+	if len(q.pliUids) > 0 {
+		uid := q.pliUids[0]
+		q.pliUids = q.pliUids[1:]
+
+		data := q.pli[uid]
+		delete(q.pli, uid)
+
+		return data, true
+	}
+
+	return nil, false
+}
+
+// Close drops all queued packets and wakes up the reader.
+func (q *SendQueue) Close() {
+	q.mx.Lock()
+	q.closed = true
+	q.queues = [prioCount][][]byte{}
+	q.pliUids = nil
+	q.pli = make(map[string][]byte)
+	q.mx.Unlock()
+
+	q.cond.Broadcast()
+}
+
+func (q *SendQueue) Stats() *QueueStats {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	s := &QueueStats{Coalesced: q.coalesced, Classes: make(map[string]*ClassStats, prioCount)}
+
+	for p := range prioCount {
+		depth := len(q.queues[p])
+		if p == PrioPLI {
+			depth = len(q.pliUids)
+		}
+
+		s.Classes[p.String()] = &ClassStats{Depth: depth, Dropped: q.dropped[p]}
+		s.Depth += depth
+		s.Dropped += q.dropped[p]
+	}
+
+	return s
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+func TestMessagePriority(t *testing.T) {
+	assert.Equal(t, PrioControl, MessagePriority(cot.MakePing("1")))
+	assert.Equal(t, PrioControl, MessagePriority(cot.MakePong()))
+	assert.Equal(t, PrioUrgent, MessagePriority(cot.BasicMsg("b-t-f", "1", time.Minute)))
+	assert.Equal(t, PrioUrgent, MessagePriority(cot.BasicMsg("b-t-f-r", "1", time.Minute)))
+	assert.Equal(t, PrioUrgent, MessagePriority(cot.BasicMsg("b-a-o-tbl", "1", time.Minute)))
+	assert.Equal(t, PrioUrgent, MessagePriority(cot.BasicMsg("b-f-t-r", "1", time.Minute)))
+	assert.Equal(t, PrioNormal, MessagePriority(cot.BasicMsg("b-m-p-s-m", "1", time.Minute)))
+	assert.Equal(t, PrioPLI, MessagePriority(cot.BasicMsg("a-f-G-U-C", "1", time.Minute)))
+}
+
+func TestSendQueueOrder(t *testing.T) {
+	q := NewSendQueue(nil)
+
+	q.Push(PrioPLI, "u1", []byte("pli1"))
+	q.Push(PrioNormal, "", []byte("normal"))
+	q.Push(PrioPLI, "u2", []byte("pli2"))
+	q.Push(PrioUrgent, "", []byte("chat"))
+	q.Push(PrioPLI, "u1", []byte("pli1-new"))
+	q.Push(PrioControl, "", []byte("ping"))
+
+	s := q.Stats()
+	assert.Equal(t, 5, s.Depth)
+	assert.Equal(t, uint64(1), s.Coalesced)
+	assert.Equal(t, 2, s.Classes["pli"].Depth)
+
+	for _, expected := range []string{"ping", "chat", "normal", "pli1-new", "pli2"} {
+		b, ok := q.TryPop()
+		require.True(t, ok)
+		assert.Equal(t, expected, string(b))
+	}
+
+	_, ok := q.TryPop()
+	assert.False(t, ok)
+}
+
+func TestSendQueueDrop(t *testing.T) {
+	var drops []Priority
+
+	q := NewSendQueue(func(p Priority) { drops = append(drops, p) })
+
+	for i := range prioLimits[PrioUrgent] + 2 {
+		q.Push(PrioUrgent, "", []byte{byte(i)})
+	}
+
+	assert.Equal(t, []Priority{PrioUrgent, PrioUrgent}, drops)
+
+	s := q.Stats()
+	assert.Equal(t, prioLimits[PrioUrgent], s.Depth)
+	assert.Equal(t, uint64(2), s.Dropped)
+	assert.Equal(t, uint64(2), s.Classes["urgent"].Dropped)
+
+	// the oldest ones are dropped
+	b, _ := q.TryPop()
+	assert.Equal(t, []byte{2}, b)
+}
+
+func TestSendQueueClose(t *testing.T) {
+	q := NewSendQueue(nil)
+
+	done := make(chan bool)
+
+	go func() {
+		_, ok := q.Pop()
+		done <- ok
+	}()
+
+	q.Push(PrioNormal, "", []byte("1"))
+	assert.True(t, <-done)
+
+	go func() {
+		_, ok := q.Pop()
+		done <- ok
+	}()
+
+	q.Close()
+	assert.False(t, <-done)
+	assert.False(t, q.Push(PrioNormal, "", []byte("2")))
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/env"
@@ -14,11 +16,15 @@ import (
 	"github.com/knadh/koanf/v2"
 
 	"github.com/kdudkov/goatak/internal/layers"
+	"github.com/kdudkov/goatak/internal/pm"
+	"github.com/kdudkov/goatak/internal/repository"
+	"github.com/kdudkov/goatak/internal/rules"
 	"github.com/kdudkov/goatak/pkg/tlsutil"
 )
 
 type AppConfig struct {
-	k *koanf.Koanf
+	k     *koanf.Koanf
+	files []string
 
 	TlsCert    *tls.Certificate
 	CertPool   *x509.CertPool
@@ -42,12 +48,18 @@ func (c *AppConfig) Load(filename ...string) bool {
 			slog.Info(fmt.Sprintf("error loading config: %s", err.Error()))
 		} else {
 			loaded = true
+			c.files = append(c.files, name)
 		}
 	}
 
 	return loaded
 }
 
+// Files returns names of successfully loaded config files.
+func (c *AppConfig) Files() []string {
+	return c.files
+}
+
 func (c *AppConfig) LoadEnv(prefix string) error {
 	return c.k.Load(env.Provider(prefix, ".", func(s string) string {
 		s1 := strings.ToLower(strings.TrimPrefix(s, prefix))
@@ -105,10 +117,29 @@ func (c *AppConfig) WelcomeMsg() string {
 	return c.k.String("welcome_msg")
 }
 
+// CotXMLScope is the scope of messages posted to /cot_xml without token, empty disables such posts.
+func (c *AppConfig) CotXMLScope() string {
+	return c.k.String("cot_xml_scope")
+}
+
+func (c *AppConfig) PersistItems() bool {
+	return c.k.Bool("persist_items")
+}
+
 func (c *AppConfig) LogAll() bool {
 	return c.k.Bool("log")
 }
 
+// LogMaxSize is the size of cot log file in bytes to start new one, 0 - no limit.
+func (c *AppConfig) LogMaxSize() int64 {
+	return c.k.Int64("log_max_size") * 1024 * 1024
+}
+
+// LogMaxAge is the age of cot log file to start new one, 0 - no limit.
+func (c *AppConfig) LogMaxAge() time.Duration {
+	return c.k.Duration("log_max_age")
+}
+
 func (c *AppConfig) MartiSSL() bool {
 	return c.k.Bool("ssl.use_ssl") || c.k.Bool("ssl.marti")
 }
@@ -121,8 +152,230 @@ func (c *AppConfig) CertTTLDays() int {
 	return c.k.Int("ssl.cert_ttl_days")
 }
 
-func (c *AppConfig) Connections() []string {
-	return nil
+// CAKeyFile is a CA private key used by ca commands, ca.key near ssl.ca by default.
+func (c *AppConfig) CAKeyFile() string {
+	if k := c.k.String("ssl.ca_key"); k != "" {
+		return k
+	}
+
+	if ca := c.k.String("ssl.ca"); ca != "" {
+		return strings.TrimSuffix(ca, filepath.Ext(ca)) + ".key"
+	}
+
+	return ""
+}
+
+// OutboxTTL is how long messages for offline contacts are kept, 0 disables the outbox.
+func (c *AppConfig) OutboxTTL() time.Duration {
+	return c.k.Duration("outbox_ttl")
+}
+
+// PackageTTL is how long data packages with onReceiveDelete flag are kept after upload, 0 means forever.
+func (c *AppConfig) PackageTTL() time.Duration {
+	return c.k.Duration("package_ttl")
+}
+
+// RetentionInterval is how often the retention job runs, 0 disables it.
+func (c *AppConfig) RetentionInterval() time.Duration {
+	return c.k.Duration("retention.interval")
+}
+
+// RetentionOrphanBlobs tells if the retention job removes blobs no file refers to. By default it is on for fs store
+// only, s3 bucket can be shared by several servers with their own databases.
+func (c *AppConfig) RetentionOrphanBlobs() bool {
+	if c.k.Exists("retention.orphan_blobs") {
+		return c.k.Bool("retention.orphan_blobs")
+	}
+
+	return c.BlobStoreType() == "fs"
+}
+
+// RetentionPolicy is the limit of files of the scope, 0 means no limit.
+type RetentionPolicy struct {
+	MaxAge  time.Duration
+	MaxSize int64
+}
+
+// RetentionPolicy returns the policy of the scope from retention.scopes, missing values are taken
+// from retention.max_age and retention.max_size. Size is configured in megabytes.
+func (c *AppConfig) RetentionPolicy(scope string) RetentionPolicy {
+	p := RetentionPolicy{
+		MaxAge:  c.k.Duration("retention.max_age"),
+		MaxSize: c.k.Int64("retention.max_size") * 1024 * 1024,
+	}
+
+	key := "retention.scopes." + scope
+
+	if c.k.Exists(key + ".max_age") {
+		p.MaxAge = c.k.Duration(key + ".max_age")
+	}
+
+	if c.k.Exists(key + ".max_size") {
+		p.MaxSize = c.k.Int64(key+".max_size") * 1024 * 1024
+	}
+
+	return p
+}
+
+// Quota is the limit of files stored in the scope or by the user, 0 means no limit.
+type Quota struct {
+	MaxBytes    int64 `json:"max_bytes"`
+	MaxFiles    int64 `json:"max_files"`
+	MaxFileSize int64 `json:"max_file_size"`
+}
+
+// ScopeQuota returns quota of the scope from quota.scopes, missing values are taken from quota.max_bytes,
+// quota.max_files and quota.max_file_size. Sizes are configured in megabytes.
+func (c *AppConfig) ScopeQuota(scope string) Quota {
+	q := Quota{
+		MaxBytes:    c.k.Int64("quota.max_bytes") * 1024 * 1024,
+		MaxFiles:    c.k.Int64("quota.max_files"),
+		MaxFileSize: c.k.Int64("quota.max_file_size") * 1024 * 1024,
+	}
+
+	return c.quota("quota.scopes."+scope, q)
+}
+
+// UserQuota returns quota of the login from quota.users, it is counted over all scopes.
+func (c *AppConfig) UserQuota(login string) Quota {
+	return c.quota("quota.users."+login, Quota{})
+}
+
+func (c *AppConfig) quota(key string, q Quota) Quota {
+	if c.k.Exists(key + ".max_bytes") {
+		q.MaxBytes = c.k.Int64(key+".max_bytes") * 1024 * 1024
+	}
+
+	if c.k.Exists(key + ".max_files") {
+		q.MaxFiles = c.k.Int64(key + ".max_files")
+	}
+
+	if c.k.Exists(key + ".max_file_size") {
+		q.MaxFileSize = c.k.Int64(key+".max_file_size") * 1024 * 1024
+	}
+
+	return q
+}
+
+// MaxUploadSize is the biggest file size allowed by quotas, 0 means no limit.
+func (c *AppConfig) MaxUploadSize() int64 {
+	n := c.k.Int64("quota.max_file_size")
+	if n == 0 {
+		return 0
+	}
+
+	for _, key := range []string{"quota.scopes", "quota.users"} {
+		for _, name := range c.k.MapKeys(key) {
+			k := key + "." + name + ".max_file_size"
+
+			if c.k.Exists(k) {
+				if c.k.Int64(k) == 0 {
+					return 0
+				}
+
+				n = max(n, c.k.Int64(k))
+			}
+		}
+	}
+
+	return n * 1024 * 1024
+}
+
+// BlobStoreType is the storage of uploaded files, fs or s3.
+func (c *AppConfig) BlobStoreType() string {
+	return c.k.String("blob_store.type")
+}
+
+// BlobDir is the directory of fs blob store.
+func (c *AppConfig) BlobDir() string {
+	if d := c.k.String("blob_store.dir"); d != "" {
+		return d
+	}
+
+	return filepath.Join(c.DataDir(), "blob")
+}
+
+func (c *AppConfig) S3Config() (pm.S3Config, error) {
+	var res pm.S3Config
+
+	if err := c.k.Unmarshal("blob_store.s3", &res); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+// AuthBackends are names of authentication backends to try in order: local, ldap.
+func (c *AppConfig) AuthBackends() []string {
+	return c.k.Strings("auth.backends")
+}
+
+// SessionTTL is the lifetime of admin login token.
+func (c *AppConfig) SessionTTL() time.Duration {
+	return c.k.Duration("auth.session_ttl")
+}
+
+// TokenKeyRotation is the age of the token signing key when the new one is made, 0 disables rotation.
+func (c *AppConfig) TokenKeyRotation() time.Duration {
+	return c.k.Duration("auth.key_rotation")
+}
+
+// ApiTokenTTL is the lifetime of api tokens created without expiration time, 0 means they never expire.
+func (c *AppConfig) ApiTokenTTL() time.Duration {
+	return c.k.Duration("auth.api_token_ttl")
+}
+
+// AuditFile is JSON lines file audit events are appended to, empty - events are in database only.
+func (c *AppConfig) AuditFile() string {
+	return c.k.String("audit.file")
+}
+
+func (c *AppConfig) LDAPConfig() (repository.LDAPConfig, error) {
+	var res repository.LDAPConfig
+
+	if err := c.k.Unmarshal("auth.ldap", &res); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+// PersistItemsTrackTTL is how long track points of persisted items are kept when track history is off, 0 means forever.
+func (c *AppConfig) PersistItemsTrackTTL() time.Duration {
+	return c.k.Duration("persist_items_track_ttl")
+}
+
+func (c *AppConfig) TrackHistory() bool {
+	return c.k.Bool("track_history.enabled")
+}
+
+// TrackHistoryTTL is how long track points are kept, 0 means forever.
+func (c *AppConfig) TrackHistoryTTL() time.Duration {
+	return c.k.Duration("track_history.ttl")
+}
+
+func (c *AppConfig) Connections() ([]*PeerConfig, error) {
+	if !c.k.Exists("federation.peers") {
+		return nil, nil
+	}
+
+	res := make([]*PeerConfig, 0)
+	if err := c.k.Unmarshal("federation.peers", &res); err != nil {
+		return nil, err
+	}
+
+	for _, p := range res {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// FederationName is the name this server puts into flow tags of the messages it relays.
+func (c *AppConfig) FederationName() string {
+	return c.k.String("federation.name")
 }
 
 func (c *AppConfig) LogExclude() []string {
@@ -146,6 +399,20 @@ func (c *AppConfig) Layers() ([]*layers.LayerDescription, error) {
 	return res, nil
 }
 
+func (c *AppConfig) Rules() ([]*rules.Rule, error) {
+	res := make([]*rules.Rule, 0)
+
+	if !c.k.Exists("rules") {
+		return res, nil
+	}
+
+	if err := c.k.Unmarshal("rules", &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (c *AppConfig) ProcessCerts() error {
 	for _, name := range []string{"ssl.ca", "ssl.cert", "ssl.key"} {
 		if c.k.String(name) == "" {
@@ -210,6 +477,8 @@ func setDefaults(k *koanf.Koanf) {
 	k.Set("db", "db.sqlite")
 
 	k.Set("delay", true)
+	k.Set("persist_items", true)
+	k.Set("persist_items_track_ttl", "24h")
 
 	k.Set("me.lat", 59.8396)
 	k.Set("me.lon", 31.0213)
@@ -217,4 +486,16 @@ func setDefaults(k *koanf.Koanf) {
 
 	k.Set("me.zoom", 10)
 	k.Set("ssl.cert_ttl_days", 365)
+	k.Set("outbox_ttl", "24h")
+	k.Set("package_ttl", "24h")
+	k.Set("track_history.ttl", "720h")
+	k.Set("retention.interval", "1h")
+	k.Set("blob_store.type", "fs")
+	k.Set("quota.max_file_size", 64)
+	k.Set("auth.backends", []string{"local"})
+	k.Set("auth.session_ttl", "48h")
+	k.Set("auth.key_rotation", "720h")
+	k.Set("auth.api_token_ttl", "8760h")
+	k.Set("log_max_size", 100)
+	k.Set("log_max_age", "24h")
 }
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+
+	"github.com/kdudkov/goatak/pkg/tlsutil"
+)
+
+const (
+	PeerProtoTCP = "tcp"
+	PeerProtoTLS = "tls"
+)
+
+// PeerConfig describes outgoing connection to another TAK server.
+type PeerConfig struct {
+	Name       string   `yaml:"name" koanf:"name"`
+	Addr       string   `yaml:"addr" koanf:"addr"`
+	Proto      string   `yaml:"proto" koanf:"proto"`
+	CA         string   `yaml:"ca" koanf:"ca"`
+	Cert       string   `yaml:"cert" koanf:"cert"`
+	Key        string   `yaml:"key" koanf:"key"`
+	ServerName string   `yaml:"server_name" koanf:"server_name"`
+	Scope      string   `yaml:"scope" koanf:"scope"`
+	OutScopes  []string `yaml:"out_scopes" koanf:"out_scopes"`
+}
+
+func (p *PeerConfig) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("peer without name")
+	}
+
+	if _, _, err := net.SplitHostPort(p.Addr); err != nil {
+		return fmt.Errorf("peer %s: invalid addr %s: %w", p.Name, p.Addr, err)
+	}
+
+	switch p.Proto {
+	case "":
+		p.Proto = PeerProtoTLS
+	case PeerProtoTCP, PeerProtoTLS:
+	default:
+		return fmt.Errorf("peer %s: invalid proto %s", p.Name, p.Proto)
+	}
+
+	if (p.Cert == "") != (p.Key == "") {
+		return fmt.Errorf("peer %s: both cert and key must be set", p.Name)
+	}
+
+	return nil
+}
+
+func (p *PeerConfig) IsTLS() bool {
+	return p.Proto == PeerProtoTLS
+}
+
+// TLSConfig makes client tls config for the peer. Peer's own ca and cert are used if set,
+// server ones otherwise. Server certificate of the peer is always verified.
+func (p *PeerConfig) TLSConfig(cert *tls.Certificate, pool *x509.CertPool) (*tls.Config, error) {
+	if p.CA != "" {
+		ca, err := loadPem(p.CA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool = tlsutil.MakeCertPool(ca...)
+	}
+
+	if p.Cert != "" {
+		c, err := tls.LoadX509KeyPair(p.Cert, p.Key)
+		if err != nil {
+			return nil, fmt.Errorf("peer %s: %w", p.Name, err)
+		}
+
+		cert = &c
+	}
+
+	if pool == nil {
+		return nil, fmt.Errorf("peer %s: no ca to verify server", p.Name)
+	}
+
+	if cert == nil {
+		return nil, fmt.Errorf("peer %s: no client certificate", p.Name)
+	}
+
+	serverName := p.ServerName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(p.Addr)
+	}
+
+	return &tls.Config{ //nolint:exhaustruct
+		Certificates: []tls.Certificate{*cert},
+		RootCAs:      pool,
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func (p *PeerConfig) CanSend(scope string) bool {
+	for _, s := range p.OutScopes {
+		if s == "*" || s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+	"github.com/kdudkov/goatak/pkg/util"
+)
+
+type AlertQuery struct {
+	Query[model.Alert]
+	id     uint
+	scope  util.StringSet
+	uid    string
+	active bool
+}
+
+func NewAlertQuery(db *gorm.DB) *AlertQuery {
+	return &AlertQuery{
+		Query: Query[model.Alert]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "created_at DESC",
+		},
+		scope: util.NewStringSet(),
+	}
+}
+
+func (q *AlertQuery) Order(s string) *AlertQuery {
+	q.order = s
+	return q
+}
+
+func (q *AlertQuery) Limit(n int) *AlertQuery {
+	q.limit = n
+	return q
+}
+
+func (q *AlertQuery) Offset(n int) *AlertQuery {
+	q.offset = n
+	return q
+}
+
+func (q *AlertQuery) Id(id uint) *AlertQuery {
+	q.id = id
+	return q
+}
+
+func (q *AlertQuery) Scope(scope string) *AlertQuery {
+	if q == nil {
+		return nil
+	}
+
+	if scope != "" {
+		q.scope.Add(scope)
+	}
+
+	return q
+}
+
+func (q *AlertQuery) ReadScope(scope []string) *AlertQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.scope.Add(scope...)
+
+	return q
+}
+
+func (q *AlertQuery) UID(uid string) *AlertQuery {
+	q.uid = uid
+	return q
+}
+
+func (q *AlertQuery) Active() *AlertQuery {
+	q.active = true
+	return q
+}
+
+func (q *AlertQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.id != 0 {
+		tx = tx.Where("id = ?", q.id)
+	}
+
+	if len(q.scope) > 0 && !q.scope.Has("*") {
+		tx = tx.Where("scope in (?)", q.scope.List())
+	}
+
+	if q.uid != "" {
+		tx = tx.Where("uid = ?", q.uid)
+	}
+
+	if q.active {
+		tx = tx.Where("active = ?", true)
+	}
+
+	return tx
+}
+
+func (q *AlertQuery) Get() []*model.Alert {
+	return q.get(q.where().Model(&model.Alert{}))
+}
+
+func (q *AlertQuery) One() *model.Alert {
+	return q.one(q.where().Model(&model.Alert{}))
+}
+
+func (q *AlertQuery) Count() int64 {
+	return q.count(q.where().Model(&model.Alert{}))
+}
+
+// CountByScope returns number of alerts in every scope.
+func (q *AlertQuery) CountByScope() map[string]int64 {
+	var rows []struct {
+		Scope string
+		Cnt   int64
+	}
+
+	res := make(map[string]int64)
+
+	if err := q.where().Model(&model.Alert{}).Select("scope, count(*) as cnt").Group("scope").Scan(&rows).Error; err != nil {
+		return res
+	}
+
+	for _, r := range rows {
+		res[r.Scope] = r.Cnt
+	}
+
+	return res
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+	"github.com/kdudkov/goatak/pkg/util"
+)
+
+// AuditQuery has no update and delete, audit log is append-only.
+type AuditQuery struct {
+	Query[model.AuditEvent]
+	actor  string
+	action string
+	target string
+	// scope is a filter of request, readScope are scopes user can see
+	scope     string
+	readScope util.StringSet
+	after     time.Time
+	before    time.Time
+}
+
+func NewAuditQuery(db *gorm.DB) *AuditQuery {
+	return &AuditQuery{
+		Query: Query[model.AuditEvent]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "time DESC, id DESC",
+		},
+		readScope: util.NewStringSet(),
+	}
+}
+
+func (q *AuditQuery) Order(s string) *AuditQuery {
+	q.order = s
+	return q
+}
+
+func (q *AuditQuery) Limit(n int) *AuditQuery {
+	q.limit = n
+	return q
+}
+
+func (q *AuditQuery) Offset(n int) *AuditQuery {
+	q.offset = n
+	return q
+}
+
+func (q *AuditQuery) Actor(actor string) *AuditQuery {
+	q.actor = actor
+	return q
+}
+
+func (q *AuditQuery) Action(action string) *AuditQuery {
+	q.action = action
+	return q
+}
+
+func (q *AuditQuery) Target(target string) *AuditQuery {
+	q.target = target
+	return q
+}
+
+func (q *AuditQuery) Scope(scope string) *AuditQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.scope = scope
+
+	return q
+}
+
+func (q *AuditQuery) ReadScope(scope []string) *AuditQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.readScope.Add(scope...)
+
+	return q
+}
+
+func (q *AuditQuery) After(t time.Time) *AuditQuery {
+	q.after = t
+	return q
+}
+
+func (q *AuditQuery) Before(t time.Time) *AuditQuery {
+	q.before = t
+	return q
+}
+
+func (q *AuditQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.actor != "" {
+		tx = tx.Where("actor = ?", q.actor)
+	}
+
+	if q.action != "" {
+		tx = tx.Where("action = ?", q.action)
+	}
+
+	if q.target != "" {
+		tx = tx.Where("target = ?", q.target)
+	}
+
+	if q.scope != "" {
+		tx = tx.Where("scope = ?", q.scope)
+	}
+
+	if len(q.readScope) > 0 && !q.readScope.Has("*") {
+		tx = tx.Where("scope in (?)", q.readScope.List())
+	}
+
+	if !q.after.IsZero() {
+		tx = tx.Where("time >= ?", q.after)
+	}
+
+	if !q.before.IsZero() {
+		tx = tx.Where("time < ?", q.before)
+	}
+
+	return tx
+}
+
+func (q *AuditQuery) Get() []*model.AuditEvent {
+	return q.get(q.where().Model(&model.AuditEvent{}))
+}
+
+func (q *AuditQuery) Count() int64 {
+	return q.count(q.where().Model(&model.AuditEvent{}))
+}
@@ -11,9 +11,10 @@ import (
 
 type CertQuery struct {
 	Query[model.Certificate]
-	uid   string
-	login string
-	sn    string
+	uid     string
+	login   string
+	sn      string
+	revoked bool
 }
 
 func NewCertQuery(db *gorm.DB) *CertQuery {
@@ -58,6 +59,11 @@ func (q *CertQuery) SN(sn string) *CertQuery {
 	return q
 }
 
+func (q *CertQuery) Revoked() *CertQuery {
+	q.revoked = true
+	return q
+}
+
 func (q *CertQuery) where() *gorm.DB {
 	tx := q.db
 
@@ -73,6 +79,10 @@ func (q *CertQuery) where() *gorm.DB {
 		tx = tx.Where("serial = ?", q.sn)
 	}
 
+	if q.revoked {
+		tx = tx.Where("revoked_at is not null")
+	}
+
 	return tx
 }
 
@@ -81,7 +81,7 @@ func (q *ChangeQuery) After(t time.Time) *ChangeQuery {
 }
 
 func (q *ChangeQuery) where() *gorm.DB {
-	tx := q.db.Joins("MissionPoint").Joins("Resource")
+	tx := q.db.Joins("MissionPoint").Joins("Resource").Joins("LogEntry")
 
 	if q.id != 0 {
 		tx = tx.Where("id = ?", q.id)
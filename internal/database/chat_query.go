@@ -0,0 +1,178 @@
+package database
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+	"github.com/kdudkov/goatak/pkg/util"
+)
+
+type ChatQuery struct {
+	Query[model.ChatMessage]
+	id       string
+	scope    util.StringSet
+	chatroom string
+	uid      string
+	after    time.Time
+	before   time.Time
+}
+
+func NewChatQuery(db *gorm.DB) *ChatQuery {
+	return &ChatQuery{
+		Query: Query[model.ChatMessage]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "time DESC",
+		},
+		scope: util.NewStringSet(),
+	}
+}
+
+func (q *ChatQuery) Order(s string) *ChatQuery {
+	q.order = s
+	return q
+}
+
+func (q *ChatQuery) Limit(n int) *ChatQuery {
+	q.limit = n
+	return q
+}
+
+func (q *ChatQuery) Offset(n int) *ChatQuery {
+	q.offset = n
+	return q
+}
+
+func (q *ChatQuery) Id(id string) *ChatQuery {
+	q.id = id
+	return q
+}
+
+func (q *ChatQuery) Scope(scope string) *ChatQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.scope.Add(scope)
+
+	return q
+}
+
+func (q *ChatQuery) ReadScope(scope []string) *ChatQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.scope.Add(scope...)
+
+	return q
+}
+
+func (q *ChatQuery) Chatroom(chatroom string) *ChatQuery {
+	q.chatroom = chatroom
+	return q
+}
+
+// UID selects messages sent from or to uid.
+func (q *ChatQuery) UID(uid string) *ChatQuery {
+	q.uid = uid
+	return q
+}
+
+func (q *ChatQuery) After(t time.Time) *ChatQuery {
+	q.after = t
+	return q
+}
+
+func (q *ChatQuery) Before(t time.Time) *ChatQuery {
+	q.before = t
+	return q
+}
+
+func (q *ChatQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.id != "" {
+		tx = tx.Where("id = ?", q.id)
+	}
+
+	if len(q.scope) > 0 && !q.scope.Has("*") {
+		tx = tx.Where("scope in (?)", q.scope.List())
+	}
+
+	if q.chatroom != "" {
+		tx = tx.Where("chatroom = ?", q.chatroom)
+	}
+
+	if q.uid != "" {
+		tx = tx.Where("from_uid = ? OR to_uid = ?", q.uid, q.uid)
+	}
+
+	if !q.after.IsZero() {
+		tx = tx.Where("time >= ?", q.after)
+	}
+
+	if !q.before.IsZero() {
+		tx = tx.Where("time < ?", q.before)
+	}
+
+	return tx
+}
+
+func (q *ChatQuery) Get() []*model.ChatMessage {
+	return q.get(q.where().Model(&model.ChatMessage{}))
+}
+
+func (q *ChatQuery) One() *model.ChatMessage {
+	return q.one(q.where().Model(&model.ChatMessage{}))
+}
+
+func (q *ChatQuery) Count() int64 {
+	return q.count(q.where().Model(&model.ChatMessage{}))
+}
+
+func (q *ChatQuery) Delete() error {
+	return q.where().Delete(&model.ChatMessage{}).Error
+}
+
+// Chatrooms returns chatrooms with message count and last message time, most recent first.
+func (q *ChatQuery) Chatrooms() []*model.ChatroomDTO {
+	var rows []struct {
+		Chatroom string
+		Count    int64
+	}
+
+	err := q.where().Model(&model.ChatMessage{}).
+		Select("chatroom, count(*) as count").
+		Group("chatroom").
+		Scan(&rows).Error
+
+	if err != nil {
+		slog.Error("db get error", slog.Any("error", err))
+		return nil
+	}
+
+	res := make([]*model.ChatroomDTO, 0, len(rows))
+
+	for _, r := range rows {
+		c := &model.ChatroomDTO{Chatroom: r.Chatroom, Count: r.Count}
+
+		var last model.ChatMessage
+		if q.where().Where("chatroom = ?", r.Chatroom).Order("time DESC").Take(&last).Error == nil {
+			c.Last = last.Time
+		}
+
+		res = append(res, c)
+	}
+
+	slices.SortFunc(res, func(a, b *model.ChatroomDTO) int {
+		return b.Last.Compare(a.Last)
+	})
+
+	return res
+}
@@ -8,9 +8,11 @@ import (
 
 type DeviceQuery struct {
 	Query[model.Device]
-	login string
-	scope string
-	full  bool
+	login      string
+	scope      string
+	admin      bool
+	superAdmin bool
+	full       bool
 }
 
 func NewDeviceQuery(db *gorm.DB) *DeviceQuery {
@@ -50,6 +52,16 @@ func (q *DeviceQuery) Scope(scope string) *DeviceQuery {
 	return q
 }
 
+func (q *DeviceQuery) Admin() *DeviceQuery {
+	q.admin = true
+	return q
+}
+
+func (q *DeviceQuery) SuperAdmin() *DeviceQuery {
+	q.superAdmin = true
+	return q
+}
+
 func (q *DeviceQuery) Full() *DeviceQuery {
 	q.full = true
 	return q
@@ -66,6 +78,14 @@ func (q *DeviceQuery) where() *gorm.DB {
 		tx = tx.Where("scope = ?", q.scope)
 	}
 
+	if q.admin {
+		tx = tx.Where("admin = ?", true)
+	}
+
+	if q.superAdmin {
+		tx = tx.Where("super_admin = ? OR (admin = ? AND role = ?)", true, true, model.ROLE_SUPERADMIN)
+	}
+
 	if q.full {
 		tx = tx.Preload("Certs", func(db *gorm.DB) *gorm.DB {
 			return db.Order("certificates.last_connect desc")
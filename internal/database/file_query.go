@@ -1,6 +1,8 @@
 package database
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 
 	"github.com/kdudkov/goatak/pkg/model"
@@ -15,6 +17,10 @@ type ResourceQuery struct {
 	hash  string
 	uid   string
 	name  string
+
+	expired      bool
+	before       time.Time
+	notInMission bool
 }
 
 func NewResourceQuery(db *gorm.DB) *ResourceQuery {
@@ -120,6 +126,34 @@ func (q *ResourceQuery) Name(name string) *ResourceQuery {
 	return q
 }
 
+// Expired selects resources with expiration time in the past.
+func (q *ResourceQuery) Expired() *ResourceQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.expired = true
+	return q
+}
+
+func (q *ResourceQuery) Before(t time.Time) *ResourceQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.before = t
+	return q
+}
+
+func (q *ResourceQuery) NotInMission() *ResourceQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.notInMission = true
+	return q
+}
+
 func (q *ResourceQuery) where() *gorm.DB {
 	tx := q.db
 
@@ -147,6 +181,18 @@ func (q *ResourceQuery) where() *gorm.DB {
 		tx = tx.Where("name = ?", q.name)
 	}
 
+	if q.expired {
+		tx = tx.Where("expiration > 0 AND expiration < ?", time.Now().Unix())
+	}
+
+	if !q.before.IsZero() {
+		tx = tx.Where("resources.created_at < ?", q.before)
+	}
+
+	if q.notInMission {
+		tx = tx.Where("id NOT IN (SELECT resource_id FROM mission_resources)")
+	}
+
 	return tx
 }
 
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type GeofenceQuery struct {
+	Query[model.Geofence]
+	id       uint
+	scope    string
+	shapeUID string
+	enabled  bool
+}
+
+func NewGeofenceQuery(db *gorm.DB) *GeofenceQuery {
+	return &GeofenceQuery{
+		Query: Query[model.Geofence]{
+			db:     db,
+			limit:  0,
+			offset: 0,
+			order:  "name",
+		},
+	}
+}
+
+func (q *GeofenceQuery) Order(s string) *GeofenceQuery {
+	q.order = s
+	return q
+}
+
+func (q *GeofenceQuery) Limit(n int) *GeofenceQuery {
+	q.limit = n
+	return q
+}
+
+func (q *GeofenceQuery) Offset(n int) *GeofenceQuery {
+	q.offset = n
+	return q
+}
+
+func (q *GeofenceQuery) Id(id uint) *GeofenceQuery {
+	q.id = id
+	return q
+}
+
+func (q *GeofenceQuery) Scope(scope string) *GeofenceQuery {
+	q.scope = scope
+	return q
+}
+
+func (q *GeofenceQuery) ShapeUID(uid string) *GeofenceQuery {
+	q.shapeUID = uid
+	return q
+}
+
+func (q *GeofenceQuery) Enabled() *GeofenceQuery {
+	q.enabled = true
+	return q
+}
+
+func (q *GeofenceQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.id != 0 {
+		tx = tx.Where("id = ?", q.id)
+	}
+
+	if q.scope != "" {
+		tx = tx.Where("scope = ?", q.scope)
+	}
+
+	if q.shapeUID != "" {
+		tx = tx.Where("shape_uid = ?", q.shapeUID)
+	}
+
+	if q.enabled {
+		tx = tx.Where("enabled = ?", true)
+	}
+
+	return tx
+}
+
+func (q *GeofenceQuery) Get() []*model.Geofence {
+	return q.get(q.where().Model(&model.Geofence{}))
+}
+
+func (q *GeofenceQuery) One() *model.Geofence {
+	return q.one(q.where().Model(&model.Geofence{}))
+}
+
+func (q *GeofenceQuery) Delete() error {
+	return q.where().Delete(&model.Geofence{}).Error
+}
+
+type GeofenceEventQuery struct {
+	Query[model.GeofenceEvent]
+	fenceID uint
+	scope   string
+	uid     string
+	after   time.Time
+}
+
+func NewGeofenceEventQuery(db *gorm.DB) *GeofenceEventQuery {
+	return &GeofenceEventQuery{
+		Query: Query[model.GeofenceEvent]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "created_at DESC",
+		},
+	}
+}
+
+func (q *GeofenceEventQuery) Limit(n int) *GeofenceEventQuery {
+	q.limit = n
+	return q
+}
+
+func (q *GeofenceEventQuery) Offset(n int) *GeofenceEventQuery {
+	q.offset = n
+	return q
+}
+
+func (q *GeofenceEventQuery) Geofence(id uint) *GeofenceEventQuery {
+	q.fenceID = id
+	return q
+}
+
+func (q *GeofenceEventQuery) Scope(scope string) *GeofenceEventQuery {
+	q.scope = scope
+	return q
+}
+
+func (q *GeofenceEventQuery) UID(uid string) *GeofenceEventQuery {
+	q.uid = uid
+	return q
+}
+
+func (q *GeofenceEventQuery) After(t time.Time) *GeofenceEventQuery {
+	q.after = t
+	return q
+}
+
+func (q *GeofenceEventQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.fenceID != 0 {
+		tx = tx.Where("geofence_id = ?", q.fenceID)
+	}
+
+	if q.scope != "" {
+		tx = tx.Where("scope = ?", q.scope)
+	}
+
+	if q.uid != "" {
+		tx = tx.Where("uid = ?", q.uid)
+	}
+
+	if !q.after.IsZero() {
+		tx = tx.Where("created_at > ?", q.after)
+	}
+
+	return tx
+}
+
+func (q *GeofenceEventQuery) Get() []*model.GeofenceEvent {
+	return q.get(q.where().Model(&model.GeofenceEvent{}))
+}
+
+func (q *GeofenceEventQuery) Count() int64 {
+	return q.count(q.where().Model(&model.GeofenceEvent{}))
+}
+
+func (q *GeofenceEventQuery) Delete() error {
+	return q.where().Delete(&model.GeofenceEvent{}).Error
+}
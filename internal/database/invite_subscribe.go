@@ -8,41 +8,58 @@ import (
 	"github.com/kdudkov/goatak/pkg/model"
 )
 
-func (mm *DatabaseManager) Subscribe(user *model.Device, mission *model.Mission, uid, password string) (*model.Subscription, error) {
-	if mission.InviteOnly {
-		return nil, fmt.Errorf("Illegal attempt to subscribe to invite only mission!")
+// Subscribe subscribes client to the mission. Invited client gets the role from invitation and needs no password,
+// the invitation must be already matched to the user and is used once.
+func (mm *DatabaseManager) Subscribe(user *model.Device, mission *model.Mission, uid, password string,
+	inv *model.Invitation,
+) (*model.Subscription, error) {
+	var role string
+
+	if inv != nil {
+		if model.IsValidRole(inv.Role) {
+			role = inv.Role
+		}
+	} else {
+		if mission.InviteOnly {
+			return nil, fmt.Errorf("Illegal attempt to subscribe to invite only mission!")
+		}
+
+		if !mission.CheckPassword(password) {
+			return nil, fmt.Errorf("Illegal attempt to subscribe to mission! Password did not match.")
+		}
 	}
 
-	if mission.Password != "" && password != mission.Password {
-		return nil, fmt.Errorf("Illegal attempt to subscribe to mission! Password did not match.")
+	s, err := mm.subscribe(mission.ID, uid, user.GetLogin(), role)
+
+	if err == nil && s != nil && inv != nil {
+		err = mm.InvitationQuery().Id(inv.ID).Delete()
 	}
 
-	return mm.subscribe(mission.ID, uid, user.GetLogin(), false)
+	return s, err
 }
 
-func (mm *DatabaseManager) subscribe(missionID uint, clientUID string, username string, creator bool) (*model.Subscription, error) {
+// subscribe creates or updates the subscription, empty role keeps the role of existing subscription.
+func (mm *DatabaseManager) subscribe(missionID uint, clientUID string, username string, role string) (*model.Subscription, error) {
 	if clientUID == "" {
 		return nil, nil
 	}
 
 	var s *model.Subscription
 
-	role := "MISSION_SUBSCRIBER"
-	if creator {
-		role = "MISSION_CREATOR"
-	}
-
 	err := mm.db.Transaction(func(tx *gorm.DB) error {
 		if ss := NewSubscriptionQuery(tx).Mission(missionID).Client(clientUID).One(); ss != nil {
 			s = ss
 		} else {
-			s = new(model.Subscription)
+			s = &model.Subscription{Role: model.RoleSubscriber}
 		}
 
 		s.MissionID = missionID
 		s.ClientUID = clientUID
 		s.Username = username
-		s.Role = role
+
+		if role != "" {
+			s.Role = role
+		}
 
 		return tx.Save(s).Error
 	})
@@ -50,6 +67,43 @@ func (mm *DatabaseManager) subscribe(missionID uint, clientUID string, username
 	return s, err
 }
 
+// SetRole changes the role of mission subscriber.
+func (mm *DatabaseManager) SetRole(missionID uint, clientUID string, role string) error {
+	if !model.IsValidRole(role) {
+		return fmt.Errorf("invalid role %s", role)
+	}
+
+	// empty uid is no filter, it would change all subscriptions of the mission
+	if clientUID == "" {
+		return fmt.Errorf("empty client uid")
+	}
+
+	sub := mm.SubscriptionQuery().Mission(missionID).Client(clientUID).One()
+	if sub == nil {
+		return fmt.Errorf("no subscription of %s", clientUID)
+	}
+
+	// user's role is the best one of all its subscriptions, so all of them are changed
+	if sub.Username != "" {
+		return mm.SubscriptionQuery().Mission(missionID).Username(sub.Username).Update(map[string]any{"role": role})
+	}
+
+	return mm.SubscriptionQuery().Mission(missionID).Client(clientUID).Update(map[string]any{"role": role})
+}
+
+// UserRole returns the best role of the user's subscriptions to the mission or empty string.
+func (mm *DatabaseManager) UserRole(missionID uint, username string) string {
+	var role string
+
+	for _, s := range mm.SubscriptionQuery().Mission(missionID).Username(username).Get() {
+		if model.RoleRank(s.Role) > model.RoleRank(role) {
+			role = s.Role
+		}
+	}
+
+	return role
+}
+
 func (mm *DatabaseManager) GetSubscribers(missionId uint) []string {
 	subscriptions := mm.SubscriptionQuery().Mission(missionId).Get()
 
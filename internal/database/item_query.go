@@ -0,0 +1,79 @@
+package database
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type ItemQuery struct {
+	Query[model.StoredItem]
+	uid   string
+	scope string
+}
+
+func NewItemQuery(db *gorm.DB) *ItemQuery {
+	return &ItemQuery{
+		Query: Query[model.StoredItem]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "uid",
+		},
+	}
+}
+
+func (q *ItemQuery) Order(s string) *ItemQuery {
+	q.order = s
+	return q
+}
+
+func (q *ItemQuery) Limit(n int) *ItemQuery {
+	q.limit = n
+	return q
+}
+
+func (q *ItemQuery) Offset(n int) *ItemQuery {
+	q.offset = n
+	return q
+}
+
+func (q *ItemQuery) UID(uid string) *ItemQuery {
+	q.uid = uid
+	return q
+}
+
+func (q *ItemQuery) Scope(scope string) *ItemQuery {
+	q.scope = scope
+	return q
+}
+
+func (q *ItemQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.uid != "" {
+		tx = tx.Where("uid = ?", q.uid)
+	}
+
+	if q.scope != "" {
+		tx = tx.Where("scope = ?", q.scope)
+	}
+
+	return tx
+}
+
+func (q *ItemQuery) Get() []*model.StoredItem {
+	return q.get(q.where().Model(&model.StoredItem{}))
+}
+
+func (q *ItemQuery) One() *model.StoredItem {
+	return q.one(q.where().Model(&model.StoredItem{}))
+}
+
+func (q *ItemQuery) Count() int64 {
+	return q.count(q.where().Model(&model.StoredItem{}))
+}
+
+func (q *ItemQuery) Delete() error {
+	return q.where().Delete(&model.StoredItem{}).Error
+}
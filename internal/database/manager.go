@@ -132,11 +132,59 @@ func (mm *DatabaseManager) FeedQuery() *FeedQuery {
 	return NewFeedQuery(mm.db)
 }
 
+func (mm *DatabaseManager) ItemQuery() *ItemQuery {
+	return NewItemQuery(mm.db)
+}
+
+func (mm *DatabaseManager) TrackQuery() *TrackQuery {
+	return NewTrackQuery(mm.db)
+}
+
+func (mm *DatabaseManager) GeofenceQuery() *GeofenceQuery {
+	return NewGeofenceQuery(mm.db)
+}
+
+func (mm *DatabaseManager) GeofenceEventQuery() *GeofenceEventQuery {
+	return NewGeofenceEventQuery(mm.db)
+}
+
+func (mm *DatabaseManager) ChatQuery() *ChatQuery {
+	return NewChatQuery(mm.db)
+}
+
+func (mm *DatabaseManager) OutboxQuery() *OutboxQuery {
+	return NewOutboxQuery(mm.db)
+}
+
+func (mm *DatabaseManager) AlertQuery() *AlertQuery {
+	return NewAlertQuery(mm.db)
+}
+
+func (mm *DatabaseManager) MissionLogQuery() *MissionLogQuery {
+	return NewMissionLogQuery(mm.db)
+}
+
+func (mm *DatabaseManager) PackageEntryQuery() *PackageEntryQuery {
+	return NewPackageEntryQuery(mm.db)
+}
+
+func (mm *DatabaseManager) ApiTokenQuery() *ApiTokenQuery {
+	return NewApiTokenQuery(mm.db)
+}
+
+func (mm *DatabaseManager) AuditQuery() *AuditQuery {
+	return NewAuditQuery(mm.db)
+}
+
 func (mm *DatabaseManager) Migrate() error {
 	if mm == nil || mm.db == nil {
 		return fmt.Errorf("no database")
 	}
 
+	// admins of older versions could see all scopes, keep it that way when super admin flag appears
+	newSuperAdmin := mm.db.Migrator().HasTable(&model.Device{}) &&
+		!mm.db.Migrator().HasColumn(&model.Device{}, "super_admin")
+
 	// Migrate the schema
 	if err := mm.db.AutoMigrate(
 		&model.Mission{},
@@ -149,11 +197,42 @@ func (mm *DatabaseManager) Migrate() error {
 		&model.Certificate{},
 		&model.Profile{},
 		&model.Feed2{},
+		&model.StoredItem{},
+		&model.TrackPoint{},
+		&model.Geofence{},
+		&model.GeofenceEvent{},
+		&model.ChatMessage{},
+		&model.OutboxMessage{},
+		&model.Alert{},
+		&model.PackageEntry{},
+		&model.MissionLogEntry{},
+		&model.SigningKey{},
+		&model.ApiToken{},
+		&model.RevokedToken{},
+		&model.AuditEvent{},
 	); err != nil {
 		return err
 	}
 
-	return nil
+	if newSuperAdmin {
+		if err := mm.DeviceQuery().Admin().Update(map[string]any{"super_admin": true}); err != nil {
+			return err
+		}
+	}
+
+	return mm.migrateMissions()
+}
+
+// AddToOutbox stores the message, undelivered message with the same uid for the same recipient is replaced.
+func (mm *DatabaseManager) AddToOutbox(o *model.OutboxMessage) error {
+	var old model.OutboxMessage
+
+	if mm.db.Where("uid = ? AND callsign = ? AND msg_uid = ?", o.UID, o.Callsign, o.MsgUID).Take(&old).Error == nil {
+		o.ID = old.ID
+		o.CreatedAt = time.Now()
+	}
+
+	return mm.Save(o)
 }
 
 func (mm *DatabaseManager) UpdateMissionChanged(id uint) error {
@@ -325,6 +404,11 @@ func (mm *DatabaseManager) GetChanges(missionId uint, after time.Time, squashed
 	for _, c := range ch {
 		key := util.FirstString(c.ContentUID, c.ContentHash)
 
+		// log entries are not mission content, clients get them from the log
+		if c.LogEntryID != nil {
+			continue
+		}
+
 		if uids.Has(key) {
 			continue
 		}
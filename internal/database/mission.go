@@ -46,7 +46,7 @@ func (mm *DatabaseManager) CreateMission(m *model.Mission) error {
 		return err
 	}
 
-	_, err = mm.subscribe(m.ID, m.CreatorUID, m.Creator, true)
+	_, err = mm.subscribe(m.ID, m.CreatorUID, m.Creator, model.RoleOwner)
 
 	return err
 }
@@ -54,3 +54,33 @@ func (mm *DatabaseManager) CreateMission(m *model.Mission) error {
 func (mm *DatabaseManager) UpdateKw(name, scope string, kw []string) error {
 	return mm.MissionQuery().Name(name).Scope(scope).Update(map[string]any{"keywords": strings.Join(kw, ",")})
 }
+
+// migrateMissions converts creator subscriptions to owner ones and hashes plaintext mission passwords.
+func (mm *DatabaseManager) migrateMissions() error {
+	if err := mm.db.Model(&model.Subscription{}).Where("role = ?", "MISSION_CREATOR").
+		Update("role", model.RoleOwner).Error; err != nil {
+		return err
+	}
+
+	var missions []*model.Mission
+
+	if err := mm.db.Where("password <> ''").Find(&missions).Error; err != nil {
+		return err
+	}
+
+	for _, m := range missions {
+		if m.PasswordHashed() {
+			continue
+		}
+
+		if err := m.SetPassword(m.Password); err != nil {
+			return err
+		}
+
+		if err := mm.MissionQuery().Id(m.ID).Update(map[string]any{"password": m.Password}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
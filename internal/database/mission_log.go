@@ -0,0 +1,70 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// SaveMissionLogEntry creates or updates the log entry and records the change of the mission.
+// Update of existing entry is recorded as the new addition of it.
+func (mm *DatabaseManager) SaveMissionLogEntry(e *model.MissionLogEntry, authorUID string) (*model.Change, error) {
+	if e == nil || e.MissionID == 0 || e.UID == "" {
+		return nil, fmt.Errorf("invalid log entry")
+	}
+
+	c := &model.Change{
+		Type:       model.CHANGE_TYPE_ADD,
+		MissionID:  e.MissionID,
+		CreatorUID: authorUID,
+		ContentUID: e.UID,
+	}
+
+	err := mm.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Mission").Save(e).Error; err != nil {
+			return err
+		}
+
+		c.LogEntryID = &e.ID
+
+		return tx.Create(c).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.LogEntry = e
+
+	return c, nil
+}
+
+func (mm *DatabaseManager) DeleteMissionLogEntry(e *model.MissionLogEntry, authorUID string) (*model.Change, error) {
+	if e == nil {
+		return nil, nil
+	}
+
+	c := &model.Change{
+		Type:       model.CHANGE_TYPE_REMOVE,
+		MissionID:  e.MissionID,
+		CreatorUID: authorUID,
+		ContentUID: e.UID,
+		LogEntryID: &e.ID,
+	}
+
+	err := mm.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(e).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(c).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+	"github.com/kdudkov/goatak/pkg/util"
+)
+
+type MissionLogQuery struct {
+	Query[model.MissionLogEntry]
+	id        uint
+	uid       string
+	missionID uint
+	scope     util.StringSet
+	after     time.Time
+	before    time.Time
+}
+
+func NewMissionLogQuery(db *gorm.DB) *MissionLogQuery {
+	return &MissionLogQuery{
+		Query: Query[model.MissionLogEntry]{
+			db:     db,
+			limit:  1000,
+			offset: 0,
+			order:  "dtg DESC",
+		},
+		scope: util.NewStringSet(),
+	}
+}
+
+func (q *MissionLogQuery) Limit(n int) *MissionLogQuery {
+	q.limit = n
+	return q
+}
+
+func (q *MissionLogQuery) Id(id uint) *MissionLogQuery {
+	q.id = id
+	return q
+}
+
+func (q *MissionLogQuery) UID(uid string) *MissionLogQuery {
+	q.uid = uid
+	return q
+}
+
+func (q *MissionLogQuery) Mission(id uint) *MissionLogQuery {
+	q.missionID = id
+	return q
+}
+
+func (q *MissionLogQuery) ReadScope(scope []string) *MissionLogQuery {
+	q.scope.Add(scope...)
+	return q
+}
+
+func (q *MissionLogQuery) After(t time.Time) *MissionLogQuery {
+	q.after = t
+	return q
+}
+
+func (q *MissionLogQuery) Before(t time.Time) *MissionLogQuery {
+	q.before = t
+	return q
+}
+
+func (q *MissionLogQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.id != 0 {
+		tx = tx.Where("id = ?", q.id)
+	}
+
+	if q.uid != "" {
+		tx = tx.Where("uid = ?", q.uid)
+	}
+
+	if q.missionID != 0 {
+		tx = tx.Where("mission_id = ?", q.missionID)
+	}
+
+	if len(q.scope) > 0 && !q.scope.Has("*") {
+		tx = tx.Where("scope in (?)", q.scope.List())
+	}
+
+	if !q.after.IsZero() {
+		tx = tx.Where("dtg > ?", q.after)
+	}
+
+	if !q.before.IsZero() {
+		tx = tx.Where("dtg < ?", q.before)
+	}
+
+	return tx
+}
+
+func (q *MissionLogQuery) Get() []*model.MissionLogEntry {
+	return q.get(q.where().Preload("Mission").Model(&model.MissionLogEntry{}))
+}
+
+func (q *MissionLogQuery) One() *model.MissionLogEntry {
+	return q.one(q.where().Preload("Mission").Model(&model.MissionLogEntry{}))
+}
+
+func (q *MissionLogQuery) Count() int64 {
+	return q.count(q.where().Model(&model.MissionLogEntry{}))
+}
+
+func (q *MissionLogQuery) Delete() error {
+	return q.where().Delete(&model.MissionLogEntry{}).Error
+}
@@ -13,6 +13,7 @@ type MissionQuery struct {
 	name  string
 	scope util.StringSet
 	tool  string
+	res   uint
 	full  bool
 }
 
@@ -102,6 +103,16 @@ func (q *MissionQuery) ReadScope(scope []string) *MissionQuery {
 	return q
 }
 
+// Resource selects missions the resource is added to.
+func (q *MissionQuery) Resource(id uint) *MissionQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.res = id
+	return q
+}
+
 func (q *MissionQuery) Full() *MissionQuery {
 	if q == nil {
 		return nil
@@ -130,6 +141,10 @@ func (q *MissionQuery) where() *gorm.DB {
 		tx = tx.Where("missions.scope in (?)", q.scope.List())
 	}
 
+	if q.res != 0 {
+		tx = tx.Where("missions.id IN (SELECT mission_id FROM mission_resources WHERE resource_id = ?)", q.res)
+	}
+
 	if q.full {
 		tx = tx.Preload("Points").Preload("Resources")
 	}
@@ -155,6 +170,7 @@ func (q *MissionQuery) Delete(id uint) error {
 			&model.Subscription{},
 			&model.Invitation{},
 			&model.Change{},
+			&model.MissionLogEntry{},
 		}
 
 		if err := tx.Where("id = ?", id).Delete(&model.Mission{}).Error; err != nil {
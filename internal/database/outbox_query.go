@@ -0,0 +1,164 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+	"github.com/kdudkov/goatak/pkg/util"
+)
+
+type OutboxQuery struct {
+	Query[model.OutboxMessage]
+	id       uint
+	scope    util.StringSet
+	uid      string
+	callsign string
+	msgUID   string
+	expired  bool
+	active   bool
+}
+
+func NewOutboxQuery(db *gorm.DB) *OutboxQuery {
+	return &OutboxQuery{
+		Query: Query[model.OutboxMessage]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "created_at",
+		},
+		scope: util.NewStringSet(),
+	}
+}
+
+func (q *OutboxQuery) Order(s string) *OutboxQuery {
+	q.order = s
+	return q
+}
+
+func (q *OutboxQuery) Limit(n int) *OutboxQuery {
+	q.limit = n
+	return q
+}
+
+func (q *OutboxQuery) Offset(n int) *OutboxQuery {
+	q.offset = n
+	return q
+}
+
+func (q *OutboxQuery) Id(id uint) *OutboxQuery {
+	q.id = id
+	return q
+}
+
+func (q *OutboxQuery) Scope(scope string) *OutboxQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.scope.Add(scope)
+
+	return q
+}
+
+func (q *OutboxQuery) ReadScope(scope []string) *OutboxQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.scope.Add(scope...)
+
+	return q
+}
+
+func (q *OutboxQuery) UID(uid string) *OutboxQuery {
+	q.uid = uid
+	return q
+}
+
+func (q *OutboxQuery) Callsign(callsign string) *OutboxQuery {
+	q.callsign = callsign
+	return q
+}
+
+// Recipient selects messages for the uid and messages for the callsign with unknown uid.
+func (q *OutboxQuery) Recipient(uid, callsign string) *OutboxQuery {
+	q.uid = uid
+	q.callsign = callsign
+
+	return q.Active()
+}
+
+func (q *OutboxQuery) MsgUID(uid string) *OutboxQuery {
+	q.msgUID = uid
+	return q
+}
+
+func (q *OutboxQuery) Expired() *OutboxQuery {
+	q.expired = true
+	return q
+}
+
+func (q *OutboxQuery) Active() *OutboxQuery {
+	q.active = true
+	return q
+}
+
+func (q *OutboxQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.id != 0 {
+		tx = tx.Where("id = ?", q.id)
+	}
+
+	if len(q.scope) > 0 && !q.scope.Has("*") {
+		tx = tx.Where("scope in (?)", q.scope.List())
+	}
+
+	switch {
+	case q.uid != "" && q.callsign != "":
+		tx = tx.Where("(uid = ? OR (uid = '' AND callsign = ?))", q.uid, q.callsign)
+	case q.uid != "":
+		tx = tx.Where("uid = ?", q.uid)
+	case q.callsign != "":
+		tx = tx.Where("callsign = ?", q.callsign)
+	}
+
+	if q.msgUID != "" {
+		tx = tx.Where("msg_uid = ?", q.msgUID)
+	}
+
+	if q.expired {
+		tx = tx.Where("expires_at < ?", time.Now())
+	}
+
+	if q.active {
+		tx = tx.Where("expires_at >= ?", time.Now())
+	}
+
+	return tx
+}
+
+func (q *OutboxQuery) Get() []*model.OutboxMessage {
+	return q.get(q.where().Model(&model.OutboxMessage{}))
+}
+
+func (q *OutboxQuery) One() *model.OutboxMessage {
+	return q.one(q.where().Model(&model.OutboxMessage{}))
+}
+
+func (q *OutboxQuery) Count() int64 {
+	return q.count(q.where().Model(&model.OutboxMessage{}))
+}
+
+func (q *OutboxQuery) Update(updates map[string]any) error {
+	return q.updateOrError(q.where().Model(&model.OutboxMessage{}), updates)
+}
+
+// Delete returns number of deleted messages.
+func (q *OutboxQuery) Delete() (int64, error) {
+	res := q.where().Delete(&model.OutboxMessage{})
+
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+	"github.com/kdudkov/goatak/pkg/util"
+)
+
+type PackageEntryQuery struct {
+	Query[model.PackageEntry]
+	id       uint
+	resource uint
+	scope    util.StringSet
+	name     string
+}
+
+func NewPackageEntryQuery(db *gorm.DB) *PackageEntryQuery {
+	return &PackageEntryQuery{
+		Query: Query[model.PackageEntry]{
+			db:     db,
+			limit:  1000,
+			offset: 0,
+			order:  "name",
+		},
+		scope: util.NewStringSet(),
+	}
+}
+
+func (q *PackageEntryQuery) Limit(n int) *PackageEntryQuery {
+	q.limit = n
+	return q
+}
+
+func (q *PackageEntryQuery) Id(id uint) *PackageEntryQuery {
+	q.id = id
+	return q
+}
+
+func (q *PackageEntryQuery) Resource(id uint) *PackageEntryQuery {
+	q.resource = id
+	return q
+}
+
+func (q *PackageEntryQuery) ReadScope(scope []string) *PackageEntryQuery {
+	q.scope.Add(scope...)
+	return q
+}
+
+func (q *PackageEntryQuery) Name(name string) *PackageEntryQuery {
+	q.name = name
+	return q
+}
+
+func (q *PackageEntryQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.id != 0 {
+		tx = tx.Where("id = ?", q.id)
+	}
+
+	if q.resource != 0 {
+		tx = tx.Where("resource_id = ?", q.resource)
+	}
+
+	if len(q.scope) > 0 && !q.scope.Has("*") {
+		tx = tx.Where("scope in (?)", q.scope.List())
+	}
+
+	if q.name != "" {
+		tx = tx.Where("name = ?", q.name)
+	}
+
+	return tx
+}
+
+func (q *PackageEntryQuery) Get() []*model.PackageEntry {
+	return q.get(q.where().Model(&model.PackageEntry{}))
+}
+
+func (q *PackageEntryQuery) One() *model.PackageEntry {
+	return q.one(q.where().Model(&model.PackageEntry{}))
+}
+
+func (q *PackageEntryQuery) Count() int64 {
+	return q.count(q.where().Model(&model.PackageEntry{}))
+}
+
+func (q *PackageEntryQuery) Delete() error {
+	return q.where().Delete(&model.PackageEntry{}).Error
+}
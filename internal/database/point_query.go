@@ -4,13 +4,14 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/kdudkov/goatak/pkg/model"
+	"github.com/kdudkov/goatak/pkg/util"
 )
 
 type PointQuery struct {
 	Query[model.Point]
 	id        uint
 	uid       string
-	scope     string
+	scope     util.StringSet
 	missionID uint
 }
 
@@ -22,6 +23,7 @@ func NewPointQuery(db *gorm.DB) *PointQuery {
 			offset: 0,
 			order:  "created_at DESC",
 		},
+		scope: util.NewStringSet(),
 	}
 }
 
@@ -57,7 +59,22 @@ func (q *PointQuery) Mission(id uint) *PointQuery {
 }
 
 func (q *PointQuery) Scope(scope string) *PointQuery {
-	q.scope = scope
+	if q == nil {
+		return nil
+	}
+
+	q.scope.Add(scope)
+
+	return q
+}
+
+func (q *PointQuery) ReadScope(scope []string) *PointQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.scope.Add(scope...)
+
 	return q
 }
 
@@ -76,8 +93,8 @@ func (q *PointQuery) where() *gorm.DB {
 		tx = tx.Where("mission_id = ?", q.missionID)
 	}
 
-	if q.scope != "" {
-		tx = tx.Where("scope = ?", q.scope)
+	if len(q.scope) > 0 && !q.scope.Has("*") {
+		tx = tx.Where("scope in (?)", q.scope.List())
 	}
 
 	return tx
@@ -2,6 +2,7 @@ package database
 
 import (
 	"testing"
+	"time"
 
 	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/require"
@@ -17,7 +18,7 @@ func getTestDatabase() *gorm.DB {
 		panic("failed to connect database")
 	}
 
-	db.AutoMigrate(&model.Device{}, &model.Certificate{})
+	db.AutoMigrate(&model.Device{}, &model.Certificate{}, &model.ChatMessage{})
 
 	return db
 }
@@ -39,3 +40,50 @@ func TestDeviceQuery_Count(t *testing.T) {
 	require.True(t, len(res[0].Certs) > 0)
 	require.True(t, len(res[1].Certs) > 0)
 }
+
+func TestChatQuery(t *testing.T) {
+	db := getTestDatabase()
+
+	now := time.Now().Truncate(time.Second)
+
+	db.Save(&model.ChatMessage{ID: "1", Time: now.Add(-time.Hour * 2), Scope: "a", Chatroom: "All Chat Rooms", FromUID: "u1", ToUID: "All Chat Rooms"})
+	db.Save(&model.ChatMessage{ID: "2", Time: now.Add(-time.Hour), Scope: "a", Chatroom: "All Chat Rooms", FromUID: "u2", ToUID: "All Chat Rooms"})
+	db.Save(&model.ChatMessage{ID: "3", Time: now, Scope: "a", Chatroom: "user1", FromUID: "u2", ToUID: "u1", Direct: true})
+	db.Save(&model.ChatMessage{ID: "4", Time: now, Scope: "b", Chatroom: "All Chat Rooms", FromUID: "u3", ToUID: "All Chat Rooms"})
+
+	require.Len(t, NewChatQuery(db).Get(), 4)
+	require.Len(t, NewChatQuery(db).Scope("a").Get(), 3)
+	require.Len(t, NewChatQuery(db).Scope("b").ReadScope([]string{"*"}).Get(), 4)
+	require.Len(t, NewChatQuery(db).Scope("a").Chatroom("All Chat Rooms").Get(), 2)
+	require.Len(t, NewChatQuery(db).UID("u1").Get(), 2)
+	require.Len(t, NewChatQuery(db).After(now.Add(-time.Minute*90)).Before(now).Get(), 1)
+	require.Equal(t, int64(3), NewChatQuery(db).Chatroom("All Chat Rooms").Count())
+
+	res := NewChatQuery(db).Scope("a").Limit(1).Offset(1).Get()
+	require.Len(t, res, 1)
+	require.Equal(t, "2", res[0].ID)
+
+	rooms := NewChatQuery(db).Scope("a").Chatrooms()
+	require.Len(t, rooms, 2)
+	require.Equal(t, "user1", rooms[0].Chatroom)
+	require.Equal(t, int64(2), rooms[1].Count)
+}
+
+func TestSuperAdminMigration(t *testing.T) {
+	db := getTestDatabase()
+	mm := New(db)
+
+	db.Save(&model.Device{Login: "admin1", Admin: true})
+	db.Save(&model.Device{Login: "user1"})
+	require.NoError(t, db.Migrator().DropColumn(&model.Device{}, "super_admin"))
+
+	// admins of old database become super admins
+	require.NoError(t, mm.Migrate())
+	require.True(t, mm.DeviceQuery().Login("admin1").One().SuperAdmin)
+	require.False(t, mm.DeviceQuery().Login("user1").One().SuperAdmin)
+
+	// but only once
+	require.NoError(t, mm.DeviceQuery().Login("admin1").Update(map[string]any{"super_admin": false}))
+	require.NoError(t, mm.Migrate())
+	require.False(t, mm.DeviceQuery().Login("admin1").One().SuperAdmin)
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// DeleteResource removes the resource with its package entries from the database. Resources added to missions
+// are not removed, mission subscribers would keep them. The blob is left for the retention job, other resources
+// can have the same hash.
+func (mm *DatabaseManager) DeleteResource(id uint) error {
+	return mm.db.Transaction(func(tx *gorm.DB) error {
+		var n int64
+
+		if err := tx.Raw("SELECT count(*) FROM mission_resources WHERE resource_id = ?", id).Scan(&n).Error; err != nil {
+			return err
+		}
+
+		if n > 0 {
+			return fmt.Errorf("resource %d is in mission", id)
+		}
+
+		if err := tx.Where("resource_id = ?", id).Delete(&model.PackageEntry{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", id).Delete(&model.Resource{}).Error
+	})
+}
+
+// ScopeUsage returns total size of resources in every scope.
+func (mm *DatabaseManager) ScopeUsage() (map[string]int64, error) {
+	var rows []struct {
+		Scope string
+		Size  int64
+	}
+
+	if err := mm.db.Model(&model.Resource{}).Select("scope, sum(size) as size").Group("scope").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]int64, len(rows))
+
+	for _, r := range rows {
+		res[r.Scope] = r.Size
+	}
+
+	return res, nil
+}
+
+// Usage is the number and total size of files.
+type Usage struct {
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// ScopeFilesUsage returns usage of the scope, or of every scope if scope is empty.
+func (mm *DatabaseManager) ScopeFilesUsage(scope string) (map[string]*Usage, error) {
+	return mm.filesUsage("scope", scope)
+}
+
+// UserFilesUsage returns usage of files submitted by the login in all scopes, or of every login if login is empty.
+func (mm *DatabaseManager) UserFilesUsage(login string) (map[string]*Usage, error) {
+	return mm.filesUsage("submission_user", login)
+}
+
+func (mm *DatabaseManager) filesUsage(column, value string) (map[string]*Usage, error) {
+	var rows []struct {
+		Name  string
+		Files int64
+		Bytes int64
+	}
+
+	tx := mm.db.Model(&model.Resource{}).Select(column + " as name, count(*) as files, coalesce(sum(size), 0) as bytes")
+
+	if value != "" {
+		tx = tx.Where(column+" = ?", value)
+	}
+
+	if err := tx.Group(column).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*Usage, len(rows))
+
+	for _, r := range rows {
+		res[r.Name] = &Usage{Files: r.Files, Bytes: r.Bytes}
+	}
+
+	return res, nil
+}
+
+// BlobInUse is true if there is a resource with this blob.
+func (mm *DatabaseManager) BlobInUse(scope, hash string) bool {
+	return mm.ResourceQuery().Scope(scope).Hash(hash).One() != nil
+}
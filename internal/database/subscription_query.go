@@ -11,6 +11,7 @@ type SubscriptionQuery struct {
 	id        uint
 	missionID uint
 	clientUID string
+	username  string
 }
 
 func NewSubscriptionQuery(db *gorm.DB) *SubscriptionQuery {
@@ -55,6 +56,11 @@ func (q *SubscriptionQuery) Client(uid string) *SubscriptionQuery {
 	return q
 }
 
+func (q *SubscriptionQuery) Username(username string) *SubscriptionQuery {
+	q.username = username
+	return q
+}
+
 func (q *SubscriptionQuery) where() *gorm.DB {
 	tx := q.db
 
@@ -70,6 +76,10 @@ func (q *SubscriptionQuery) where() *gorm.DB {
 		tx = tx.Where("client_uid = ?", q.clientUID)
 	}
 
+	if q.username != "" {
+		tx = tx.Where("username = ?", q.username)
+	}
+
 	return tx
 }
 
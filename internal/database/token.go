@@ -0,0 +1,50 @@
+package database
+
+import (
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// SigningKeys returns all token signing keys, the newest first.
+func (mm *DatabaseManager) SigningKeys() ([]*model.SigningKey, error) {
+	var res []*model.SigningKey
+
+	err := mm.db.Order("created_at DESC").Find(&res).Error
+
+	return res, err
+}
+
+// DeleteSigningKeys removes keys retired before the time except ones with active api tokens.
+func (mm *DatabaseManager) DeleteSigningKeys(retiredBefore time.Time) (int64, error) {
+	inUse := mm.db.Model(&model.ApiToken{}).Select("key_id").
+		Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+
+	res := mm.db.Where("retired_at IS NOT NULL AND retired_at < ? AND id NOT IN (?)", retiredBefore, inUse).
+		Delete(&model.SigningKey{})
+
+	return res.RowsAffected, res.Error
+}
+
+// DropSigningKeys removes all keys but the given one.
+func (mm *DatabaseManager) DropSigningKeys(keep string) (int64, error) {
+	res := mm.db.Where("id <> ?", keep).Delete(&model.SigningKey{})
+
+	return res.RowsAffected, res.Error
+}
+
+// RevokedTokens returns ids of revoked tokens that are not expired yet.
+func (mm *DatabaseManager) RevokedTokens() ([]string, error) {
+	var res []string
+
+	err := mm.db.Model(&model.RevokedToken{}).Where("expires_at > ?", time.Now()).Pluck("id", &res).Error
+
+	return res, err
+}
+
+// DeleteExpiredRevocations removes entries of tokens that can't be used anymore anyway.
+func (mm *DatabaseManager) DeleteExpiredRevocations() (int64, error) {
+	res := mm.db.Where("expires_at <= ?", time.Now()).Delete(&model.RevokedToken{})
+
+	return res.RowsAffected, res.Error
+}
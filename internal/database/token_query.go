@@ -0,0 +1,119 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+	"github.com/kdudkov/goatak/pkg/util"
+)
+
+type ApiTokenQuery struct {
+	Query[model.ApiToken]
+	id     string
+	name   string
+	keyID  string
+	scope  util.StringSet
+	active bool
+}
+
+func NewApiTokenQuery(db *gorm.DB) *ApiTokenQuery {
+	return &ApiTokenQuery{
+		Query: Query[model.ApiToken]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "created_at DESC",
+		},
+		scope: util.NewStringSet(),
+	}
+}
+
+func (q *ApiTokenQuery) Order(s string) *ApiTokenQuery {
+	q.order = s
+	return q
+}
+
+func (q *ApiTokenQuery) Limit(n int) *ApiTokenQuery {
+	q.limit = n
+	return q
+}
+
+func (q *ApiTokenQuery) Offset(n int) *ApiTokenQuery {
+	q.offset = n
+	return q
+}
+
+func (q *ApiTokenQuery) Id(id string) *ApiTokenQuery {
+	q.id = id
+	return q
+}
+
+func (q *ApiTokenQuery) Name(name string) *ApiTokenQuery {
+	q.name = name
+	return q
+}
+
+func (q *ApiTokenQuery) KeyID(id string) *ApiTokenQuery {
+	q.keyID = id
+	return q
+}
+
+func (q *ApiTokenQuery) ReadScope(scope []string) *ApiTokenQuery {
+	if q == nil {
+		return nil
+	}
+
+	q.scope.Add(scope...)
+
+	return q
+}
+
+// Active selects tokens that are not revoked and not expired.
+func (q *ApiTokenQuery) Active() *ApiTokenQuery {
+	q.active = true
+	return q
+}
+
+func (q *ApiTokenQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.id != "" {
+		tx = tx.Where("id = ?", q.id)
+	}
+
+	if q.name != "" {
+		tx = tx.Where("name = ?", q.name)
+	}
+
+	if q.keyID != "" {
+		tx = tx.Where("key_id = ?", q.keyID)
+	}
+
+	if len(q.scope) > 0 && !q.scope.Has("*") {
+		tx = tx.Where("scope in (?)", q.scope.List())
+	}
+
+	if q.active {
+		tx = tx.Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+	}
+
+	return tx
+}
+
+func (q *ApiTokenQuery) Get() []*model.ApiToken {
+	return q.get(q.where().Model(&model.ApiToken{}))
+}
+
+func (q *ApiTokenQuery) One() *model.ApiToken {
+	return q.one(q.where().Model(&model.ApiToken{}))
+}
+
+func (q *ApiTokenQuery) Count() int64 {
+	return q.count(q.where().Model(&model.ApiToken{}))
+}
+
+func (q *ApiTokenQuery) Update(updates map[string]any) error {
+	return q.updateOrError(q.where().Model(&model.ApiToken{}), updates)
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+	"github.com/kdudkov/goatak/pkg/util"
+)
+
+type TrackQuery struct {
+	Query[model.TrackPoint]
+	uid    string
+	scope  util.StringSet
+	after  time.Time
+	before time.Time
+	bbox   []float64
+}
+
+func NewTrackQuery(db *gorm.DB) *TrackQuery {
+	return &TrackQuery{
+		Query: Query[model.TrackPoint]{
+			db:     db,
+			limit:  model.MaxTrackPoints,
+			offset: 0,
+			order:  "time DESC",
+		},
+		scope: util.NewStringSet(),
+	}
+}
+
+func (q *TrackQuery) Order(s string) *TrackQuery {
+	q.order = s
+	return q
+}
+
+func (q *TrackQuery) Limit(n int) *TrackQuery {
+	q.limit = n
+	return q
+}
+
+func (q *TrackQuery) Offset(n int) *TrackQuery {
+	q.offset = n
+	return q
+}
+
+func (q *TrackQuery) UID(uid string) *TrackQuery {
+	q.uid = uid
+	return q
+}
+
+func (q *TrackQuery) Scope(scope string) *TrackQuery {
+	if scope != "" {
+		q.scope.Add(scope)
+	}
+
+	return q
+}
+
+func (q *TrackQuery) ReadScope(scope []string) *TrackQuery {
+	q.scope.Add(scope...)
+
+	return q
+}
+
+func (q *TrackQuery) After(t time.Time) *TrackQuery {
+	q.after = t
+	return q
+}
+
+func (q *TrackQuery) Before(t time.Time) *TrackQuery {
+	q.before = t
+	return q
+}
+
+// BBox limits points to the box, coordinates are in the GeoJSON order: min lon, min lat, max lon, max lat.
+func (q *TrackQuery) BBox(minLon, minLat, maxLon, maxLat float64) *TrackQuery {
+	q.bbox = []float64{minLon, minLat, maxLon, maxLat}
+	return q
+}
+
+func (q *TrackQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.uid != "" {
+		tx = tx.Where("uid = ?", q.uid)
+	}
+
+	if len(q.scope) > 0 && !q.scope.Has("*") {
+		tx = tx.Where("scope in (?)", q.scope.List())
+	}
+
+	if !q.after.IsZero() {
+		tx = tx.Where("time >= ?", q.after)
+	}
+
+	if !q.before.IsZero() {
+		tx = tx.Where("time < ?", q.before)
+	}
+
+	if len(q.bbox) == 4 {
+		tx = tx.Where("lon >= ? AND lat >= ? AND lon <= ? AND lat <= ?", q.bbox[0], q.bbox[1], q.bbox[2], q.bbox[3])
+	}
+
+	return tx
+}
+
+func (q *TrackQuery) Get() []*model.TrackPoint {
+	return q.get(q.where().Model(&model.TrackPoint{}))
+}
+
+func (q *TrackQuery) Count() int64 {
+	return q.count(q.where().Model(&model.TrackPoint{}))
+}
+
+// Delete returns number of deleted points.
+func (q *TrackQuery) Delete() (int64, error) {
+	res := q.where().Delete(&model.TrackPoint{})
+
+	return res.RowsAffected, res.Error
+}
@@ -35,5 +35,12 @@ func GetDatabase(dsn string, debug bool) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	// every new connection to in-memory sqlite gets its own empty database
+	if dsn == ":memory:" {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.SetMaxOpenConns(1)
+		}
+	}
+
 	return db, nil
 }
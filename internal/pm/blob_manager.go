@@ -7,10 +7,7 @@ import (
 	"io"
 	"log/slog"
 	"os"
-	"path/filepath"
 	"sync"
-
-	"github.com/kdudkov/goatak/pkg/util"
 )
 
 var (
@@ -19,44 +16,42 @@ var (
 	ErrBadHash  = errors.New("bad hash")
 )
 
+// BlobManager stores files in BlobStore by their sha256 hash, so the same file is stored once in the scope.
 type BlobManager struct {
-	logger  *slog.Logger
-	mx      sync.RWMutex
-	basedir string
+	logger *slog.Logger
+	mx     sync.RWMutex
+	store  BlobStore
 }
 
-func NewBlobManages(basedir string) *BlobManager {
-	_ = os.MkdirAll(basedir, 0777)
-
+func NewBlobManager(store BlobStore) *BlobManager {
 	return &BlobManager{
-		logger:  slog.With("logger", "file_manager"),
-		mx:      sync.RWMutex{},
-		basedir: basedir,
+		logger: slog.With("logger", "file_manager"),
+		mx:     sync.RWMutex{},
+		store:  store,
 	}
 }
 
-func (m *BlobManager) fileName(scope, hash string) string {
-	if scope == "" {
-		return filepath.Join(m.basedir, hash)
-	}
-
-	_ = os.MkdirAll(filepath.Join(m.basedir, scope), 0777)
+// NewBlobManages returns manager with filesystem store.
+func NewBlobManages(basedir string) *BlobManager {
+	return NewBlobManager(NewFsStore(basedir))
+}
 
-	return filepath.Join(m.basedir, scope, hash)
+func (m *BlobManager) Store() BlobStore {
+	return m.store
 }
 
-func (m *BlobManager) GetFile(hash string, scope string) (io.ReadSeekCloser, error) {
+func (m *BlobManager) GetFile(hash string, scope string) (io.ReadCloser, error) {
 	m.mx.RLock()
 	defer m.mx.RUnlock()
 
-	if hash == "" || !util.FileExists(m.fileName(scope, hash)) {
+	if hash == "" {
 		return nil, ErrNotFound
 	}
 
-	return os.Open(m.fileName(scope, hash))
+	return m.store.Get(scope, hash)
 }
 
-func (m *BlobManager) GetFileStat(scope, hash string) (os.FileInfo, error) {
+func (m *BlobManager) GetFileStat(scope, hash string) (*Blob, error) {
 	m.mx.RLock()
 	defer m.mx.RUnlock()
 
@@ -64,34 +59,35 @@ func (m *BlobManager) GetFileStat(scope, hash string) (os.FileInfo, error) {
 		return nil, ErrNoHash
 	}
 
-	return os.Stat(m.fileName(scope, hash))
+	return m.store.Stat(scope, hash)
 }
 
+// PutFile stores the content and returns its hash. If hash is given, content must have it.
 func (m *BlobManager) PutFile(scope, hash string, r io.Reader) (string, int64, error) {
 	if r == nil {
 		return "", 0, errors.New("no reader")
 	}
 
-	m.mx.Lock()
-	defer m.mx.Unlock()
-
-	if hash != "" && util.FileExists(m.fileName(scope, hash)) {
-		return hash, 0, nil
+	if hash != "" {
+		if _, err := m.GetFileStat(scope, hash); err == nil {
+			return hash, 0, nil
+		}
 	}
 
 	f, err := os.CreateTemp("", "")
-
 	if err != nil {
 		return "", 0, err
 	}
 
-	h := sha256.New()
-
-	rr := io.TeeReader(r, h)
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
 
-	var n int64
+	h := sha256.New()
 
-	if n, err = io.Copy(f, rr); err != nil {
+	n, err := io.Copy(f, io.TeeReader(r, h))
+	if err != nil {
 		return "", 0, err
 	}
 
@@ -101,11 +97,35 @@ func (m *BlobManager) PutFile(scope, hash string, r io.Reader) (string, int64, e
 		return "", 0, ErrBadHash
 	}
 
-	if err1 := f.Close(); err1 != nil {
-		return "", 0, err1
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if _, err := m.store.Stat(scope, hash1); err == nil {
+		return hash1, n, nil
 	}
 
-	err = os.Rename(f.Name(), m.fileName(scope, hash1))
+	return hash1, n, m.store.Put(scope, hash1, f, n)
+}
+
+func (m *BlobManager) Delete(scope, hash string) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if hash == "" {
+		return ErrNoHash
+	}
+
+	return m.store.Delete(scope, hash)
+}
+
+// List returns all stored blobs.
+func (m *BlobManager) List() ([]*Blob, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
 
-	return hash1, n, err
+	return m.store.List()
 }
@@ -0,0 +1,24 @@
+package pm
+
+import (
+	"io"
+	"time"
+)
+
+// Blob is the stored file, its name is sha256 hash of the content.
+type Blob struct {
+	Scope   string
+	Hash    string
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore keeps blobs by scope and hash. Get and Stat of missing blob return ErrNotFound.
+type BlobStore interface {
+	Get(scope, hash string) (io.ReadCloser, error)
+	Stat(scope, hash string) (*Blob, error)
+	// Put stores the content, hash is already checked by the caller.
+	Put(scope, hash string, r io.Reader, size int64) error
+	Delete(scope, hash string) error
+	List() ([]*Blob, error)
+}
@@ -0,0 +1,131 @@
+package pm
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FsStore keeps blobs in local directory, blobs of the scope are in subdirectory with scope name.
+type FsStore struct {
+	basedir string
+}
+
+func NewFsStore(basedir string) *FsStore {
+	_ = os.MkdirAll(basedir, 0777)
+
+	return &FsStore{basedir: basedir}
+}
+
+func (s *FsStore) fileName(scope, hash string) string {
+	return filepath.Join(s.basedir, scope, hash)
+}
+
+func (s *FsStore) Get(scope, hash string) (io.ReadCloser, error) {
+	f, err := os.Open(s.fileName(scope, hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return f, err
+}
+
+func (s *FsStore) Stat(scope, hash string) (*Blob, error) {
+	fi, err := os.Stat(s.fileName(scope, hash))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	return &Blob{Scope: scope, Hash: hash, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// Put writes the blob to temporary file first, so there are no partial blobs.
+func (s *FsStore) Put(scope, hash string, r io.Reader, _ int64) error {
+	dir := filepath.Join(s.basedir, scope)
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.fileName(scope, hash))
+}
+
+func (s *FsStore) Delete(scope, hash string) error {
+	if err := os.Remove(s.fileName(scope, hash)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *FsStore) List() ([]*Blob, error) {
+	entries, err := os.ReadDir(s.basedir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Blob, 0)
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			if b := blobInfo("", e); b != nil {
+				res = append(res, b)
+			}
+
+			continue
+		}
+
+		files, err := os.ReadDir(filepath.Join(s.basedir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			if b := blobInfo(e.Name(), f); b != nil {
+				res = append(res, b)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func blobInfo(scope string, e os.DirEntry) *Blob {
+	if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+		return nil
+	}
+
+	fi, err := e.Info()
+	if err != nil {
+		return nil
+	}
+
+	return &Blob{Scope: scope, Hash: e.Name(), Size: fi.Size(), ModTime: fi.ModTime()}
+}
@@ -0,0 +1,133 @@
+package pm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+type MigrateOpts struct {
+	// DryRun only lists blobs to copy
+	DryRun bool
+	// Delete removes blob from the source after verified copy
+	Delete bool
+}
+
+type MigrateResult struct {
+	Copied  int
+	Skipped int
+	Bytes   int64
+	Errors  []string
+}
+
+// Migrate copies all blobs from src to dst. Content is checked against the hash when it is read from src
+// and again after it is written to dst. Blobs that are already in dst with the same size are skipped.
+func Migrate(src, dst BlobStore, opts MigrateOpts) (*MigrateResult, error) {
+	blobs, err := src.List()
+	if err != nil {
+		return nil, err
+	}
+
+	res := new(MigrateResult)
+
+	for _, b := range blobs {
+		if b2, err := dst.Stat(b.Scope, b.Hash); err == nil && b2.Size == b.Size {
+			res.Skipped++
+
+			continue
+		}
+
+		if opts.DryRun {
+			res.Copied++
+			res.Bytes += b.Size
+
+			continue
+		}
+
+		if err := copyBlob(src, dst, b); err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("%s/%s: %s", b.Scope, b.Hash, err.Error()))
+
+			continue
+		}
+
+		res.Copied++
+		res.Bytes += b.Size
+
+		if opts.Delete {
+			if err := src.Delete(b.Scope, b.Hash); err != nil {
+				res.Errors = append(res.Errors, fmt.Sprintf("%s/%s: can't delete: %s", b.Scope, b.Hash, err.Error()))
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func copyBlob(src, dst BlobStore, b *Blob) error {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	r, err := src.Get(b.Scope, b.Hash)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(f, io.TeeReader(r, h))
+	r.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != b.Hash {
+		return fmt.Errorf("source %w", ErrBadHash)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := dst.Put(b.Scope, b.Hash, f, n); err != nil {
+		return err
+	}
+
+	if err := VerifyBlob(dst, b.Scope, b.Hash); err != nil {
+		_ = dst.Delete(b.Scope, b.Hash)
+
+		return fmt.Errorf("copy: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyBlob reads the blob and checks its sha256 hash.
+func VerifyBlob(s BlobStore, scope, hash string) error {
+	r, err := s.Get(scope, hash)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return ErrBadHash
+	}
+
+	return nil
+}
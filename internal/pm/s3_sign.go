@@ -0,0 +1,131 @@
+package pm
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	amzDateFormat   = "20060102T150405Z"
+	emptyHash       = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	headerAmzDate   = "X-Amz-Date"
+	headerAmzSha256 = "X-Amz-Content-Sha256"
+)
+
+// signV4 adds AWS Signature Version 4 authorization header to the request. Host and all x-amz-* headers are signed.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region, service string, t time.Time) {
+	amzDate := t.UTC().Format(amzDateFormat)
+	scope := strings.Join([]string{amzDate[:8], region, service, "aws4_request"}, "/")
+
+	req.Header.Set(headerAmzDate, amzDate)
+
+	headers, signed := canonicalHeaders(req)
+
+	canonical := strings.Join([]string{
+		req.Method,
+		canonicalURI(req),
+		canonicalQuery(req),
+		headers,
+		signed,
+		payloadHash,
+	}, "\n")
+
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+secretKey), amzDate[:8])
+	for _, s := range []string{region, service, "aws4_request"} {
+		key = hmacSha256(key, s)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signed, hex.EncodeToString(hmacSha256(key, toSign))))
+}
+
+func canonicalURI(req *http.Request) string {
+	if p := req.URL.EscapedPath(); p != "" {
+		return p
+	}
+
+	return "/"
+}
+
+func canonicalQuery(req *http.Request) string {
+	q := req.URL.Query()
+	res := make([]string, 0, len(q))
+
+	for k, vals := range q {
+		for _, v := range vals {
+			res = append(res, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+
+	sort.Strings(res)
+
+	return strings.Join(res, "&")
+}
+
+func canonicalHeaders(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	values := map[string]string{"host": host}
+
+	for k, v := range req.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-amz-") {
+			values[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	var b strings.Builder
+
+	for _, k := range names {
+		b.WriteString(k + ":" + values[k] + "\n")
+	}
+
+	return b.String(), strings.Join(names, ";")
+}
+
+// awsEscape encodes everything except unreserved characters, as AWS requires.
+func awsEscape(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,252 @@
+package pm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type S3Config struct {
+	// Endpoint is the url of S3 server, like https://s3.eu-central-1.amazonaws.com or http://minio:9000
+	Endpoint  string `koanf:"endpoint"`
+	Region    string `koanf:"region"`
+	Bucket    string `koanf:"bucket"`
+	AccessKey string `koanf:"access_key"`
+	SecretKey string `koanf:"secret_key"`
+	// Prefix is added to the object keys, so the bucket can be shared
+	Prefix string `koanf:"prefix"`
+	// PathStyle uses endpoint/bucket/key urls instead of bucket.endpoint/key, MinIO needs it
+	PathStyle bool `koanf:"path_style"`
+}
+
+// S3Store keeps blobs in S3 compatible storage as objects with prefix/scope/hash keys.
+type S3Store struct {
+	conf   S3Config
+	base   *url.URL
+	client *http.Client
+}
+
+func NewS3Store(conf S3Config) (*S3Store, error) {
+	if conf.Endpoint == "" || conf.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+
+	u, err := url.Parse(conf.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+
+	if conf.Region == "" {
+		conf.Region = "us-east-1"
+	}
+
+	if !conf.PathStyle {
+		u.Host = conf.Bucket + "." + u.Host
+	}
+
+	return &S3Store{conf: conf, base: u, client: &http.Client{}}, nil
+}
+
+func (s *S3Store) key(scope, hash string) string {
+	if scope == "" {
+		return s.conf.Prefix + hash
+	}
+
+	return s.conf.Prefix + scope + "/" + hash
+}
+
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.base
+	p := strings.TrimSuffix(u.Path, "/")
+
+	if s.conf.PathStyle {
+		p += "/" + s.conf.Bucket
+	}
+
+	segments := strings.Split(key, "/")
+	escaped := make([]string, len(segments))
+
+	for i, seg := range segments {
+		escaped[i] = awsEscape(seg)
+	}
+
+	u.Path = p + "/" + key
+	u.RawPath = p + "/" + strings.Join(escaped, "/")
+
+	return &u
+}
+
+func (s *S3Store) do(method string, u *url.URL, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	// zero length with body is sent chunked, s3 does not accept it
+	if body != nil && size == 0 {
+		body = http.NoBody
+	}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.ContentLength = size
+
+	req.Header.Set(headerAmzSha256, payloadHash)
+	signV4(req, payloadHash, s.conf.AccessKey, s.conf.SecretKey, s.conf.Region, "s3", time.Now())
+
+	return s.client.Do(req)
+}
+
+func (s *S3Store) object(method, scope, hash string) (*http.Response, error) {
+	resp, err := s.do(method, s.objectURL(s.key(scope, hash)), nil, 0, emptyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode >= 300 {
+		return nil, s3Error(resp)
+	}
+
+	return resp, nil
+}
+
+func (s *S3Store) Get(scope, hash string) (io.ReadCloser, error) {
+	resp, err := s.object(http.MethodGet, scope, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (s *S3Store) Stat(scope, hash string) (*Blob, error) {
+	resp, err := s.object(http.MethodHead, scope, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body.Close()
+
+	b := &Blob{Scope: scope, Hash: hash, Size: resp.ContentLength}
+	b.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	return b, nil
+}
+
+// Put sends the hash as payload checksum, so the server checks the content too.
+func (s *S3Store) Put(scope, hash string, r io.Reader, size int64) error {
+	resp, err := s.do(http.MethodPut, s.objectURL(s.key(scope, hash)), r, size, hash)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return s3Error(resp)
+	}
+
+	return nil
+}
+
+func (s *S3Store) Delete(scope, hash string) error {
+	resp, err := s.object(http.MethodDelete, scope, hash)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	return nil
+}
+
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Store) List() ([]*Blob, error) {
+	res := make([]*Blob, 0)
+	token := ""
+
+	for {
+		u := s.objectURL("")
+		q := url.Values{"list-type": {"2"}}
+
+		if s.conf.Prefix != "" {
+			q.Set("prefix", s.conf.Prefix)
+		}
+
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		u.RawQuery = strings.ReplaceAll(q.Encode(), "+", "%20")
+
+		resp, err := s.do(http.MethodGet, u, nil, 0, emptyHash)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode >= 300 {
+			return nil, s3Error(resp)
+		}
+
+		var l listResult
+
+		err = xml.NewDecoder(resp.Body).Decode(&l)
+		resp.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, o := range l.Contents {
+			scope, hash, found := strings.Cut(strings.TrimPrefix(o.Key, s.conf.Prefix), "/")
+			if !found {
+				scope, hash = "", scope
+			}
+
+			res = append(res, &Blob{Scope: scope, Hash: hash, Size: o.Size, ModTime: o.LastModified})
+		}
+
+		if !l.IsTruncated || l.NextContinuationToken == "" {
+			return res, nil
+		}
+
+		token = l.NextContinuationToken
+	}
+}
+
+func s3Error(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	if xml.NewDecoder(bytes.NewReader(body)).Decode(&e) == nil && e.Code != "" {
+		return fmt.Errorf("s3 error %d %s: %s", resp.StatusCode, e.Code, e.Message)
+	}
+
+	return errors.New("s3 error " + strconv.Itoa(resp.StatusCode))
+}
@@ -0,0 +1,290 @@
+package pm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccessKey = "minio"
+	testSecretKey = "minio123"
+)
+
+// fakeS3 is a MinIO-like stand-in with path style urls. It checks signatures and payload hashes.
+type fakeS3 struct {
+	mx      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+	pageLen int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{bucket: "goatak", objects: make(map[string][]byte), pageLen: 2}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	return f, srv
+}
+
+func (f *fakeS3) checkSignature(r *http.Request) bool {
+	tm, err := time.Parse(amzDateFormat, r.Header.Get(headerAmzDate))
+	if err != nil {
+		return false
+	}
+
+	req, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	req.Host = r.Host
+
+	for k, v := range r.Header {
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-") {
+			req.Header[k] = v
+		}
+	}
+
+	signV4(req, r.Header.Get(headerAmzSha256), testAccessKey, testSecretKey, "us-east-1", "s3", tm)
+
+	return req.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if !f.checkSignature(r) {
+		s3Fail(w, http.StatusForbidden, "SignatureDoesNotMatch")
+
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		s3Fail(w, http.StatusNotFound, "NoSuchBucket")
+
+		return
+	}
+
+	if key == "" && r.Method == http.MethodGet {
+		f.list(w, r)
+
+		return
+	}
+
+	data, ok := f.objects[key]
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		h := sha256.Sum256(body)
+
+		if hex.EncodeToString(h[:]) != r.Header.Get(headerAmzSha256) {
+			s3Fail(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+
+			return
+		}
+
+		f.objects[key] = body
+	case http.MethodGet, http.MethodHead:
+		if !ok {
+			s3Fail(w, http.StatusNotFound, "NoSuchKey")
+
+			return
+		}
+
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	keys := make([]string, 0)
+
+	for k := range f.objects {
+		if strings.HasPrefix(k, r.URL.Query().Get("prefix")) && k > r.URL.Query().Get("continuation-token") {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	type object struct {
+		Key          string
+		Size         int
+		LastModified time.Time
+	}
+
+	res := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []object
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{}
+
+	if len(keys) > f.pageLen {
+		keys = keys[:f.pageLen]
+		res.IsTruncated = true
+		res.NextContinuationToken = keys[len(keys)-1]
+	}
+
+	for _, k := range keys {
+		res.Contents = append(res.Contents, object{Key: k, Size: len(f.objects[k]), LastModified: time.Now()})
+	}
+
+	_ = xml.NewEncoder(w).Encode(res)
+}
+
+func s3Fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func putBlob(t *testing.T, m *BlobManager, scope, data string) string {
+	t.Helper()
+
+	hash, n, err := m.PutFile(scope, "", strings.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+
+	return hash
+}
+
+func testStore(t *testing.T, store BlobStore) {
+	m := NewBlobManager(store)
+
+	h1 := putBlob(t, m, "", "root blob")
+	h2 := putBlob(t, m, "scope 1", "scoped blob")
+	h3 := putBlob(t, m, "scope 1", "")
+	putBlob(t, m, "scope2", "other")
+
+	// same content again
+	assert.Equal(t, h2, putBlob(t, m, "scope 1", "scoped blob"))
+
+	_, _, err := m.PutFile("scope 1", h1, strings.NewReader("bad"))
+	require.ErrorIs(t, err, ErrBadHash)
+
+	r, err := m.GetFile(h2, "scope 1")
+	require.NoError(t, err)
+
+	data, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "scoped blob", string(data))
+
+	b, err := m.GetFileStat("", h1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), b.Size)
+
+	_, err = m.GetFile(h1, "scope 1")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = m.GetFileStat("scope2", h2)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	blobs, err := m.List()
+	require.NoError(t, err)
+	require.Len(t, blobs, 4)
+
+	names := make([]string, 0)
+	for _, b := range blobs {
+		names = append(names, b.Scope+"/"+b.Hash)
+	}
+
+	assert.Contains(t, names, "/"+h1)
+	assert.Contains(t, names, "scope 1/"+h3)
+
+	require.NoError(t, m.Delete("scope 1", h2))
+
+	_, err = m.GetFileStat("scope 1", h2)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFsStore(t *testing.T) {
+	testStore(t, NewFsStore(t.TempDir()))
+}
+
+func TestS3Store(t *testing.T) {
+	_, srv := newFakeS3(t)
+
+	s, err := NewS3Store(S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "goatak",
+		AccessKey: testAccessKey,
+		SecretKey: testSecretKey,
+		Prefix:    "blob/",
+		PathStyle: true,
+	})
+	require.NoError(t, err)
+
+	testStore(t, s)
+
+	bad, err := NewS3Store(S3Config{Endpoint: srv.URL, Bucket: "goatak", AccessKey: testAccessKey, SecretKey: "bad", PathStyle: true})
+	require.NoError(t, err)
+
+	_, err = bad.List()
+	require.ErrorContains(t, err, "SignatureDoesNotMatch")
+
+	// payload hash is checked by the server
+	require.ErrorContains(t, s.Put("", strings.Repeat("0", 64), strings.NewReader("data"), 4), "XAmzContentSHA256Mismatch")
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	src := NewFsStore(dir)
+	m := NewBlobManager(src)
+
+	h1 := putBlob(t, m, "", "blob 1")
+	putBlob(t, m, "s1", "blob 2")
+	h3 := putBlob(t, m, "s1", "blob 3")
+
+	// corrupted blob
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "s1", h3), []byte("changed"), 0o644))
+
+	fake, srv := newFakeS3(t)
+
+	dst, err := NewS3Store(S3Config{Endpoint: srv.URL, Bucket: "goatak", AccessKey: testAccessKey, SecretKey: testSecretKey, PathStyle: true})
+	require.NoError(t, err)
+
+	res, err := Migrate(src, dst, MigrateOpts{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Copied)
+	assert.Empty(t, fake.objects)
+
+	res, err = Migrate(src, dst, MigrateOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Copied)
+	assert.Equal(t, int64(12), res.Bytes)
+	require.Len(t, res.Errors, 1)
+	assert.Contains(t, res.Errors[0], h3)
+	assert.Len(t, fake.objects, 2)
+
+	require.NoError(t, VerifyBlob(dst, "", h1))
+
+	res, err = Migrate(src, dst, MigrateOpts{Delete: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Skipped)
+	assert.Equal(t, 0, res.Copied)
+
+	// skipped blobs are not deleted
+	_, err = src.Stat("", h1)
+	require.NoError(t, err)
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+var (
+	ErrUnknownUser = errors.New("unknown user")
+	ErrBadPassword = errors.New("bad password")
+)
+
+// Authenticator is an authentication backend. It returns ErrUnknownUser for users it does not know, so the next
+// backend is tried, and ErrBadPassword to stop the chain.
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (*model.Device, error)
+}
+
+const localAuthName = "local"
+
+// localAuth checks bcrypt passwords of devices. Devices provisioned by other backends have no local password.
+type localAuth struct {
+	u *UserDbRepository
+}
+
+func (a localAuth) Name() string {
+	return localAuthName
+}
+
+func (a localAuth) Authenticate(username, password string) (*model.Device, error) {
+	d := a.u.cache.Load(username)
+
+	if d == nil || d.AuthSource != "" {
+		return nil, ErrUnknownUser
+	}
+
+	if !d.CheckPassword(password) {
+		return nil, ErrBadPassword
+	}
+
+	return d, nil
+}
@@ -13,6 +13,7 @@ type AuthRepository interface {
 	Start() error
 	Stop()
 	CheckAuth(username, password string) bool
+	Authenticate(username, password string) *internal.Device
 	IsValid(username, sn string) bool
 	Get(username string) *internal.Device
 }
@@ -21,10 +22,12 @@ type DeviceRepository interface {
 	Start() error
 	Stop()
 	CheckAuth(username, password string) bool
+	Authenticate(username, password string) *internal.Device
 	IsValid(username, sn string) bool
 	Get(username string) *internal.Device
 	SaveSignInfo(username, uid, sn string, till time.Time)
 	SaveConnectInfo(username, uid, sn string)
+	RevokeCert(sn, reason string) error
 }
 
 type ItemsRepository interface {
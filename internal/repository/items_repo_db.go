@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const itemsFlushInterval = time.Second * 5
+
+// ItemsDbRepo keeps items in memory and writes changed items and new track points to the database
+// in background. Items are loaded back on start.
+type ItemsDbRepo struct {
+	*ItemsMemoryRepo
+	dbm    *database.DatabaseManager
+	logger *slog.Logger
+
+	dirty     sync.Map
+	mx        sync.Mutex
+	lastSaved map[string]time.Time
+	noTrack   bool
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewItemsDbRepo(dbm *database.DatabaseManager, tm ...time.Duration) *ItemsDbRepo {
+	return &ItemsDbRepo{
+		ItemsMemoryRepo: NewItemsMemoryRepo(tm...),
+		dbm:             dbm,
+		logger:          slog.With("logger", "items_db"),
+		dirty:           sync.Map{},
+		lastSaved:       make(map[string]time.Time),
+		stop:            make(chan struct{}),
+	}
+}
+
+// WithoutTrack disables saving of track points, so they can be written by track history.
+func (r *ItemsDbRepo) WithoutTrack() *ItemsDbRepo {
+	r.noTrack = true
+
+	return r
+}
+
+func (r *ItemsDbRepo) Start() error {
+	r.load()
+
+	r.changeCb.SubscribeNamed("db", func(item *model.Item) bool {
+		r.dirty.Store(item.GetUID(), struct{}{})
+		return true
+	})
+
+	r.deleteCb.SubscribeNamed("db", func(uid string) bool {
+		r.dirty.Store(uid, struct{}{})
+		return true
+	})
+
+	r.wg.Add(1)
+
+	go r.flusher()
+
+	return r.ItemsMemoryRepo.Start()
+}
+
+func (r *ItemsDbRepo) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+func (r *ItemsDbRepo) load() {
+	var n int
+
+	for _, s := range r.dbm.ItemQuery().Limit(0).Get() {
+		track := r.dbm.TrackQuery().UID(s.UID).Get()
+		slices.Reverse(track)
+
+		item, err := model.ItemFromStored(s, track)
+		if err != nil {
+			r.logger.Warn("invalid stored item "+s.UID, slog.Any("error", err))
+			r.delete(s.UID)
+
+			continue
+		}
+
+		if item.IsOld() {
+			r.delete(s.UID)
+
+			continue
+		}
+
+		if len(track) > 0 {
+			r.lastSaved[s.UID] = track[len(track)-1].Time
+		}
+
+		r.items.Store(item.GetUID(), item)
+		n++
+	}
+
+	r.logger.Info("items loaded", slog.Int("count", n))
+}
+
+func (r *ItemsDbRepo) flusher() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(itemsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.flush()
+		case <-r.stop:
+			r.flush()
+			return
+		}
+	}
+}
+
+func (r *ItemsDbRepo) flush() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	r.dirty.Range(func(key, _ any) bool {
+		uid := key.(string)
+		r.dirty.Delete(uid)
+
+		if item := r.Get(uid); item != nil {
+			r.save(item)
+		} else {
+			r.delete(uid)
+		}
+
+		return true
+	})
+}
+
+func (r *ItemsDbRepo) save(item *model.Item) {
+	s, err := item.ToStored()
+	if err != nil {
+		r.logger.Error("item marshal error", slog.Any("error", err))
+		return
+	}
+
+	if err := r.dbm.ForceSave(s); err != nil || r.noTrack {
+		return
+	}
+
+	last := r.lastSaved[item.GetUID()]
+	points := make([]*model.TrackPoint, 0)
+
+	for _, p := range item.GetTrack() {
+		if p.Time.After(last) {
+			points = append(points, model.NewTrackPoint(item, p))
+		}
+	}
+
+	if len(points) == 0 {
+		return
+	}
+
+	if err := r.dbm.Create(&points); err == nil {
+		r.lastSaved[item.GetUID()] = points[len(points)-1].Time
+	}
+}
+
+func (r *ItemsDbRepo) delete(uid string) {
+	delete(r.lastSaved, uid)
+
+	if err := r.dbm.ItemQuery().UID(uid).Delete(); err != nil {
+		r.logger.Error("item delete error", slog.Any("error", err))
+	}
+
+	// points written by track history are kept until its ttl
+	if r.noTrack {
+		return
+	}
+
+	if _, err := r.dbm.TrackQuery().UID(uid).Delete(); err != nil {
+		r.logger.Error("item track delete error", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func newMsg(uid string, lat, lon float64, stale time.Duration) *cot.CotMessage {
+	tak := cot.BasicMsg("a-f-G", uid, stale)
+	tak.CotEvent.Lat = lat
+	tak.CotEvent.Lon = lon
+	tak.CotEvent.Detail = &cotproto.Detail{Contact: &cotproto.Contact{Callsign: "cs_" + uid, Endpoint: "*:-1:stcp"}}
+
+	msg, _ := cot.CotFromProto(tak, "", "scope1")
+
+	return msg
+}
+
+func TestItemsDbRepo(t *testing.T) {
+	db, err := database.GetDatabase(":memory:", false)
+	require.NoError(t, err)
+
+	dbm := database.New(db)
+	require.NoError(t, dbm.Migrate())
+
+	r := NewItemsDbRepo(dbm)
+	require.NoError(t, r.Start())
+
+	item := model.FromMsg(newMsg("uid1", 10, 20, time.Hour))
+	r.Store(item)
+
+	msg := newMsg("uid1", 11, 21, time.Hour)
+	msg.GetTakMessage().GetCotEvent().SendTime += 1000
+	item.Update(msg)
+	r.Store(item)
+
+	// stale unit should not be restored
+	unit := newMsg("uid2", 10, 20, -time.Minute)
+	unit.GetTakMessage().GetCotEvent().GetDetail().GetContact().Endpoint = ""
+	r.Store(model.FromMsg(unit))
+
+	time.Sleep(time.Millisecond * 100)
+	r.Stop()
+
+	r2 := NewItemsDbRepo(dbm)
+	require.NoError(t, r2.Start())
+	defer r2.Stop()
+
+	i := r2.Get("uid1")
+	require.NotNil(t, i)
+	assert.Equal(t, "cs_uid1", i.GetCallsign())
+	assert.Equal(t, "scope1", i.GetScope())
+	assert.False(t, i.IsOnline())
+	require.Len(t, i.GetTrack(), 2)
+	assert.Equal(t, 11., i.GetTrack()[1].Lat)
+
+	assert.Nil(t, r2.Get("uid2"))
+	assert.Equal(t, int64(1), dbm.ItemQuery().Count())
+}
+
+func TestItemsDbRepoDelete(t *testing.T) {
+	db, err := database.GetDatabase(":memory:", false)
+	require.NoError(t, err)
+
+	dbm := database.New(db)
+	require.NoError(t, dbm.Migrate())
+
+	r := NewItemsDbRepo(dbm)
+	require.NoError(t, r.Start())
+	defer r.Stop()
+
+	r.Store(model.FromMsg(newMsg("uid1", 10, 20, time.Hour)))
+	r.Store(model.FromMsg(newMsg("uid2", 10, 20, time.Hour)))
+	time.Sleep(time.Millisecond * 100)
+	r.flush()
+
+	require.Equal(t, int64(1), dbm.TrackQuery().UID("uid1").Count())
+
+	r.Remove("uid1")
+	time.Sleep(time.Millisecond * 100)
+	r.flush()
+
+	assert.Equal(t, int64(0), dbm.ItemQuery().UID("uid1").Count())
+	assert.Equal(t, int64(0), dbm.TrackQuery().UID("uid1").Count())
+	assert.Equal(t, int64(1), dbm.TrackQuery().UID("uid2").Count())
+}
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const ldapAuthName = "ldap"
+
+var ErrNoGroup = errors.New("user is not in any mapped group")
+
+// LDAPGroup maps members of LDAP group to device scope and flags.
+type LDAPGroup struct {
+	Group      string   `koanf:"group"`
+	Scope      string   `koanf:"scope"`
+	ReadScope  []string `koanf:"read_scope"`
+	Admin      bool     `koanf:"admin"`
+	SuperAdmin bool     `koanf:"super_admin"`
+	// Role is admin role of the group members, the first mapped group with role set wins
+	Role string `koanf:"role"`
+}
+
+type LDAPConfig struct {
+	// URL is ldap://host:389 or ldaps://host:636
+	URL                string        `koanf:"url"`
+	StartTLS           bool          `koanf:"start_tls"`
+	InsecureSkipVerify bool          `koanf:"insecure_skip_verify"`
+	CAFile             string        `koanf:"ca_file"`
+	Timeout            time.Duration `koanf:"timeout"`
+	// BindDN and BindPassword are used to find the user and groups, anonymous bind is used if it is empty
+	BindDN       string `koanf:"bind_dn"`
+	BindPassword string `koanf:"bind_password"`
+	BaseDN       string `koanf:"base_dn"`
+	// UserFilter finds the user, {login} is replaced with the login
+	UserFilter string `koanf:"user_filter"`
+	// GroupAttribute of user entry has DNs of user groups, like memberOf in Active Directory
+	GroupAttribute string `koanf:"group_attribute"`
+	// GroupFilter is used to search groups instead of GroupAttribute, {dn} is replaced with the user DN
+	// and {login} with the login
+	GroupFilter string `koanf:"group_filter"`
+	GroupBaseDN string `koanf:"group_base_dn"`
+	// Groups are checked in order, the first one with scope sets the device scope, scopes of others are added
+	// to read scopes. Users without mapped groups get DefaultScope or are refused if it is empty.
+	Groups       []LDAPGroup `koanf:"groups"`
+	DefaultScope string      `koanf:"default_scope"`
+}
+
+// LDAPAuth authenticates users by bind to LDAP or Active Directory server.
+type LDAPAuth struct {
+	conf LDAPConfig
+	tls  *tls.Config
+}
+
+func NewLDAPAuth(conf LDAPConfig) (*LDAPAuth, error) {
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.UserFilter == "" {
+		conf.UserFilter = "(uid={login})"
+	}
+
+	if conf.GroupAttribute == "" {
+		conf.GroupAttribute = "memberOf"
+	}
+
+	if conf.GroupBaseDN == "" {
+		conf.GroupBaseDN = conf.BaseDN
+	}
+
+	if conf.Timeout == 0 {
+		conf.Timeout = time.Second * 10
+	}
+
+	a := &LDAPAuth{
+		conf: conf,
+		//nolint:gosec
+		tls: &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: conf.InsecureSkipVerify},
+	}
+
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		a.tls.RootCAs = x509.NewCertPool()
+
+		if !a.tls.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", conf.CAFile)
+		}
+	}
+
+	return a, nil
+}
+
+func (a *LDAPAuth) Name() string {
+	return ldapAuthName
+}
+
+func (a *LDAPAuth) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(a.conf.URL, ldap.DialWithTLSConfig(a.tls),
+		ldap.DialWithDialer(&net.Dialer{Timeout: a.conf.Timeout}))
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetTimeout(a.conf.Timeout)
+
+	if a.conf.StartTLS {
+		if err := conn.StartTLS(a.tls); err != nil {
+			conn.Close()
+
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (a *LDAPAuth) search(conn *ldap.Conn, base, filter string, attrs []string) ([]*ldap.Entry, error) {
+	res, err := conn.Search(ldap.NewSearchRequest(base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, int(a.conf.Timeout.Seconds()), false, filter, attrs, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Entries, nil
+}
+
+// Authenticate finds the user entry and its groups with service account, then binds as the user.
+func (a *LDAPAuth) Authenticate(username, password string) (*model.Device, error) {
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if a.conf.BindDN != "" {
+		if err := conn.Bind(a.conf.BindDN, a.conf.BindPassword); err != nil {
+			return nil, fmt.Errorf("service bind: %w", err)
+		}
+	}
+
+	attrs := []string{"dn"}
+	if a.conf.GroupFilter == "" {
+		attrs = append(attrs, a.conf.GroupAttribute)
+	}
+
+	filter := strings.ReplaceAll(a.conf.UserFilter, "{login}", ldap.EscapeFilter(username))
+
+	users, err := a.search(conn, a.conf.BaseDN, filter, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) != 1 {
+		return nil, ErrUnknownUser
+	}
+
+	user := users[0]
+
+	var groups []string
+
+	if a.conf.GroupFilter == "" {
+		groups = user.GetAttributeValues(a.conf.GroupAttribute)
+	} else {
+		filter := strings.NewReplacer("{dn}", ldap.EscapeFilter(user.DN), "{login}", ldap.EscapeFilter(username)).
+			Replace(a.conf.GroupFilter)
+
+		entries, err := a.search(conn, a.conf.GroupBaseDN, filter, []string{"dn"})
+		if err != nil {
+			return nil, fmt.Errorf("group search: %w", err)
+		}
+
+		for _, e := range entries {
+			groups = append(groups, e.DN)
+		}
+	}
+
+	if err := conn.Bind(user.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrBadPassword
+		}
+
+		return nil, err
+	}
+
+	return a.device(username, groups)
+}
+
+func (a *LDAPAuth) device(login string, groups []string) (*model.Device, error) {
+	d := &model.Device{Login: login}
+	found := false
+
+	for _, g := range a.conf.Groups {
+		if !slices.ContainsFunc(groups, func(s string) bool { return strings.EqualFold(s, g.Group) }) {
+			continue
+		}
+
+		found = true
+		d.Admin = d.Admin || g.Admin
+		d.SuperAdmin = d.SuperAdmin || g.SuperAdmin
+
+		if d.Role == "" {
+			d.Role = g.Role
+		}
+
+		switch {
+		case g.Scope == "" || g.Scope == d.Scope:
+		case d.Scope == "":
+			d.Scope = g.Scope
+		default:
+			d.ReadScope = addScope(d.ReadScope, g.Scope)
+		}
+
+		for _, s := range g.ReadScope {
+			d.ReadScope = addScope(d.ReadScope, s)
+		}
+	}
+
+	if !found && a.conf.DefaultScope == "" {
+		return nil, ErrNoGroup
+	}
+
+	if d.Scope == "" {
+		d.Scope = a.conf.DefaultScope
+	}
+
+	return d, nil
+}
+
+func addScope(scopes []string, s string) []string {
+	if slices.Contains(scopes, s) {
+		return scopes
+	}
+
+	return append(scopes, s)
+}
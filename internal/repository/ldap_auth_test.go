@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"errors"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	svcDN   = "cn=svc,dc=test"
+	svcPass = "svc1"
+)
+
+type ldapEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// fakeLDAP is a stand-in LDAP server that knows simple bind and search with equality filters.
+// Search needs the service account bind.
+type fakeLDAP struct {
+	entries []*ldapEntry
+}
+
+var filterRe = regexp.MustCompile(`\(([\w-]+)=([^()]*)\)`)
+
+func newFakeLDAP(t *testing.T) string {
+	f := &fakeLDAP{entries: []*ldapEntry{
+		{dn: svcDN, password: svcPass},
+		{dn: "uid=alice,ou=users,dc=test", password: "alice1", attrs: map[string][]string{
+			"uid":      {"alice"},
+			"memberOf": {"cn=Blue,ou=groups,dc=test", "cn=admins,ou=groups,dc=test", "cn=other,ou=groups,dc=test"},
+		}},
+		{dn: "uid=bob,ou=users,dc=test", password: "bob1", attrs: map[string][]string{
+			"uid":      {"bob"},
+			"memberOf": {"cn=red,ou=groups,dc=test", "cn=blue,ou=groups,dc=test"},
+		}},
+		{dn: "uid=carol,ou=users,dc=test", password: "carol1", attrs: map[string][]string{"uid": {"carol"}}},
+		{dn: "cn=blue,ou=groups,dc=test", attrs: map[string][]string{"member": {"uid=alice,ou=users,dc=test"}}},
+		{dn: "cn=admins,ou=groups,dc=test", attrs: map[string][]string{"member": {"uid=alice,ou=users,dc=test"}}},
+	}}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go f.serve(conn)
+		}
+	}()
+
+	return "ldap://" + l.Addr().String()
+}
+
+func (f *fakeLDAP) serve(conn net.Conn) {
+	defer conn.Close()
+
+	var bound string
+
+	for {
+		p, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		id := p.Children[0].Value
+		op := p.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			pass := op.Children[2].Data.String()
+			code := ldap.LDAPResultInvalidCredentials
+
+			for _, e := range f.entries {
+				if strings.EqualFold(e.dn, dn) && e.password != "" && e.password == pass {
+					code = ldap.LDAPResultSuccess
+					bound = e.dn
+				}
+			}
+
+			f.send(conn, id, f.result(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			if bound != svcDN {
+				f.send(conn, id, f.result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+
+				continue
+			}
+
+			base := op.Children[0].Value.(string)
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+
+			for _, e := range f.entries {
+				if strings.HasSuffix(strings.ToLower(e.dn), strings.ToLower(base)) && e.match(filter) {
+					f.send(conn, id, e.packet())
+				}
+			}
+
+			f.send(conn, id, f.result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (e *ldapEntry) match(filter string) bool {
+	for _, m := range filterRe.FindAllStringSubmatch(filter, -1) {
+		if m[1] == "objectClass" {
+			continue
+		}
+
+		found := false
+
+		for _, v := range e.attrs[m[1]] {
+			found = found || strings.EqualFold(v, m[2])
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *ldapEntry) packet() *ber.Packet {
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+
+	attrs := ber.NewSequence("")
+
+	for name, values := range e.attrs {
+		a := ber.NewSequence("")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+
+		a.AppendChild(set)
+		attrs.AppendChild(a)
+	}
+
+	res.AppendChild(attrs)
+
+	return res
+}
+
+func (f *fakeLDAP) result(tag ber.Tag, code int) *ber.Packet {
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	res.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+
+	return res
+}
+
+func (f *fakeLDAP) send(w io.Writer, id any, op *ber.Packet) {
+	p := ber.NewSequence("")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	p.AppendChild(op)
+
+	_, _ = w.Write(p.Bytes())
+}
+
+func ldapConfig(url string) LDAPConfig {
+	return LDAPConfig{
+		URL:          url,
+		BindDN:       svcDN,
+		BindPassword: svcPass,
+		BaseDN:       "ou=users,dc=test",
+		UserFilter:   "(&(objectClass=person)(uid={login}))",
+		Groups: []LDAPGroup{
+			{Group: "cn=admins,ou=groups,dc=test", Admin: true},
+			{Group: "cn=blue,ou=groups,dc=test", Scope: "blue", ReadScope: []string{"white"}, Role: model.ROLE_OPERATOR},
+			{Group: "cn=red,ou=groups,dc=test", Scope: "red", Role: model.ROLE_VIEWER},
+		},
+	}
+}
+
+func TestLDAPAuth(t *testing.T) {
+	url := newFakeLDAP(t)
+
+	a, err := NewLDAPAuth(ldapConfig(url))
+	require.NoError(t, err)
+
+	d, err := a.Authenticate("alice", "alice1")
+	require.NoError(t, err)
+	assert.Equal(t, "blue", d.Scope)
+	assert.Equal(t, []string{"white"}, d.ReadScope)
+	assert.True(t, d.Admin)
+	assert.Equal(t, model.ROLE_OPERATOR, d.Role)
+
+	// the first group with scope sets the scope
+	d, err = a.Authenticate("bob", "bob1")
+	require.NoError(t, err)
+	assert.Equal(t, "blue", d.Scope)
+	assert.Equal(t, []string{"white", "red"}, d.ReadScope)
+	assert.False(t, d.Admin)
+	assert.Equal(t, model.ROLE_OPERATOR, d.Role)
+
+	_, err = a.Authenticate("alice", "bad")
+	require.ErrorIs(t, err, ErrBadPassword)
+
+	_, err = a.Authenticate("dave", "dave1")
+	require.ErrorIs(t, err, ErrUnknownUser)
+
+	_, err = a.Authenticate("carol", "carol1")
+	require.ErrorIs(t, err, ErrNoGroup)
+
+	_, err = a.Authenticate("*", "x")
+	require.ErrorIs(t, err, ErrUnknownUser)
+
+	// groups are searched instead of memberOf attribute
+	conf := ldapConfig(url)
+	conf.GroupFilter = "(member={dn})"
+	conf.GroupBaseDN = "ou=groups,dc=test"
+	conf.DefaultScope = "guests"
+
+	a, err = NewLDAPAuth(conf)
+	require.NoError(t, err)
+
+	d, err = a.Authenticate("alice", "alice1")
+	require.NoError(t, err)
+	assert.Equal(t, "blue", d.Scope)
+	assert.True(t, d.Admin)
+
+	d, err = a.Authenticate("bob", "bob1")
+	require.NoError(t, err)
+	assert.Equal(t, "guests", d.Scope)
+	assert.Empty(t, d.ReadScope)
+
+	conf.BindPassword = "bad"
+
+	a, err = NewLDAPAuth(conf)
+	require.NoError(t, err)
+
+	_, err = a.Authenticate("alice", "alice1")
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrUnknownUser))
+}
+
+func TestAuthChain(t *testing.T) {
+	db, err := database.GetDatabase(":memory:", false)
+	require.NoError(t, err)
+
+	dbm := database.New(db)
+	require.NoError(t, dbm.Migrate())
+
+	bob := &model.Device{Login: "bob", Scope: "local"}
+	require.NoError(t, bob.SetPassword("local"))
+	require.NoError(t, dbm.Create(bob))
+
+	a, err := NewLDAPAuth(ldapConfig(newFakeLDAP(t)))
+	require.NoError(t, err)
+
+	r := NewUserDbRepository("", dbm)
+	r.SetBackends(r.Local(), a)
+
+	// provisioned on first login
+	d := r.Authenticate("alice", "alice1")
+	require.NotNil(t, d)
+	assert.Equal(t, ldapAuthName, d.AuthSource)
+
+	d = dbm.DeviceQuery().Login("alice").One()
+	require.NotNil(t, d)
+	assert.Equal(t, "blue", d.Scope)
+	assert.True(t, d.Admin)
+	assert.True(t, r.IsValid("alice", ""))
+
+	// scope is updated from groups on login
+	require.NoError(t, dbm.DeviceQuery().Login("alice").Update(map[string]any{"scope": "other", "admin": false}))
+
+	d = r.Authenticate("alice", "alice1")
+	require.NotNil(t, d)
+	assert.Equal(t, "blue", d.Scope)
+	assert.True(t, r.Get("alice").Admin)
+
+	assert.Nil(t, r.Authenticate("alice", "bad"))
+	assert.Nil(t, r.Authenticate("alice", ""))
+
+	// provisioned device has no local password
+	r.SetBackends(r.Local())
+	assert.Nil(t, r.Authenticate("alice", "alice1"))
+	r.SetBackends(r.Local(), a)
+
+	// disabled locally
+	require.NoError(t, dbm.DeviceQuery().Login("alice").Update(map[string]any{"disabled": true}))
+	assert.Nil(t, r.Authenticate("alice", "alice1"))
+	assert.False(t, r.CheckAuth("alice", "alice1"))
+
+	// local device is checked by local password only
+	assert.Nil(t, r.Authenticate("bob", "bob1"))
+	require.NotNil(t, r.Authenticate("bob", "local"))
+	assert.Equal(t, "local", r.Authenticate("bob", "local").Scope)
+
+	// local device is not taken by ldap
+	r.SetBackends(a)
+	assert.Nil(t, r.Authenticate("bob", "bob1"))
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	trackQueueSize     = 1000
+	trackBatchSize     = 200
+	trackFlushInterval = time.Second
+)
+
+// TrackWriter saves track points to the database in background, in batches.
+type TrackWriter struct {
+	dbm    *database.DatabaseManager
+	logger *slog.Logger
+	ch     chan *model.TrackPoint
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewTrackWriter(dbm *database.DatabaseManager) *TrackWriter {
+	return &TrackWriter{
+		dbm:    dbm,
+		logger: slog.With("logger", "track_writer"),
+		ch:     make(chan *model.TrackPoint, trackQueueSize),
+		stop:   make(chan struct{}),
+	}
+}
+
+func (w *TrackWriter) Start() {
+	w.wg.Add(1)
+
+	go w.writer()
+}
+
+// Stop writes queued points and stops the writer.
+func (w *TrackWriter) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+// Add queues the point, returns false if queue is full and point is dropped.
+func (w *TrackWriter) Add(p *model.TrackPoint) bool {
+	select {
+	case w.ch <- p:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *TrackWriter) writer() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(trackFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*model.TrackPoint, 0, trackBatchSize)
+
+	for {
+		select {
+		case p := <-w.ch:
+			batch = append(batch, p)
+
+			if len(batch) >= trackBatchSize {
+				w.write(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.write(batch)
+			batch = batch[:0]
+		case <-w.stop:
+			for len(w.ch) > 0 {
+				batch = append(batch, <-w.ch)
+			}
+
+			w.write(batch)
+
+			return
+		}
+	}
+}
+
+func (w *TrackWriter) write(points []*model.TrackPoint) {
+	if len(points) == 0 {
+		return
+	}
+
+	if err := w.dbm.Create(&points); err != nil {
+		w.logger.Warn("track points lost", slog.Int("count", len(points)))
+	}
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"time"
@@ -18,7 +20,9 @@ type UserDbRepository struct {
 	logger   *slog.Logger
 	userFile string
 	cache    *cache.Cache[*model.Device]
+	certs    *cache.Cache[*model.Certificate]
 	dbm      *database.DatabaseManager
+	backends []Authenticator
 }
 
 func NewUserDbRepository(userFile string, dbm *database.DatabaseManager) *UserDbRepository {
@@ -29,14 +33,30 @@ func NewUserDbRepository(userFile string, dbm *database.DatabaseManager) *UserDb
 	}
 
 	u.cache = cache.NewWithTTL(time.Second*10, u.loadUser)
+	u.certs = cache.NewWithTTL(time.Second*10, u.loadCert)
+	u.backends = []Authenticator{u.Local()}
 
 	return u
 }
 
+// Local returns the backend that checks passwords stored in database.
+func (u *UserDbRepository) Local() Authenticator {
+	return localAuth{u: u}
+}
+
+// SetBackends sets authentication backends to try in order.
+func (u *UserDbRepository) SetBackends(backends ...Authenticator) {
+	u.backends = backends
+}
+
 func (u UserDbRepository) loadUser(username string) *model.Device {
 	return u.dbm.DeviceQuery().Login(username).One()
 }
 
+func (u UserDbRepository) loadCert(sn string) *model.Certificate {
+	return u.dbm.CertsQuery().SN(sn).One()
+}
+
 func (u UserDbRepository) Start() error {
 	if u.dbm.DeviceQuery().Count() == 0 {
 		u.logger.Info("load devices from file")
@@ -53,7 +73,7 @@ func (u UserDbRepository) Start() error {
 				return err
 			}
 
-			d = &model.Device{Login: "admin", Scope: "admin", Admin: true}
+			d = &model.Device{Login: "admin", Scope: "admin", Admin: true, SuperAdmin: true}
 			_ = d.SetPassword("admin")
 
 			if err := u.dbm.Create(d); err != nil {
@@ -70,15 +90,128 @@ func (u UserDbRepository) Stop() {
 }
 
 func (u UserDbRepository) CheckAuth(username, password string) bool {
-	user := u.cache.Load(username)
+	return u.Authenticate(username, password) != nil
+}
+
+// Authenticate tries backends in order until one of them knows the user. Devices of users authenticated
+// by other backends are created on first login and updated on every next one.
+func (u UserDbRepository) Authenticate(username, password string) *model.Device {
+	if username == "" || password == "" {
+		return nil
+	}
+
+	for _, b := range u.backends {
+		d, err := b.Authenticate(username, password)
+
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrUnknownUser):
+			continue
+		case errors.Is(err, ErrBadPassword):
+			return nil
+		default:
+			u.logger.Warn(b.Name()+" auth error", slog.String("user", username), slog.Any("error", err))
+
+			continue
+		}
 
-	return user.IsGood() && user.CheckPassword(password)
+		if b.Name() != localAuthName {
+			if d, err = u.provision(b.Name(), d); err != nil {
+				u.logger.Warn("can't provision device", slog.String("user", username), slog.Any("error", err))
+
+				return nil
+			}
+		}
+
+		if !d.IsGood() {
+			return nil
+		}
+
+		return d
+	}
+
+	return nil
 }
 
+// provision creates or updates the device with scopes and admin flags given by the backend.
+func (u UserDbRepository) provision(source string, d *model.Device) (*model.Device, error) {
+	dev := u.dbm.DeviceQuery().Login(d.Login).One()
+
+	switch {
+	case dev == nil:
+		d.AuthSource = source
+
+		if err := u.dbm.Create(d); err != nil {
+			return nil, err
+		}
+
+		u.logger.Info("device provisioned", slog.String("user", d.Login), slog.String("source", source),
+			slog.String("scope", d.Scope))
+
+		dev = d
+	case dev.AuthSource != source:
+		return nil, fmt.Errorf("device %s exists and is not from %s", d.Login, source)
+	default:
+		dev.Scope = d.Scope
+		dev.ReadScope = d.ReadScope
+		dev.Admin = d.Admin
+		dev.SuperAdmin = d.SuperAdmin
+		dev.Role = d.Role
+
+		if err := u.dbm.Save(dev); err != nil {
+			return nil, err
+		}
+	}
+
+	u.cache.Delete(d.Login)
+
+	return dev, nil
+}
+
+// IsValid checks user and, if serial is given, certificate. Certificates that are not signed by this server are not
+// in database and are checked by user only.
 func (u UserDbRepository) IsValid(username, sn string) bool {
 	user := u.cache.Load(username)
 
-	return user != nil && user.IsGood()
+	if user == nil || !user.IsGood() {
+		return false
+	}
+
+	if sn == "" {
+		return true
+	}
+
+	cert := u.certs.Load(sn)
+
+	if cert.IsRevoked() || cert.IsExpired() {
+		u.logger.Warn("revoked or expired certificate", slog.String("user", username), slog.String("sn", sn))
+
+		return false
+	}
+
+	return true
+}
+
+func (u UserDbRepository) RevokeCert(sn, reason string) error {
+	cert := u.dbm.CertsQuery().SN(sn).One()
+	if cert == nil {
+		return fmt.Errorf("certificate %s is not found", sn)
+	}
+
+	if cert.IsRevoked() {
+		return nil
+	}
+
+	cert.Revoke(reason)
+
+	if err := u.dbm.Save(cert); err != nil {
+		return err
+	}
+
+	u.certs.Delete(sn)
+	u.logger.Info("certificate revoked", slog.String("user", cert.Login), slog.String("sn", sn), slog.String("reason", reason))
+
+	return nil
 }
 
 func (u UserDbRepository) Get(username string) *model.Device {
@@ -113,8 +246,13 @@ func (u UserDbRepository) loadUsersFile() error {
 }
 
 func (u UserDbRepository) SaveSignInfo(username, uid, sn string, till time.Time) {
+	// new cert for the same device replaces the old one
 	if uid != "" && uid != "taktracker" {
-		_ = u.dbm.CertsQuery().Login(username).UID(uid).Delete()
+		for _, c := range u.dbm.CertsQuery().Login(username).UID(uid).Get() {
+			if c.Serial != sn && !c.IsRevoked() {
+				_ = u.RevokeCert(c.Serial, model.REVOKE_SUPERSEDED)
+			}
+		}
 	}
 
 	cert := &model.Certificate{
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestCertRevoke(t *testing.T) {
+	db, err := database.GetDatabase(":memory:", false)
+	require.NoError(t, err)
+
+	dbm := database.New(db)
+	require.NoError(t, dbm.Migrate())
+	require.NoError(t, dbm.Create(&model.Device{Login: "user1", Scope: "test"}))
+
+	r := NewUserDbRepository("", dbm)
+
+	till := time.Now().Add(time.Hour)
+	r.SaveSignInfo("user1", "uid1", "0a01", till)
+	r.SaveSignInfo("user1", "uid2", "0a02", till)
+
+	require.True(t, r.IsValid("user1", "0a01"))
+	require.True(t, r.IsValid("user1", "0a02"))
+	// cert signed by someone else
+	require.True(t, r.IsValid("user1", "ffff"))
+
+	require.NoError(t, r.RevokeCert("0a01", model.REVOKE_KEY_COMPROMISE))
+	require.Error(t, r.RevokeCert("ffff", model.REVOKE_KEY_COMPROMISE))
+
+	require.False(t, r.IsValid("user1", "0a01"))
+	require.True(t, r.IsValid("user1", "0a02"))
+
+	// new cert for the same uid supersedes the old one
+	r.SaveSignInfo("user1", "uid2", "0a03", till)
+	require.False(t, r.IsValid("user1", "0a02"))
+	require.True(t, r.IsValid("user1", "0a03"))
+
+	c := dbm.CertsQuery().SN("0a02").One()
+	require.Equal(t, model.REVOKE_SUPERSEDED, c.RevokeReason)
+
+	// expired
+	r.SaveSignInfo("user1", "uid3", "0a04", time.Now().Add(-time.Minute))
+	require.False(t, r.IsValid("user1", "0a04"))
+
+	require.Len(t, dbm.CertsQuery().Revoked().Get(), 2)
+}
+
+func TestNoSuperAdminsOnStart(t *testing.T) {
+	db, err := database.GetDatabase(":memory:", false)
+	require.NoError(t, err)
+
+	dbm := database.New(db)
+	require.NoError(t, dbm.Migrate())
+	require.NoError(t, dbm.Create(&model.Device{Login: "admin1", Scope: "test", Admin: true, Role: model.ROLE_VIEWER}))
+
+	require.NoError(t, NewUserDbRepository("", dbm).Start())
+	require.NoError(t, dbm.Migrate())
+	require.NoError(t, NewUserDbRepository("", dbm).Start())
+
+	require.Equal(t, int64(0), dbm.DeviceQuery().SuperAdmin().Count())
+}
@@ -135,14 +135,18 @@ func (r *AdminMemRepository) Stop() {
 }
 
 func (r *AdminMemRepository) CheckAuth(username, password string) bool {
+	return r.Authenticate(username, password) != nil
+}
+
+func (r *AdminMemRepository) Authenticate(username, password string) *model.Device {
 	r.mx.RLock()
 	defer r.mx.RUnlock()
 
-	if user, ok := r.users[username]; ok {
-		return user.IsGood() && user.CheckPassword(password)
+	if user, ok := r.users[username]; ok && user.IsGood() && user.CheckPassword(password) {
+		return user
 	}
 
-	return false
+	return nil
 }
 
 func (r *AdminMemRepository) IsValid(username, sn string) bool {
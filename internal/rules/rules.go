@@ -0,0 +1,205 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+const (
+	ActionDrop    = "drop"
+	ActionScope   = "scope"
+	ActionCopy    = "copy"
+	ActionStrip   = "strip"
+	ActionDeliver = "deliver"
+)
+
+type Rule struct {
+	Name   string    `yaml:"name" koanf:"name"`
+	Types  []string  `yaml:"types" koanf:"types"`
+	Scopes []string  `yaml:"scopes" koanf:"scopes"`
+	Logins []string  `yaml:"logins" koanf:"logins"`
+	UID    string    `yaml:"uid" koanf:"uid"`
+	BBox   []float64 `yaml:"bbox" koanf:"bbox"`
+
+	Action string   `yaml:"action" koanf:"action"`
+	Scope  string   `yaml:"scope" koanf:"scope"`
+	Tags   []string `yaml:"tags" koanf:"tags"`
+	To     []string `yaml:"to" koanf:"to"`
+
+	uidRe *regexp.Regexp
+}
+
+func (r *Rule) Compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule without name")
+	}
+
+	if r.UID != "" {
+		re, err := regexp.Compile(r.UID)
+		if err != nil {
+			return fmt.Errorf("rule %s: invalid uid regexp: %w", r.Name, err)
+		}
+
+		r.uidRe = re
+	}
+
+	if len(r.BBox) != 0 && len(r.BBox) != 4 {
+		return fmt.Errorf("rule %s: bbox must be [min_lat, min_lon, max_lat, max_lon]", r.Name)
+	}
+
+	switch r.Action {
+	case ActionDrop:
+	case ActionScope, ActionCopy:
+		if r.Scope == "" {
+			return fmt.Errorf("rule %s: no scope for action %s", r.Name, r.Action)
+		}
+	case ActionStrip:
+		if len(r.Tags) == 0 {
+			return fmt.Errorf("rule %s: no tags to strip", r.Name)
+		}
+	case ActionDeliver:
+		if len(r.To) == 0 {
+			return fmt.Errorf("rule %s: no logins to deliver", r.Name)
+		}
+	default:
+		return fmt.Errorf("rule %s: invalid action %s", r.Name, r.Action)
+	}
+
+	return nil
+}
+
+// Match checks message against all rule conditions. Empty condition matches anything.
+func (r *Rule) Match(msg *cot.CotMessage, login string) bool {
+	if len(r.Types) > 0 && !cot.MatchAnyPattern(msg.GetType(), r.Types...) {
+		return false
+	}
+
+	if len(r.Scopes) > 0 && !slices.Contains(r.Scopes, msg.Scope) {
+		return false
+	}
+
+	if len(r.Logins) > 0 && !slices.Contains(r.Logins, login) {
+		return false
+	}
+
+	if r.uidRe != nil && !r.uidRe.MatchString(msg.GetUID()) {
+		return false
+	}
+
+	if len(r.BBox) == 4 {
+		lat, lon := msg.GetLatLon()
+
+		if lat == 0 && lon == 0 {
+			return false
+		}
+
+		if lat < r.BBox[0] || lon < r.BBox[1] || lat > r.BBox[2] || lon > r.BBox[3] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type Engine struct {
+	rules  atomic.Pointer[[]*Rule]
+	metric *prometheus.CounterVec
+}
+
+func NewEngine(metric *prometheus.CounterVec) *Engine {
+	e := &Engine{metric: metric}
+	e.rules.Store(&[]*Rule{})
+
+	return e
+}
+
+// SetRules replaces all rules. Old rules are kept if any of the new ones is invalid.
+func (e *Engine) SetRules(rules []*Rule) error {
+	names := make(map[string]bool, len(rules))
+
+	for _, r := range rules {
+		if err := r.Compile(); err != nil {
+			return err
+		}
+
+		if names[r.Name] {
+			return fmt.Errorf("duplicate rule name %s", r.Name)
+		}
+
+		names[r.Name] = true
+	}
+
+	e.rules.Store(&rules)
+
+	return nil
+}
+
+func (e *Engine) Rules() []*Rule {
+	return *e.rules.Load()
+}
+
+// Apply runs all rules in order and changes the message. Returns false if message must be dropped.
+// drop and deliver actions stop rules processing.
+func (e *Engine) Apply(msg *cot.CotMessage, login string) bool {
+	for _, r := range e.Rules() {
+		if !r.Match(msg, login) {
+			continue
+		}
+
+		if e.metric != nil {
+			e.metric.WithLabelValues(r.Name, r.Action).Inc()
+		}
+
+		switch r.Action {
+		case ActionDrop:
+			return false
+		case ActionScope:
+			msg.Scope = r.Scope
+		case ActionCopy:
+			if !slices.Contains(msg.CopyScopes, r.Scope) {
+				msg.CopyScopes = append(msg.CopyScopes, r.Scope)
+			}
+		case ActionStrip:
+			stripTags(msg, r.Tags)
+		case ActionDeliver:
+			msg.DestLogins = r.To
+
+			return true
+		}
+	}
+
+	return true
+}
+
+func stripTags(msg *cot.CotMessage, tags []string) {
+	if d := msg.GetTakMessage().GetCotEvent().GetDetail(); d != nil {
+		// these tags are kept in protobuf fields, not in xml detail
+		for _, t := range tags {
+			switch t {
+			case "contact":
+				d.Contact = nil
+			case "__group":
+				d.Group = nil
+			case "precisionlocation":
+				d.PrecisionLocation = nil
+			case "status":
+				d.Status = nil
+			case "takv":
+				d.Takv = nil
+			case "track":
+				d.Track = nil
+			}
+		}
+	}
+
+	if msg.Detail != nil {
+		msg.Detail.RemoveTags(tags...)
+		msg.TakMessage = msg.GetUpdatedTakMessage()
+	}
+}
@@ -0,0 +1,82 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+func newMsg(typ, uid, scope string, lat, lon float64) *cot.CotMessage {
+	tak := cot.BasicMsg(typ, uid, time.Minute)
+	tak.CotEvent.Lat = lat
+	tak.CotEvent.Lon = lon
+	tak.CotEvent.Detail = &cotproto.Detail{XmlDetail: "<remarks>secret</remarks><color argb=\"-1\"/>"}
+
+	msg, _ := cot.CotFromProto(tak, "", scope)
+
+	return msg
+}
+
+func TestCompile(t *testing.T) {
+	require.Error(t, (&Rule{Action: ActionDrop}).Compile())
+	require.Error(t, (&Rule{Name: "r1", Action: "aaa"}).Compile())
+	require.Error(t, (&Rule{Name: "r1", Action: ActionCopy}).Compile())
+	require.Error(t, (&Rule{Name: "r1", Action: ActionDrop, UID: "[a"}).Compile())
+	require.Error(t, (&Rule{Name: "r1", Action: ActionDrop, BBox: []float64{1, 2}}).Compile())
+	require.NoError(t, (&Rule{Name: "r1", Action: ActionDrop, UID: "^ANDROID-"}).Compile())
+
+	e := NewEngine(nil)
+	require.NoError(t, e.SetRules([]*Rule{{Name: "r1", Action: ActionDrop}}))
+	require.Error(t, e.SetRules([]*Rule{{Name: "r2", Action: ActionDrop}, {Name: "r2", Action: ActionDrop}}))
+	assert.Len(t, e.Rules(), 1)
+}
+
+func TestMatch(t *testing.T) {
+	r := &Rule{
+		Name:   "r1",
+		Types:  []string{"a-h-"},
+		Scopes: []string{"public"},
+		Logins: []string{"user1"},
+		UID:    "^ANDROID-",
+		BBox:   []float64{50, 30, 60, 40},
+		Action: ActionDrop,
+	}
+	require.NoError(t, r.Compile())
+
+	assert.True(t, r.Match(newMsg("a-h-G", "ANDROID-1", "public", 55, 35), "user1"))
+	assert.False(t, r.Match(newMsg("a-f-G", "ANDROID-1", "public", 55, 35), "user1"))
+	assert.False(t, r.Match(newMsg("a-h-G", "ANDROID-1", "private", 55, 35), "user1"))
+	assert.False(t, r.Match(newMsg("a-h-G", "ANDROID-1", "public", 55, 35), "user2"))
+	assert.False(t, r.Match(newMsg("a-h-G", "IOS-1", "public", 55, 35), "user1"))
+	assert.False(t, r.Match(newMsg("a-h-G", "ANDROID-1", "public", 45, 35), "user1"))
+	assert.False(t, r.Match(newMsg("a-h-G", "ANDROID-1", "public", 0, 0), "user1"))
+}
+
+func TestApply(t *testing.T) {
+	e := NewEngine(nil)
+	require.NoError(t, e.SetRules([]*Rule{
+		{Name: "drop_hostile", Types: []string{"a-h-"}, Action: ActionDrop},
+		{Name: "move", Scopes: []string{"test"}, Action: ActionScope, Scope: "public"},
+		{Name: "copy", Scopes: []string{"public"}, Action: ActionCopy, Scope: "hq"},
+		{Name: "strip", Action: ActionStrip, Tags: []string{"remarks"}},
+		{Name: "deliver", Types: []string{"b-"}, Action: ActionDeliver, To: []string{"adm"}},
+		{Name: "never", Action: ActionDrop},
+	}))
+
+	assert.False(t, e.Apply(newMsg("a-h-G", "uid1", "test", 1, 1), ""))
+
+	msg := newMsg("b-m-p-s-p-i", "uid1", "test", 1, 1)
+	require.True(t, e.Apply(msg, ""))
+
+	assert.Equal(t, "public", msg.Scope)
+	assert.Equal(t, []string{"hq"}, msg.CopyScopes)
+	assert.Equal(t, []string{"adm"}, msg.DestLogins)
+	assert.False(t, msg.GetDetail().Has("remarks"))
+	assert.True(t, msg.GetDetail().Has("color"))
+	assert.NotContains(t, msg.GetTakMessage().GetCotEvent().GetDetail().GetXmlDetail(), "secret")
+}
@@ -12,6 +12,8 @@ const (
 	LocalFrom      = "local"
 	LocalScope     = "local"
 	BroadcastScope = "broadcast"
+
+	flowTags = "_flow-tags_"
 )
 
 type CotMessage struct {
@@ -19,6 +21,9 @@ type CotMessage struct {
 	Scope      string               `json:"scope"`
 	TakMessage *cotproto.TakMessage `json:"tak_message"`
 	Detail     *Node                `json:"-"`
+	// server side routing set by rules: deliver only to these logins, copy to other scopes
+	DestLogins []string `json:"-"`
+	CopyScopes []string `json:"-"`
 }
 
 func LocalCotMessage(msg *cotproto.TakMessage) *CotMessage {
@@ -260,6 +265,34 @@ func (m *CotMessage) IsMapItem() bool {
 	return (m.GetLat() != 0 && m.GetLon() != 0) && MatchAnyPattern(m.GetType(), "b-")
 }
 
+// HasFlowTag checks if message was already relayed by the server with given name.
+func (m *CotMessage) HasFlowTag(name string) bool {
+	return m.GetDetail().GetFirst(flowTags).GetAttr(name) != ""
+}
+
+// FlowHops returns the number of servers the message has passed through.
+func (m *CotMessage) FlowHops() int {
+	if n := m.GetDetail().GetFirst(flowTags); n != nil {
+		return len(n.Attrs)
+	}
+
+	return 0
+}
+
+// AddFlowTag marks the message as relayed by the server with given name.
+func (m *CotMessage) AddFlowTag(name string, t time.Time) {
+	if m == nil || m.HasFlowTag(name) {
+		return
+	}
+
+	if m.Detail == nil {
+		m.Detail = NewXMLDetails()
+	}
+
+	m.Detail.AddOrChangeChild(flowTags, map[string]string{name: t.UTC().Format(time.RFC3339)})
+	m.TakMessage = m.GetUpdatedTakMessage()
+}
+
 func (m *CotMessage) GetLatLon() (float64, float64) {
 	if m == nil {
 		return 0, 0
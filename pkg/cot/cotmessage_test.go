@@ -0,0 +1,30 @@
+package cot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowTags(t *testing.T) {
+	msg := LocalCotMessage(BasicMsg("a-f-G", "uid1", time.Minute))
+
+	assert.False(t, msg.HasFlowTag("srv1"))
+	assert.Equal(t, 0, msg.FlowHops())
+
+	msg.AddFlowTag("srv1", time.Now())
+	msg.AddFlowTag("srv1", time.Now())
+	msg.AddFlowTag("srv2", time.Now())
+
+	assert.True(t, msg.HasFlowTag("srv1"))
+	assert.True(t, msg.HasFlowTag("srv2"))
+	assert.Equal(t, 2, msg.FlowHops())
+
+	msg2, err := CotFromProto(msg.GetTakMessage(), "", "")
+	require.NoError(t, err)
+
+	assert.True(t, msg2.HasFlowTag("srv1"))
+	assert.Equal(t, 2, msg2.FlowHops())
+}
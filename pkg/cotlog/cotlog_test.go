@@ -0,0 +1,175 @@
+package cotlog
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+func testMsg(uid string, detailSize int) *cotproto.TakMessage {
+	msg := cot.BasicMsg("a-f-G", uid, time.Minute)
+	msg.CotEvent.Detail = &cotproto.Detail{XmlDetail: "<remarks>" + strings.Repeat("x", detailSize) + "</remarks>"}
+
+	return msg
+}
+
+func readAll(t *testing.T, r *Reader) []*Record {
+	t.Helper()
+
+	var res []*Record
+
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return res
+		}
+
+		require.NoError(t, err)
+
+		res = append(res, rec)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		w := NewWriter(WriterOpts{Dir: dir, Compress: compress, Source: "test"})
+
+		now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		w.now = func() time.Time { return now }
+
+		require.NoError(t, w.Write("scope1", testMsg("uid1", 10)))
+		// more than 64k
+		require.NoError(t, w.Write("", testMsg("uid2", 100_000)))
+
+		for i := range 100 {
+			now = now.Add(time.Second)
+			require.NoError(t, w.Write("scope1", testMsg("uid3", i)))
+		}
+
+		require.NoError(t, w.Close())
+
+		r, err := Open(w.name)
+		require.NoError(t, err)
+
+		assert.False(t, r.Legacy())
+		assert.Equal(t, "test", r.Header().Source)
+		assert.Equal(t, compress, r.Header().Compressed)
+
+		recs := readAll(t, r)
+		require.Len(t, recs, 102)
+		assert.Equal(t, "scope1", recs[0].Scope)
+		assert.Equal(t, "uid2", recs[1].Msg.GetCotEvent().GetUid())
+		assert.Len(t, recs[1].Msg.GetCotEvent().GetDetail().GetXmlDetail(), 100_000+len("<remarks></remarks>"))
+		require.NoError(t, r.Close())
+
+		idx, err := ReadIndex(w.name + IndexExt)
+		require.NoError(t, err)
+		assert.Len(t, idx, 11)
+
+		r, err = Open(w.name)
+		require.NoError(t, err)
+		require.NoError(t, r.Seek(time.Date(2024, 5, 1, 10, 0, 55, 0, time.UTC)))
+
+		recs = readAll(t, r)
+		require.Len(t, recs, 46)
+		assert.True(t, recs[0].Time.Equal(time.Date(2024, 5, 1, 10, 0, 55, 0, time.UTC)))
+		// records before seek time were skipped using index
+		assert.Greater(t, r.pos, int64(0))
+		require.NoError(t, r.Close())
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(WriterOpts{Dir: dir, MaxSize: 1000, MaxAge: time.Hour})
+
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+
+	for range 3 {
+		require.NoError(t, w.Write("", testMsg("uid1", 600)))
+	}
+
+	now = now.Add(time.Hour)
+	require.NoError(t, w.Write("", testMsg("uid1", 10)))
+	require.NoError(t, w.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+Ext))
+	require.NoError(t, err)
+	// size is checked before write, so first file gets two records
+	assert.Len(t, files, 3)
+
+	var total int
+
+	for _, f := range files {
+		r, err := Open(f)
+		require.NoError(t, err)
+
+		total += len(readAll(t, r))
+		_ = r.Close()
+	}
+
+	assert.Equal(t, 4, total)
+}
+
+func TestLegacy(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "2024-01-01.tak")
+
+	var data []byte
+
+	for _, uid := range []string{"uid1", "uid2"} {
+		b, err := proto.Marshal(testMsg(uid, 10))
+		require.NoError(t, err)
+
+		data = append(data, byte(len(b)%256), byte(len(b)/256))
+		data = append(data, b...)
+	}
+
+	require.NoError(t, os.WriteFile(name, data, 0o600))
+
+	r, err := Open(name)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	assert.True(t, r.Legacy())
+
+	recs := readAll(t, r)
+	require.Len(t, recs, 2)
+	assert.Equal(t, "uid2", recs[1].Msg.GetCotEvent().GetUid())
+	assert.False(t, recs[1].Time.IsZero())
+}
+
+func TestTruncated(t *testing.T) {
+	w := NewWriter(WriterOpts{Dir: t.TempDir()})
+	require.NoError(t, w.Write("", testMsg("uid1", 10)))
+	require.NoError(t, w.Write("", testMsg("uid2", 10)))
+	require.NoError(t, w.Close())
+
+	st, err := os.Stat(w.name)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(w.name, st.Size()-5))
+
+	r, err := Open(w.name)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	_, err = r.Next()
+	require.NoError(t, err)
+
+	_, err = r.Next()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
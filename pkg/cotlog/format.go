@@ -0,0 +1,91 @@
+// Package cotlog implements recording format for CoT messages.
+//
+// File starts with 8-byte magic, format version and flags bytes, then uvarint length and json header.
+// Records follow, every record is uvarint length and the payload: uvarint time in unix millis,
+// uvarint length and scope, protobuf TakMessage. If FlagGzip is set, all records are gzip compressed.
+//
+// Legacy files (without magic) are 2-byte little endian length and TakMessage, they are read too.
+package cotlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+const (
+	Magic   = "GOATAKLG"
+	Version = 2
+
+	FlagGzip byte = 1
+
+	// MaxRecordSize protects from huge allocations reading broken file.
+	MaxRecordSize = 16 << 20
+
+	Ext      = ".tak"
+	IndexExt = ".idx"
+)
+
+var ErrTooBig = errors.New("record is too big")
+
+type Header struct {
+	Version    int       `json:"version"`
+	Created    time.Time `json:"created"`
+	Source     string    `json:"source,omitempty"`
+	Compressed bool      `json:"compressed,omitempty"`
+}
+
+type Record struct {
+	Time  time.Time
+	Scope string
+	Msg   *cotproto.TakMessage
+}
+
+func encodeRecord(r *Record) ([]byte, error) {
+	b, err := proto.Marshal(r.Msg)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make([]byte, 0, len(b)+len(r.Scope)+2*binary.MaxVarintLen64)
+	payload = binary.AppendUvarint(payload, uint64(r.Time.UnixMilli()))
+	payload = binary.AppendUvarint(payload, uint64(len(r.Scope)))
+	payload = append(payload, r.Scope...)
+	payload = append(payload, b...)
+
+	if len(payload) > MaxRecordSize {
+		return nil, ErrTooBig
+	}
+
+	res := make([]byte, 0, len(payload)+binary.MaxVarintLen64)
+	res = binary.AppendUvarint(res, uint64(len(payload)))
+
+	return append(res, payload...), nil
+}
+
+func decodeRecord(payload []byte) (*Record, error) {
+	ms, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid record time")
+	}
+
+	payload = payload[n:]
+
+	l, n := binary.Uvarint(payload)
+	if n <= 0 || uint64(len(payload)-n) < l {
+		return nil, fmt.Errorf("invalid record scope")
+	}
+
+	r := &Record{Time: time.UnixMilli(int64(ms)), Scope: string(payload[n : n+int(l)]), Msg: new(cotproto.TakMessage)}
+
+	if err := proto.Unmarshal(payload[n+int(l):], r.Msg); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
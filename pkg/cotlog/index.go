@@ -0,0 +1,73 @@
+package cotlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	indexMagic     = "GOATAKIX"
+	indexEntrySize = 16
+)
+
+// IndexEntry points to the first record with time not before Time.
+// Offset is counted in uncompressed records stream, from the end of the header.
+type IndexEntry struct {
+	Time   time.Time
+	Offset int64
+}
+
+func appendIndexEntry(b []byte, e IndexEntry) []byte {
+	b = binary.BigEndian.AppendUint64(b, uint64(e.Time.UnixMilli()))
+
+	return binary.BigEndian.AppendUint64(b, uint64(e.Offset))
+}
+
+// ReadIndex reads sidecar index file, incomplete last entry is ignored.
+func ReadIndex(name string) ([]IndexEntry, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < len(indexMagic) || string(b[:len(indexMagic)]) != indexMagic {
+		return nil, errors.New("invalid index file")
+	}
+
+	b = b[len(indexMagic):]
+	res := make([]IndexEntry, 0, len(b)/indexEntrySize)
+
+	for len(b) >= indexEntrySize {
+		res = append(res, IndexEntry{
+			Time:   time.UnixMilli(int64(binary.BigEndian.Uint64(b))),
+			Offset: int64(binary.BigEndian.Uint64(b[8:])),
+		})
+
+		b = b[indexEntrySize:]
+	}
+
+	return res, nil
+}
+
+// findOffset returns offset of the last entry before t.
+func findOffset(idx []IndexEntry, t time.Time) int64 {
+	i := sort.Search(len(idx), func(i int) bool {
+		return !idx[i].Time.Before(t)
+	})
+
+	if i == 0 {
+		return 0
+	}
+
+	return idx[i-1].Offset
+}
+
+func writeIndexHeader(w io.Writer) error {
+	_, err := io.WriteString(w, indexMagic)
+
+	return err
+}
@@ -0,0 +1,232 @@
+package cotlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+// Reader reads records from new or legacy file.
+type Reader struct {
+	name   string
+	f      *os.File
+	r      *bufio.Reader
+	header *Header
+	// offset of records start in file and position in records stream
+	start int64
+	pos   int64
+	from  time.Time
+}
+
+func Open(name string) (*Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{name: name, f: f}
+
+	if err := r.init(); err != nil {
+		_ = f.Close()
+
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return r, nil
+}
+
+func (r *Reader) init() error {
+	br := bufio.NewReader(r.f)
+
+	b, err := br.Peek(len(Magic) + 2)
+	if err != nil || string(b[:len(Magic)]) != Magic {
+		r.r = br
+
+		return nil //nolint:nilerr
+	}
+
+	if b[len(Magic)] != Version {
+		return fmt.Errorf("unsupported version %d", b[len(Magic)])
+	}
+
+	flags := b[len(Magic)+1]
+	_, _ = br.Discard(len(Magic) + 2)
+
+	l, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+
+	if l > MaxRecordSize {
+		return ErrTooBig
+	}
+
+	data := make([]byte, l)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return err
+	}
+
+	r.header = new(Header)
+	if err := json.Unmarshal(data, r.header); err != nil {
+		return err
+	}
+
+	r.start = int64(len(Magic) + 2 + uvarintLen(l) + len(data))
+
+	return r.reset(flags&FlagGzip != 0, br)
+}
+
+func (r *Reader) reset(compressed bool, br *bufio.Reader) error {
+	r.pos = 0
+
+	if !compressed {
+		r.r = br
+
+		return nil
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return err
+	}
+
+	gz.Multistream(false)
+	r.r = bufio.NewReader(gz)
+
+	return nil
+}
+
+// Header returns nil for legacy file.
+func (r *Reader) Header() *Header {
+	return r.header
+}
+
+func (r *Reader) Legacy() bool {
+	return r.header == nil
+}
+
+// Seek makes Next skip records before t, using the index file to skip the file part if it exists.
+func (r *Reader) Seek(t time.Time) error {
+	r.from = t
+
+	if r.Legacy() {
+		return nil
+	}
+
+	idx, err := ReadIndex(r.name + IndexExt)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	offset := findOffset(idx, t)
+
+	if offset <= r.pos {
+		return nil
+	}
+
+	if !r.header.Compressed {
+		if _, err := r.f.Seek(r.start+offset, io.SeekStart); err != nil {
+			return err
+		}
+
+		r.r.Reset(r.f)
+		r.pos = offset
+
+		return nil
+	}
+
+	n, err := r.r.Discard(int(offset - r.pos))
+	r.pos += int64(n)
+
+	return err
+}
+
+// Next returns the next record or io.EOF.
+func (r *Reader) Next() (*Record, error) {
+	for {
+		rec, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if r.from.IsZero() || !rec.Time.Before(r.from) {
+			return rec, nil
+		}
+	}
+}
+
+func (r *Reader) next() (*Record, error) {
+	if r.Legacy() {
+		return r.nextLegacy()
+	}
+
+	l, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+
+	if l > MaxRecordSize {
+		return nil, ErrTooBig
+	}
+
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return nil, unexpected(err)
+	}
+
+	r.pos += int64(uvarintLen(l)) + int64(l)
+
+	return decodeRecord(buf)
+}
+
+func (r *Reader) nextLegacy() (*Record, error) {
+	lenBuf := make([]byte, 2)
+
+	if _, err := io.ReadFull(r.r, lenBuf); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, int(lenBuf[0])+int(lenBuf[1])*256)
+
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return nil, unexpected(err)
+	}
+
+	m := new(cotproto.TakMessage)
+	if err := proto.Unmarshal(buf, m); err != nil {
+		return nil, err
+	}
+
+	return &Record{Time: cot.TimeFromMillis(m.GetCotEvent().GetSendTime()), Msg: m}, nil
+}
+
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
+
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+func uvarintLen(x uint64) int {
+	return len(binary.AppendUvarint(nil, x))
+}
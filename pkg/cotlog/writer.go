@@ -0,0 +1,246 @@
+package cotlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+const (
+	DefaultMaxAge        = time.Hour * 24
+	DefaultIndexInterval = time.Second * 10
+)
+
+type WriterOpts struct {
+	Dir string
+	// MaxSize of uncompressed records in file, 0 - no limit
+	MaxSize int64
+	// MaxAge of file, 0 - no limit
+	MaxAge time.Duration
+	// IndexInterval is minimal time between index entries
+	IndexInterval time.Duration
+	Compress      bool
+	Source        string
+}
+
+// Writer writes records to files in Dir, opening new file when current one gets too big or too old.
+// Writes are buffered, call Flush periodically.
+type Writer struct {
+	opts WriterOpts
+	mu   sync.Mutex
+	now  func() time.Time
+
+	name      string
+	f         *os.File
+	buf       *bufio.Writer
+	gz        *gzip.Writer
+	w         io.Writer
+	idx       *os.File
+	idxBuf    *bufio.Writer
+	size      int64
+	opened    time.Time
+	lastIndex time.Time
+}
+
+func NewWriter(opts WriterOpts) *Writer {
+	if opts.IndexInterval == 0 {
+		opts.IndexInterval = DefaultIndexInterval
+	}
+
+	return &Writer{opts: opts, now: time.Now}
+}
+
+// FileName returns the name of current file.
+func (w *Writer) FileName() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.name
+}
+
+func (w *Writer) Write(scope string, msg *cotproto.TakMessage) error {
+	return w.WriteRecord(&Record{Time: w.now(), Scope: scope, Msg: msg})
+}
+
+func (w *Writer) WriteRecord(r *Record) error {
+	b, err := encodeRecord(r)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.needRotate() {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if w.lastIndex.IsZero() || r.Time.Sub(w.lastIndex) >= w.opts.IndexInterval {
+		if _, err := w.idxBuf.Write(appendIndexEntry(nil, IndexEntry{Time: r.Time, Offset: w.size})); err != nil {
+			return err
+		}
+
+		w.lastIndex = r.Time
+	}
+
+	n, err := w.w.Write(b)
+	w.size += int64(n)
+
+	return err
+}
+
+func (w *Writer) needRotate() bool {
+	if w.f == nil {
+		return true
+	}
+
+	if w.opts.MaxSize > 0 && w.size >= w.opts.MaxSize {
+		return true
+	}
+
+	return w.opts.MaxAge > 0 && w.now().Sub(w.opened) >= w.opts.MaxAge
+}
+
+func (w *Writer) rotate() error {
+	if err := w.close(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(w.opts.Dir, 0o777); err != nil {
+		return err
+	}
+
+	now := w.now()
+	base := filepath.Join(w.opts.Dir, now.Format("2006-01-02_150405"))
+
+	var f *os.File
+
+	for i := 0; ; i++ {
+		name := base + Ext
+		if i > 0 {
+			name = fmt.Sprintf("%s-%d%s", base, i, Ext)
+		}
+
+		var err error
+
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+		if err == nil {
+			w.name = name
+
+			break
+		}
+
+		if !errors.Is(err, os.ErrExist) || i > 100 {
+			return err
+		}
+	}
+
+	idx, err := os.OpenFile(w.name+IndexExt, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	w.f = f
+	w.buf = bufio.NewWriterSize(f, 64*1024)
+	w.idx = idx
+	w.idxBuf = bufio.NewWriter(idx)
+	w.size = 0
+	w.opened = now
+	w.lastIndex = time.Time{}
+
+	if err := writeHeader(w.buf, &Header{Version: Version, Created: now, Source: w.opts.Source, Compressed: w.opts.Compress}); err != nil {
+		return err
+	}
+
+	if err := writeIndexHeader(w.idxBuf); err != nil {
+		return err
+	}
+
+	w.w = w.buf
+
+	if w.opts.Compress {
+		w.gz = gzip.NewWriter(w.buf)
+		w.w = w.gz
+	}
+
+	return nil
+}
+
+func writeHeader(w io.Writer, h *Header) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	var flags byte
+	if h.Compressed {
+		flags |= FlagGzip
+	}
+
+	b := append([]byte(Magic), Version, flags)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+
+	_, err = w.Write(append(b, data...))
+
+	return err
+}
+
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.flush()
+}
+
+func (w *Writer) flush() error {
+	if w.f == nil {
+		return nil
+	}
+
+	if w.gz != nil {
+		if err := w.gz.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(w.buf.Flush(), w.idxBuf.Flush())
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.close()
+}
+
+func (w *Writer) close() error {
+	if w.f == nil {
+		return nil
+	}
+
+	var errs []error
+
+	if w.gz != nil {
+		errs = append(errs, w.gz.Close())
+	}
+
+	errs = append(errs, w.buf.Flush(), w.idxBuf.Flush(), w.f.Close(), w.idx.Close())
+
+	w.f, w.idx, w.gz, w.w = nil, nil, nil, nil
+
+	return errors.Join(errs...)
+}
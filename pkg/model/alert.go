@@ -0,0 +1,166 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+const ALERT_CANCEL = "b-a-o-can"
+
+// Alert is an emergency raised by a client (911, ring the bell, troops in contact). It stays active until
+// the client or admin cancels it.
+type Alert struct {
+	ID          uint      `gorm:"primaryKey"`
+	CreatedAt   time.Time `gorm:"index;type:timestamp"`
+	UpdatedAt   time.Time `gorm:"type:timestamp"`
+	UID         string    `gorm:"index;size:255"`
+	Scope       string    `gorm:"index;size:255"`
+	Type        string    `gorm:"size:32"`
+	Kind        string    `gorm:"size:255"`
+	SenderUID   string    `gorm:"index;size:255"`
+	Callsign    string    `gorm:"size:255"`
+	Lat         float64
+	Lon         float64
+	Active      bool       `gorm:"index"`
+	AckedAt     *time.Time `gorm:"type:timestamp"`
+	AckedBy     string     `gorm:"size:255"`
+	CancelledAt *time.Time `gorm:"type:timestamp"`
+	CancelledBy string     `gorm:"size:255"`
+	MsgData     []byte
+}
+
+type AlertDTO struct {
+	ID          uint       `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	UID         string     `json:"uid"`
+	Scope       string     `json:"scope"`
+	Type        string     `json:"type"`
+	Kind        string     `json:"kind"`
+	SenderUID   string     `json:"sender_uid"`
+	Callsign    string     `json:"callsign"`
+	Lat         float64    `json:"lat"`
+	Lon         float64    `json:"lon"`
+	Active      bool       `json:"active"`
+	AckedAt     *time.Time `json:"acked_at,omitempty"`
+	AckedBy     string     `json:"acked_by,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	CancelledBy string     `json:"cancelled_by,omitempty"`
+}
+
+// IsAlert checks for emergency message, cancel message is an alert too.
+func IsAlert(msg *cot.CotMessage) bool {
+	return cot.MatchPattern(msg.GetType(), "b-a-o-")
+}
+
+func NewAlert(msg *cot.CotMessage) *Alert {
+	a := &Alert{
+		UID:    msg.GetUID(),
+		Scope:  msg.Scope,
+		Active: true,
+	}
+
+	a.Update(msg)
+
+	return a
+}
+
+// Update takes sender, position and the message itself from repeated alert message.
+func (a *Alert) Update(msg *cot.CotMessage) {
+	a.Type = msg.GetType()
+	a.Lat, a.Lon = msg.GetLatLon()
+	a.SenderUID, a.Callsign = alertSender(msg)
+
+	if e := msg.GetDetail().GetFirst("emergency"); e != nil {
+		a.Kind = e.GetAttr("type")
+	}
+
+	if a.Kind == "" {
+		a.Kind = cot.GetMsgType(a.Type)
+	}
+
+	if b, err := proto.Marshal(msg.GetTakMessage()); err == nil {
+		a.MsgData = b
+	}
+}
+
+// alertSender gets uid and callsign of the device that raised the alert, emergency text is the callsign.
+func alertSender(msg *cot.CotMessage) (string, string) {
+	uid, callsign := msg.GetParent()
+
+	if e := msg.GetDetail().GetFirst("emergency"); e != nil && e.GetText() != "" {
+		callsign = e.GetText()
+	}
+
+	if callsign == "" {
+		callsign = msg.GetCallsign()
+	}
+
+	return uid, callsign
+}
+
+// Cancel closes the alert. By is the callsign of the client or admin login.
+func (a *Alert) Cancel(by string) {
+	now := time.Now()
+
+	a.Active = false
+	a.CancelledAt = &now
+	a.CancelledBy = by
+}
+
+func (a *Alert) Ack(by string) {
+	now := time.Now()
+
+	a.AckedAt = &now
+	a.AckedBy = by
+}
+
+// Message restores the last alert message with current time.
+func (a *Alert) Message() (*cot.CotMessage, error) {
+	return restoreMessage(a.MsgData, a.Scope)
+}
+
+// CancelMessage makes the message clients use to cancel the alert.
+func (a *Alert) CancelMessage() *cot.CotMessage {
+	tak := cot.BasicMsg(ALERT_CANCEL, a.UID, time.Second*10)
+	tak.CotEvent.How = "h-e"
+	tak.CotEvent.Lat = a.Lat
+	tak.CotEvent.Lon = a.Lon
+
+	xd := cot.NewXMLDetails()
+	xd.AddPpLink(a.SenderUID, "", a.Callsign)
+	xd.AddChild("emergency", map[string]string{"cancel": "true"}, a.Callsign)
+	tak.CotEvent.Detail = &cotproto.Detail{XmlDetail: xd.AsXMLString()}
+
+	return &cot.CotMessage{TakMessage: tak, Detail: xd, Scope: a.Scope}
+}
+
+func (a *Alert) String() string {
+	return fmt.Sprintf("%s %s from %s (%s) in %s", a.Kind, a.UID, a.Callsign, a.SenderUID, a.Scope)
+}
+
+func (a *Alert) DTO() *AlertDTO {
+	return &AlertDTO{
+		ID:          a.ID,
+		CreatedAt:   a.CreatedAt,
+		UpdatedAt:   a.UpdatedAt,
+		UID:         a.UID,
+		Scope:       a.Scope,
+		Type:        a.Type,
+		Kind:        a.Kind,
+		SenderUID:   a.SenderUID,
+		Callsign:    a.Callsign,
+		Lat:         a.Lat,
+		Lon:         a.Lon,
+		Active:      a.Active,
+		AckedAt:     a.AckedAt,
+		AckedBy:     a.AckedBy,
+		CancelledAt: a.CancelledAt,
+		CancelledBy: a.CancelledBy,
+	}
+}
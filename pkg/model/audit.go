@@ -0,0 +1,71 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// audit actions
+const (
+	AUDIT_LOGIN_FAILED   = "login_failed"
+	AUDIT_DEVICE_CREATE  = "device_create"
+	AUDIT_DEVICE_UPDATE  = "device_update"
+	AUDIT_UNIT_DELETE    = "unit_delete"
+	AUDIT_PROFILE_DELETE = "profile_delete"
+	AUDIT_FILE_DELETE    = "file_delete"
+	AUDIT_COT_POST       = "cot_post"
+	AUDIT_CERT_SIGN      = "cert_sign"
+	AUDIT_CERT_REVOKE    = "cert_revoke"
+	AUDIT_CERT_REJECTED  = "cert_rejected"
+	AUDIT_TOKEN_CREATE   = "token_create"
+	AUDIT_TOKEN_REVOKE   = "token_revoke"
+	AUDIT_KEY_ROTATE     = "key_rotate"
+)
+
+var ErrAuditAppendOnly = errors.New("audit events can't be changed")
+
+// AuditEvent is a record of administrative or security event. Events are never updated or deleted.
+type AuditEvent struct {
+	ID       uint      `gorm:"primaryKey"`
+	Time     time.Time `gorm:"index;type:timestamp"`
+	Actor    string    `gorm:"index;size:255"`
+	Action   string    `gorm:"index;size:64"`
+	Target   string    `gorm:"index;size:255"`
+	Scope    string    `gorm:"index;size:255"`
+	SourceIP string    `gorm:"size:64"`
+	Details  string    `gorm:"size:1024"`
+}
+
+type AuditEventDTO struct {
+	ID       uint      `json:"id"`
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor"`
+	Action   string    `json:"action"`
+	Target   string    `json:"target,omitempty"`
+	Scope    string    `json:"scope,omitempty"`
+	SourceIP string    `json:"source_ip,omitempty"`
+	Details  string    `json:"details,omitempty"`
+}
+
+func (e *AuditEvent) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+func (e *AuditEvent) BeforeDelete(*gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+func (e *AuditEvent) DTO() *AuditEventDTO {
+	return &AuditEventDTO{
+		ID:       e.ID,
+		Time:     e.Time,
+		Actor:    e.Actor,
+		Action:   e.Action,
+		Target:   e.Target,
+		Scope:    e.Scope,
+		SourceIP: e.SourceIP,
+		Details:  e.Details,
+	}
+}
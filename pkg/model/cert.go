@@ -1,26 +1,87 @@
 package model
 
 import (
+	"crypto/x509"
+	"encoding/hex"
+	"math/big"
 	"time"
 )
 
+// revocation reasons, see RFC 5280 5.3.1
+const (
+	REVOKE_UNSPECIFIED    = "unspecified"
+	REVOKE_KEY_COMPROMISE = "key_compromise"
+	REVOKE_AFFILIATION    = "affiliation_changed"
+	REVOKE_SUPERSEDED     = "superseded"
+	REVOKE_CESSATION      = "cessation_of_operation"
+)
+
+var revokeReasonCodes = map[string]int{
+	REVOKE_UNSPECIFIED:    0,
+	REVOKE_KEY_COMPROMISE: 1,
+	REVOKE_AFFILIATION:    3,
+	REVOKE_SUPERSEDED:     4,
+	REVOKE_CESSATION:      5,
+}
+
 type Certificate struct {
-	Serial      string     `gorm:"primaryKey;size:255"`
-	CreatedAt   time.Time  `gorm:"index;type:timestamp"`
-	UpdatedAt   time.Time  `gorm:"type:timestamp"`
-	Login       string     `gorm:"not null;index;size:255"`
-	UID         string     `gorm:"index;size:255"`
-	LastConnect *time.Time `gorm:"type:timestamp"`
-	ValidTill   *time.Time `gorm:"type:timestamp"`
+	Serial       string     `gorm:"primaryKey;size:255"`
+	CreatedAt    time.Time  `gorm:"index;type:timestamp"`
+	UpdatedAt    time.Time  `gorm:"type:timestamp"`
+	Login        string     `gorm:"not null;index;size:255"`
+	UID          string     `gorm:"index;size:255"`
+	LastConnect  *time.Time `gorm:"type:timestamp"`
+	ValidTill    *time.Time `gorm:"type:timestamp"`
+	RevokedAt    *time.Time `gorm:"index;type:timestamp"`
+	RevokeReason string     `gorm:"size:64"`
 }
 
 type CertificateDTO struct {
-	UID         string     `json:"uid"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	Login       string     `json:"login"`
-	Serial      string     `json:"serial"`
-	LastConnect *time.Time `json:"last_connect"`
+	UID          string     `json:"uid"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Login        string     `json:"login"`
+	Serial       string     `json:"serial"`
+	LastConnect  *time.Time `json:"last_connect"`
+	ValidTill    *time.Time `json:"valid_till,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokeReason string     `json:"revoke_reason,omitempty"`
+}
+
+func ValidRevokeReason(reason string) bool {
+	_, ok := revokeReasonCodes[reason]
+
+	return ok
+}
+
+func (c *Certificate) IsRevoked() bool {
+	return c != nil && c.RevokedAt != nil
+}
+
+func (c *Certificate) IsExpired() bool {
+	return c != nil && c.ValidTill != nil && c.ValidTill.Before(time.Now())
+}
+
+func (c *Certificate) Revoke(reason string) {
+	now := time.Now()
+	c.RevokedAt = &now
+	c.RevokeReason = reason
+}
+
+// RevocationEntry returns CRL entry for revoked certificate. Serial is a hex string as it is stored in database.
+func (c *Certificate) RevocationEntry() (x509.RevocationListEntry, error) {
+	b, err := hex.DecodeString(c.Serial)
+	if err != nil {
+		return x509.RevocationListEntry{}, err
+	}
+
+	e := x509.RevocationListEntry{
+		SerialNumber:   new(big.Int).SetBytes(b),
+		RevocationTime: *c.RevokedAt,
+		ReasonCode:     revokeReasonCodes[c.RevokeReason],
+	}
+
+	return e, nil
 }
 
 func (c *Certificate) DTO() *CertificateDTO {
@@ -29,11 +90,14 @@ func (c *Certificate) DTO() *CertificateDTO {
 	}
 
 	return &CertificateDTO{
-		UID:         c.UID,
-		CreatedAt:   c.CreatedAt,
-		UpdatedAt:   c.UpdatedAt,
-		Login:       c.Login,
-		Serial:      c.Serial,
-		LastConnect: c.LastConnect,
+		UID:          c.UID,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+		Login:        c.Login,
+		Serial:       c.Serial,
+		LastConnect:  c.LastConnect,
+		ValidTill:    c.ValidTill,
+		RevokedAt:    c.RevokedAt,
+		RevokeReason: c.RevokeReason,
 	}
 }
@@ -22,6 +22,8 @@ type Change struct {
 	ContentHash    string `gorm:"size:255"`
 	ResourceID     *uint
 	Resource       *Resource `gorm:"foreignKey:ResourceID"`
+	LogEntryID     *uint
+	LogEntry       *MissionLogEntry `gorm:"foreignKey:LogEntryID"`
 }
 
 func (c *Change) String() string {
@@ -37,5 +39,9 @@ func (c *Change) String() string {
 		return fmt.Sprintf("RESOURCE %s, mid: %d, uid: %s, %d", c.Type, c.MissionID, c.ContentUID, c.ResourceID)
 	}
 
+	if c.LogEntryID != nil {
+		return fmt.Sprintf("LOG %s, mid: %d, uid: %s, %d", c.Type, c.MissionID, c.ContentUID, c.LogEntryID)
+	}
+
 	return fmt.Sprintf("INVALID %s, mid: %d, uid: %s", c.Type, c.MissionID, c.ContentUID)
 }
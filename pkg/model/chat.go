@@ -25,17 +25,25 @@ type Chat struct {
 }
 
 type ChatMessage struct {
-	ID       string    `json:"message_id"`
-	Time     time.Time `json:"time"`
-	Parent   string    `json:"parent"`
-	Chatroom string    `json:"chatroom"`
-	From     string    `json:"from"`
-	FromUID  string    `json:"from_uid"`
-	ToUID    string    `json:"to_uid"`
+	ID       string    `gorm:"primaryKey;size:255" json:"message_id"`
+	Time     time.Time `gorm:"index;type:timestamp" json:"time"`
+	Scope    string    `gorm:"index;size:255" json:"scope,omitempty"`
+	Parent   string    `gorm:"size:255" json:"parent"`
+	Chatroom string    `gorm:"index;size:255" json:"chatroom"`
+	From     string    `gorm:"column:sender;size:255" json:"from"`
+	FromUID  string    `gorm:"index;size:255" json:"from_uid"`
+	ToUID    string    `gorm:"index;size:255" json:"to_uid"`
 	Direct   bool      `json:"direct"`
 	Text     string    `json:"text"`
 }
 
+// ChatroomDTO is a chatroom summary for chat history browsing.
+type ChatroomDTO struct {
+	Chatroom string    `json:"chatroom"`
+	Count    int64     `json:"count"`
+	Last     time.Time `json:"last"`
+}
+
 func NewChatMessages(myUID string) *ChatMessages {
 	msg := new(ChatMessages)
 	msg.uid = myUID
@@ -2,6 +2,7 @@ package model
 
 import (
 	"log/slog"
+	"slices"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -15,7 +16,10 @@ type Device struct {
 	Scope       string         `gorm:"not null;size:255" yaml:"scope"`
 	Disabled    bool           `gorm:"not null;default:false"`
 	Admin       bool           `gorm:"not null;default:false"`
+	SuperAdmin  bool           `gorm:"not null;default:false" yaml:"super_admin"`
+	Role        string         `gorm:"size:32" yaml:"role"`
 	ReadScope   []string       `gorm:"serializer:json" yaml:"read_scope"`
+	AuthSource  string         `gorm:"size:64" yaml:"-"`
 	LastConnect *time.Time     `gorm:"type:timestamp"`
 	Certs       []*Certificate `gorm:"foreignKey:Login"`
 	CreatedAt   time.Time      `gorm:"type:timestamp"`
@@ -27,17 +31,22 @@ type DeviceDTO struct {
 	Scope       string            `json:"scope"`
 	Disabled    bool              `json:"disabled"`
 	Admin       bool              `json:"admin,omitempty"`
+	SuperAdmin  bool              `json:"super_admin,omitempty"`
+	Role        string            `json:"role,omitempty"`
 	ReadScope   []string          `json:"read_scope,omitempty"`
+	AuthSource  string            `json:"auth_source,omitempty"`
 	LastConnect *time.Time        `json:"last_connect,omitempty"`
 	Certs       []*CertificateDTO `json:"certs,omitempty"`
 }
 
 type DevicePutDTO struct {
-	Admin     bool     `json:"admin,omitempty"`
-	Disabled  bool     `json:"disabled"`
-	Password  string   `json:"password,omitempty"`
-	Scope     string   `json:"scope,omitempty"`
-	ReadScope []string `json:"read_scope,omitempty"`
+	Admin      bool     `json:"admin,omitempty"`
+	SuperAdmin bool     `json:"super_admin,omitempty"`
+	Role       string   `json:"role,omitempty"`
+	Disabled   bool     `json:"disabled"`
+	Password   string   `json:"password,omitempty"`
+	Scope      string   `json:"scope,omitempty"`
+	ReadScope  []string `json:"read_scope,omitempty"`
 }
 
 type DevicePostDTO struct {
@@ -88,6 +97,58 @@ func (u *Device) CanSeeScope(scope string) bool {
 	return false
 }
 
+// AdminScopes returns scopes the user can see in admin api, "*" means all scopes.
+func (u *Device) AdminScopes() []string {
+	if u == nil {
+		return []string{""}
+	}
+
+	if u.IsSuperAdmin() {
+		return []string{"*"}
+	}
+
+	return append([]string{u.Scope}, u.ReadScope...)
+}
+
+func (u *Device) IsSuperAdmin() bool {
+	return u != nil && (u.SuperAdmin || (u.Admin && u.Role == ROLE_SUPERADMIN))
+}
+
+// GetRole returns admin role, admins without role set are superadmins or admins depending on super admin flag.
+func (u *Device) GetRole() string {
+	switch {
+	case u == nil:
+		return ""
+	case u.Role != "":
+		return u.Role
+	case u.SuperAdmin:
+		return ROLE_SUPERADMIN
+	default:
+		return ROLE_ADMIN
+	}
+}
+
+// Permissions returns admin permissions of the user, empty for non-admins.
+func (u *Device) Permissions() []string {
+	if !u.CanLogIn() {
+		return nil
+	}
+
+	return RolePermissions(u.GetRole())
+}
+
+func (u *Device) Can(perm string) bool {
+	return slices.Contains(u.Permissions(), perm)
+}
+
+func (u *Device) AdminCanSeeScope(scope string) bool {
+	if u.IsSuperAdmin() {
+		return true
+	}
+
+	return u.CanSeeScope(scope)
+}
+
 func (u *Device) CheckPassword(password string) bool {
 	if u == nil {
 		return false
@@ -140,7 +201,10 @@ func (u *Device) DTO() *DeviceDTO {
 		Scope:       u.Scope,
 		Disabled:    u.Disabled,
 		Admin:       u.Admin,
+		SuperAdmin:  u.SuperAdmin,
+		Role:        u.Role,
 		ReadScope:   u.ReadScope,
+		AuthSource:  u.AuthSource,
 		LastConnect: u.LastConnect,
 		Certs:       certs,
 	}
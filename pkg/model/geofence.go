@@ -0,0 +1,236 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+const (
+	GEOFENCE_POLYGON = "polygon"
+	GEOFENCE_CIRCLE  = "circle"
+
+	GEOFENCE_ENTER = "enter"
+	GEOFENCE_EXIT  = "exit"
+)
+
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type Geofence struct {
+	ID        uint        `gorm:"primaryKey"`
+	CreatedAt time.Time   `gorm:"type:timestamp"`
+	UpdatedAt time.Time   `gorm:"type:timestamp"`
+	Scope     string      `gorm:"index;size:255"`
+	Name      string      `gorm:"size:255"`
+	Kind      string      `gorm:"size:32"`
+	ShapeUID  string      `gorm:"index;size:255"`
+	Points    []*GeoPoint `gorm:"serializer:json"`
+	Lat       float64
+	Lon       float64
+	Radius    float64
+	Enabled   bool
+	Author    string `gorm:"size:255"`
+}
+
+type GeofenceEvent struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"index;type:timestamp"`
+	GeofenceID uint      `gorm:"index"`
+	Scope      string    `gorm:"index;size:255"`
+	UID        string    `gorm:"index;size:255"`
+	Callsign   string    `gorm:"size:255"`
+	Type       string    `gorm:"size:255"`
+	Event      string    `gorm:"size:32"`
+	Lat        float64
+	Lon        float64
+}
+
+type GeofenceDTO struct {
+	ID        uint        `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Scope     string      `json:"scope"`
+	Name      string      `json:"name"`
+	Kind      string      `json:"kind"`
+	ShapeUID  string      `json:"shape_uid,omitempty"`
+	Points    []*GeoPoint `json:"points,omitempty"`
+	Lat       float64     `json:"lat,omitempty"`
+	Lon       float64     `json:"lon,omitempty"`
+	Radius    float64     `json:"radius,omitempty"`
+	Enabled   bool        `json:"enabled"`
+	Author    string      `json:"author,omitempty"`
+}
+
+type GeofencePostDTO struct {
+	Scope    string      `json:"scope"`
+	Name     string      `json:"name"`
+	Kind     string      `json:"kind"`
+	ShapeUID string      `json:"shape_uid"`
+	Points   []*GeoPoint `json:"points"`
+	Lat      float64     `json:"lat"`
+	Lon      float64     `json:"lon"`
+	Radius   float64     `json:"radius"`
+	Enabled  bool        `json:"enabled"`
+}
+
+type GeofenceEventDTO struct {
+	ID         uint      `json:"id"`
+	Time       time.Time `json:"time"`
+	GeofenceID uint      `json:"geofence_id"`
+	Scope      string    `json:"scope"`
+	UID        string    `json:"uid"`
+	Callsign   string    `json:"callsign"`
+	Type       string    `json:"type"`
+	Event      string    `json:"event"`
+	Lat        float64   `json:"lat"`
+	Lon        float64   `json:"lon"`
+}
+
+func (g *Geofence) String() string {
+	return fmt.Sprintf("%d %s %s (%s)", g.ID, g.Kind, g.Name, g.Scope)
+}
+
+func (g *Geofence) Validate() error {
+	switch g.Kind {
+	case GEOFENCE_POLYGON:
+		if len(g.Points) < 3 {
+			return fmt.Errorf("polygon must have at least 3 points")
+		}
+	case GEOFENCE_CIRCLE:
+		if g.Radius <= 0 {
+			return fmt.Errorf("invalid radius")
+		}
+	default:
+		return fmt.Errorf("invalid geofence kind %s", g.Kind)
+	}
+
+	return nil
+}
+
+func (g *Geofence) Contains(lat, lon float64) bool {
+	switch g.Kind {
+	case GEOFENCE_CIRCLE:
+		d, _ := DistBea(g.Lat, g.Lon, lat, lon)
+
+		return d <= g.Radius
+	case GEOFENCE_POLYGON:
+		return pointInPolygon(g.Points, lat, lon)
+	}
+
+	return false
+}
+
+// UpdateFromShape takes fence geometry from drawing shape message (u-d-f, u-d-r or u-d-c-c).
+func (g *Geofence) UpdateFromShape(msg *cot.CotMessage) error {
+	if cot.MatchPattern(msg.GetType(), "u-d-c-c") {
+		e := msg.GetDetail().GetFirst("shape").GetFirst("ellipse")
+		if e == nil {
+			return fmt.Errorf("no ellipse in circle %s", msg.GetUID())
+		}
+
+		major, _ := strconv.ParseFloat(e.GetAttr("major"), 64)
+		minor, _ := strconv.ParseFloat(e.GetAttr("minor"), 64)
+
+		g.Kind = GEOFENCE_CIRCLE
+		g.Lat, g.Lon = msg.GetLatLon()
+		g.Radius = max(major, minor)
+		g.Points = nil
+	} else {
+		points := make([]*GeoPoint, 0)
+
+		for _, l := range msg.GetDetail().GetAll("link") {
+			if p := parseLinkPoint(l.GetAttr("point")); p != nil {
+				points = append(points, p)
+			}
+		}
+
+		g.Kind = GEOFENCE_POLYGON
+		g.Points = points
+		g.Lat, g.Lon, g.Radius = 0, 0, 0
+	}
+
+	g.ShapeUID = msg.GetUID()
+
+	if g.Name == "" {
+		g.Name = msg.GetCallsign()
+	}
+
+	if g.Scope == "" {
+		g.Scope = msg.Scope
+	}
+
+	return g.Validate()
+}
+
+func (g *Geofence) DTO() *GeofenceDTO {
+	return &GeofenceDTO{
+		ID:        g.ID,
+		CreatedAt: g.CreatedAt,
+		Scope:     g.Scope,
+		Name:      g.Name,
+		Kind:      g.Kind,
+		ShapeUID:  g.ShapeUID,
+		Points:    g.Points,
+		Lat:       g.Lat,
+		Lon:       g.Lon,
+		Radius:    g.Radius,
+		Enabled:   g.Enabled,
+		Author:    g.Author,
+	}
+}
+
+func (e *GeofenceEvent) DTO() *GeofenceEventDTO {
+	return &GeofenceEventDTO{
+		ID:         e.ID,
+		Time:       e.CreatedAt,
+		GeofenceID: e.GeofenceID,
+		Scope:      e.Scope,
+		UID:        e.UID,
+		Callsign:   e.Callsign,
+		Type:       e.Type,
+		Event:      e.Event,
+		Lat:        e.Lat,
+		Lon:        e.Lon,
+	}
+}
+
+func parseLinkPoint(s string) *GeoPoint {
+	parts := strings.Split(s, ",")
+	if len(parts) < 2 {
+		return nil
+	}
+
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lon, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+
+	return &GeoPoint{Lat: lat, Lon: lon}
+}
+
+// pointInPolygon is a ray casting test, polygon is closed implicitly.
+func pointInPolygon(poly []*GeoPoint, lat, lon float64) bool {
+	if len(poly) < 3 {
+		return false
+	}
+
+	inside := false
+
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		pi, pj := poly[i], poly[j]
+
+		if (pi.Lat > lat) != (pj.Lat > lat) &&
+			lon < (pj.Lon-pi.Lon)*(lat-pi.Lat)/(pj.Lat-pi.Lat)+pi.Lon {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+func getShapeMsg(typ string, lat, lon float64, detail string) *cot.CotMessage {
+	m := cot.BasicMsg(typ, "shape1", time.Minute)
+	m.CotEvent.Lat = lat
+	m.CotEvent.Lon = lon
+	xd, _ := cot.DetailsFromString(detail)
+	m.CotEvent.Detail = &cotproto.Detail{XmlDetail: xd.AsXMLString(), Contact: &cotproto.Contact{Callsign: "Shape 1"}} //nolint:exhaustruct
+
+	return &cot.CotMessage{TakMessage: m, Detail: xd, From: "", Scope: "scope1"}
+}
+
+func TestGeofenceContains(t *testing.T) {
+	poly := &Geofence{Kind: GEOFENCE_POLYGON, Points: []*GeoPoint{{10, 10}, {10, 20}, {20, 20}, {20, 10}}}
+	require.NoError(t, poly.Validate())
+
+	assert.True(t, poly.Contains(15, 15))
+	assert.False(t, poly.Contains(25, 15))
+	assert.False(t, poly.Contains(15, 5))
+
+	circle := &Geofence{Kind: GEOFENCE_CIRCLE, Lat: 50, Lon: 30, Radius: 1000}
+	require.NoError(t, circle.Validate())
+
+	assert.True(t, circle.Contains(50.005, 30))
+	assert.False(t, circle.Contains(50.01, 30))
+
+	require.Error(t, (&Geofence{Kind: GEOFENCE_POLYGON, Points: []*GeoPoint{{1, 1}, {2, 2}}}).Validate())
+	require.Error(t, (&Geofence{Kind: GEOFENCE_CIRCLE}).Validate())
+	require.Error(t, (&Geofence{Kind: "line"}).Validate())
+}
+
+func TestGeofenceFromShape(t *testing.T) {
+	f := new(Geofence)
+
+	rect := getShapeMsg("u-d-r", 15, 15, "<link point=\"10,10,0\"/><link point=\"10,20,0\"/><link point=\"20,20,0\"/><link point=\"20,10,0\"/>")
+	require.NoError(t, f.UpdateFromShape(rect))
+
+	assert.Equal(t, GEOFENCE_POLYGON, f.Kind)
+	assert.Equal(t, "Shape 1", f.Name)
+	assert.Equal(t, "scope1", f.Scope)
+	assert.Equal(t, "shape1", f.ShapeUID)
+	assert.Len(t, f.Points, 4)
+	assert.True(t, f.Contains(12, 12))
+
+	circle := getShapeMsg("u-d-c-c", 50, 30, "<shape><ellipse major=\"1000\" minor=\"1000\" angle=\"360\"/></shape>")
+	require.NoError(t, f.UpdateFromShape(circle))
+
+	assert.Equal(t, GEOFENCE_CIRCLE, f.Kind)
+	assert.Equal(t, 1000., f.Radius)
+	assert.Nil(t, f.Points)
+	assert.True(t, f.Contains(50.005, 30))
+
+	require.Error(t, f.UpdateFromShape(getShapeMsg("u-d-c-c", 50, 30, "")))
+}
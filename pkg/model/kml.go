@@ -0,0 +1,671 @@
+package model
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/util"
+)
+
+const (
+	KmlPointType   = "b-m-p-s-m"
+	KmlShapeType   = "u-d-f"
+	kmlDefaultIcon = "http://maps.google.com/mapfiles/kml/pushpin/wht-pushpin.png"
+	kmlStrokeColor = "-1"
+	kmlStrokeWidth = "3.0"
+	// KmlMaxSize is the max size of KML file, also of KML unpacked from KMZ
+	KmlMaxSize = 50 << 20
+)
+
+// KmlImportOpts are applied to all messages made from KML file.
+type KmlImportOpts struct {
+	// Source is used to make stable uids, so the second import of the same file updates items
+	Source          string
+	Scope           string
+	Stale           time.Duration
+	CreatorUID      string
+	CreatorCallsign string
+}
+
+type kmlIn struct {
+	kmlContainer
+}
+
+type kmlContainer struct {
+	Styles     []*kmlStyle       `xml:"Style"`
+	StyleMaps  []*kmlStyleMap    `xml:"StyleMap"`
+	Placemarks []*kmlPlacemarkIn `xml:"Placemark"`
+	Folders    []*kmlContainer   `xml:"Folder"`
+	Documents  []*kmlContainer   `xml:"Document"`
+}
+
+type kmlStyle struct {
+	ID        string        `xml:"id,attr,omitempty"`
+	IconStyle *kmlIconStyle `xml:"IconStyle,omitempty"`
+	LineStyle *kmlLineStyle `xml:"LineStyle,omitempty"`
+	PolyStyle *kmlPolyStyle `xml:"PolyStyle,omitempty"`
+}
+
+type kmlIconStyle struct {
+	Color string `xml:"color,omitempty"`
+	Href  string `xml:"Icon>href,omitempty"`
+}
+
+type kmlLineStyle struct {
+	Color string  `xml:"color,omitempty"`
+	Width float64 `xml:"width,omitempty"`
+}
+
+type kmlPolyStyle struct {
+	Color string `xml:"color,omitempty"`
+	Fill  *int   `xml:"fill,omitempty"`
+}
+
+type kmlStyleMap struct {
+	ID    string `xml:"id,attr"`
+	Pairs []struct {
+		Key      string `xml:"key"`
+		StyleURL string `xml:"styleUrl"`
+	} `xml:"Pair"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlCoords struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPolygon struct {
+	Outer string `xml:"outerBoundaryIs>LinearRing>coordinates"`
+}
+
+type kmlGeometry struct {
+	Points   []*kmlCoords   `xml:"Point"`
+	Lines    []*kmlCoords   `xml:"LineString"`
+	Rings    []*kmlCoords   `xml:"LinearRing"`
+	Polygons []*kmlPolygon  `xml:"Polygon"`
+	Multi    []*kmlGeometry `xml:"MultiGeometry"`
+}
+
+type kmlPlacemarkIn struct {
+	kmlGeometry
+	ID          string     `xml:"id,attr"`
+	Name        string     `xml:"name"`
+	Description string     `xml:"description"`
+	StyleURL    string     `xml:"styleUrl"`
+	Style       *kmlStyle  `xml:"Style"`
+	Data        []*kmlData `xml:"ExtendedData>Data"`
+}
+
+func (p *kmlPlacemarkIn) data(name string) string {
+	for _, d := range p.Data {
+		if d.Name == name {
+			return strings.TrimSpace(d.Value)
+		}
+	}
+
+	return ""
+}
+
+type kmlPoint struct {
+	Lat, Lon, Hae float64
+}
+
+type kmlShape struct {
+	points []*kmlPoint
+	closed bool
+}
+
+// ParseKML makes point and shape messages from KML or KMZ file.
+// Placemarks with Point become b-m-p-s-m points, LineString and Polygon - u-d-f shapes, polygons are closed.
+func ParseKML(data []byte, opts *KmlImportOpts) ([]*cot.CotMessage, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		var err error
+
+		if data, err = kmlFromKMZ(data); err != nil {
+			return nil, err
+		}
+	}
+
+	doc := new(kmlIn)
+	if err := xml.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+
+	styles := make(map[string]*kmlStyle)
+	maps := make(map[string]string)
+	placemarks := make([]*kmlPlacemarkIn, 0)
+
+	var walk func(c *kmlContainer)
+
+	walk = func(c *kmlContainer) {
+		for _, s := range c.Styles {
+			styles[s.ID] = s
+		}
+
+		for _, m := range c.StyleMaps {
+			for _, p := range m.Pairs {
+				if p.Key == "normal" {
+					maps[m.ID] = strings.TrimPrefix(p.StyleURL, "#")
+				}
+			}
+		}
+
+		placemarks = append(placemarks, c.Placemarks...)
+
+		for _, f := range c.Folders {
+			walk(f)
+		}
+
+		for _, d := range c.Documents {
+			walk(d)
+		}
+	}
+
+	walk(&doc.kmlContainer)
+
+	if opts.Stale == 0 {
+		opts.Stale = time.Hour * 24 * 365
+	}
+
+	res := make([]*cot.CotMessage, 0, len(placemarks))
+
+	for i, p := range placemarks {
+		style := p.Style
+
+		if style == nil {
+			id := strings.TrimPrefix(p.StyleURL, "#")
+			if m, ok := maps[id]; ok {
+				id = m
+			}
+
+			style = styles[id]
+		}
+
+		key := p.ID
+		if key == "" {
+			key = strconv.Itoa(i)
+		}
+
+		res = append(res, placemarkToMsgs(p, style, opts, key)...)
+	}
+
+	if len(res) == 0 {
+		return nil, errors.New("no placemarks found")
+	}
+
+	return res, nil
+}
+
+func kmlFromKMZ(data []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var f *zip.File
+
+	for _, zf := range zr.File {
+		if strings.EqualFold(path.Ext(zf.Name), ".kml") {
+			// doc.kml is the main file by convention, the first kml file otherwise
+			if f == nil || strings.EqualFold(path.Base(zf.Name), "doc.kml") {
+				f = zf
+			}
+		}
+	}
+
+	if f == nil {
+		return nil, errors.New("no kml file in kmz")
+	}
+
+	if f.UncompressedSize64 > KmlMaxSize {
+		return nil, errors.New("kml file in kmz is too big")
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	b, err := io.ReadAll(io.LimitReader(r, KmlMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) > KmlMaxSize {
+		return nil, errors.New("kml file in kmz is too big")
+	}
+
+	return b, nil
+}
+
+func placemarkToMsgs(p *kmlPlacemarkIn, style *kmlStyle, opts *KmlImportOpts, key string) []*cot.CotMessage {
+	points := make([]*kmlPoint, 0)
+
+	shapes := make([]*kmlShape, 0)
+
+	var collect func(g *kmlGeometry)
+
+	collect = func(g *kmlGeometry) {
+		for _, c := range g.Points {
+			if pts := parseKmlCoords(c.Coordinates); len(pts) > 0 {
+				points = append(points, pts[0])
+			}
+		}
+
+		for _, c := range g.Lines {
+			if pts := parseKmlCoords(c.Coordinates); len(pts) > 1 {
+				shapes = append(shapes, &kmlShape{points: pts})
+			}
+		}
+
+		for _, c := range g.Rings {
+			if pts := parseKmlCoords(c.Coordinates); len(pts) > 2 {
+				shapes = append(shapes, &kmlShape{points: pts, closed: true})
+			}
+		}
+
+		for _, c := range g.Polygons {
+			if pts := parseKmlCoords(c.Outer); len(pts) > 2 {
+				shapes = append(shapes, &kmlShape{points: pts, closed: true})
+			}
+		}
+
+		for _, m := range g.Multi {
+			collect(m)
+		}
+	}
+
+	collect(&p.kmlGeometry)
+
+	res := make([]*cot.CotMessage, 0, len(points)+len(shapes))
+	n := 0
+
+	uid := func() string {
+		n++
+
+		if u := p.data("uid"); u != "" && len(points)+len(shapes) == 1 {
+			return u
+		}
+
+		return uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("%s#%s#%d", opts.Source, key, n))).String()
+	}
+
+	for _, pt := range points {
+		typ := KmlPointType
+		if t := p.data("type"); t != "" && !strings.HasPrefix(t, "u-d-") {
+			typ = t
+		}
+
+		msg := newKmlMsg(typ, uid(), pt.Lat, pt.Lon, p, opts)
+		msg.GetTakMessage().GetCotEvent().Hae = pt.Hae
+
+		if style != nil && style.IconStyle != nil {
+			if argb, ok := kmlColorToArgb(style.IconStyle.Color); ok {
+				msg.Detail.AddOrChangeChild("color", map[string]string{"argb": argb})
+			}
+		}
+
+		if iconset := util.FirstString(p.data("iconsetpath"), spotIconset(msg)); iconset != "" {
+			msg.Detail.AddOrChangeChild("usericon", map[string]string{"iconsetpath": iconset})
+		}
+
+		res = append(res, finishKmlMsg(msg))
+	}
+
+	for _, s := range shapes {
+		lat, lon := centroid(s.points)
+		msg := newKmlMsg(KmlShapeType, uid(), lat, lon, p, opts)
+
+		for _, pt := range s.points {
+			msg.Detail.AddChild("link", map[string]string{"point": fmt.Sprintf("%f,%f,%.1f", pt.Lat, pt.Lon, pt.Hae)}, "")
+		}
+
+		if s.closed && !samePoint(s.points[0], s.points[len(s.points)-1]) {
+			pt := s.points[0]
+			msg.Detail.AddChild("link", map[string]string{"point": fmt.Sprintf("%f,%f,%.1f", pt.Lat, pt.Lon, pt.Hae)}, "")
+		}
+
+		stroke, width := kmlStrokeColor, kmlStrokeWidth
+
+		if style != nil && style.LineStyle != nil {
+			if argb, ok := kmlColorToArgb(style.LineStyle.Color); ok {
+				stroke = argb
+			}
+
+			if style.LineStyle.Width > 0 {
+				width = fmt.Sprintf("%.1f", style.LineStyle.Width)
+			}
+		}
+
+		msg.Detail.AddChild("strokeColor", map[string]string{"value": stroke}, "")
+		msg.Detail.AddChild("strokeWeight", map[string]string{"value": width}, "")
+
+		if s.closed && style != nil && style.PolyStyle != nil && (style.PolyStyle.Fill == nil || *style.PolyStyle.Fill != 0) {
+			if argb, ok := kmlColorToArgb(style.PolyStyle.Color); ok {
+				msg.Detail.AddChild("fillColor", map[string]string{"value": argb}, "")
+			}
+		}
+
+		msg.Detail.AddChild("labels_on", map[string]string{"value": "true"}, "")
+
+		res = append(res, finishKmlMsg(msg))
+	}
+
+	return res
+}
+
+//nolint:exhaustruct
+func newKmlMsg(typ, uid string, lat, lon float64, p *kmlPlacemarkIn, opts *KmlImportOpts) *cot.CotMessage {
+	tak := cot.BasicMsg(typ, uid, opts.Stale)
+	tak.CotEvent.How = "h-e"
+	tak.CotEvent.Lat = lat
+	tak.CotEvent.Lon = lon
+	tak.CotEvent.Detail = &cotproto.Detail{Contact: &cotproto.Contact{Callsign: util.FirstString(strings.TrimSpace(p.Name), uid)}}
+
+	xd := cot.NewXMLDetails()
+
+	if opts.CreatorUID != "" {
+		xd.AddPpLink(opts.CreatorUID, "", opts.CreatorCallsign)
+	}
+
+	xd.AddChild("archive", nil, "")
+
+	if d := strings.TrimSpace(p.Description); d != "" {
+		xd.AddChild("remarks", nil, d)
+	}
+
+	return &cot.CotMessage{Scope: opts.Scope, TakMessage: tak, Detail: xd}
+}
+
+func finishKmlMsg(msg *cot.CotMessage) *cot.CotMessage {
+	msg.TakMessage = msg.GetUpdatedTakMessage()
+
+	return msg
+}
+
+// spotIconset is the iconset of colored ATAK spot map marker.
+func spotIconset(msg *cot.CotMessage) string {
+	if msg.GetType() != KmlPointType {
+		return ""
+	}
+
+	if c := msg.GetColor(); c != "" {
+		return "COT_MAPPING_SPOTMAP/" + KmlPointType + "/" + c
+	}
+
+	return ""
+}
+
+// parseKmlCoords parses "lon,lat[,alt] lon,lat[,alt]..." string.
+func parseKmlCoords(s string) []*kmlPoint {
+	res := make([]*kmlPoint, 0)
+
+	for _, tuple := range strings.Fields(s) {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			continue
+		}
+
+		lon, err1 := strconv.ParseFloat(parts[0], 64)
+		lat, err2 := strconv.ParseFloat(parts[1], 64)
+
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		pt := &kmlPoint{Lat: lat, Lon: lon}
+
+		if len(parts) > 2 {
+			pt.Hae, _ = strconv.ParseFloat(parts[2], 64)
+		}
+
+		res = append(res, pt)
+	}
+
+	return res
+}
+
+func samePoint(a, b *kmlPoint) bool {
+	return a.Lat == b.Lat && a.Lon == b.Lon
+}
+
+func centroid(points []*kmlPoint) (float64, float64) {
+	var lat, lon float64
+
+	for _, p := range points {
+		lat += p.Lat
+		lon += p.Lon
+	}
+
+	return lat / float64(len(points)), lon / float64(len(points))
+}
+
+// kmlColorToArgb converts KML aabbggrr color to CoT signed argb integer.
+func kmlColorToArgb(s string) (string, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 8 {
+		return "", false
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return "", false
+	}
+
+	a, b, g, r := (v>>24)&0xff, (v>>16)&0xff, (v>>8)&0xff, v&0xff
+
+	return strconv.Itoa(int(int32(uint32(a<<24 | r<<16 | g<<8 | b)))), true //nolint:gosec
+}
+
+// argbToKmlColor converts CoT signed argb integer to KML aabbggrr color.
+func argbToKmlColor(s string) (string, bool) {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return "", false
+	}
+
+	u := uint32(v) //nolint:gosec
+	a, r, g, b := (u>>24)&0xff, (u>>16)&0xff, (u>>8)&0xff, u&0xff
+
+	return fmt.Sprintf("%02x%02x%02x%02x", a, b, g, r), true
+}
+
+type kmlPlacemarkOut struct {
+	Name        string      `xml:"name"`
+	Description string      `xml:"description,omitempty"`
+	Style       *kmlStyle   `xml:"Style,omitempty"`
+	Data        []*kmlData  `xml:"ExtendedData>Data,omitempty"`
+	Point       *kmlCoords  `xml:"Point,omitempty"`
+	LineString  *kmlCoords  `xml:"LineString,omitempty"`
+	Polygon     *kmlPolygon `xml:"Polygon,omitempty"`
+}
+
+type kmlDocOut struct {
+	XMLName    xml.Name           `xml:"kml"`
+	Xmlns      string             `xml:"xmlns,attr"`
+	Name       string             `xml:"Document>name"`
+	Placemarks []*kmlPlacemarkOut `xml:"Document>Placemark"`
+}
+
+// WriteKMZ writes points and shapes as KMZ with doc.kml inside.
+func WriteKMZ(w io.Writer, name string, msgs []*cot.CotMessage) error {
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create("doc.kml")
+	if err != nil {
+		return err
+	}
+
+	if err := WriteKMLDoc(f, name, msgs); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// WriteKMLDoc writes points and shapes as KML placemarks, cot type, uid and iconset are kept in ExtendedData.
+// u-d-f shapes are written as LineString or Polygon if closed, rectangles as Polygon, circles as Polygon approximation.
+func WriteKMLDoc(w io.Writer, name string, msgs []*cot.CotMessage) error {
+	doc := &kmlDocOut{Xmlns: "http://www.opengis.net/kml/2.2", Name: name}
+
+	for _, msg := range msgs {
+		if p := msgToPlacemark(msg); p != nil {
+			doc.Placemarks = append(doc.Placemarks, p)
+		}
+	}
+
+	return writeXML(w, doc)
+}
+
+func msgToPlacemark(msg *cot.CotMessage) *kmlPlacemarkOut {
+	evt := msg.GetTakMessage().GetCotEvent()
+	if evt == nil {
+		return nil
+	}
+
+	p := &kmlPlacemarkOut{
+		Name:        util.FirstString(msg.GetCallsign(), msg.GetUID()),
+		Description: msg.GetDetail().GetFirst("remarks").GetText(),
+		Data: []*kmlData{
+			{Name: "uid", Value: msg.GetUID()},
+			{Name: "type", Value: msg.GetType()},
+		},
+	}
+
+	if iconset := msg.GetIconsetPath(); iconset != "" {
+		p.Data = append(p.Data, &kmlData{Name: "iconsetpath", Value: iconset})
+	}
+
+	points := make([]string, 0)
+	for _, l := range msg.GetDetail().GetAll("link") {
+		if pt := l.GetAttr("point"); pt != "" {
+			points = append(points, linkToKmlCoord(pt))
+		}
+	}
+
+	switch {
+	case cot.MatchPattern(msg.GetType(), "u-d-c-c"):
+		e := msg.GetDetail().GetFirst("shape").GetFirst("ellipse")
+		major, _ := strconv.ParseFloat(e.GetAttr("major"), 64)
+		minor, _ := strconv.ParseFloat(e.GetAttr("minor"), 64)
+
+		if r := max(major, minor); r > 0 {
+			p.Polygon = &kmlPolygon{Outer: circleCoords(evt.GetLat(), evt.GetLon(), r)}
+		}
+	case cot.MatchAnyPattern(msg.GetType(), "u-d-f", "u-d-r") && len(points) > 1:
+		coords := strings.Join(points, " ")
+		closed := points[0] == points[len(points)-1]
+
+		if msg.GetType() == "u-d-r" && !closed {
+			coords += " " + points[0]
+			closed = true
+		}
+
+		if closed && len(points) > 2 {
+			p.Polygon = &kmlPolygon{Outer: coords}
+		} else {
+			p.LineString = &kmlCoords{Coordinates: coords}
+		}
+	default:
+		if evt.GetLat() == 0 && evt.GetLon() == 0 {
+			return nil
+		}
+
+		p.Point = &kmlCoords{Coordinates: fmt.Sprintf("%f,%f,%.1f", evt.GetLon(), evt.GetLat(), hae(evt.GetHae()))}
+	}
+
+	p.Style = msgStyle(msg, p)
+
+	return p
+}
+
+func msgStyle(msg *cot.CotMessage, p *kmlPlacemarkOut) *kmlStyle {
+	style := new(kmlStyle)
+
+	if p.Point != nil {
+		style.IconStyle = &kmlIconStyle{Href: kmlDefaultIcon}
+
+		if c, ok := argbToKmlColor(msg.GetColor()); ok {
+			style.IconStyle.Color = c
+		}
+
+		return style
+	}
+
+	style.LineStyle = new(kmlLineStyle)
+
+	if c, ok := argbToKmlColor(msg.GetDetail().GetFirst("strokeColor").GetAttr("value")); ok {
+		style.LineStyle.Color = c
+	}
+
+	style.LineStyle.Width, _ = strconv.ParseFloat(msg.GetDetail().GetFirst("strokeWeight").GetAttr("value"), 64)
+
+	if p.Polygon != nil {
+		fill := 0
+		style.PolyStyle = &kmlPolyStyle{Fill: &fill}
+
+		if c, ok := argbToKmlColor(msg.GetDetail().GetFirst("fillColor").GetAttr("value")); ok {
+			fill = 1
+			style.PolyStyle.Color = c
+		}
+	}
+
+	return style
+}
+
+func hae(h float64) float64 {
+	if h == cot.NotNum || math.IsNaN(h) {
+		return 0
+	}
+
+	return h
+}
+
+// linkToKmlCoord converts "lat,lon[,hae]" link point to "lon,lat,hae".
+func linkToKmlCoord(s string) string {
+	parts := strings.Split(s, ",")
+	if len(parts) < 2 {
+		return ""
+	}
+
+	h := "0"
+	if len(parts) > 2 {
+		h = strings.TrimSpace(parts[2])
+	}
+
+	return strings.TrimSpace(parts[1]) + "," + strings.TrimSpace(parts[0]) + "," + h
+}
+
+func circleCoords(lat, lon, radius float64) string {
+	const steps = 36
+
+	pts := make([]string, 0, steps+1)
+
+	for i := 0; i <= steps; i++ {
+		a := 2 * math.Pi * float64(i%steps) / steps
+		dLat := radius * math.Cos(a) / 111320
+		dLon := radius * math.Sin(a) / (111320 * math.Cos(lat*math.Pi/180))
+		pts = append(pts, fmt.Sprintf("%f,%f,0", lon+dLon, lat+dLat))
+	}
+
+	return strings.Join(pts, " ")
+}
@@ -0,0 +1,172 @@
+package model
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+const testKml = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+<Document>
+  <name>test</name>
+  <Style id="red">
+    <IconStyle><color>ff0000ff</color></IconStyle>
+    <LineStyle><color>ff00ff00</color><width>5</width></LineStyle>
+    <PolyStyle><color>7fff0000</color></PolyStyle>
+  </Style>
+  <StyleMap id="redmap">
+    <Pair><key>normal</key><styleUrl>#red</styleUrl></Pair>
+    <Pair><key>highlight</key><styleUrl>#other</styleUrl></Pair>
+  </StyleMap>
+  <Folder>
+    <name>folder</name>
+    <Placemark>
+      <name>point 1</name>
+      <description>some text</description>
+      <styleUrl>#redmap</styleUrl>
+      <Point><coordinates>30.5,50.25,100</coordinates></Point>
+    </Placemark>
+    <Placemark>
+      <name>line</name>
+      <styleUrl>#red</styleUrl>
+      <LineString><coordinates>30,50,0 31,50,0
+        31,51,0</coordinates></LineString>
+    </Placemark>
+  </Folder>
+  <Placemark>
+    <name>area</name>
+    <styleUrl>#red</styleUrl>
+    <Polygon><outerBoundaryIs><LinearRing><coordinates>30,50 31,50 31,51 30,50</coordinates></LinearRing></outerBoundaryIs></Polygon>
+  </Placemark>
+</Document>
+</kml>`
+
+func byCallsign(msgs []*cot.CotMessage) map[string]*cot.CotMessage {
+	res := make(map[string]*cot.CotMessage)
+
+	for _, m := range msgs {
+		res[m.GetCallsign()] = m
+	}
+
+	return res
+}
+
+func linkPoints(m *cot.CotMessage) int {
+	n := 0
+
+	for _, l := range m.GetDetail().GetAll("link") {
+		if l.GetAttr("point") != "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestKmlColors(t *testing.T) {
+	argb, ok := kmlColorToArgb("ff0000ff")
+	require.True(t, ok)
+	assert.Equal(t, "-65536", argb)
+
+	c, ok := argbToKmlColor("-65536")
+	require.True(t, ok)
+	assert.Equal(t, "ff0000ff", c)
+
+	c, ok = argbToKmlColor("-1")
+	require.True(t, ok)
+	assert.Equal(t, "ffffffff", c)
+
+	_, ok = kmlColorToArgb("red")
+	assert.False(t, ok)
+}
+
+func TestParseKML(t *testing.T) {
+	opts := &KmlImportOpts{Source: "test.kml", Scope: "scope1", CreatorUID: "admin", CreatorCallsign: "Admin"}
+
+	msgs, err := ParseKML([]byte(testKml), opts)
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+
+	items := byCallsign(msgs)
+
+	p := items["point 1"]
+	require.NotNil(t, p)
+	assert.Equal(t, KmlPointType, p.GetType())
+	assert.Equal(t, "point 1", p.GetCallsign())
+	assert.Equal(t, "scope1", p.Scope)
+	assert.InDelta(t, 50.25, p.GetLat(), 0.0001)
+	assert.InDelta(t, 30.5, p.GetLon(), 0.0001)
+	assert.Equal(t, "-65536", p.GetColor())
+	assert.Equal(t, "COT_MAPPING_SPOTMAP/b-m-p-s-m/-65536", p.GetIconsetPath())
+	assert.Equal(t, "some text", p.GetDetail().GetFirst("remarks").GetText())
+	assert.Contains(t, p.GetTakMessage().GetCotEvent().GetDetail().GetXmlDetail(), "usericon")
+
+	parent, _ := p.GetParent()
+	assert.Equal(t, "admin", parent)
+
+	line := items["line"]
+	require.NotNil(t, line)
+	assert.Equal(t, KmlShapeType, line.GetType())
+	assert.Equal(t, 3, linkPoints(line))
+	assert.Equal(t, "-16711936", line.GetDetail().GetFirst("strokeColor").GetAttr("value"))
+	assert.Equal(t, "5.0", line.GetDetail().GetFirst("strokeWeight").GetAttr("value"))
+	assert.Nil(t, line.GetDetail().GetFirst("fillColor"))
+
+	area := items["area"]
+	require.NotNil(t, area)
+	assert.Equal(t, 4, linkPoints(area))
+	assert.Equal(t, "2130706687", area.GetDetail().GetFirst("fillColor").GetAttr("value"))
+
+	// uids are stable
+	msgs2, err := ParseKML([]byte(testKml), opts)
+	require.NoError(t, err)
+	assert.Equal(t, line.GetUID(), byCallsign(msgs2)["line"].GetUID())
+
+	_, err = ParseKML([]byte("<kml></kml>"), opts)
+	require.Error(t, err)
+}
+
+func TestKMZRoundTrip(t *testing.T) {
+	msgs, err := ParseKML([]byte(testKml), &KmlImportOpts{Source: "test.kml"})
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, WriteKMZ(&b, "export", msgs))
+
+	msgs2, err := ParseKML(b.Bytes(), &KmlImportOpts{Source: "other.kmz"})
+	require.NoError(t, err)
+	require.Len(t, msgs2, 3)
+
+	for i, m := range msgs {
+		assert.Equal(t, m.GetUID(), msgs2[i].GetUID())
+		assert.Equal(t, m.GetType(), msgs2[i].GetType())
+		assert.Equal(t, m.GetCallsign(), msgs2[i].GetCallsign())
+		assert.Equal(t, m.GetColor(), msgs2[i].GetColor())
+		assert.Equal(t, linkPoints(m), linkPoints(msgs2[i]))
+	}
+
+	items := byCallsign(msgs2)
+	assert.Equal(t, "-16711936", items["line"].GetDetail().GetFirst("strokeColor").GetAttr("value"))
+	assert.Equal(t, "2130706687", items["area"].GetDetail().GetFirst("fillColor").GetAttr("value"))
+}
+
+func TestKMZTooBig(t *testing.T) {
+	var b bytes.Buffer
+
+	zw := zip.NewWriter(&b)
+	w, err := zw.Create("doc.kml")
+	require.NoError(t, err)
+
+	_, err = w.Write(make([]byte, KmlMaxSize+1))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	_, err = ParseKML(b.Bytes(), &KmlImportOpts{Source: "big.kmz"})
+	require.ErrorContains(t, err, "too big")
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"strconv"
 	"time"
 
@@ -18,7 +19,13 @@ func MissionChangeNotificationMsg(missionName string, scope string, c *Change) *
 
 	xd := cot.NewXMLDetails()
 
-	ch := xd.AddChild("mission", map[string]string{"type": "CHANGE", "name": missionName}, "").
+	// log entry changes are announced with LOG type, client fetches the log after it
+	typ := "CHANGE"
+	if c.LogEntryID != nil {
+		typ = "LOG"
+	}
+
+	ch := xd.AddChild("mission", map[string]string{"type": typ, "name": missionName}, "").
 		AddChild("MissionChanges", nil, "").AddChild("MissionChange", nil, "")
 
 	ch.AddChild("contentUid", nil, c.ContentUID)
@@ -50,3 +57,37 @@ func MissionCreateNotificationMsg(m *Mission) *cot.CotMessage {
 
 	return &cot.CotMessage{From: cot.LocalFrom, TakMessage: msg, Detail: xd, Scope: m.Scope}
 }
+
+// MissionInviteNotificationMsg has the same uid for the same mission and invitee, so repeated invitation
+// replaces undelivered one.
+func MissionInviteNotificationMsg(m *Mission, inv *Invitation) *cot.CotMessage {
+	msg := cot.BasicMsg("t-x-m-i", fmt.Sprintf("%s-invite-%s", m.Name, inv.Invitee), missionNotificationStale)
+	msg.CotEvent.How = "h-g-i-g-o"
+
+	xd := cot.NewXMLDetails()
+
+	params := map[string]string{"type": "INVITE", "name": m.Name, "authorUid": inv.CreatorUID}
+
+	if m.Tool != "" {
+		params["tool"] = m.Tool
+	}
+
+	if m.Token != "" {
+		params["token"] = m.Token
+	}
+
+	role := GetRole(inv.Role)
+	r := xd.AddChild("mission", params, "").AddChild("role", map[string]string{"type": role.Type}, "")
+
+	if len(role.Permissions) > 0 {
+		p := r.AddChild("permissions", nil, "")
+
+		for _, perm := range role.Permissions {
+			p.AddChild("permission", map[string]string{"type": perm}, "")
+		}
+	}
+
+	msg.CotEvent.Detail = &cotproto.Detail{XmlDetail: xd.AsXMLString()}
+
+	return &cot.CotMessage{From: cot.LocalFrom, TakMessage: msg, Detail: xd, Scope: m.Scope}
+}
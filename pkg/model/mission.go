@@ -1,7 +1,10 @@
 package model
 
 import (
+	"strings"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Mission struct {
@@ -27,3 +30,34 @@ type Mission struct {
 	Points         []*Point    `gorm:"many2many:mission_points;"`
 	Token          string      `gorm:"size:255"`
 }
+
+// SetPassword stores bcrypt hash of the password, empty password removes the protection.
+func (m *Mission) SetPassword(password string) error {
+	if password == "" {
+		m.Password = ""
+
+		return nil
+	}
+
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return err
+	}
+
+	m.Password = string(b)
+
+	return nil
+}
+
+func (m *Mission) CheckPassword(password string) bool {
+	if m.Password == "" {
+		return true
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(m.Password), []byte(password)) == nil
+}
+
+// PasswordHashed is false for passwords stored before hashing was added.
+func (m *Mission) PasswordHashed() bool {
+	return m.Password == "" || strings.HasPrefix(m.Password, "$2")
+}
@@ -25,6 +25,7 @@ func (x *CotTime) UnmarshalText(text []byte) error {
 }
 
 type MissionDTO struct {
+	ID                uint               `json:"id,omitempty"`
 	Name              string             `json:"name"`
 	Scope             string             `json:"scope,omitempty"`
 	CreatorUID        string             `json:"creatorUid"`
@@ -91,15 +92,16 @@ type MissionSubscriptionDTO struct {
 }
 
 type MissionChangeDTO struct {
-	Type            string             `json:"type"`
-	MissionName     string             `json:"missionName"`
-	Timestamp       CotTime            `json:"timestamp"`
-	CreatorUID      string             `json:"creatorUid"`
-	ServerTime      CotTime            `json:"serverTime"`
-	ContentUID      string             `json:"contentUid,omitempty"`
-	ContentHash     string             `json:"contentHash,omitempty"`
-	Details         *MissionDetailsDTO `json:"details,omitempty"`
-	ContentResource *ResourceDTO       `json:"contentResource,omitempty"`
+	Type            string              `json:"type"`
+	MissionName     string              `json:"missionName"`
+	Timestamp       CotTime             `json:"timestamp"`
+	CreatorUID      string              `json:"creatorUid"`
+	ServerTime      CotTime             `json:"serverTime"`
+	ContentUID      string              `json:"contentUid,omitempty"`
+	ContentHash     string              `json:"contentHash,omitempty"`
+	Details         *MissionDetailsDTO  `json:"details,omitempty"`
+	ContentResource *ResourceDTO        `json:"contentResource,omitempty"`
+	LogEntry        *MissionLogEntryDTO `json:"logEntry,omitempty"`
 }
 
 type MissionDetailsDTO struct {
@@ -189,6 +191,7 @@ func ToMissionDTOFull(m *Mission, withToken bool, withScope bool) *MissionDTO {
 	}
 
 	if withScope {
+		mDTO.ID = m.ID
 		mDTO.Scope = m.Scope
 	}
 
@@ -274,6 +277,10 @@ func ToChangeDTO(c *Change, name string) *MissionChangeDTO {
 		cd.ContentResource = ToResourceDTO(r)
 	}
 
+	if l := c.LogEntry; l != nil {
+		cd.LogEntry = ToMissionLogEntryDTO(l, []string{name})
+	}
+
 	return cd
 }
 
@@ -345,13 +352,29 @@ func NewRole(typ string, perms ...string) *MissionRoleDTO {
 
 func GetRole(name string) *MissionRoleDTO {
 	switch name {
-	case "MISSION_OWNER":
-		return NewRole(name, "MISSION_MANAGE_FEEDS", "MISSION_SET_PASSWORD",
-			"MISSION_WRITE", "MISSION_MANAGE_LAYERS", "MISSION_UPDATE_GROUPS", "MISSION_READ", "MISSION_DELETE",
-			"MISSION_SET_ROLE")
-	case "MISSION_SUBSCRIBER", "":
-		return NewRole("MISSION_SUBSCRIBER", "MISSION_WRITE", "MISSION_READ")
+	case RoleOwner, roleCreator:
+		return NewRole(RoleOwner, "MISSION_MANAGE_FEEDS", PermSetPassword,
+			PermWrite, "MISSION_MANAGE_LAYERS", "MISSION_UPDATE_GROUPS", PermRead, PermDelete,
+			PermSetRole)
+	case RoleSubscriber, "":
+		return NewRole(RoleSubscriber, PermWrite, PermRead)
+	case RoleReadOnly:
+		return NewRole(RoleReadOnly, PermRead)
 	default:
 		return NewRole(name)
 	}
 }
+
+func (r *MissionRoleDTO) Has(perm string) bool {
+	if r == nil {
+		return false
+	}
+
+	for _, p := range r.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// MissionLogEntry is an entry of the mission log. ATAK can post one entry to several missions,
+// it is stored as a row per mission with the same UID.
+type MissionLogEntry struct {
+	ID            uint      `gorm:"primaryKey"`
+	CreatedAt     time.Time `gorm:"type:timestamp"`
+	UpdatedAt     time.Time `gorm:"type:timestamp"`
+	UID           string    `gorm:"size:255;not null;uniqueIndex:idx_log_uid_mission"`
+	MissionID     uint      `gorm:"not null;uniqueIndex:idx_log_uid_mission"`
+	Mission       *Mission  `gorm:"foreignKey:MissionID"`
+	Scope         string    `gorm:"index;not null;size:255"`
+	EntryUID      string    `gorm:"size:255"`
+	CreatorUID    string    `gorm:"size:255"`
+	Content       string
+	Dtg           time.Time `gorm:"type:timestamp"`
+	Keywords      string
+	ContentHashes string
+}
+
+func (e *MissionLogEntry) UpdateFromDTO(d *MissionLogEntryDTO) {
+	e.EntryUID = d.EntryUID
+	e.Content = d.Content
+	e.Keywords = strings.Join(d.Keywords, ",")
+	e.ContentHashes = strings.Join(d.ContentHashes, ",")
+
+	if e.CreatorUID == "" {
+		e.CreatorUID = d.CreatorUID
+	}
+
+	switch {
+	case !d.Dtg.IsZero():
+		e.Dtg = d.Dtg
+	case e.Dtg.IsZero():
+		e.Dtg = time.Now()
+	}
+}
+
+func ToMissionLogEntryDTO(e *MissionLogEntry, missions []string) *MissionLogEntryDTO {
+	return &MissionLogEntryDTO{
+		Content:       e.Content,
+		ContentHashes: splitList(e.ContentHashes),
+		Created:       e.CreatedAt,
+		CreatorUID:    e.CreatorUID,
+		Dtg:           e.Dtg,
+		ID:            e.UID,
+		Keywords:      splitList(e.Keywords),
+		MissionNames:  missions,
+		Servertime:    e.UpdatedAt,
+		EntryUID:      e.EntryUID,
+	}
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+
+	return strings.Split(s, ",")
+}
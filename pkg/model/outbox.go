@@ -0,0 +1,111 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+// OutboxMessage is a message for offline contact. It is sent when contact with given uid or callsign connects.
+// The same CoT uid for the same recipient replaces the old message.
+type OutboxMessage struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index;type:timestamp"`
+	UpdatedAt time.Time `gorm:"type:timestamp"`
+	ExpiresAt time.Time `gorm:"index;type:timestamp"`
+	UID       string    `gorm:"uniqueIndex:idx_outbox_dest;size:255"`
+	Callsign  string    `gorm:"uniqueIndex:idx_outbox_dest;size:255"`
+	MsgUID    string    `gorm:"uniqueIndex:idx_outbox_dest;size:255"`
+	Scope     string    `gorm:"index;size:255"`
+	Type      string    `gorm:"size:255"`
+	Sender    string    `gorm:"size:255"`
+	MsgData   []byte
+}
+
+type OutboxMessageDTO struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UID       string    `json:"uid,omitempty"`
+	Callsign  string    `json:"callsign,omitempty"`
+	MsgUID    string    `json:"msg_uid"`
+	Scope     string    `json:"scope"`
+	Type      string    `json:"type"`
+	Sender    string    `json:"sender,omitempty"`
+	Text      string    `json:"text,omitempty"`
+}
+
+func NewOutboxMessage(uid, callsign string, msg *cot.CotMessage, ttl time.Duration) (*OutboxMessage, error) {
+	b, err := proto.Marshal(msg.GetTakMessage())
+	if err != nil {
+		return nil, err
+	}
+
+	return &OutboxMessage{
+		ExpiresAt: time.Now().Add(ttl),
+		UID:       uid,
+		Callsign:  callsign,
+		MsgUID:    msg.GetUID(),
+		Scope:     msg.Scope,
+		Type:      msg.GetType(),
+		Sender:    msg.GetCallsign(),
+		MsgData:   b,
+	}, nil
+}
+
+func (o *OutboxMessage) String() string {
+	return fmt.Sprintf("%s %s -> %s%s", o.Type, o.MsgUID, o.UID, o.Callsign)
+}
+
+// Message restores the stored message.
+func (o *OutboxMessage) Message() (*cot.CotMessage, error) {
+	return restoreMessage(o.MsgData, o.Scope)
+}
+
+// restoreMessage unmarshals stored message with time moved to now, keeping its stale interval,
+// so clients do not drop it as outdated.
+func restoreMessage(data []byte, scope string) (*cot.CotMessage, error) {
+	tak := new(cotproto.TakMessage)
+	if err := proto.Unmarshal(data, tak); err != nil {
+		return nil, err
+	}
+
+	if ev := tak.GetCotEvent(); ev != nil {
+		now := cot.TimeToMillis(time.Now())
+		stale := uint64(time.Minute.Milliseconds())
+
+		if ev.GetStaleTime() > ev.GetSendTime() {
+			stale = ev.GetStaleTime() - ev.GetSendTime()
+		}
+
+		ev.SendTime = now
+		ev.StartTime = now
+		ev.StaleTime = now + stale
+	}
+
+	return cot.CotFromProto(tak, cot.LocalFrom, scope)
+}
+
+func (o *OutboxMessage) DTO() *OutboxMessageDTO {
+	d := &OutboxMessageDTO{
+		ID:        o.ID,
+		CreatedAt: o.CreatedAt,
+		ExpiresAt: o.ExpiresAt,
+		UID:       o.UID,
+		Callsign:  o.Callsign,
+		MsgUID:    o.MsgUID,
+		Scope:     o.Scope,
+		Type:      o.Type,
+		Sender:    o.Sender,
+	}
+
+	if m, err := o.Message(); err == nil {
+		d.Text = m.GetDetail().GetFirst("remarks").GetText()
+	}
+
+	return d
+}
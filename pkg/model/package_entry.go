@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// PackageEntry is a file from uploaded data package. Cot files imported as points have Imported set.
+type PackageEntry struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"type:timestamp"`
+	ResourceID uint      `gorm:"index"`
+	Scope      string    `gorm:"index;not null;size:255"`
+	Name       string    `gorm:"size:1024"`
+	MIMEType   string    `gorm:"size:255"`
+	Size       int64
+	UID        string `gorm:"index;size:255"`
+	Ignore     bool
+	Imported   bool
+}
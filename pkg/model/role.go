@@ -0,0 +1,74 @@
+package model
+
+import (
+	"slices"
+)
+
+// admin permissions
+const (
+	// PERM_VIEW allows to see map, units, missions, files, alerts and other data of admin's scopes
+	PERM_VIEW = "view"
+	// PERM_MESSAGES allows to read chat history and outbox
+	PERM_MESSAGES = "messages"
+	// PERM_OPERATE allows to send cot, delete units and files, handle alerts, edit feeds and geofences
+	PERM_OPERATE = "operate"
+	// PERM_USERS allows to manage devices, certificates, profiles and api tokens
+	PERM_USERS = "users"
+	// PERM_AUDIT allows to read audit log
+	PERM_AUDIT = "audit"
+)
+
+// admin roles
+const (
+	ROLE_VIEWER       = "viewer"
+	ROLE_OPERATOR     = "operator"
+	ROLE_USER_MANAGER = "user-manager"
+	// ROLE_ADMIN has all permissions in admin's scopes, it is the role of admins without role set
+	ROLE_ADMIN = "admin"
+	// ROLE_SUPERADMIN has all permissions in all scopes
+	ROLE_SUPERADMIN = "superadmin"
+)
+
+var allPermissions = []string{PERM_VIEW, PERM_MESSAGES, PERM_OPERATE, PERM_USERS, PERM_AUDIT}
+
+var rolePermissions = map[string][]string{
+	ROLE_VIEWER:       {PERM_VIEW},
+	ROLE_OPERATOR:     {PERM_VIEW, PERM_MESSAGES, PERM_OPERATE},
+	ROLE_USER_MANAGER: {PERM_VIEW, PERM_USERS, PERM_AUDIT},
+	ROLE_ADMIN:        allPermissions,
+	ROLE_SUPERADMIN:   allPermissions,
+}
+
+// Roles returns known role names from the least powerful.
+func Roles() []string {
+	return []string{ROLE_VIEWER, ROLE_OPERATOR, ROLE_USER_MANAGER, ROLE_ADMIN, ROLE_SUPERADMIN}
+}
+
+// ValidRole checks role name, empty role is valid and means admin.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+
+	return ok || role == ""
+}
+
+// RolePermissions returns permissions of the role, unknown role has none.
+func RolePermissions(role string) []string {
+	if role == "" {
+		role = ROLE_ADMIN
+	}
+
+	return rolePermissions[role]
+}
+
+// RoleIncludes checks that every permission of the other role is in the role.
+func RoleIncludes(role, other string) bool {
+	perms := RolePermissions(role)
+
+	for _, p := range RolePermissions(other) {
+		if !slices.Contains(perms, p) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceRoles(t *testing.T) {
+	admin := &Device{Login: "admin", Admin: true}
+	assert.Equal(t, ROLE_ADMIN, admin.GetRole())
+	assert.Equal(t, allPermissions, admin.Permissions())
+
+	sa := &Device{Login: "sa", Admin: true, SuperAdmin: true}
+	assert.Equal(t, ROLE_SUPERADMIN, sa.GetRole())
+
+	viewer := &Device{Login: "viewer", Admin: true, Role: ROLE_VIEWER}
+	assert.True(t, viewer.Can(PERM_VIEW))
+	assert.False(t, viewer.Can(PERM_OPERATE))
+	assert.False(t, viewer.IsSuperAdmin())
+
+	assert.True(t, (&Device{Admin: true, Role: ROLE_SUPERADMIN}).IsSuperAdmin())
+	assert.False(t, (&Device{Role: ROLE_SUPERADMIN}).IsSuperAdmin())
+
+	// role gives nothing to non-admins and disabled ones
+	assert.False(t, (&Device{Role: ROLE_OPERATOR}).Can(PERM_VIEW))
+	assert.False(t, (&Device{Admin: true, Disabled: true}).Can(PERM_VIEW))
+	assert.False(t, (*Device)(nil).Can(PERM_VIEW))
+
+	// unknown role has no permissions
+	assert.False(t, ValidRole("root"))
+	assert.Empty(t, (&Device{Admin: true, Role: "root"}).Permissions())
+
+	assert.True(t, RoleIncludes(ROLE_OPERATOR, ROLE_VIEWER))
+	assert.False(t, RoleIncludes(ROLE_USER_MANAGER, ROLE_OPERATOR))
+	assert.True(t, RoleIncludes("", ROLE_USER_MANAGER))
+}
@@ -0,0 +1,194 @@
+package model
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+// StoredItem is a database copy of the Item, used to restore map state after restart.
+type StoredItem struct {
+	UID       string    `gorm:"primaryKey;size:255"`
+	Scope     string    `gorm:"index;size:255"`
+	Class     string    `gorm:"size:32"`
+	Type      string    `gorm:"size:255"`
+	Callsign  string    `gorm:"size:255"`
+	LastSeen  time.Time `gorm:"type:timestamp"`
+	StaleTime time.Time `gorm:"index;type:timestamp"`
+	UpdatedAt time.Time `gorm:"type:timestamp"`
+	MsgData   []byte
+}
+
+type TrackPoint struct {
+	ID       uint      `gorm:"primaryKey"`
+	UID      string    `gorm:"index:idx_track_uid_time;size:255"`
+	Scope    string    `gorm:"index;size:255"`
+	Time     time.Time `gorm:"index:idx_track_uid_time;index:idx_track_time;type:timestamp"`
+	Type     string    `gorm:"size:255"`
+	Callsign string    `gorm:"size:255"`
+	Lat      float64
+	Lon      float64
+	Alt      float64
+	Speed    float64
+	Course   float64
+	Ce       float64
+}
+
+type TrackPointDTO struct {
+	UID      string    `json:"uid"`
+	Scope    string    `json:"scope"`
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type,omitempty"`
+	Callsign string    `json:"callsign,omitempty"`
+	Lat      float64   `json:"lat"`
+	Lon      float64   `json:"lon"`
+	Alt      float64   `json:"alt"`
+	Speed    float64   `json:"speed"`
+	Course   float64   `json:"course"`
+}
+
+func (i *Item) ToStored() (*StoredItem, error) {
+	i.mx.RLock()
+	defer i.mx.RUnlock()
+
+	b, err := proto.Marshal(i.msg.GetTakMessage())
+	if err != nil {
+		return nil, err
+	}
+
+	return &StoredItem{
+		UID:       i.uid,
+		Scope:     i.msg.Scope,
+		Class:     i.class,
+		Type:      i.msg.GetType(),
+		Callsign:  i.msg.GetCallsign(),
+		LastSeen:  i.lastSeen,
+		StaleTime: i.msg.GetStaleTime(),
+		MsgData:   b,
+	}, nil
+}
+
+// ItemFromStored restores the item. All restored contacts are offline until they send something.
+func ItemFromStored(s *StoredItem, track []*TrackPoint) (*Item, error) {
+	if s == nil {
+		return nil, fmt.Errorf("nil item")
+	}
+
+	tak := new(cotproto.TakMessage)
+	if err := proto.Unmarshal(s.MsgData, tak); err != nil {
+		return nil, err
+	}
+
+	msg, err := cot.CotFromProto(tak, "", s.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Item{
+		uid:      s.UID,
+		class:    s.Class,
+		lastSeen: s.LastSeen,
+		online:   false,
+		msg:      msg,
+	}
+
+	for _, p := range track {
+		i.track = append(i.track, p.ToPos())
+	}
+
+	return i, nil
+}
+
+func NewTrackPoint(item *Item, p *Pos) *TrackPoint {
+	return &TrackPoint{
+		UID:      item.GetUID(),
+		Scope:    item.GetScope(),
+		Time:     p.Time,
+		Type:     item.GetType(),
+		Callsign: item.GetCallsign(),
+		Lat:      p.Lat,
+		Lon:      p.Lon,
+		Alt:      p.Alt,
+		Speed:    p.Speed,
+		Course:   p.Track,
+		Ce:       p.Ce,
+	}
+}
+
+func TrackPointFromMsg(msg *cot.CotMessage) *TrackPoint {
+	p := msg2pos(msg)
+
+	return &TrackPoint{
+		UID:      msg.GetUID(),
+		Scope:    msg.Scope,
+		Time:     p.Time,
+		Type:     msg.GetType(),
+		Callsign: msg.GetCallsign(),
+		Lat:      p.Lat,
+		Lon:      p.Lon,
+		Alt:      p.Alt,
+		Speed:    p.Speed,
+		Course:   p.Track,
+		Ce:       p.Ce,
+	}
+}
+
+func (p *TrackPoint) DTO() *TrackPointDTO {
+	return &TrackPointDTO{
+		UID:      p.UID,
+		Scope:    p.Scope,
+		Time:     p.Time,
+		Type:     p.Type,
+		Callsign: p.Callsign,
+		Lat:      p.Lat,
+		Lon:      p.Lon,
+		Alt:      p.Alt,
+		Speed:    p.Speed,
+		Course:   p.Course,
+	}
+}
+
+// Event makes CoT event of the point, as TAK server returns for history requests.
+func (p *TrackPoint) Event() *cot.Event {
+	xd := cot.NewXMLDetails()
+
+	if p.Callsign != "" {
+		xd.AddChild("contact", map[string]string{"callsign": p.Callsign}, "")
+	}
+
+	xd.AddChild("track", map[string]string{
+		"speed":  strconv.FormatFloat(p.Speed, 'f', -1, 64),
+		"course": strconv.FormatFloat(p.Course, 'f', -1, 64),
+	}, "")
+
+	return &cot.Event{
+		XMLName: xml.Name{Local: "event"},
+		Version: "2.0",
+		Type:    p.Type,
+		UID:     p.UID,
+		Time:    p.Time.UTC(),
+		Start:   p.Time.UTC(),
+		Stale:   p.Time.Add(time.Minute).UTC(),
+		How:     "m-g",
+		Detail:  xd,
+		Point:   cot.Point{Lat: p.Lat, Lon: p.Lon, Hae: p.Alt, Ce: p.Ce, Le: cot.NotNum},
+	}
+}
+
+func (p *TrackPoint) ToPos() *Pos {
+	return &Pos{
+		Time:  p.Time,
+		Lat:   p.Lat,
+		Lon:   p.Lon,
+		Alt:   p.Alt,
+		Speed: p.Speed,
+		Track: p.Course,
+		Ce:    p.Ce,
+	}
+}
@@ -2,6 +2,21 @@ package model
 
 import "time"
 
+const (
+	RoleOwner      = "MISSION_OWNER"
+	RoleSubscriber = "MISSION_SUBSCRIBER"
+	RoleReadOnly   = "MISSION_READONLY_SUBSCRIBER"
+
+	// roleCreator was used for mission creators before roles were enforced
+	roleCreator = "MISSION_CREATOR"
+
+	PermRead        = "MISSION_READ"
+	PermWrite       = "MISSION_WRITE"
+	PermDelete      = "MISSION_DELETE"
+	PermSetRole     = "MISSION_SET_ROLE"
+	PermSetPassword = "MISSION_SET_PASSWORD"
+)
+
 type Subscription struct {
 	ID        uint      `gorm:"primaryKey"`
 	CreatedAt time.Time `gorm:"type:timestamp"`
@@ -10,3 +25,22 @@ type Subscription struct {
 	Username  string    `gorm:"size:255"`
 	Role      string    `gorm:"size:255"`
 }
+
+// IsValidRole checks the role can be given to the subscriber.
+func IsValidRole(role string) bool {
+	return role == RoleOwner || role == RoleSubscriber || role == RoleReadOnly
+}
+
+// RoleRank is used to choose the best role of user with many subscriptions.
+func RoleRank(role string) int {
+	switch role {
+	case RoleOwner, roleCreator:
+		return 3
+	case RoleSubscriber:
+		return 2
+	case RoleReadOnly:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,121 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	API_TOKEN_PREFIX = "token:"
+	API_TOKEN_SOURCE = "token"
+)
+
+// SigningKey is HMAC key for admin session and api tokens. The newest key signs new tokens, retired keys
+// are kept to check tokens signed before the rotation.
+type SigningKey struct {
+	ID        string     `gorm:"primaryKey;size:64"`
+	Key       []byte     `gorm:"not null"`
+	CreatedAt time.Time  `gorm:"index;type:timestamp"`
+	RetiredAt *time.Time `gorm:"type:timestamp"`
+}
+
+func (k *SigningKey) IsRetired() bool {
+	return k != nil && k.RetiredAt != nil
+}
+
+// ApiToken is a named long-lived token of a service account, ID is the jti claim of the token.
+type ApiToken struct {
+	ID         string     `gorm:"primaryKey;size:64"`
+	Name       string     `gorm:"not null;uniqueIndex;size:255"`
+	CreatedAt  time.Time  `gorm:"type:timestamp"`
+	CreatedBy  string     `gorm:"size:255"`
+	KeyID      string     `gorm:"index;size:64"`
+	Scope      string     `gorm:"not null;size:255"`
+	ReadScope  []string   `gorm:"serializer:json"`
+	SuperAdmin bool       `gorm:"not null;default:false"`
+	Role       string     `gorm:"size:32"`
+	ExpiresAt  *time.Time `gorm:"type:timestamp"`
+	LastUsed   *time.Time `gorm:"type:timestamp"`
+	RevokedAt  *time.Time `gorm:"index;type:timestamp"`
+}
+
+type ApiTokenDTO struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  string     `json:"created_by"`
+	Scope      string     `json:"scope"`
+	ReadScope  []string   `json:"read_scope,omitempty"`
+	SuperAdmin bool       `json:"super_admin,omitempty"`
+	Role       string     `json:"role,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsed   *time.Time `json:"last_used,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Token is returned once, on creation
+	Token string `json:"token,omitempty"`
+}
+
+type ApiTokenPostDTO struct {
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	ReadScope  []string   `json:"read_scope,omitempty"`
+	SuperAdmin bool       `json:"super_admin,omitempty"`
+	Role       string     `json:"role,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// RevokedToken is an entry of the revocation list. It is kept until the token expires.
+type RevokedToken struct {
+	ID        string    `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time `gorm:"type:timestamp"`
+	ExpiresAt time.Time `gorm:"index;type:timestamp"`
+}
+
+func (t *ApiToken) IsRevoked() bool {
+	return t != nil && t.RevokedAt != nil
+}
+
+func (t *ApiToken) IsExpired() bool {
+	return t != nil && t.ExpiresAt != nil && t.ExpiresAt.Before(time.Now())
+}
+
+func (t *ApiToken) IsActive() bool {
+	return t != nil && !t.IsRevoked() && !t.IsExpired()
+}
+
+func (t *ApiToken) Revoke() {
+	now := time.Now()
+	t.RevokedAt = &now
+}
+
+// Device is the admin user the token acts as.
+func (t *ApiToken) Device() *Device {
+	if t == nil {
+		return nil
+	}
+
+	return &Device{
+		Login:      API_TOKEN_PREFIX + t.Name,
+		Scope:      t.Scope,
+		ReadScope:  t.ReadScope,
+		Admin:      true,
+		SuperAdmin: t.SuperAdmin,
+		Role:       t.Role,
+		AuthSource: API_TOKEN_SOURCE,
+	}
+}
+
+func (t *ApiToken) DTO() *ApiTokenDTO {
+	return &ApiTokenDTO{
+		ID:         t.ID,
+		Name:       t.Name,
+		CreatedAt:  t.CreatedAt,
+		CreatedBy:  t.CreatedBy,
+		Scope:      t.Scope,
+		ReadScope:  t.ReadScope,
+		SuperAdmin: t.SuperAdmin,
+		Role:       t.Role,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsed:   t.LastUsed,
+		RevokedAt:  t.RevokedAt,
+	}
+}
@@ -0,0 +1,187 @@
+package model
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Track is the history of one item.
+type Track struct {
+	UID      string
+	Callsign string
+	Scope    string
+	Points   []*TrackPoint
+}
+
+func (t *Track) Name() string {
+	if t.Callsign != "" {
+		return t.Callsign
+	}
+
+	return t.UID
+}
+
+// GroupTracks splits points to tracks by uid, points of every track are sorted by time.
+func GroupTracks(points []*TrackPoint) []*Track {
+	res := make([]*Track, 0)
+	byUID := make(map[string]*Track)
+
+	for _, p := range points {
+		t, ok := byUID[p.UID]
+		if !ok {
+			t = &Track{UID: p.UID, Scope: p.Scope}
+			byUID[p.UID] = t
+			res = append(res, t)
+		}
+
+		if p.Callsign != "" {
+			t.Callsign = p.Callsign
+		}
+
+		t.Points = append(t.Points, p)
+	}
+
+	for _, t := range res {
+		slices.SortStableFunc(t.Points, func(a, b *TrackPoint) int {
+			return a.Time.Compare(b.Time)
+		})
+	}
+
+	return res
+}
+
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Ele  float64 `xml:"ele"`
+	Time string  `xml:"time"`
+}
+
+type gpxTrack struct {
+	Name   string      `xml:"name"`
+	Points []*gpxPoint `xml:"trkseg>trkpt"`
+}
+
+type gpxDoc struct {
+	XMLName xml.Name    `xml:"gpx"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Version string      `xml:"version,attr"`
+	Creator string      `xml:"creator,attr"`
+	Tracks  []*gpxTrack `xml:"trk"`
+}
+
+func WriteGPX(w io.Writer, tracks []*Track) error {
+	doc := &gpxDoc{Xmlns: "http://www.topografix.com/GPX/1/1", Version: "1.1", Creator: "goatak"}
+
+	for _, t := range tracks {
+		trk := &gpxTrack{Name: t.Name()}
+
+		for _, p := range t.Points {
+			trk.Points = append(trk.Points, &gpxPoint{Lat: p.Lat, Lon: p.Lon, Ele: p.Alt, Time: p.Time.UTC().Format(time.RFC3339)})
+		}
+
+		doc.Tracks = append(doc.Tracks, trk)
+	}
+
+	return writeXML(w, doc)
+}
+
+type kmlTrack struct {
+	When  []string `xml:"when"`
+	Coord []string `xml:"gx:coord"`
+}
+
+type kmlPlacemark struct {
+	Name  string    `xml:"name"`
+	Track *kmlTrack `xml:"gx:Track"`
+}
+
+type kmlDoc struct {
+	XMLName    xml.Name        `xml:"kml"`
+	Xmlns      string          `xml:"xmlns,attr"`
+	XmlnsGx    string          `xml:"xmlns:gx,attr"`
+	Name       string          `xml:"Document>name"`
+	Placemarks []*kmlPlacemark `xml:"Document>Placemark"`
+}
+
+// WriteKML writes tracks as gx:Track elements, so the time of every point is kept.
+func WriteKML(w io.Writer, name string, tracks []*Track) error {
+	doc := &kmlDoc{Xmlns: "http://www.opengis.net/kml/2.2", XmlnsGx: "http://www.google.com/kml/ext/2.2", Name: name}
+
+	for _, t := range tracks {
+		trk := new(kmlTrack)
+
+		for _, p := range t.Points {
+			trk.When = append(trk.When, p.Time.UTC().Format(time.RFC3339))
+			trk.Coord = append(trk.Coord, fmt.Sprintf("%f %f %.1f", p.Lon, p.Lat, p.Alt))
+		}
+
+		doc.Placemarks = append(doc.Placemarks, &kmlPlacemark{Name: t.Name(), Track: trk})
+	}
+
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+
+	return enc.Encode(doc)
+}
+
+// WriteGeoJSON writes FeatureCollection with LineString for every track (Point if track has one point only).
+// Point times are in coordTimes property.
+func WriteGeoJSON(w io.Writer, tracks []*Track) error {
+	features := make([]any, 0, len(tracks))
+
+	for _, t := range tracks {
+		coords := make([][]float64, 0, len(t.Points))
+		times := make([]string, 0, len(t.Points))
+
+		for _, p := range t.Points {
+			coords = append(coords, []float64{p.Lon, p.Lat, p.Alt})
+			times = append(times, p.Time.UTC().Format(time.RFC3339))
+		}
+
+		geometry := map[string]any{"type": "LineString", "coordinates": coords}
+		if len(coords) == 1 {
+			geometry = map[string]any{"type": "Point", "coordinates": coords[0]}
+		}
+
+		features = append(features, map[string]any{
+			"type":     "Feature",
+			"geometry": geometry,
+			"properties": map[string]any{
+				"uid":        t.UID,
+				"callsign":   t.Callsign,
+				"scope":      t.Scope,
+				"coordTimes": times,
+			},
+		})
+	}
+
+	return json.NewEncoder(w).Encode(map[string]any{"type": "FeatureCollection", "features": features})
+}
+
+// ExportTracks writes tracks in given format, returns content type.
+func ExportTracks(w io.Writer, format, name string, tracks []*Track) (string, error) {
+	switch strings.ToLower(format) {
+	case "gpx":
+		return "application/gpx+xml", WriteGPX(w, tracks)
+	case "kml":
+		return "application/vnd.google-earth.kml+xml", WriteKML(w, name, tracks)
+	case "geojson":
+		return "application/geo+json", WriteGeoJSON(w, tracks)
+	}
+
+	return "", fmt.Errorf("unknown format %s", format)
+}
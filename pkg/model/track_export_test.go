@@ -0,0 +1,48 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupTracks(t *testing.T) {
+	now := time.Now()
+
+	points := []*TrackPoint{
+		{UID: "u1", Time: now.Add(time.Second), Lat: 2},
+		{UID: "u2", Time: now, Lat: 10, Callsign: "c2"},
+		{UID: "u1", Time: now, Lat: 1, Callsign: "c1"},
+	}
+
+	tracks := GroupTracks(points)
+	require.Len(t, tracks, 2)
+	assert.Equal(t, "c1", tracks[0].Name())
+	assert.InDelta(t, 1., tracks[0].Points[0].Lat, 0.001)
+	assert.InDelta(t, 2., tracks[0].Points[1].Lat, 0.001)
+
+	var buf bytes.Buffer
+
+	_, err := ExportTracks(&buf, "geojson", "", tracks)
+	require.NoError(t, err)
+
+	var fc struct {
+		Features []struct {
+			Geometry struct {
+				Type string `json:"type"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &fc))
+	require.Len(t, fc.Features, 2)
+	assert.Equal(t, "LineString", fc.Features[0].Geometry.Type)
+	assert.Equal(t, "Point", fc.Features[1].Geometry.Type)
+
+	_, err = ExportTracks(&buf, "csv", "", tracks)
+	require.Error(t, err)
+}
@@ -0,0 +1,208 @@
+package tlsutil
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const (
+	CAKeyBits   = 4096
+	CertKeyBits = 2048
+)
+
+var DefaultSubject = pkix.Name{Country: []string{"RU"}, Province: []string{"RU"}, Locality: []string{"XX"}, OrganizationalUnit: []string{"Goatak"}}
+
+func NewSerial() *big.Int {
+	sn, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+
+	return sn
+}
+
+// SerialString is the serial format used in certificates table.
+func SerialString(sn *big.Int) string {
+	return hex.EncodeToString(sn.Bytes())
+}
+
+func NewKey(bits int) (crypto.Signer, error) {
+	return rsa.GenerateKey(rand.Reader, bits)
+}
+
+func subject(cn string) pkix.Name {
+	s := DefaultSubject
+	s.CommonName = cn
+
+	return s
+}
+
+// CATemplate is a template for self-signed root certificate.
+func CATemplate(cn string, ttl time.Duration) *x509.Certificate {
+	now := time.Now()
+
+	return &x509.Certificate{
+		SerialNumber:          NewSerial(),
+		Subject:               subject(cn),
+		NotBefore:             now,
+		NotAfter:              now.Add(ttl),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+}
+
+// ServerTemplate is a template for server certificate. Server cert signs client certificates and CRL,
+// so it is a CA too. Names are added as IP or DNS SANs.
+func ServerTemplate(host string, names []string, ttl time.Duration) *x509.Certificate {
+	now := time.Now()
+
+	tpl := &x509.Certificate{
+		SerialNumber:          NewSerial(),
+		Subject:               subject(host),
+		NotBefore:             now,
+		NotAfter:              now.Add(ttl),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	tpl.IPAddresses, tpl.DNSNames = SplitNames(append([]string{host}, names...))
+
+	return tpl
+}
+
+// ClientTemplate is the same as certificates issued on enrollment: uid is kept in email address.
+func ClientTemplate(login, uid string, ttl time.Duration) *x509.Certificate {
+	now := time.Now()
+
+	tpl := &x509.Certificate{
+		SerialNumber: NewSerial(),
+		Subject:      pkix.Name{Organization: []string{login}, CommonName: login},
+		NotBefore:    now,
+		NotAfter:     now.Add(ttl),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	if uid != "" {
+		tpl.EmailAddresses = []string{uid}
+	}
+
+	return tpl
+}
+
+// SplitNames splits names to ip addresses and dns names, duplicates are skipped.
+func SplitNames(names []string) ([]net.IP, []string) {
+	var ips []net.IP
+
+	var dns []string
+
+	seen := make(map[string]bool)
+
+	for _, n := range names {
+		if n == "" || seen[n] {
+			continue
+		}
+
+		seen[n] = true
+
+		if ip := net.ParseIP(n); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dns = append(dns, n)
+		}
+	}
+
+	return ips, dns
+}
+
+// Names returns all SANs of the certificate.
+func Names(cert *x509.Certificate) []string {
+	res := make([]string, 0, len(cert.IPAddresses)+len(cert.DNSNames))
+
+	for _, ip := range cert.IPAddresses {
+		res = append(res, ip.String())
+	}
+
+	return append(res, cert.DNSNames...)
+}
+
+// Sign makes certificate from template. Self-signed certificate is made if issuer is nil, issuerKey is
+// the key of the certificate itself then.
+func Sign(tpl *x509.Certificate, pub crypto.PublicKey, issuer *x509.Certificate, issuerKey crypto.Signer) (*x509.Certificate, error) {
+	if issuer == nil {
+		issuer = tpl
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, tpl, issuer, pub, issuerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	return x509.ParseCertificate(b)
+}
+
+func CertsToPem(certs ...*x509.Certificate) []byte {
+	var res []byte
+
+	for _, c := range certs {
+		res = append(res, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+
+	return res
+}
+
+func KeyToPem(key crypto.Signer) ([]byte, error) {
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}), nil
+}
+
+// ParseKey reads first private key from PEM data, PKCS1, PKCS8 and EC keys are supported.
+func ParseKey(b []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+
+		block, b = pem.Decode(b)
+		if block == nil {
+			return nil, errors.New("no private key found")
+		}
+
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+
+			if s, ok := k.(crypto.Signer); ok {
+				return s, nil
+			}
+
+			return nil, errors.New("unsupported private key type")
+		}
+	}
+}
+
+// MakeP12 makes client keystore. Legacy encryption is used, ATAK can't read modern one.
+func MakeP12(passwd string, key crypto.Signer, cert *x509.Certificate, cas ...*x509.Certificate) ([]byte, error) {
+	return pkcs12.LegacyRC2.Encode(key, cert, cas, passwd)
+}
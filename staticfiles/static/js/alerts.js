@@ -0,0 +1,79 @@
+const pageSize = 50;
+
+const app = Vue.createApp({
+    data: function () {
+        return {
+            alerts: [],
+            active: true,
+            total: 0,
+            page: 0,
+            error: null,
+        }
+    },
+
+    mounted() {
+        this.renew();
+        setInterval(this.renew, 5000);
+    },
+    methods: {
+        setPage: function (n) {
+            if (n < 0) return;
+
+            this.page = n;
+            this.renew();
+        },
+        pages: function () {
+            return Math.max(1, Math.ceil(this.total / pageSize));
+        },
+        renew: function () {
+            let vm = this;
+
+            let params = new URLSearchParams({
+                active: this.active,
+                limit: pageSize,
+                offset: this.page * pageSize,
+            });
+
+            fetch('/api/alert?' + params.toString(), {redirect: 'manual'})
+                .then(resp => {
+                    if (!resp.ok) {
+                        window.location.reload();
+                    }
+                    vm.total = parseInt(resp.headers.get('X-Total-Count') || '0');
+                    return resp.json();
+                })
+                .then(data => {
+                    vm.error = null;
+                    vm.alerts = data;
+                })
+                .catch(err => {
+                    console.log(err);
+                    vm.error = err;
+                });
+        },
+        post: function (a, action) {
+            let vm = this;
+
+            fetch('/api/alert/' + a.id + '/' + action, {method: "POST"})
+                .then(resp => {
+                    if (resp.status > 299) {
+                        vm.error = 'Error: ' + resp.status;
+                        return;
+                    }
+                    vm.renew();
+                });
+        },
+        ack: function (a) {
+            this.post(a, 'ack');
+        },
+        cancel: function (a) {
+            if (!confirm('Cancel ' + a.kind + ' from ' + a.callsign + '? Clients will get cancel message.')) return;
+
+            this.post(a, 'cancel');
+        },
+        dt: dtShort,
+        printCoords: printCoords,
+    },
+});
+
+app.mount('#app');
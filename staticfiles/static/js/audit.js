@@ -0,0 +1,71 @@
+const pageSize = 50;
+
+const app = Vue.createApp({
+    data: function () {
+        return {
+            events: [],
+            actions: ['login_failed', 'cert_rejected', 'device_create', 'device_update', 'unit_delete',
+                'profile_delete', 'file_delete', 'cot_post', 'cert_sign', 'cert_revoke', 'token_create',
+                'token_revoke', 'key_rotate'],
+            actor: '',
+            action: '',
+            target: '',
+            scope: '',
+            total: 0,
+            page: 0,
+            error: null,
+        }
+    },
+
+    mounted() {
+        this.renew();
+        setInterval(this.renew, 10000);
+    },
+    methods: {
+        setPage: function (n) {
+            if (n < 0) return;
+
+            this.page = n;
+            this.renew();
+        },
+        pages: function () {
+            return Math.max(1, Math.ceil(this.total / pageSize));
+        },
+        query: function () {
+            let params = new URLSearchParams();
+
+            for (const k of ['actor', 'action', 'target', 'scope']) {
+                if (this[k]) params.set(k, this[k]);
+            }
+
+            return params;
+        },
+        renew: function () {
+            let vm = this;
+
+            let params = this.query();
+            params.set('limit', pageSize);
+            params.set('offset', this.page * pageSize);
+
+            fetch('/api/audit?' + params.toString(), {redirect: 'manual'})
+                .then(resp => {
+                    if (!resp.ok) {
+                        window.location.reload();
+                    }
+                    vm.total = parseInt(resp.headers.get('X-Total-Count') || '0');
+                    return resp.json();
+                })
+                .then(data => {
+                    vm.error = null;
+                    vm.events = data;
+                })
+                .catch(err => {
+                    console.log(err);
+                    vm.error = err;
+                });
+        },
+        dt: dtShort,
+    },
+});
+
+app.mount('#app');
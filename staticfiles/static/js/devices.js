@@ -38,6 +38,8 @@ const app = Vue.createApp({
                 read_scope: ['admin', 'public'],
                 password: '',
                 disabled: false,
+                super_admin: false,
+                role: '',
             };
             bootstrap.Modal.getOrCreateInstance(document.getElementById('device_w')).show();
         },
@@ -47,6 +49,8 @@ const app = Vue.createApp({
                 scope: this.current.scope,
                 password: '',
                 disabled: this.current.disabled || false,
+                super_admin: this.current.super_admin || false,
+                role: this.current.role || '',
             };
 
             if (this.current.read_scope) {
@@ -119,6 +123,30 @@ const app = Vue.createApp({
           this.error = err;
         });
     },
+    revoke: function (c) {
+      let vm = this;
+
+      if (!confirm("Revoke certificate " + c.serial + "?")) return;
+
+      fetch("/api/cert/" + c.serial + "/revoke", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ reason: "unspecified" }),
+      })
+        .then((resp) => resp.json())
+        .then((data) => {
+          if (data.error) {
+            vm.error = data.error;
+            return;
+          }
+
+          Object.assign(c, data);
+        })
+        .catch((err) => {
+          console.log(err);
+          vm.error = err;
+        });
+    },
     printCoords: printCoords,
     dt: dtShort,
   },
@@ -3,6 +3,11 @@ const app = Vue.createApp({
         return {
             data: [],
             current: null,
+            entries: [],
+            entry: null,
+            entryText: null,
+            retention: null,
+            quota: null,
             ts: 0,
         }
     },
@@ -31,6 +36,78 @@ const app = Vue.createApp({
                     vm.data = data.sort((a, b) => a.Scope.localeCompare(b.Scope) || a.FileName.toLowerCase().localeCompare(b.FileName.toLowerCase()));
                     vm.ts += 1;
                 });
+
+            fetch('/api/retention')
+                .then(resp => resp.ok ? resp.json() : null)
+                .then(data => {
+                    vm.retention = data;
+                });
+
+            fetch('/api/quota')
+                .then(resp => resp.ok ? resp.json() : null)
+                .then(data => {
+                    vm.quota = data;
+                });
+        },
+        reclaimed: function (r) {
+            return Object.values(r.bytes).reduce((a, b) => a + b, 0);
+        },
+        removed: function (r) {
+            return Object.values(r.files).reduce((a, b) => a + b, 0);
+        },
+        used: function (u) {
+            let s = this.size(u.bytes);
+            if (u.quota.max_bytes > 0) s += " of " + this.size(u.quota.max_bytes);
+            return s;
+        },
+        files: function (u) {
+            let s = u.files.toString();
+            if (u.quota.max_files > 0) s += " of " + u.quota.max_files;
+            return s;
+        },
+        full: function (u) {
+            return (u.quota.max_bytes > 0 && u.bytes >= u.quota.max_bytes * 0.9) ||
+                (u.quota.max_files > 0 && u.files >= u.quota.max_files * 0.9);
+        },
+        size: function (n) {
+            if (n > 1024 * 1024) return (n / 1024 / 1024).toFixed(1) + " MB";
+            if (n > 1024) return (n / 1024).toFixed(1) + " KB";
+            return n + " B";
+        },
+        select: function (p) {
+            let vm = this;
+
+            this.current = p;
+            this.entries = [];
+            this.entry = null;
+            this.entryText = null;
+
+            fetch('/api/file/' + p.ID + '/entries')
+                .then(resp => resp.ok ? resp.json() : [])
+                .then(data => {
+                    if (vm.current === p) {
+                        vm.entries = data;
+                    }
+                });
+        },
+        entryUrl: function (e) {
+            return '/api/file/' + e.ResourceID + '/entry?name=' + encodeURIComponent(e.Name);
+        },
+        preview: function (e) {
+            let vm = this;
+
+            this.entry = e;
+            this.entryText = null;
+
+            if (e.MIMEType.startsWith('text/') || e.MIMEType.endsWith('xml') || e.MIMEType.endsWith('json')) {
+                fetch(this.entryUrl(e))
+                    .then(resp => resp.text())
+                    .then(text => {
+                        if (vm.entry === e) {
+                            vm.entryText = text;
+                        }
+                    });
+            }
         },
         printCoords: function (lat, lng) {
             return lat.toFixed(6) + "," + lng.toFixed(6);
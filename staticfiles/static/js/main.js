@@ -18,6 +18,9 @@ const app = Vue.createApp({
             });
             return this.ts && arr;
         },
+        peers: function () {
+            return this.ts && this.connections.filter(c => c.peer).map(c => c.peer);
+        },
     },
     methods: {
         getData: function () {
@@ -35,6 +38,10 @@ const app = Vue.createApp({
                     vm.ts += 1;
                 });
         },
+        queue_title: function (q) {
+            return Object.entries(q.classes).map(([k, v]) => k + ': ' + v.depth + ', dropped ' + v.dropped).join('\n') +
+                '\ncoalesced: ' + q.coalesced;
+        },
         dt: dtShort,
     },
 });
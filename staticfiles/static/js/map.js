@@ -200,6 +200,10 @@ const app = Vue.createApp({
 
             fetch('/api/message', { redirect: 'manual' })
                 .then(resp => {
+                    // role without messages permission
+                    if (resp.status === 403) {
+                        return {};
+                    }
                     if (!resp.ok) {
                         window.location.reload();
                     }
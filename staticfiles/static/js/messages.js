@@ -0,0 +1,81 @@
+const pageSize = 50;
+
+const app = Vue.createApp({
+    data: function () {
+        return {
+            chatrooms: [],
+            current: null,
+            messages: [],
+            total: 0,
+            page: 0,
+            error: null,
+        }
+    },
+
+    mounted() {
+        this.renew();
+    },
+    methods: {
+        renew: function () {
+            let vm = this;
+
+            fetch('/api/chatroom', {redirect: 'manual'})
+                .then(resp => {
+                    if (!resp.ok) {
+                        window.location.reload();
+                    }
+                    return resp.json();
+                })
+                .then(data => {
+                    vm.chatrooms = data;
+                });
+        },
+        setCurrent: function (c) {
+            this.current = c;
+            this.setPage(0);
+        },
+        setPage: function (n) {
+            if (n < 0) return;
+
+            this.page = n;
+            this.loadMessages();
+        },
+        pages: function () {
+            return Math.max(1, Math.ceil(this.total / pageSize));
+        },
+        loadMessages: function () {
+            let vm = this;
+
+            if (!this.current) return;
+
+            let params = new URLSearchParams({
+                chatroom: this.current.chatroom,
+                limit: pageSize,
+                offset: this.page * pageSize,
+            });
+
+            fetch('/api/message?' + params.toString(), {redirect: 'manual'})
+                .then(resp => {
+                    if (!resp.ok) {
+                        vm.error = 'error ' + resp.status;
+                        return null;
+                    }
+                    vm.total = parseInt(resp.headers.get('X-Total-Count') || '0');
+                    return resp.json();
+                })
+                .then(data => {
+                    if (!data) return;
+
+                    vm.error = null;
+                    vm.messages = data;
+                })
+                .catch(err => {
+                    console.log(err);
+                    vm.error = err;
+                });
+        },
+        dt: dtShort,
+    },
+});
+
+app.mount('#app');
@@ -3,6 +3,7 @@ const app = Vue.createApp({
         return {
             missions: [],
             current: null,
+            log: [],
             alert: null,
             ts: 0,
         }
@@ -27,6 +28,18 @@ const app = Vue.createApp({
                     vm.ts += 1;
                 });
         },
+        select: function (m) {
+            let vm = this;
+
+            this.current = m;
+            this.log = [];
+
+            fetch('/api/mission/' + m.id + '/log')
+                .then(resp => resp.json())
+                .then(data => {
+                    vm.log = data;
+                });
+        },
         printCoords: printCoords,
         dt: dtShort,
     },
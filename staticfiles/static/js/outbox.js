@@ -0,0 +1,73 @@
+const pageSize = 50;
+
+const app = Vue.createApp({
+    data: function () {
+        return {
+            messages: [],
+            uid: '',
+            callsign: '',
+            total: 0,
+            page: 0,
+            error: null,
+        }
+    },
+
+    mounted() {
+        this.renew();
+    },
+    methods: {
+        setPage: function (n) {
+            if (n < 0) return;
+
+            this.page = n;
+            this.renew();
+        },
+        pages: function () {
+            return Math.max(1, Math.ceil(this.total / pageSize));
+        },
+        renew: function () {
+            let vm = this;
+
+            let params = new URLSearchParams({
+                uid: this.uid,
+                callsign: this.callsign,
+                limit: pageSize,
+                offset: this.page * pageSize,
+            });
+
+            fetch('/api/outbox?' + params.toString(), {redirect: 'manual'})
+                .then(resp => {
+                    if (!resp.ok) {
+                        window.location.reload();
+                    }
+                    vm.total = parseInt(resp.headers.get('X-Total-Count') || '0');
+                    return resp.json();
+                })
+                .then(data => {
+                    vm.error = null;
+                    vm.messages = data;
+                })
+                .catch(err => {
+                    console.log(err);
+                    vm.error = err;
+                });
+        },
+        remove: function (m) {
+            let vm = this;
+
+            if (!confirm('Delete message for ' + (m.callsign || m.uid) + '?')) return;
+
+            fetch('/api/outbox/' + m.id, {method: "DELETE"})
+                .then(resp => {
+                    if (resp.status > 299) {
+                        vm.error = 'Error deleting message: ' + resp.status;
+                        return;
+                    }
+                    vm.renew();
+                });
+        },
+        dt: dtShort,
+    },
+});
+
+app.mount('#app');